@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// accessTrackedKeys caps the keys tracked, the least recently used are
+	// forgotten first
+	accessTrackedKeys  = 1000
+	defaultRecentLimit = 20
+)
+
+// KeyAccess counts the reads and writes of a key in the session.
+type KeyAccess struct {
+	Key       string    `json:"key"`
+	Reads     int       `json:"reads"`
+	Writes    int       `json:"writes"`
+	LastRead  time.Time `json:"last_read"`
+	LastWrite time.Time `json:"last_write"`
+	// Deleted is set when the last write deleted the key
+	Deleted bool `json:"deleted,omitempty"`
+}
+
+type MessageRecentKeys struct {
+	// Limit caps each list, 20 by default
+	Limit int `json:"limit"`
+}
+
+type RecentKeysResponse struct {
+	Viewed   []KeyAccess `json:"viewed"`
+	Modified []KeyAccess `json:"modified"`
+}
+
+// keyAccessLog tracks the keys opened and written from the frontend since
+// the database was opened.
+type keyAccessLog struct {
+	mx   *sync.Mutex
+	keys map[string]*KeyAccess
+}
+
+func newKeyAccessLog() *keyAccessLog {
+	return &keyAccessLog{mx: new(sync.Mutex), keys: make(map[string]*KeyAccess)}
+}
+
+// record counts a successful call on key. Only get, set and delete are
+// tracked.
+func (l *keyAccessLog) record(t messageType, key string) {
+	if key == "" {
+		return
+	}
+	if t != TypeGet && t != TypeSet && t != TypeDelete {
+		return
+	}
+	now := time.Now()
+	l.mx.Lock()
+	defer l.mx.Unlock()
+	access, ok := l.keys[key]
+	if !ok {
+		if len(l.keys) >= accessTrackedKeys {
+			l.evict()
+		}
+		access = &KeyAccess{Key: key}
+		l.keys[key] = access
+	}
+	switch t {
+	case TypeGet:
+		access.Reads++
+		access.LastRead = now
+	default:
+		access.Writes++
+		access.LastWrite = now
+		access.Deleted = t == TypeDelete
+	}
+}
+
+// evict forgets the key accessed least recently.
+func (l *keyAccessLog) evict() {
+	var (
+		oldest string
+		at     time.Time
+	)
+	for key, access := range l.keys {
+		last := access.LastRead
+		if access.LastWrite.After(last) {
+			last = access.LastWrite
+		}
+		if oldest == "" || last.Before(at) {
+			oldest, at = key, last
+		}
+	}
+	delete(l.keys, oldest)
+}
+
+// recent returns up to limit keys read and written, most recent first.
+func (l *keyAccessLog) recent(limit int) (viewed, modified []KeyAccess) {
+	l.mx.Lock()
+	viewed, modified = []KeyAccess{}, []KeyAccess{}
+	for _, access := range l.keys {
+		if access.Reads > 0 {
+			viewed = append(viewed, *access)
+		}
+		if access.Writes > 0 {
+			modified = append(modified, *access)
+		}
+	}
+	l.mx.Unlock()
+
+	sort.Slice(viewed, func(i, j int) bool { return viewed[i].LastRead.After(viewed[j].LastRead) })
+	sort.Slice(modified, func(i, j int) bool { return modified[i].LastWrite.After(modified[j].LastWrite) })
+	return viewed[:min(len(viewed), limit)], modified[:min(len(modified), limit)]
+}
+
+func (l *keyAccessLog) reset() {
+	l.mx.Lock()
+	defer l.mx.Unlock()
+	l.keys = make(map[string]*KeyAccess)
+}
+
+// recentKeys lists the keys recently viewed and modified in the session, to
+// jump back to them.
+func (a *App) recentKeys(msg AppMessage) AppMessage {
+	var recentMsg MessageRecentKeys
+	if msg.Body != "" {
+		if err := json.Unmarshal([]byte(msg.Body), &recentMsg); err != nil {
+			log.Printf("unmarshaling recent keys message failure: %v", err)
+			return AppMessage{Type: msg.Type, Body: err.Error()}
+		}
+	}
+	if recentMsg.Limit <= 0 {
+		recentMsg.Limit = defaultRecentLimit
+	}
+	var resp RecentKeysResponse
+	resp.Viewed, resp.Modified = a.access.recent(recentMsg.Limit)
+	bt, _ := json.Marshal(resp)
+	return AppMessage{Type: msg.Type, Body: string(bt)}
+}
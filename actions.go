@@ -0,0 +1,647 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+)
+
+// ActionParam describes one field of an action's message body.
+type ActionParam struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Required bool   `json:"required,omitempty"`
+}
+
+// Action describes a message type for the command palette and for scripts
+// discovering what the backend can do.
+type Action struct {
+	Type        messageType   `json:"type"`
+	Title       string        `json:"title"`
+	Description string        `json:"description"`
+	Category    string        `json:"category"`
+	Params      []ActionParam `json:"params,omitempty"`
+	// NeedsDB is set for actions that only work on an opened database
+	NeedsDB     bool `json:"needs_db"`
+	Mutating    bool `json:"mutating"`
+	Destructive bool `json:"destructive"`
+	// Available tells whether the action can run in the current state
+	Available bool `json:"available"`
+}
+
+type ActionsResponse struct {
+	Actions []Action `json:"actions"`
+}
+
+const (
+	categoryDatabase    = "database"
+	categoryData        = "data"
+	categoryBackup      = "backup"
+	categoryMaintenance = "maintenance"
+	categorySecurity    = "security"
+	categorySettings    = "settings"
+	categoryTools       = "tools"
+)
+
+// actionRegistry lists every message type handled by Call. Mutating and
+// destructive flags are filled from the safe mode and write password sets.
+var actionRegistry = []Action{
+	{
+		Type: TypeOpen, Title: "Open database", Category: categoryDatabase,
+		Description: "Open a badger directory, optionally encrypted, managed, read-only or as a copy, or a backup file read-only in memory",
+		Params: []ActionParam{
+			{Name: "path", Type: "string", Required: true}, {Name: "decryption_key", Type: "string"},
+			{Name: "compression", Type: "string"}, {Name: "managed", Type: "bool"},
+			{Name: "read_ts", Type: "uint64"}, {Name: "read_only", Type: "bool"}, {Name: "copy_first", Type: "bool"},
+			{Name: "checksum_mode", Type: "string"}, {Name: "key_rotation", Type: "duration"},
+			{Name: "block_cache_mb", Type: "int"}, {Name: "index_cache_mb", Type: "int"}, {Name: "num_compactors", Type: "int"},
+			{Name: "sync_writes", Type: "bool"}, {Name: "gc", Type: "object"}, {Name: "no_profile", Type: "bool"},
+			{Name: "passphrase", Type: "string"},
+		},
+	},
+	{
+		Type: TypeOpenDemo, Title: "Open demo database", Category: categoryDatabase,
+		Description: "Explore the app on an in-memory database of sample JSON, binary, image and expiring keys",
+	},
+	{
+		Type: TypePresets, Title: "Quick-open presets", Category: categoryDatabase,
+		Description: "Default locations and open options of well-known badger applications",
+	},
+	{
+		Type: TypeReopen, Title: "Reopen database", Category: categoryDatabase,
+		Description: "Reopen the database with the last used parameters",
+		Params:      []ActionParam{{Name: "decryption_key", Type: "string"}, {Name: "num_compactors", Type: "int"}},
+	},
+	{
+		Type: TypeInfo, Title: "Database info", Category: categoryDatabase, NeedsDB: true,
+		Description: "Sizes, versions, encryption and key rotation of the opened database",
+	},
+	{
+		Type: TypeOptions, Title: "Effective options", Category: categoryDatabase, NeedsDB: true,
+		Description: "Badger options in effect for the connection after defaults and overrides",
+	},
+	{
+		Type: TypeSampleStats, Title: "Sampled statistics", Category: categoryDatabase, NeedsDB: true,
+		Description: "Estimate key length, value size, TTL usage and value kinds from a sample",
+		Params:      []ActionParam{{Name: "fraction", Type: "float"}},
+	},
+	{
+		Type: TypeNamespaces, Title: "Namespaces chart", Category: categoryDatabase, NeedsDB: true,
+		Description: "Key counts and bytes per first-level key segment",
+		Params:      []ActionParam{{Name: "delimiter", Type: "string"}},
+	},
+	{
+		Type: TypeTreemap, Title: "Keyspace map", Category: categoryDatabase, NeedsDB: true,
+		Description: "Nested prefixes with their byte sizes for a treemap of where the space goes",
+		Params: []ActionParam{
+			{Name: "prefix", Type: "string"}, {Name: "delimiter", Type: "string"}, {Name: "depth", Type: "int"},
+			{Name: "children", Type: "int"}, {Name: "fraction", Type: "float"},
+		},
+	},
+	{
+		Type: TypeHistogram, Title: "Size histogram", Category: categoryDatabase, NeedsDB: true,
+		Description: "Key and value size distribution, optionally under a prefix",
+		Params:      []ActionParam{{Name: "prefix", Type: "string"}},
+	},
+	{
+		Type: TypeCompression, Title: "Compression report", Category: categoryMaintenance, NeedsDB: true,
+		Description: "Compression ratio of SST tables per namespace",
+		Params:      []ActionParam{{Name: "delimiter", Type: "string"}},
+	},
+	{
+		Type: TypePurgeExpired, Title: "Purge expired keys", Category: categoryMaintenance, NeedsDB: true,
+		Description: "Report entries whose TTL passed but which compaction hasn't dropped yet, optionally delete them",
+		Params:      []ActionParam{{Name: "prefix", Type: "string"}, {Name: "purge", Type: "bool"}},
+	},
+	{
+		Type: TypeReadTs, Title: "Browse at timestamp", Category: categoryDatabase, NeedsDB: true,
+		Description: "Read the database as of a commit timestamp, 0 resets to latest",
+		Params:      []ActionParam{{Name: "ts", Type: "uint64", Required: true}},
+	},
+	{
+		Type: TypeList, Title: "List keys", Category: categoryData, NeedsDB: true,
+		Description: "List keys page by page, optionally sorted by size, expiry or version",
+		Params: []ActionParam{
+			{Name: "limit", Type: "int"}, {Name: "cursor", Type: "string"},
+			{Name: "sort", Type: "string"}, {Name: "desc", Type: "bool"}, {Name: "preview", Type: "int"},
+		},
+	},
+	{
+		Type: TypeGlobalSearch, Title: "Search several databases", Category: categoryData,
+		Description: "Search the open database and other data directories at once, hits tagged by database",
+		Params: []ActionParam{
+			{Name: "paths", Type: "[]string"}, {Name: "prefix", Type: "string"},
+			{Name: "contains", Type: "string"}, {Name: "limit", Type: "int"},
+		},
+	},
+	{
+		Type: TypeLabel, Title: "Label prefix", Category: categoryData, NeedsDB: true,
+		Description: "Give a prefix a friendly name shown in lists and charts, kept in the database profile",
+		Params:      []ActionParam{{Name: "prefix", Type: "string", Required: true}, {Name: "label", Type: "string"}},
+	},
+	{
+		Type: TypeValueTemplate, Title: "Value template", Category: categoryData, NeedsDB: true,
+		Description: "Set the value new keys under a prefix start with in the editor, kept in the database profile",
+		Params:      []ActionParam{{Name: "prefix", Type: "string", Required: true}, {Name: "template", Type: "string"}},
+	},
+	{
+		Type: TypeNewValue, Title: "New value", Category: categoryData, NeedsDB: true,
+		Description: "Get the templated value a new key starts with",
+		Params:      []ActionParam{{Name: "key", Type: "string", Required: true}},
+	},
+	{
+		Type: TypeSchema, Title: "Value schema", Category: categoryData, NeedsDB: true,
+		Description: "Attach a JSON Schema to a prefix, values written under it that don't match are rejected",
+		Params:      []ActionParam{{Name: "prefix", Type: "string", Required: true}, {Name: "schema", Type: "object"}},
+	},
+	{
+		Type: TypeHooks, Title: "Write hooks", Category: categoryData, NeedsDB: true,
+		Description: "Keep derived keys like index entries up to date when matching keys are set or deleted, kept in the database profile",
+		Params:      []ActionParam{{Name: "hooks", Type: "object"}},
+	},
+	{
+		Type: TypeStaging, Title: "Staging", Category: categoryData, NeedsDB: true,
+		Description: "Collect edits and deletes in a changeset to review before committing them together",
+		Params:      []ActionParam{{Name: "enabled", Type: "bool"}},
+	},
+	{
+		Type: TypeCommitStaged, Title: "Commit staged changes", Category: categoryData, NeedsDB: true,
+		Description: "Write the staged changeset, unless a staged key changed in the meantime",
+	},
+	{
+		Type: TypeDiscardStaged, Title: "Discard staged changes", Category: categoryData, NeedsDB: true,
+		Description: "Drop staged changes, all of them or those of some keys",
+		Params:      []ActionParam{{Name: "keys", Type: "object"}, {Name: "ids", Type: "[]string"}},
+	},
+	{
+		Type: TypeRecentKeys, Title: "Recent keys", Category: categoryData, NeedsDB: true,
+		Description: "Keys viewed and modified in this session, most recent first",
+		Params:      []ActionParam{{Name: "limit", Type: "int"}},
+	},
+	{
+		Type: TypeOpenKey, Title: "Follow open key", Category: categoryData, NeedsDB: true,
+		Description: "Tell which key and version the editor shows, to be warned with key:stale when it's written elsewhere",
+		Params:      []ActionParam{{Name: "key", Type: "string"}, {Name: "version", Type: "int"}},
+	},
+	{
+		Type: TypeCapabilities, Title: "API capabilities", Category: categoryTools,
+		Description: "Report the API version and the schema version of every message type",
+	},
+	{
+		Type: TypeCompareKey, Title: "Compare key across databases", Category: categoryTools,
+		Description: "Compare the value of a key in two databases by hash and size, with a diff of the values",
+		Params: []ActionParam{
+			{Name: "key", Type: "string"}, {Name: "id", Type: "string"}, {Name: "left", Type: "string"},
+			{Name: "right", Type: "string", Required: true}, {Name: "context", Type: "int"},
+		},
+	},
+	{
+		Type: TypeValueHistory, Title: "Value history", Category: categoryData,
+		Description: "Previous values of a key edited in this session, newest first",
+		Params:      []ActionParam{{Name: "key", Type: "string", Required: true}},
+	},
+	{
+		Type: TypeRevert, Title: "Revert value", Category: categoryData, NeedsDB: true,
+		Description: "Write a previous value of a key from its session history back",
+		Params: []ActionParam{
+			{Name: "key", Type: "string", Required: true}, {Name: "entry", Type: "uint64"},
+			{Name: "expected_version", Type: "uint64"},
+		},
+	},
+	{
+		Type: TypeShareSnapshot, Title: "Share snapshot", Category: categoryBackup, NeedsDB: true,
+		Description: "Write the database into a single read-only snapshot file a colleague can open in memory",
+		Params: []ActionParam{
+			{Name: "path", Type: "string", Required: true}, {Name: "include_decoder", Type: "bool"},
+			{Name: "passphrase", Type: "string"},
+		},
+	},
+	{
+		Type: TypeOpenSnapshot, Title: "Open snapshot", Category: categoryDatabase,
+		Description: "Open a shared snapshot file as a read-only in-memory database",
+		Params:      []ActionParam{{Name: "path", Type: "string", Required: true}, {Name: "passphrase", Type: "string"}},
+	},
+	{
+		Type: TypeRefresh, Title: "Refresh database", Category: categoryDatabase, NeedsDB: true,
+		Description: "Reopen a read-only or copied database to see what another process wrote to it since",
+		Params:      []ActionParam{{Name: "decryption_key", Type: "string"}},
+	},
+	{
+		Type: TypeIgnored, Title: "Ignored prefixes", Category: categoryData, NeedsDB: true,
+		Description: "Hide prefixes from listing, search, counts and exports, kept in the database profile",
+		Params:      []ActionParam{{Name: "prefixes", Type: "object"}},
+	},
+	{
+		Type: TypeKeyLayout, Title: "Key layout", Category: categoryData, NeedsDB: true,
+		Description: "Describe the binary keys under a prefix, like uid:u64+ts:unixms, so they're shown as tuples",
+		Params:      []ActionParam{{Name: "prefix", Type: "string", Required: true}, {Name: "layout", Type: "string"}},
+	},
+	{
+		Type: TypeRenderKey, Title: "Render key", Category: categoryData, NeedsDB: true,
+		Description: "Decode a key with the key layouts of the profile, or try a layout on it",
+		Params: []ActionParam{
+			{Name: "id", Type: "string"}, {Name: "key", Type: "string"},
+			{Name: "layout", Type: "string"}, {Name: "prefix", Type: "string"},
+		},
+	},
+	{
+		Type: TypeDecoder, Title: "Assign decoder", Category: categoryData, NeedsDB: true,
+		Description: "Assign a value decoder to a prefix, kept in the database profile with the key layouts and applied on open",
+		Params:      []ActionParam{{Name: "prefix", Type: "string"}, {Name: "decoder", Type: "string"}},
+	},
+	{
+		Type: TypeHexDump, Title: "Hex dump", Category: categoryData, NeedsDB: true,
+		Description: "Page through a binary value as a hex dump with offsets and an ASCII gutter",
+		Params: []ActionParam{
+			{Name: "key", Type: "string"}, {Name: "id", Type: "string"},
+			{Name: "offset", Type: "int"}, {Name: "length", Type: "int"},
+		},
+	},
+	{
+		Type: TypeValueSearch, Title: "Search in value", Category: categoryData, NeedsDB: true,
+		Description: "Find a text, hex bytes or a regular expression inside one large value and list the match offsets",
+		Params: []ActionParam{
+			{Name: "key", Type: "string"}, {Name: "id", Type: "string"}, {Name: "pattern", Type: "string"},
+			{Name: "hex", Type: "string"}, {Name: "regex", Type: "bool"}, {Name: "ignore_case", Type: "bool"},
+			{Name: "from", Type: "int"}, {Name: "limit", Type: "int"},
+		},
+	},
+	{
+		Type: TypeAdvice, Title: "Maintenance advice", Category: categoryMaintenance, NeedsDB: true,
+		Description: "Analyze the value log discard stats and the LSM tree shape and suggest GC, flatten or more compactors",
+	},
+	{
+		Type: TypeFlatten, Title: "Flatten LSM tree", Category: categoryMaintenance, NeedsDB: true,
+		Description: "Compact every table of the LSM tree into a single level, dropping stale data",
+		Params:      []ActionParam{{Name: "accept_low_space", Type: "bool"}},
+	},
+	{
+		Type: TypeSpaceEstimate, Title: "Estimate disk space", Category: categoryMaintenance, NeedsDB: true,
+		Description: "Estimate the disk space a restore, import or flatten takes and whether it fits",
+		Params: []ActionParam{
+			{Name: "operation", Type: "string", Required: true}, {Name: "path", Type: "string"}, {Name: "bytes", Type: "int"},
+		},
+	},
+	{
+		Type: TypeRetention, Title: "Retention rules", Category: categoryMaintenance, NeedsDB: true,
+		Description: "Define per prefix rules deleting entries older than a number of days, kept in the database profile",
+		Params:      []ActionParam{{Name: "rules", Type: "object"}},
+	},
+	{
+		Type: TypeRunRetention, Title: "Run retention", Category: categoryMaintenance, NeedsDB: true,
+		Description: "Apply the retention rules now, or report what they would delete",
+		Params:      []ActionParam{{Name: "name", Type: "string"}, {Name: "dry_run", Type: "bool"}},
+	},
+	{
+		Type: TypeScope, Title: "Working prefix", Category: categoryData, NeedsDB: true,
+		Description: "Pin a prefix that listing, search, counts, exports, jobs and analysis stay under",
+		Params:      []ActionParam{{Name: "prefix", Type: "string"}},
+	},
+	{
+		Type: TypeVirtual, Title: "Virtual databases", Category: categoryDatabase, NeedsDB: true,
+		Description: "Define prefixes of the database browsed as databases of their own, kept in the database profile",
+		Params: []ActionParam{
+			{Name: "name", Type: "string"}, {Name: "prefix", Type: "string"},
+		},
+	},
+	{
+		Type: TypeUseVirtual, Title: "Switch virtual database", Category: categoryDatabase, NeedsDB: true,
+		Description: "Browse a virtual database, or the whole connection without a name",
+		Params:      []ActionParam{{Name: "name", Type: "string"}},
+	},
+	{
+		Type: TypeSearch, Title: "Search keys", Category: categoryData, NeedsDB: true,
+		Description: "Find keys by prefix, optionally sorted by size, expiry or version",
+		Params: []ActionParam{
+			{Name: "prefix", Type: "string", Required: true}, {Name: "limit", Type: "int"}, {Name: "offset", Type: "int"},
+			{Name: "sort", Type: "string"}, {Name: "desc", Type: "bool"}, {Name: "preview", Type: "int"},
+		},
+	},
+	{
+		Type: TypeGet, Title: "Get value", Category: categoryData, NeedsDB: true,
+		Description: "Show the value of a key",
+		Params:      []ActionParam{{Name: "key", Type: "string", Required: true}},
+	},
+	{
+		Type: TypeSet, Title: "Set value", Category: categoryData, NeedsDB: true,
+		Description: "Create or update a key",
+		Params: []ActionParam{
+			{Name: "key", Type: "string", Required: true}, {Name: "value", Type: "string", Required: true},
+			{Name: "expected_version", Type: "uint64"},
+		},
+	},
+	{
+		Type: TypeWriteBatching, Title: "Write batching", Category: categoryData, NeedsDB: true,
+		Description: "Buffer sets and deletes in a write batch flushed every N entries or M milliseconds",
+		Params: []ActionParam{
+			{Name: "enabled", Type: "bool", Required: true}, {Name: "max_entries", Type: "int"},
+			{Name: "interval_ms", Type: "int"},
+		},
+	},
+	{
+		Type: TypeFlushWrites, Title: "Flush writes", Category: categoryData, NeedsDB: true,
+		Description: "Commit the writes buffered by write batching now",
+	},
+	{
+		Type: TypeTouch, Title: "Refresh TTL", Category: categoryData, NeedsDB: true,
+		Description: "Rewrite keys with the same value and a new TTL",
+		Params: []ActionParam{
+			{Name: "key", Type: "string"}, {Name: "keys", Type: "[]string"}, {Name: "ids", Type: "[]string"},
+			{Name: "ttl", Type: "duration"},
+		},
+	},
+	{
+		Type: TypeDuplicate, Title: "Duplicate key", Category: categoryData, NeedsDB: true,
+		Description: "Copy a value with its TTL and UserMeta to a new key",
+		Params: []ActionParam{
+			{Name: "key", Type: "string", Required: true}, {Name: "new_key", Type: "string", Required: true},
+			{Name: "overwrite", Type: "bool"},
+		},
+	},
+	{
+		Type: TypeGenerate, Title: "Generate keys", Category: categoryData, NeedsDB: true,
+		Description: "Create fixture keys from a template with counter, UUID, time and random placeholders",
+		Params: []ActionParam{
+			{Name: "key", Type: "string", Required: true}, {Name: "value", Type: "string"},
+			{Name: "count", Type: "int", Required: true}, {Name: "start", Type: "int"},
+			{Name: "ttl", Type: "duration"}, {Name: "overwrite", Type: "bool"}, {Name: "dry_run", Type: "bool"},
+		},
+	},
+	{
+		Type: TypePaste, Title: "Paste rows", Category: categoryData, NeedsDB: true,
+		Description: "Write key/value rows pasted from a spreadsheet or a JSON array as one batch",
+		Params: []ActionParam{
+			{Name: "text", Type: "string", Required: true}, {Name: "format", Type: "string"},
+			{Name: "header", Type: "bool"}, {Name: "overwrite", Type: "bool"}, {Name: "dry_run", Type: "bool"},
+			{Name: "accept_low_space", Type: "bool"},
+		},
+	},
+	{
+		Type: TypeWatchExpiry, Title: "Watch key expiry", Category: categoryData,
+		Description: "Get notified shortly before watched keys expire and when they're gone",
+		Params: []ActionParam{
+			{Name: "keys", Type: "[]string", Required: true}, {Name: "unwatch", Type: "bool"},
+			{Name: "lead", Type: "duration"},
+		},
+	},
+	{
+		Type: TypeDelete, Title: "Delete key", Category: categoryData, NeedsDB: true,
+		Description: "Remove a key, or the rows of a selection",
+		Params: []ActionParam{
+			{Name: "key", Type: "string"}, {Name: "expected_version", Type: "uint64"}, {Name: "ids", Type: "[]string"},
+		},
+	},
+	{
+		Type: TypeDropPrefix, Title: "Drop prefix", Category: categoryData, NeedsDB: true,
+		Description: "Preview the keys under a prefix, then delete them all with the preview's token",
+		Params: []ActionParam{
+			{Name: "prefix", Type: "string", Required: true}, {Name: "limit", Type: "int"},
+			{Name: "token", Type: "string"},
+		},
+	},
+	{
+		Type: TypeVersions, Title: "Key versions", Category: categoryData, NeedsDB: true,
+		Description: "List the retained versions of a key",
+		Params:      []ActionParam{{Name: "key", Type: "string", Required: true}},
+	},
+	{
+		Type: TypeBackup, Title: "Export backup", Category: categoryBackup, NeedsDB: true,
+		Description: "Dump the database to a file, optionally compressed and encrypted",
+		Params: []ActionParam{
+			{Name: "path", Type: "string", Required: true}, {Name: "compress", Type: "bool"},
+			{Name: "passphrase", Type: "string"},
+		},
+	},
+	{
+		Type: TypeExportKeys, Title: "Export key inventory", Category: categoryBackup, NeedsDB: true,
+		Description: "Write keys one per line, optionally with size and expiry, for diffing environments",
+		Params: []ActionParam{
+			{Name: "path", Type: "string", Required: true}, {Name: "prefix", Type: "string"},
+			{Name: "with_size", Type: "bool"}, {Name: "with_expiry", Type: "bool"},
+		},
+	},
+	{
+		Type: TypeExport, Title: "Export keys and values", Category: categoryBackup, NeedsDB: true,
+		Description: "Write the keys and values of the database or a prefix to JSON, NDJSON or CSV in the background",
+		Params: []ActionParam{
+			{Name: "path", Type: "string", Required: true}, {Name: "prefix", Type: "string"}, {Name: "format", Type: "string"},
+		},
+	},
+	{
+		Type: TypeRestore, Title: "Restore backup", Category: categoryBackup, NeedsDB: true,
+		Description: "Load a backup file into the database or into a new database directory",
+		Params: []ActionParam{
+			{Name: "path", Type: "string", Required: true}, {Name: "passphrase", Type: "string"},
+			{Name: "dir", Type: "string"}, {Name: "accept_low_space", Type: "bool"},
+		},
+	},
+	{
+		Type: TypeBackupS3, Title: "Backup to S3", Category: categoryBackup, NeedsDB: true,
+		Description: "Upload a backup to the configured S3 bucket",
+		Params: []ActionParam{
+			{Name: "key", Type: "string"}, {Name: "compress", Type: "bool"}, {Name: "passphrase", Type: "string"},
+		},
+	},
+	{
+		Type: TypeRestoreS3, Title: "Restore from S3", Category: categoryBackup, NeedsDB: true,
+		Description: "Load a backup from the configured S3 bucket",
+		Params: []ActionParam{
+			{Name: "key", Type: "string", Required: true}, {Name: "passphrase", Type: "string"},
+			{Name: "accept_low_space", Type: "bool"},
+		},
+	},
+	{
+		Type: TypeListS3, Title: "List S3 backups", Category: categoryBackup,
+		Description: "List backups stored in the configured S3 bucket",
+	},
+	{
+		Type: TypeAggregate, Title: "Aggregate values", Category: categoryData, NeedsDB: true,
+		Description: "Count, sum, average, min or max over values or a JSON field, grouped by key segment",
+		Params: []ActionParam{
+			{Name: "prefix", Type: "string"}, {Name: "match", Type: "string"},
+			{Name: "func", Type: "string", Required: true}, {Name: "field", Type: "string"},
+			{Name: "group_by", Type: "int"}, {Name: "delimiter", Type: "string"},
+		},
+	},
+	{
+		Type: TypeColumns, Title: "Table view", Category: categoryData, NeedsDB: true,
+		Description: "JSON values under a prefix as rows of the chosen fields",
+		Params: []ActionParam{
+			{Name: "prefix", Type: "string", Required: true}, {Name: "fields", Type: "[]string"},
+			{Name: "limit", Type: "int"}, {Name: "cursor", Type: "string"},
+		},
+	},
+	{
+		Type: TypeMigrate, Title: "Run migration", Category: categoryData, NeedsDB: true,
+		Description: "Apply rename, re-encode and drop steps from a JSON or YAML file",
+		Params: []ActionParam{
+			{Name: "path", Type: "string", Required: true}, {Name: "dry_run", Type: "bool"},
+			{Name: "report_path", Type: "string"},
+		},
+	},
+	{
+		Type: TypeCollisions, Title: "Check rename collisions", Category: categoryData, NeedsDB: true,
+		Description: "List the keys a prefix rename would overwrite before running it",
+		Params: []ActionParam{
+			{Name: "prefix", Type: "string", Required: true}, {Name: "to", Type: "string"},
+			{Name: "match", Type: "string"}, {Name: "limit", Type: "int"},
+		},
+	},
+	{
+		Type: TypeVlogFiles, Title: "Value log files", Category: categoryMaintenance, NeedsDB: true,
+		Description: "List value log files with their dead data ratio",
+	},
+	{
+		Type: TypeGC, Title: "Run value log GC", Category: categoryMaintenance, NeedsDB: true,
+		Description: "Rewrite value log files above the discard ratio",
+		Params:      []ActionParam{{Name: "discard_ratio", Type: "float"}},
+	},
+	{
+		Type: TypeCompactions, Title: "Compaction events", Category: categoryMaintenance,
+		Description: "Recent compactions reported by badger",
+	},
+	{
+		Type: TypeInternalKeys, Title: "Toggle internal keys", Category: categoryMaintenance,
+		Description: "Show or hide badger's own !badger! keys",
+		Params:      []ActionParam{{Name: "show", Type: "bool", Required: true}},
+	},
+	{
+		Type: TypeSafeMode, Title: "Toggle safe mode", Category: categorySecurity,
+		Description: "Reject all writes until safe mode is turned off",
+		Params: []ActionParam{
+			{Name: "enabled", Type: "bool", Required: true}, {Name: "confirm", Type: "bool"},
+		},
+	},
+	{
+		Type: TypeWritePassword, Title: "Set write password", Category: categorySecurity,
+		Description: "Protect destructive operations with a password",
+		Params:      []ActionParam{{Name: "current", Type: "string"}, {Name: "new", Type: "string"}},
+	},
+	{
+		Type: TypeUnlockWrites, Title: "Unlock destructive operations", Category: categorySecurity,
+		Description: "Enter the write password for this session",
+		Params:      []ActionParam{{Name: "password", Type: "string", Required: true}},
+	},
+	{
+		Type: TypeSettings, Title: "Show settings", Category: categorySettings,
+		Description: "Read the application settings",
+	},
+	{
+		Type: TypeSaveSettings, Title: "Save settings", Category: categorySettings,
+		Description: "Persist the application settings",
+	},
+	{
+		Type: TypeExportSettings, Title: "Export settings", Category: categorySettings,
+		Description: "Write settings, bookmarks and saved queries to a file for sharing",
+		Params:      []ActionParam{{Name: "path", Type: "string", Required: true}},
+	},
+	{
+		Type: TypeImportSettings, Title: "Import settings", Category: categorySettings,
+		Description: "Replace settings, bookmarks and saved queries from an exported file",
+		Params:      []ActionParam{{Name: "path", Type: "string", Required: true}},
+	},
+	{
+		Type: TypeSaveProfile, Title: "Save connection profile", Category: categorySettings,
+		Description: "Remember delimiter, compression, read-only, decoder, cache sizes and default prefix of a database",
+		Params: []ActionParam{
+			{Name: "path", Type: "string"}, {Name: "delimiter", Type: "string"},
+			{Name: "compression", Type: "string"}, {Name: "read_only", Type: "bool"},
+			{Name: "decoder", Type: "string"}, {Name: "block_cache_mb", Type: "int"},
+			{Name: "index_cache_mb", Type: "int"}, {Name: "default_prefix", Type: "string"},
+			{Name: "gc", Type: "object"}, {Name: "delete", Type: "bool"},
+		},
+	},
+	{
+		Type: TypeS3Credentials, Title: "Set S3 credentials", Category: categorySettings,
+		Description: "Store S3 access keys in the OS keychain",
+		Params: []ActionParam{
+			{Name: "access_key_id", Type: "string", Required: true},
+			{Name: "secret_access_key", Type: "string", Required: true},
+		},
+	},
+	{
+		Type: TypeStartJob, Title: "Start background job", Category: categoryTools, NeedsDB: true,
+		Description: "Run a key inventory export, a query export, a prefix scan or a cache warm-up in the background",
+		Params: []ActionParam{
+			{Name: "kind", Type: "string", Required: true}, {Name: "params", Type: "object"},
+		},
+	},
+	{
+		Type: TypeExportDelta, Title: "Export changes since manifest", Category: categoryTools, NeedsDB: true,
+		Description: "Re-run an earlier export for only the keys written since its manifest",
+		Params: []ActionParam{
+			{Name: "manifest", Type: "string", Required: true}, {Name: "path", Type: "string", Required: true},
+		},
+	},
+	{
+		Type: TypeJobs, Title: "Background jobs", Category: categoryTools,
+		Description: "List background jobs with their status and progress",
+	},
+	{
+		Type: TypePauseJob, Title: "Pause job", Category: categoryTools,
+		Description: "Stop a running job at its checkpoint so it can be resumed later",
+		Params:      []ActionParam{{Name: "id", Type: "string", Required: true}},
+	},
+	{
+		Type: TypeResumeJob, Title: "Resume job", Category: categoryTools, NeedsDB: true,
+		Description: "Continue a paused or failed job after its checkpoint",
+		Params:      []ActionParam{{Name: "id", Type: "string", Required: true}},
+	},
+	{
+		Type: TypeCancelJob, Title: "Cancel job", Category: categoryTools,
+		Description: "Stop a job for good",
+		Params:      []ActionParam{{Name: "id", Type: "string", Required: true}},
+	},
+	{
+		Type: TypeActivity, Title: "Activity log", Category: categoryTools,
+		Description: "Recent operations of the connection from the frontend, jobs and webhooks",
+		Params:      []ActionParam{{Name: "limit", Type: "int"}, {Name: "source", Type: "string"}},
+	},
+	{
+		Type: TypeMetrics, Title: "Operation latency", Category: categoryTools,
+		Description: "p50, p95 and p99 latency of every database operation",
+		Params:      []ActionParam{{Name: "reset", Type: "bool"}},
+	},
+	{
+		Type: TypeCrashReports, Title: "Crash reports", Category: categoryTools,
+		Description: "Saved crash bundles, newest first",
+	},
+	{
+		Type: TypeRevealCrash, Title: "Reveal crash report", Category: categoryTools,
+		Description: "Show a crash bundle in the file manager to attach it to a bug report",
+		Params:      []ActionParam{{Name: "name", Type: "string"}},
+	},
+	{
+		Type: TypeRepl, Title: "Console command", Category: categoryTools,
+		Description: "Run a console command such as get, set, scan or count",
+		Params:      []ActionParam{{Name: "command", Type: "string", Required: true}},
+	},
+	{
+		Type: TypeActions, Title: "List actions", Category: categoryTools,
+		Description: "Describe every available action",
+	},
+}
+
+func (a *App) actions(msg AppMessage) AppMessage {
+	running := a.db.IsRunning()
+	readOnly := running && a.db.IsReadOnly()
+
+	actions := make([]Action, 0, len(actionRegistry))
+	for _, action := range actionRegistry {
+		_, action.Mutating = mutatingTypes[action.Type]
+		_, action.Destructive = destructiveTypes[action.Type]
+
+		action.Available = true
+		switch {
+		case action.NeedsDB && !running:
+			action.Available = false
+		case action.Mutating && (a.safeMode.Load() || readOnly):
+			action.Available = false
+		case action.Type == TypeOpen || action.Type == TypeReopen || action.Type == TypeOpenDemo:
+			action.Available = !running
+		}
+		actions = append(actions, action)
+	}
+	log.Printf("listed %d actions", len(actions))
+	bt, _ := json.Marshal(ActionsResponse{Actions: actions})
+	return AppMessage{Type: msg.Type, Body: string(bt)}
+}
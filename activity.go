@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	activityLogSize = 500
+	// activityResultLen caps how much of an error response is kept
+	activityResultLen = 200
+
+	SourceCall    = "call"
+	SourceJob     = "job"
+	SourceWebhook = "webhook"
+	// SourceRetention are scheduled retention runs
+	SourceRetention = "retention"
+
+	activityOk = "ok"
+)
+
+// ActivityEntry is one operation of the connection, made by the frontend, a
+// background job or a subscription.
+type ActivityEntry struct {
+	Time       time.Time `json:"time"`
+	Source     string    `json:"source"`
+	Type       string    `json:"type"`
+	Key        string    `json:"key,omitempty"`
+	DurationMs float64   `json:"duration_ms"`
+	// Result is ok or the error
+	Result string `json:"result"`
+}
+
+type MessageActivity struct {
+	// Limit returns only the newest entries, all of them when zero
+	Limit int `json:"limit"`
+	// Source filters the entries by source
+	Source string `json:"source"`
+}
+
+type ActivityResponse struct {
+	Entries []ActivityEntry `json:"entries"`
+}
+
+// activityLog is a ring buffer of the last operations of the connection.
+type activityLog struct {
+	mx      *sync.Mutex
+	entries []ActivityEntry
+	next    int
+}
+
+func newActivityLog() *activityLog {
+	return &activityLog{mx: new(sync.Mutex), entries: make([]ActivityEntry, 0, activityLogSize)}
+}
+
+func (l *activityLog) add(e ActivityEntry) {
+	if len(e.Result) > activityResultLen {
+		e.Result = e.Result[:activityResultLen] + "..."
+	}
+	l.mx.Lock()
+	defer l.mx.Unlock()
+	if len(l.entries) < activityLogSize {
+		l.entries = append(l.entries, e)
+		return
+	}
+	l.entries[l.next] = e
+	l.next = (l.next + 1) % activityLogSize
+}
+
+// list returns the entries newest first.
+func (l *activityLog) list(limit int, source string) []ActivityEntry {
+	l.mx.Lock()
+	defer l.mx.Unlock()
+	n := len(l.entries)
+	newest := n - 1
+	if n == activityLogSize {
+		newest = (l.next - 1 + n) % n
+	}
+	entries := make([]ActivityEntry, 0, n)
+	for i := 0; i < n; i++ {
+		e := l.entries[(newest-i+n)%n]
+		if source != "" && e.Source != source {
+			continue
+		}
+		entries = append(entries, e)
+		if limit > 0 && len(entries) == limit {
+			break
+		}
+	}
+	return entries
+}
+
+func (l *activityLog) reset() {
+	l.mx.Lock()
+	defer l.mx.Unlock()
+	l.entries, l.next = l.entries[:0], 0
+}
+
+// recordCall logs a handled message. The key or prefix is taken from the
+// body when it has one, nothing else of the body is kept.
+func (a *App) recordCall(msg AppMessage, response AppMessage, took time.Duration) {
+	if msg.Type == TypeActivity {
+		return
+	}
+	var target struct {
+		Key    string `json:"key"`
+		Prefix string `json:"prefix"`
+	}
+	_ = json.Unmarshal([]byte(msg.Body), &target)
+	key := target.Key
+	if key == "" {
+		key = target.Prefix
+	}
+	result := activityResult(response.Body)
+	a.activity.add(ActivityEntry{
+		Time: time.Now(), Source: SourceCall, Type: string(msg.Type), Key: key,
+		DurationMs: float64(took.Microseconds()) / 1000, Result: result,
+	})
+	if result == activityOk {
+		a.access.record(msg.Type, target.Key)
+	}
+}
+
+// activityResult tells successful responses, plain ok or a JSON document,
+// from error messages.
+func activityResult(body string) string {
+	if body == OkStatus || strings.HasPrefix(body, "{") || strings.HasPrefix(body, "[") {
+		return activityOk
+	}
+	return body
+}
+
+func (a *App) listActivity(msg AppMessage) AppMessage {
+	var activityMsg MessageActivity
+	if msg.Body != "" {
+		if err := json.Unmarshal([]byte(msg.Body), &activityMsg); err != nil {
+			log.Printf("unmarshaling activity message failure: %v", err)
+			return AppMessage{Type: msg.Type, Body: err.Error()}
+		}
+	}
+	bt, _ := json.Marshal(ActivityResponse{
+		Entries: a.activity.list(activityMsg.Limit, activityMsg.Source),
+	})
+	return AppMessage{Type: msg.Type, Body: string(bt)}
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/filinvadim/badger-gui/database"
+	"log"
+)
+
+const (
+	// gcAdviceHighRatio and gcAdviceLowRatio are the discard ratios GC is
+	// advised at, the high one when it reclaims enough
+	gcAdviceHighRatio = 0.5
+	gcAdviceLowRatio  = 0.3
+	// gcAdviceMinBytes is the least dead data worth a GC run
+	gcAdviceMinBytes = 64 << 20
+	// flattenAdviceStale is the share of stale data in the LSM tree that's
+	// worth a flatten, given flattenAdviceMinBytes of it at least
+	flattenAdviceStale    = 0.2
+	flattenAdviceMinBytes = 64 << 20
+	// compactorsAdviceScore is the score of a level lagging that far behind
+	// its target that more compactors are advised, up to maxAdvisedCompactors
+	compactorsAdviceScore = 2
+	maxAdvisedCompactors  = 8
+
+	AdviceInfo    = "info"
+	AdviceWarning = "warning"
+)
+
+// Suggestion is a maintenance action the advisor recommends.
+type Suggestion struct {
+	// Kind is gc, flatten or compactors
+	Kind     string `json:"kind"`
+	Severity string `json:"severity"`
+	Title    string `json:"title"`
+	Reason   string `json:"reason"`
+	// Action is the message applying the suggestion, sent as is. It's
+	// left out for read-only connections.
+	Action *AppMessage `json:"action,omitempty"`
+}
+
+type AdviceResponse struct {
+	Suggestions []Suggestion     `json:"suggestions"`
+	Levels      []database.Level `json:"levels"`
+	VlogSize    int64            `json:"vlog_size"`
+	// DeadBytes is the value log data badger has accounted as discarded
+	DeadBytes uint64 `json:"dead_bytes"`
+}
+
+type FlattenResponse struct {
+	Status string           `json:"status"`
+	Levels []database.Level `json:"levels"`
+}
+
+// advise analyzes the discard stats of the value log and the shape of the
+// LSM tree and recommends maintenance, each suggestion with the message that
+// applies it.
+func (a *App) advise(msg AppMessage) AppMessage {
+	if !a.db.IsRunning() {
+		log.Printf("db not running for advice operation")
+		return AppMessage{Type: msg.Type, Body: NotRunningResponse}
+	}
+	levels, err := a.db.Levels()
+	if err != nil {
+		log.Printf("reading levels failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+	files, err := a.db.VlogFiles()
+	if err != nil {
+		log.Printf("listing vlog files failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+	opts, err := a.db.Options()
+	if err != nil {
+		log.Printf("reading options failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+
+	resp := AdviceResponse{Suggestions: []Suggestion{}, Levels: levels}
+	for _, f := range files {
+		resp.VlogSize += f.Size
+		resp.DeadBytes += f.DiscardBytes
+	}
+	for _, s := range []*Suggestion{gcAdvice(files), flattenAdvice(levels), compactorsAdvice(levels, opts)} {
+		if s == nil {
+			continue
+		}
+		if a.db.IsReadOnly() {
+			s.Action = nil
+			s.Reason += "; the connection is read-only, reopen it writable to apply this"
+		}
+		resp.Suggestions = append(resp.Suggestions, *s)
+	}
+	log.Printf("maintenance advice: %d suggestions", len(resp.Suggestions))
+	bt, _ := json.Marshal(resp)
+	return AppMessage{Type: msg.Type, Body: string(bt)}
+}
+
+// gcAdvice recommends a value log GC when enough dead data sits in files
+// badger would rewrite. The last file is being written and never collected.
+func gcAdvice(files []database.VlogFile) *Suggestion {
+	if len(files) < 2 {
+		return nil
+	}
+	files = files[:len(files)-1]
+	var size int64
+	for _, f := range files {
+		size += f.Size
+	}
+	reclaimable := func(ratio float64) (bytes uint64, count int) {
+		for _, f := range files {
+			if f.DeadRatio >= ratio {
+				bytes += f.DiscardBytes
+				count++
+			}
+		}
+		return bytes, count
+	}
+	ratio := gcAdviceHighRatio
+	bytes, count := reclaimable(ratio)
+	if bytes < gcAdviceMinBytes {
+		ratio = gcAdviceLowRatio
+		if bytes, count = reclaimable(ratio); bytes < gcAdviceMinBytes {
+			return nil
+		}
+	}
+	s := &Suggestion{
+		Kind: "gc", Severity: AdviceInfo,
+		Title: fmt.Sprintf("Run value log GC at ratio %.1f", ratio),
+		Reason: fmt.Sprintf("%d value log files are at least %.0f%% dead, about %s can be reclaimed",
+			count, ratio*100, formatBytes(int64(bytes))),
+	}
+	if size > 0 && float64(bytes) >= float64(size)/2 {
+		s.Severity = AdviceWarning
+	}
+	body, _ := json.Marshal(MessageGC{DiscardRatio: ratio})
+	s.Action = &AppMessage{Type: TypeGC, Body: string(body)}
+	return s
+}
+
+// flattenAdvice recommends a flatten when much of the LSM tree is stale and
+// spread over several levels, compactions would take long to clear it.
+func flattenAdvice(levels []database.Level) *Suggestion {
+	var (
+		size, stale int64
+		used        int
+	)
+	for _, l := range levels {
+		size += l.Size
+		stale += l.StaleSize
+		if l.Level > 0 && l.Tables > 0 {
+			used++
+		}
+	}
+	if used < 2 || stale < flattenAdviceMinBytes || float64(stale) < float64(size)*flattenAdviceStale {
+		return nil
+	}
+	return &Suggestion{
+		Kind: "flatten", Severity: AdviceInfo, Title: "Flatten the LSM tree",
+		Reason: fmt.Sprintf("%s of the %s LSM tree is stale, spread over %d levels",
+			formatBytes(stale), formatBytes(size), used),
+		Action: &AppMessage{Type: TypeFlatten},
+	}
+}
+
+// compactorsAdvice recommends more compactors when level 0 nears the write
+// stall or a level lags far behind its target.
+func compactorsAdvice(levels []database.Level, opts database.EffectiveOptions) *Suggestion {
+	if opts.NumCompactors >= maxAdvisedCompactors {
+		return nil
+	}
+	var reason string
+	for _, l := range levels {
+		switch {
+		case l.Level == 0 && opts.NumLevelZeroTablesStall > 0 && l.Tables*2 >= opts.NumLevelZeroTablesStall:
+			reason = fmt.Sprintf("level 0 holds %d tables, writes stall at %d", l.Tables, opts.NumLevelZeroTablesStall)
+		case l.Level > 0 && l.Score >= compactorsAdviceScore:
+			reason = fmt.Sprintf("level %d is %.1f times over its target size", l.Level, l.Score)
+		default:
+			continue
+		}
+		break
+	}
+	if reason == "" {
+		return nil
+	}
+	compactors := min(max(opts.NumCompactors*2, 4), maxAdvisedCompactors)
+	// the key stays out, the frontend asks for it on encrypted databases
+	body, _ := json.Marshal(map[string]int{"num_compactors": compactors})
+	return &Suggestion{
+		Kind: "compactors", Severity: AdviceWarning,
+		Title:  fmt.Sprintf("Increase compactors from %d to %d", opts.NumCompactors, compactors),
+		Reason: reason + "; compactions are falling behind. The database is reopened, encrypted ones need their key",
+		Action: &AppMessage{Type: TypeReopen, Body: string(body)},
+	}
+}
+
+// flatten compacts the LSM tree into a single level.
+func (a *App) flatten(msg AppMessage) AppMessage {
+	if !a.db.IsRunning() {
+		log.Printf("db not running for flatten operation")
+		return AppMessage{Type: msg.Type, Body: NotRunningResponse}
+	}
+	var flattenMsg MessageFlatten
+	if msg.Body != "" {
+		if err := json.Unmarshal([]byte(msg.Body), &flattenMsg); err != nil {
+			log.Printf("unmarshaling flatten message failure: %v", err)
+			return AppMessage{Type: msg.Type, Body: err.Error()}
+		}
+	}
+	if held, ok := a.guardSpace(msg.Type, database.SpaceFlatten, 0, flattenMsg.AcceptLowSpace); !ok {
+		return held
+	}
+	if err := a.db.Flatten(); err != nil {
+		log.Printf("flatten failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+	levels, err := a.db.Levels()
+	if err != nil {
+		log.Printf("reading levels failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+	bt, _ := json.Marshal(FlattenResponse{Status: OkStatus, Levels: levels})
+	return AppMessage{Type: msg.Type, Body: string(bt)}
+}
+
+// formatBytes renders a size in binary units.
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	aggCount = "count"
+	aggSum   = "sum"
+	aggAvg   = "avg"
+	aggMin   = "min"
+	aggMax   = "max"
+
+	defaultDelimiter = ":"
+)
+
+type MessageAggregate struct {
+	Prefix string `json:"prefix"`
+	// Match optionally narrows the keys to those matching the regexp
+	Match string `json:"match"`
+	// Func is one of count, sum, avg, min, max
+	Func string `json:"func"`
+	// Field is a dotted path into JSON values, empty uses the value itself
+	Field string `json:"field"`
+	// GroupBy is the 1-based key segment to group by, 0 aggregates everything
+	GroupBy   int    `json:"group_by"`
+	Delimiter string `json:"delimiter"`
+}
+
+type AggregateGroup struct {
+	Group string `json:"group"`
+	Count int    `json:"count"`
+	// Value is unset for count
+	Value *float64 `json:"value,omitempty"`
+	// Skipped counts keys whose value or field isn't a number
+	Skipped int `json:"skipped"`
+
+	sum float64
+}
+
+type AggregateResponse struct {
+	Func    string           `json:"func"`
+	Field   string           `json:"field"`
+	Scanned int              `json:"scanned"`
+	Groups  []AggregateGroup `json:"groups"`
+}
+
+func (a *App) aggregate(msg AppMessage) AppMessage {
+	if !a.db.IsRunning() {
+		log.Printf("db not running for aggregate operation")
+		return AppMessage{Type: msg.Type, Body: NotRunningResponse}
+	}
+	var aggMsg MessageAggregate
+	if err := json.Unmarshal([]byte(msg.Body), &aggMsg); err != nil {
+		log.Printf("unmarshaling aggregate message failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+	if aggMsg.Func == "" {
+		aggMsg.Func = aggCount
+	}
+	switch aggMsg.Func {
+	case aggCount, aggSum, aggAvg, aggMin, aggMax:
+	default:
+		log.Printf("unknown aggregate function: %s", aggMsg.Func)
+		return AppMessage{Type: msg.Type, Body: fmt.Sprintf("unknown aggregate function %q", aggMsg.Func)}
+	}
+	var match *regexp.Regexp
+	if aggMsg.Match != "" {
+		var err error
+		if match, err = regexp.Compile(aggMsg.Match); err != nil {
+			log.Printf("compiling aggregate match failure: %v", err)
+			return AppMessage{Type: msg.Type, Body: err.Error()}
+		}
+	}
+	if aggMsg.Delimiter == "" {
+		aggMsg.Delimiter = a.delimiter()
+	}
+
+	aggMsg.Prefix = a.scoped(aggMsg.Prefix)
+	resp := AggregateResponse{Func: aggMsg.Func, Field: aggMsg.Field}
+	groups := make(map[string]*AggregateGroup)
+	prefix := a.virtualPrefix()
+	err := a.db.Scan(aggMsg.Prefix, func(key string, value []byte) error {
+		// matched and grouped as the virtual database in use shows the key
+		key, _ = relativeTo(prefix, key)
+		if match != nil && !match.MatchString(key) {
+			return nil
+		}
+		resp.Scanned++
+
+		name := keySegment(key, aggMsg.Delimiter, aggMsg.GroupBy)
+		g, ok := groups[name]
+		if !ok {
+			g = &AggregateGroup{Group: name}
+			groups[name] = g
+		}
+		if aggMsg.Func == aggCount {
+			g.Count++
+			return nil
+		}
+
+		n, ok := numericValue(value, aggMsg.Field)
+		if !ok {
+			g.Skipped++
+			return nil
+		}
+		g.Count++
+		g.sum += n
+		switch {
+		case g.Value == nil:
+			g.Value = &n
+		case aggMsg.Func == aggMin:
+			*g.Value = math.Min(*g.Value, n)
+		case aggMsg.Func == aggMax:
+			*g.Value = math.Max(*g.Value, n)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("aggregating failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+
+	for _, g := range groups {
+		switch aggMsg.Func {
+		case aggSum:
+			g.Value = &g.sum
+		case aggAvg:
+			if g.Count > 0 {
+				avg := g.sum / float64(g.Count)
+				g.Value = &avg
+			}
+		}
+		resp.Groups = append(resp.Groups, *g)
+	}
+	sort.Slice(resp.Groups, func(i, j int) bool {
+		return resp.Groups[i].Group < resp.Groups[j].Group
+	})
+
+	log.Printf("aggregated %d keys into %d groups", resp.Scanned, len(resp.Groups))
+	bt, _ := json.Marshal(resp)
+	return AppMessage{Type: msg.Type, Body: string(bt)}
+}
+
+// delimiter returns the key delimiter the database was opened with.
+func (a *App) delimiter() string {
+	a.mx.Lock()
+	defer a.mx.Unlock()
+	if a.lastOpen != nil && a.lastOpen.Delimiter != "" {
+		return a.lastOpen.Delimiter
+	}
+	return defaultDelimiter
+}
+
+// keySegment returns the n-th (1-based) segment of key, or an empty string
+// when n is 0 or the key is shorter.
+func keySegment(key, delimiter string, n int) string {
+	if n <= 0 {
+		return ""
+	}
+	segments := strings.Split(key, delimiter)
+	if n > len(segments) {
+		return ""
+	}
+	return segments[n-1]
+}
+
+func numericValue(value []byte, field string) (float64, bool) {
+	if field == "" {
+		n, err := strconv.ParseFloat(strings.TrimSpace(string(value)), 64)
+		return n, err == nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(value))
+	dec.UseNumber()
+	var doc any
+	if err := dec.Decode(&doc); err != nil {
+		return 0, false
+	}
+	doc, ok := jsonPath(doc, field)
+	if !ok {
+		return 0, false
+	}
+	switch v := doc.(type) {
+	case json.Number:
+		n, err := v.Float64()
+		return n, err == nil
+	case string:
+		n, err := strconv.ParseFloat(v, 64)
+		return n, err == nil
+	}
+	return 0, false
+}
+
+// jsonPath walks a dotted path through a decoded JSON document, numeric parts
+// index arrays as in items.0.sku.
+func jsonPath(doc any, path string) (any, bool) {
+	for _, part := range strings.Split(path, ".") {
+		switch v := doc.(type) {
+		case map[string]any:
+			var ok bool
+			if doc, ok = v[part]; !ok {
+				return nil, false
+			}
+		case []any:
+			i, err := strconv.Atoi(part)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil, false
+			}
+			doc = v[i]
+		default:
+			return nil, false
+		}
+	}
+	return doc, true
+}
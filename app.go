@@ -3,108 +3,507 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/filinvadim/badger-gui/config"
+	"github.com/filinvadim/badger-gui/database"
 	"github.com/wailsapp/wails/v2/pkg/runtime"
+	"io"
 	"log"
 	"net/http"
+	"os"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
 )
 
 type Storer interface {
-	Open(dbPath, decryptKey, compression string) (err error)
+	Open(opts database.OpenOptions) (err error)
 	Set(key string, value []byte) error
 	Get(key string) ([]byte, error)
+	GetVersioned(key string) ([]byte, uint64, error)
+	SetChecked(key string, value []byte, expected uint64) (version uint64, err error)
+	DeleteChecked(key string, expected uint64) (version uint64, err error)
+	Meta(key string) (database.KeyMeta, error)
+	ViewValue(key string, fn func(value []byte, version uint64) error) error
+	ValueThreshold() int64
+	ValueLocation(size int64) string
 	Delete(key string) error
+	DropPrefix(prefix string) error
+	SetBatching(maxEntries int, interval time.Duration) error
+	Batching() database.BatchStatus
+	FlushBatch() (int, error)
+	DiscardBatch() int
+	Touch(keys []string, ttl time.Duration) (missing []string, err error)
+	Duplicate(src, dst string, overwrite bool) error
+	SetMany(entries []database.Change, overwrite bool) (existing []string, err error)
+	Apply(changes []database.Change) error
+	Update(fn func(txn *database.Txn) error) error
+	UpdateKey(key string, fn func(txn *database.Txn) error) (version uint64, err error)
 	List(limit *int, startCursor *string) (keys []string, cursor string, err error)
 	Search(prefix string, limit *int, offset int) (keys []string, err error)
+	Count(prefix string) (int, error)
+	Scan(prefix string, fn func(key string, value []byte) error) error
+	WalkKeys(prefix string, fn func(database.KeyMeta) error) error
+	WalkKeysFrom(prefix, after string, fn func(database.KeyMeta) error) error
+	WalkAllKeys(prefix string, fn func(database.KeyMeta) error) error
+	WarmUpFrom(prefix, after string, fn func(database.KeyMeta) error) error
+	ExpiredKeys(prefix string, purge bool) (database.ExpiredStats, error)
+	Transform(prefix string, fn database.TransformFunc, dryRun bool, progress func(database.TransformStats)) (database.TransformStats, error)
+	Backup(w io.Writer, opts database.BackupOptions) (version uint64, err error)
+	Restore(r io.Reader, passphrase string) error
+	OpenBackup(r io.Reader, passphrase string, opts database.OpenOptions) error
 	IsRunning() bool
 	IsInMemory() bool
+	IsManaged() bool
+	IsReadOnly() bool
+	SetReadTs(ts uint64) error
+	MaxVersion() uint64
+	PageSize() int
+	Versions(key string) ([]database.Version, error)
+	Info() (database.Info, error)
+	Options() (database.EffectiveOptions, error)
+	SampleStats(fraction float64) (database.SampleStats, error)
+	Namespaces(delimiter string, top int) ([]database.Namespace, database.Namespace, error)
+	Treemap(prefix, delimiter string, depth, maxChildren int, fraction float64) (database.Treemap, error)
+	Compression() string
+	CompressionByNamespace(delimiter string) ([]database.CompressionStat, database.CompressionStat, error)
+	Subscribe(ctx context.Context, prefixes []string, fn func(database.KeyChange)) error
+	VlogFiles() ([]database.VlogFile, error)
+	RunGC(discardRatio float64) (rewritten bool, err error)
+	Levels() ([]database.Level, error)
+	Flatten() error
+	EstimateSpace(operation string, input int64) (database.SpaceEstimate, error)
+	Degraded() *database.Degraded
+	OnCompaction(fn func(database.CompactionEvent))
+	OnUnhealthy(fn func(error))
+	OnGC(fn func(database.GCEvent))
+	ExternalWrites() (*database.ExternalWrites, error)
+	Health() error
+	Compactions() []database.CompactionEvent
+	SetShowInternal(show bool)
+	SetIgnoredPrefixes(prefixes []string)
+	IgnoredPrefixes() []string
 	Close()
 }
 
 type messageType string
 
 const (
-	TypeOpen   messageType = "open"
-	TypeSet    messageType = "set"
-	TypeDelete messageType = "delete"
-	TypeList   messageType = "list"
-	TypeGet    messageType = "get"
-	TypeSearch messageType = "search"
-
-	OkStatus                   = "ok"
-	NotRunningResponse         = "db isn't running"
-	AlreadyRunningResponse     = "db already running"
-	UnknownMessageTypeResponse = "unknown message type"
+	TypeOpen    messageType = "open"
+	TypeSet     messageType = "set"
+	TypeDelete  messageType = "delete"
+	TypeList    messageType = "list"
+	TypeGet     messageType = "get"
+	TypeSearch  messageType = "search"
+	TypeBackup  messageType = "backup"
+	TypeRestore messageType = "restore"
+
+	TypeSettings       messageType = "settings"
+	TypeSaveSettings   messageType = "save_settings"
+	TypeS3Credentials  messageType = "s3_credentials"
+	TypeBackupS3       messageType = "backup_s3"
+	TypeRestoreS3      messageType = "restore_s3"
+	TypeListS3         messageType = "list_s3"
+	TypeReadTs         messageType = "read_ts"
+	TypeVersions       messageType = "versions"
+	TypeVlogFiles      messageType = "vlog_files"
+	TypeGC             messageType = "gc"
+	TypeCompactions    messageType = "compactions"
+	TypeInternalKeys   messageType = "internal_keys"
+	TypeSafeMode       messageType = "safe_mode"
+	TypeWritePassword  messageType = "write_password"
+	TypeUnlockWrites   messageType = "unlock_writes"
+	TypeReopen         messageType = "reopen"
+	TypeInfo           messageType = "info"
+	TypeRepl           messageType = "repl"
+	TypeActions        messageType = "actions"
+	TypeMigrate        messageType = "migrate"
+	TypeAggregate      messageType = "aggregate"
+	TypeSampleStats    messageType = "sample_stats"
+	TypeNamespaces     messageType = "namespaces"
+	TypeExportKeys     messageType = "export_keys"
+	TypePresets        messageType = "presets"
+	TypeTouch          messageType = "touch"
+	TypeDuplicate      messageType = "duplicate"
+	TypeExportSettings messageType = "export_settings"
+	TypeImportSettings messageType = "import_settings"
+	TypeHistogram      messageType = "histogram"
+	TypeCompression    messageType = "compression"
+	TypeWatchExpiry    messageType = "watch_expiry"
+	TypePurgeExpired   messageType = "purge_expired"
+	TypeSaveProfile    messageType = "save_profile"
+	TypeOptions        messageType = "options"
+	TypeDropPrefix     messageType = "drop_prefix"
+	TypeJobs           messageType = "jobs"
+	TypeStartJob       messageType = "start_job"
+	TypePauseJob       messageType = "pause_job"
+	TypeResumeJob      messageType = "resume_job"
+	TypeCancelJob      messageType = "cancel_job"
+	TypeWriteBatching  messageType = "write_batching"
+	TypeFlushWrites    messageType = "flush_writes"
+	TypeActivity       messageType = "activity"
+	TypeMetrics        messageType = "metrics"
+	TypeCrashReports   messageType = "crash_reports"
+	TypeRevealCrash    messageType = "reveal_crash"
+	TypeOpenDemo       messageType = "open_demo"
+	TypeTreemap        messageType = "treemap"
+	TypeColumns        messageType = "columns"
+	TypeScope          messageType = "scope"
+	TypeLabel          messageType = "label"
+	TypeGlobalSearch   messageType = "global_search"
+	TypeExportDelta    messageType = "export_delta"
+	TypeGenerate       messageType = "generate"
+	TypePaste          messageType = "paste"
+	TypeCollisions     messageType = "rename_collisions"
+	TypeRetention      messageType = "retention"
+	TypeRunRetention   messageType = "run_retention"
+	TypeValueTemplate  messageType = "value_template"
+	TypeNewValue       messageType = "new_value"
+	TypeSchema         messageType = "schema"
+	TypeHooks          messageType = "hooks"
+	TypeStaging        messageType = "staging"
+	TypeCommitStaged   messageType = "commit_staged"
+	TypeDiscardStaged  messageType = "discard_staged"
+	TypeRecentKeys     messageType = "recent_keys"
+	TypeOpenKey        messageType = "open_key"
+	TypeCapabilities   messageType = "capabilities"
+	TypeCompareKey     messageType = "compare_key"
+	TypeValueHistory   messageType = "value_history"
+	TypeRevert         messageType = "revert"
+	TypeShareSnapshot  messageType = "share_snapshot"
+	TypeOpenSnapshot   messageType = "open_snapshot"
+	TypeRefresh        messageType = "refresh"
+	TypeIgnored        messageType = "ignored"
+	TypeKeyLayout      messageType = "key_layout"
+	TypeRenderKey      messageType = "render_key"
+	TypeDecoder        messageType = "decoder"
+	TypeHexDump        messageType = "hex_dump"
+	TypeValueSearch    messageType = "value_search"
+	TypeAdvice         messageType = "advice"
+	TypeFlatten        messageType = "flatten"
+	TypeSpaceEstimate  messageType = "space_estimate"
+	TypeVirtual        messageType = "virtual"
+	TypeUseVirtual     messageType = "use_virtual"
+	TypeExport         messageType = "export"
+
+	OkStatus                     = "ok"
+	NotRunningResponse           = "db isn't running"
+	AlreadyRunningResponse       = "db already running"
+	UnknownMessageTypeResponse   = "unknown message type"
+	SafeModeOnResponse           = "safe mode is on, writes are disabled"
+	ConfirmationRequiredResponse = "confirmation required"
+	WriteProtectedResponse       = "destructive operations are protected, enter the write password"
+	WrongPasswordResponse        = "wrong password"
+	ConflictStatus               = "conflict"
+	StorageWarningStatus         = "storage_warning"
+	NoProfileResponse            = "profile path is required, in-memory databases have no profile"
+	VirtualRefusedResponse       = "not available in a virtual database, switch back to the whole connection first"
+
+	EventCompaction        = "compaction"
+	EventIdleClosed        = "db:idle_closed"
+	EventReplOutput        = "repl:output"
+	EventUnhealthy         = "db:unhealthy"
+	EventKeyExpiring       = "key:expiring"
+	EventKeyExpired        = "key:expired"
+	EventMigrationProgress = "migration:progress"
 )
 
 type AppMessage struct {
 	Type messageType `json:"type"`
 	Body string      `json:"body"`
+	// Version is the API version the caller speaks, see APIVersion.
+	// Responses carry the version of the backend.
+	Version int `json:"version,omitempty"`
 }
 
 type MessageOpen struct {
-	Path          string `json:"path"`
-	DecryptionKey string `json:"decryption_key"`
+	Path string `json:"path"`
+	// ValueDir is the value log directory when it's on another disk than
+	// Path, empty when it's Path
+	ValueDir      string `json:"value_dir"`
+	DecryptionKey Secret `json:"decryption_key"`
 	Compression   string `json:"compression"`
 	Delimiter     string `json:"delimiter"`
+	Managed       bool   `json:"managed"`
+	ReadTs        uint64 `json:"read_ts"`
+	// ChecksumMode is one of none, table, block, table_and_block
+	ChecksumMode        string `json:"checksum_mode"`
+	VerifyValueChecksum bool   `json:"verify_value_checksum"`
+	DetectConflicts     *bool  `json:"detect_conflicts"`
+	ReadOnly            bool   `json:"read_only"`
+	CopyFirst           bool   `json:"copy_first"`
+	// SyncWrites defaults to true, false trades crash safety for write speed
+	SyncWrites *bool `json:"sync_writes"`
+	// KeyRotation is a Go duration like "240h" applied to encrypted databases
+	KeyRotation string `json:"key_rotation"`
+	// BlockCacheMB and IndexCacheMB override badger's cache sizes
+	BlockCacheMB int64 `json:"block_cache_mb"`
+	IndexCacheMB int64 `json:"index_cache_mb"`
+	// PageSize is how many keys list and search return without a limit,
+	// PrefetchSize how many values iterators fetch ahead
+	PageSize     int `json:"page_size"`
+	PrefetchSize int `json:"prefetch_size"`
+	// NumCompactors is how many compactions badger runs at once, 2 by
+	// default
+	NumCompactors int `json:"num_compactors"`
+	// GC enables periodic value log GC for the connection
+	GC *config.GCPolicy `json:"gc"`
+	// NoProfile skips the saved profile of the database
+	NoProfile bool `json:"no_profile"`
+	// AcceptStorageWarnings opens a symlinked or network-mounted database
+	// writable anyway, otherwise only read-only opens proceed
+	AcceptStorageWarnings bool `json:"accept_storage_warnings"`
+	// Passphrase decrypts an encrypted backup file or snapshot given as Path
+	Passphrase string `json:"passphrase"`
 }
 
 type MessageSet struct {
 	Key   string `json:"key"`
 	Value string `json:"value"`
+	// ExpectedVersion is the version the edit is based on, see Item.Version.
+	// When set the write is rejected with a ConflictResponse if the key
+	// changed in the meantime.
+	ExpectedVersion uint64 `json:"expected_version"`
+}
+
+// WriteResponse answers writes made with an expected version, and sets that
+// moved a value between the LSM tree and the value log.
+type WriteResponse struct {
+	Status  string `json:"status"`
+	Version uint64 `json:"version,omitempty"`
+	*StorageMove
+}
+
+// StorageMove warns that a write changed where badger keeps the value, which
+// rewrites it on the other side and leaves garbage for compaction or GC.
+type StorageMove struct {
+	Storage         string `json:"storage"`
+	PreviousStorage string `json:"previous_storage"`
+	ValueThreshold  int64  `json:"value_threshold"`
+	Warning         string `json:"warning"`
+}
+
+// ConflictResponse carries the current state of a key that changed since
+// the client loaded it, so the user can reload, overwrite or merge.
+type ConflictResponse struct {
+	Status  string `json:"status"`
+	Key     string `json:"key"`
+	Version uint64 `json:"version"`
+	Value   string `json:"value"`
+	Deleted bool   `json:"deleted"`
 }
 
 type OpenResponse struct {
-	Status   string `json:"status"`
-	InMemory bool   `json:"inmemory"`
+	Status     string `json:"status"`
+	InMemory   bool   `json:"inmemory"`
+	Managed    bool   `json:"managed"`
+	ReadOnly   bool   `json:"read_only"`
+	MaxVersion uint64 `json:"max_version"`
+	// PageSize is how many keys a page holds when list is sent no limit
+	PageSize int `json:"page_size"`
+	// Profile is the saved profile applied on open, the frontend takes the
+	// decoders, key layouts and default prefix from it
+	Profile *config.Profile `json:"profile,omitempty"`
+	// Warnings are the storage warnings the open went ahead despite
+	Warnings []database.StorageWarning `json:"warnings,omitempty"`
+	// Backup is set when Path was a backup file, restored in memory
+	Backup bool `json:"backup,omitempty"`
+	// Degraded are the reduced cache settings the open fell back to after
+	// running out of memory
+	Degraded *database.Degraded `json:"degraded,omitempty"`
+}
+
+// StorageWarningResponse answers a writable open of a database badger may
+// misbehave on, see database.CheckStorage. Opening read-only or with
+// accept_storage_warnings proceeds.
+type StorageWarningResponse struct {
+	Status   string                    `json:"status"`
+	Warnings []database.StorageWarning `json:"warnings"`
+}
+
+type MessageReadTs struct {
+	Ts uint64 `json:"ts"`
+}
+
+type VersionsResponse struct {
+	Key      string             `json:"key"`
+	Versions []database.Version `json:"versions"`
+}
+
+type CompactionsResponse struct {
+	Events []database.CompactionEvent `json:"events"`
+}
+
+type ReadTsResponse struct {
+	ReadTs     uint64 `json:"read_ts"`
+	MaxVersion uint64 `json:"max_version"`
 }
 
 type MessageDelete struct {
-	Key string `json:"key"`
+	Key             string `json:"key"`
+	ExpectedVersion uint64 `json:"expected_version"`
+	// IDs deletes a selection of rows at once instead of Key, see rowID
+	IDs []string `json:"ids"`
 }
 
-type MessageGet MessageDelete
+type MessageGet struct {
+	Key string `json:"key"`
+}
 
 type MessageList struct {
 	Limit  *int    `json:"limit"`
 	Cursor *string `json:"cursor"`
+	// Sort orders the page by key, size, expires or version, the cursor
+	// still follows key order
+	Sort string `json:"sort"`
+	Desc bool   `json:"desc"`
+	// Preview reads the first bytes of each value of the page, up to 1024,
+	// for Previews. Zero leaves them out.
+	Preview int `json:"preview"`
 }
 
 type MessageSearch struct {
 	Prefix string `json:"prefix"`
 	Limit  *int   `json:"limit"`
 	Offset int    `json:"offset"`
+	// Sort orders the page like MessageList.Sort
+	Sort string `json:"sort"`
+	Desc bool   `json:"desc"`
+	// Preview is as for MessageList
+	Preview int `json:"preview"`
 }
 
 type ListResponse struct {
 	Cursor string   `json:"cursor"`
 	Keys   []string `json:"keys"`
+	// IDs are the opaque row IDs of Keys, in the same order
+	IDs []string `json:"ids"`
+	// Meta is the metadata the page was sorted by, in the same order
+	Meta []database.KeyMeta `json:"meta,omitempty"`
+	// Labels are the names of the labeled prefixes of the page's keys, by
+	// prefix
+	Labels map[string]string `json:"labels,omitempty"`
+	// Previews are the heads of the values of Keys when asked for, in the
+	// same order
+	Previews []ValuePreview `json:"previews,omitempty"`
+	// Rendered are the keys decoded with the key layouts of the profile, in
+	// the same order, null for keys without a layout
+	Rendered []*RenderedKey `json:"rendered,omitempty"`
 }
 
 type SearchResponse struct {
-	Keys   []string `json:"keys"`
-	Offset int      `json:"offset"`
+	Keys     []string           `json:"keys"`
+	IDs      []string           `json:"ids"`
+	Offset   int                `json:"offset"`
+	Meta     []database.KeyMeta `json:"meta,omitempty"`
+	Labels   map[string]string  `json:"labels,omitempty"`
+	Previews []ValuePreview     `json:"previews,omitempty"`
+	Rendered []*RenderedKey     `json:"rendered,omitempty"`
 }
 
 type Item struct {
-	Key   string `json:"key"`
-	Value string `json:"value"`
+	Key     string `json:"key"`
+	Value   string `json:"value"`
+	Version uint64 `json:"version,omitempty"`
+	// Internal describes badger's own bookkeeping entries
+	Internal string `json:"internal,omitempty"`
+	// Media replaces the raw bytes of PDF, audio and video values
+	Media *MediaInfo `json:"media,omitempty"`
+	// Staged is set when Value is a staged edit not committed yet
+	Staged bool `json:"staged,omitempty"`
+	// Decoder is the decoder the profile assigns to the key's prefix
+	Decoder string `json:"decoder,omitempty"`
+	// Binary is set when the value isn't text, hex_dump pages through it
+	Binary bool `json:"binary,omitempty"`
+}
+
+type MessageInternalKeys struct {
+	Show bool `json:"show"`
 }
 
 type App struct {
-	ctx context.Context
-	db  Storer
+	ctx      context.Context
+	db       Storer
+	settings *config.Store
+	safeMode *atomic.Bool
+	// unlocked is set once the write password was entered in this session
+	unlocked *atomic.Bool
+
+	mx       *sync.Mutex
+	lastOpen *MessageOpen
+	// scope is the working prefix reads are constrained to
+	scope string
+	// virtual is the virtual database in use, scope is its prefix
+	virtual      string
+	lastActivity *atomic.Int64
+	stopWatchers context.CancelFunc
+	httpServer   *http.Server
+	debugServer  *http.Server
+	automation   *automationServer
+	replHistory  []string
+	// expiryWatches are keys whose TTL the user follows, by key
+	expiryWatches map[string]*ExpiryWatch
+	// pendingDrop is the last previewed drop prefix awaiting confirmation
+	pendingDrop *pendingDrop
+	// jobs are the background jobs of the session, by ID
+	jobs map[string]*Job
+	// retentionRuns are the last runs of scheduled retention rules, by
+	// database path and rule name
+	retentionRuns map[string]time.Time
+	// staging collects set and delete calls to commit them together, nil
+	// while they're written right away
+	staging *changeset
+	// openKey is the key open in the editor, followed for outside writes
+	openKey *openKey
+	// externalWrites are the writes of another process to the directory of
+	// the connection, once noticed and until refreshed
+	externalWrites *database.ExternalWrites
+	// activity records the recent operations of the connection
+	activity *activityLog
+	// access tracks the keys viewed and modified since the database opened
+	access *keyAccessLog
+	// history keeps the previous values of the keys edited in the session
+	history *valueHistory
+	latency *latencyRecorder
+	// inflight counts the calls being handled, shutdown waits for them
+	inflight *atomic.Int64
+	// quitting is set once the app waits for its jobs to quit
+	quitting *atomic.Bool
+	done     chan struct{}
 }
 
-// NewApp creates a new App application struct
-func NewApp(db Storer) *App {
-	return &App{db: db}
+// NewApp creates a new App application struct. Storer calls are timed for
+// the metrics message.
+func NewApp(db Storer, settings *config.Store) *App {
+	latency := newLatencyRecorder()
+	return &App{
+		db: timedStorer{Storer: db, latency: latency}, latency: latency, settings: settings, safeMode: new(atomic.Bool), unlocked: new(atomic.Bool),
+		mx: new(sync.Mutex), lastActivity: new(atomic.Int64), done: make(chan struct{}),
+		activity: newActivityLog(), access: newKeyAccessLog(), history: newValueHistory(), inflight: new(atomic.Int64), quitting: new(atomic.Bool),
+	}
 }
 
 // Startup is called when the app starts. The context is saved
 // so we can call the runtime methods
 func (a *App) startup(ctx context.Context) {
 	a.ctx = ctx
+	a.db.OnCompaction(func(e database.CompactionEvent) {
+		runtime.EventsEmit(a.ctx, EventCompaction, e)
+	})
+	a.db.OnUnhealthy(a.onUnhealthy)
+	a.db.OnGC(a.onGC)
+	go a.watchIdle()
+	go a.watchHealth()
+	go a.watchExpiries()
+	go a.watchRetention()
+	go a.watchExternalWrites()
+	a.loadJobs()
+	a.restartHTTPServer()
+	a.restartDebugServer()
+	a.restartAutomation()
 	log.Println("starting application")
 }
 
@@ -117,133 +516,744 @@ func (a *App) OpenDirectoryDialog() string {
 		log.Printf("error opening directory dialog: %v", err)
 		return ""
 	}
-	return path
+	return database.ShortPath(path)
+}
+
+// OpenFileDialog opens a file picker for backup files and shared snapshots,
+// which open as read-only in-memory databases
+func (a *App) OpenFileDialog() string {
+	path, err := runtime.OpenFileDialog(a.ctx, runtime.OpenDialogOptions{
+		Title: "Select Badger backup or snapshot file",
+	})
+	if err != nil {
+		log.Printf("error opening file dialog: %v", err)
+		return ""
+	}
+	return database.ShortPath(path)
+}
+
+// SaveFileDialog opens a save dialog for a backup file, suggesting a name
+// stamped with the current time
+func (a *App) SaveFileDialog() string {
+	path, err := runtime.SaveFileDialog(a.ctx, runtime.SaveDialogOptions{
+		Title:           "Save Badger backup",
+		DefaultFilename: "badger-" + time.Now().Format("20060102-150405") + ".bak",
+		Filters:         []runtime.FileFilter{{DisplayName: "Badger backups (*.bak)", Pattern: "*.bak"}},
+	})
+	if err != nil {
+		log.Printf("error opening save dialog: %v", err)
+		return ""
+	}
+	return database.ShortPath(path)
+}
+
+// SaveExportDialog opens a save dialog for an export in format, json, ndjson
+// or csv
+func (a *App) SaveExportDialog(format string) string {
+	if format == "" {
+		format = exportFormatNDJSON
+	}
+	path, err := runtime.SaveFileDialog(a.ctx, runtime.SaveDialogOptions{
+		Title:           "Export keys and values",
+		DefaultFilename: "badger-export-" + time.Now().Format("20060102-150405") + "." + format,
+		Filters:         []runtime.FileFilter{{DisplayName: strings.ToUpper(format) + " (*." + format + ")", Pattern: "*." + format}},
+	})
+	if err != nil {
+		log.Printf("error opening save dialog: %v", err)
+		return ""
+	}
+	return database.ShortPath(path)
 }
 
 // Call calls a JS/Go mapped method
 func (a *App) Call(msg AppMessage) (response AppMessage) {
 	// Log message type without exposing sensitive data
 	log.Printf("received message type: %s", msg.Type)
+	a.touch()
+	a.inflight.Add(1)
+	defer a.inflight.Add(-1)
+	start := time.Now()
+	defer func() { a.recordCall(msg, response, time.Since(start)) }()
+	defer func() {
+		if r := recover(); r != nil {
+			response = a.recoverCall(msg.Type, r)
+		}
+		response.Version = APIVersion
+	}()
+
+	if resp, rejected := unsupportedVersion(msg); rejected {
+		return resp
+	}
+
+	if a.isWriteLocked(msg.Type) {
+		log.Printf("%s rejected: safe mode is on", msg.Type)
+		return AppMessage{Type: msg.Type, Body: SafeModeOnResponse}
+	}
+	if a.isWriteProtected(msg.Type) {
+		log.Printf("%s rejected: write password required", msg.Type)
+		return AppMessage{Type: msg.Type, Body: WriteProtectedResponse}
+	}
+	if a.isVirtualRefused(msg.Type) {
+		log.Printf("%s rejected: a virtual database is in use", msg.Type)
+		return AppMessage{Type: msg.Type, Body: VirtualRefusedResponse}
+	}
 
 	switch msg.Type {
 	case TypeOpen:
 		if a.db.IsRunning() {
 			log.Printf(AlreadyRunningResponse)
-			return AppMessage{msg.Type, AlreadyRunningResponse}
+			return AppMessage{Type: msg.Type, Body: AlreadyRunningResponse}
 		}
 		var openMsg MessageOpen
 		if err := json.Unmarshal([]byte(msg.Body), &openMsg); err != nil {
 			log.Printf("unmarshaling open message failure: %v", err)
-			return AppMessage{msg.Type, err.Error()}
+			return AppMessage{Type: msg.Type, Body: err.Error()}
 		}
-
-		log.Printf("opening db at path: [%s], compression: %s", openMsg.Path, openMsg.Compression)
-		if err := a.db.Open(openMsg.Path, openMsg.DecryptionKey, openMsg.Compression); err != nil {
-			log.Printf("opening db failure: %v", err)
-			return AppMessage{msg.Type, err.Error()}
-		}
-		log.Printf("db opened with delimiter [%s], in memory [%t]", openMsg.Delimiter, a.db.IsInMemory())
-		bt, _ := json.Marshal(OpenResponse{OkStatus, a.db.IsInMemory()})
-		return AppMessage{msg.Type, string(bt)}
+		return a.open(msg.Type, openMsg)
 	case TypeSet:
 		if !a.db.IsRunning() {
 			log.Printf("db not running for set operation")
-			return AppMessage{msg.Type, NotRunningResponse}
+			return AppMessage{Type: msg.Type, Body: NotRunningResponse}
 		}
 		var setMsg MessageSet
 		if err := json.Unmarshal([]byte(msg.Body), &setMsg); err != nil {
 			log.Printf("unmarshaling set message failure: %v", err)
-			return AppMessage{msg.Type, err.Error()}
+			return AppMessage{Type: msg.Type, Body: err.Error()}
+		}
+		setMsg.Key = a.virtualKey(setMsg.Key)
+		if prefix, violations := a.schemas().validate(setMsg.Key, []byte(setMsg.Value)); len(violations) > 0 {
+			return schemaViolation(msg.Type, a.shownKey(setMsg.Key), prefix, violations)
+		}
+		if staged, ok := a.stage(msg.Type, setMsg.Key, []byte(setMsg.Value), setMsg.ExpectedVersion); ok {
+			return staged
+		}
+		a.ownWrite(setMsg.Key, []byte(setMsg.Value))
+		move := a.storageMove(setMsg.Key, len(setMsg.Value))
+		before := snapshot(a.db, setMsg.Key)
+		version, err := a.writeKey(setMsg.Key, []byte(setMsg.Value), setMsg.ExpectedVersion)
+		if err == nil {
+			a.history.push(msg.Type, setMsg.Key, before)
+		}
+		if setMsg.ExpectedVersion != 0 {
+			return a.checkedWriteResponse(msg.Type, setMsg.Key, version, move, err)
+		}
+		if err != nil {
+			log.Printf("setting key failure %s: %v", logKey(setMsg.Key), err)
+			return AppMessage{Type: msg.Type, Body: err.Error()}
 		}
-		if err := a.db.Set(setMsg.Key, []byte(setMsg.Value)); err != nil {
-			log.Printf("setting key failure %s: %v", setMsg.Key, err)
-			return AppMessage{msg.Type, err.Error()}
+		log.Printf("key %s set successfully", logKey(setMsg.Key))
+		if move != nil {
+			bt, _ := json.Marshal(WriteResponse{Status: OkStatus, StorageMove: move})
+			return AppMessage{Type: msg.Type, Body: string(bt)}
 		}
-		log.Printf("key %s set successfully", setMsg.Key)
-		return AppMessage{msg.Type, OkStatus}
+		return AppMessage{Type: msg.Type, Body: OkStatus}
 	case TypeGet:
 		if !a.db.IsRunning() {
 			log.Printf("db not running for get operation")
-			return AppMessage{msg.Type, NotRunningResponse}
+			return AppMessage{Type: msg.Type, Body: NotRunningResponse}
 		}
 		var getMsg MessageGet
 		if err := json.Unmarshal([]byte(msg.Body), &getMsg); err != nil {
 			log.Printf("unmarshaling get message failure: %v", err)
-			return AppMessage{msg.Type, err.Error()}
+			return AppMessage{Type: msg.Type, Body: err.Error()}
+		}
+		getMsg.Key = a.virtualKey(getMsg.Key)
+		if edit, ok := a.stagedValue(getMsg.Key); ok {
+			if edit.delete {
+				return AppMessage{Type: msg.Type, Body: database.ErrKeyNotFound.Error()}
+			}
+			bt, _ := json.Marshal(Item{
+				Key: a.shownKey(getMsg.Key), Value: string(edit.value), Version: edit.base, Staged: true, Decoder: a.decoderOf(getMsg.Key),
+			})
+			return AppMessage{Type: msg.Type, Body: string(bt)}
 		}
-		value, err := a.db.Get(getMsg.Key)
+		value, version, err := a.db.GetVersioned(getMsg.Key)
 		if err != nil {
-			log.Printf("getting key failure %s: %v", getMsg.Key, err)
-			return AppMessage{msg.Type, err.Error()}
+			log.Printf("getting key failure %s: %v", logKey(getMsg.Key), err)
+			return AppMessage{Type: msg.Type, Body: err.Error()}
+		}
+		log.Printf("key %s retrieved, value length: %d", logKey(getMsg.Key), len(value))
+		item := Item{Key: a.shownKey(getMsg.Key), Version: version, Decoder: a.decoderOf(getMsg.Key)}
+		if database.IsInternalKey(getMsg.Key) {
+			item.Internal = database.DecodeInternalKey(getMsg.Key, value)
 		}
-		log.Printf("key %s retrieved, value length: %d", getMsg.Key, len(value))
 		if isImage(value) {
 			value = []byte("[image]")
+		} else if media := mediaInfo(value); media != nil {
+			item.Media = media
+			value = []byte(media.String())
+		} else {
+			item.Binary = !utf8.Valid(value)
 		}
-		bt, _ := json.Marshal(Item{Key: getMsg.Key, Value: string(value)})
-		return AppMessage{msg.Type, string(bt)}
+		item.Value = string(value)
+		bt, _ := json.Marshal(item)
+		return AppMessage{Type: msg.Type, Body: string(bt)}
 	case TypeDelete:
 		if !a.db.IsRunning() {
 			log.Printf("db not running for delete operation")
-			return AppMessage{msg.Type, NotRunningResponse}
+			return AppMessage{Type: msg.Type, Body: NotRunningResponse}
 		}
 		var deleteMsg MessageDelete
 		if err := json.Unmarshal([]byte(msg.Body), &deleteMsg); err != nil {
 			log.Printf("unmarshaling delete message failure: %v", err)
-			return AppMessage{msg.Type, err.Error()}
+			return AppMessage{Type: msg.Type, Body: err.Error()}
+		}
+		if len(deleteMsg.IDs) > 0 {
+			return a.deleteIDs(msg.Type, deleteMsg.IDs)
+		}
+		deleteMsg.Key = a.virtualKey(deleteMsg.Key)
+		if staged, ok := a.stage(msg.Type, deleteMsg.Key, nil, deleteMsg.ExpectedVersion); ok {
+			return staged
 		}
-		if err := a.db.Delete(deleteMsg.Key); err != nil {
-			log.Printf("deleting key failure %s: %v", deleteMsg.Key, err)
-			return AppMessage{msg.Type, err.Error()}
+		a.ownWrite(deleteMsg.Key, nil)
+		before := snapshot(a.db, deleteMsg.Key)
+		version, err := a.writeKey(deleteMsg.Key, nil, deleteMsg.ExpectedVersion)
+		if err == nil {
+			a.history.push(msg.Type, deleteMsg.Key, before)
 		}
-		log.Printf("key %s deleted", deleteMsg.Key)
-		return AppMessage{msg.Type, OkStatus}
+		if deleteMsg.ExpectedVersion != 0 {
+			return a.checkedWriteResponse(msg.Type, deleteMsg.Key, version, nil, err)
+		}
+		if err != nil {
+			log.Printf("deleting key failure %s: %v", logKey(deleteMsg.Key), err)
+			return AppMessage{Type: msg.Type, Body: err.Error()}
+		}
+		log.Printf("key %s deleted", logKey(deleteMsg.Key))
+		return AppMessage{Type: msg.Type, Body: OkStatus}
 	case TypeList:
 		if !a.db.IsRunning() {
 			log.Printf("db not running for list operation")
-			return AppMessage{msg.Type, NotRunningResponse}
+			return AppMessage{Type: msg.Type, Body: NotRunningResponse}
 		}
 		var listMsg MessageList
 		if err := json.Unmarshal([]byte(msg.Body), &listMsg); err != nil {
 			log.Printf("unmarshaling list message failure: %v", err)
-			return AppMessage{msg.Type, err.Error()}
+			return AppMessage{Type: msg.Type, Body: err.Error()}
+		}
+		if listMsg.Cursor != nil && *listMsg.Cursor != "" {
+			cursor := a.virtualKey(*listMsg.Cursor)
+			listMsg.Cursor = &cursor
+		}
+		var (
+			keys   []string
+			cursor string
+			err    error
+		)
+		if a.scoped("") != "" {
+			keys, cursor, err = a.listScoped(listMsg.Limit, listMsg.Cursor)
+		} else {
+			keys, cursor, err = a.db.List(listMsg.Limit, listMsg.Cursor)
 		}
-		keys, cursor, err := a.db.List(listMsg.Limit, listMsg.Cursor)
 		if err != nil {
 			log.Printf("listing items failure: %v", err)
 		}
-		bt, _ := json.Marshal(ListResponse{Cursor: cursor, Keys: keys})
+		var meta []database.KeyMeta
+		if listMsg.Sort != "" || listMsg.Desc {
+			if keys, meta, err = a.sortByMeta(keys, listMsg.Sort, listMsg.Desc); err != nil {
+				log.Printf("sorting items failure: %v", err)
+				return AppMessage{Type: msg.Type, Body: err.Error()}
+			}
+		}
+		if cursor != "end" {
+			cursor = a.shownKey(cursor)
+		}
+		shown := a.shownKeys(keys)
+		resp := ListResponse{
+			Cursor: cursor, Keys: shown, IDs: rowIDs(shown), Meta: a.shownMeta(meta), Labels: a.pageLabels(keys), Rendered: a.renderKeys(keys),
+		}
+		if listMsg.Preview > 0 {
+			resp.Previews = a.previews(keys, listMsg.Preview)
+		}
+		bt, _ := json.Marshal(resp)
 		log.Printf("listed %d items, cursor: %s", len(keys), cursor)
-		return AppMessage{msg.Type, string(bt)}
+		return AppMessage{Type: msg.Type, Body: string(bt)}
 	case TypeSearch:
 		if !a.db.IsRunning() {
 			log.Printf("db not running for list operation")
-			return AppMessage{msg.Type, NotRunningResponse}
+			return AppMessage{Type: msg.Type, Body: NotRunningResponse}
 		}
 		var searchMsg MessageSearch
 		if err := json.Unmarshal([]byte(msg.Body), &searchMsg); err != nil {
 			log.Printf("unmarshaling list message failure: %v", err)
-			return AppMessage{msg.Type, err.Error()}
+			return AppMessage{Type: msg.Type, Body: err.Error()}
 		}
 
-		keys, err := a.db.Search(searchMsg.Prefix, searchMsg.Limit, searchMsg.Offset)
+		keys, err := a.db.Search(a.scoped(searchMsg.Prefix), searchMsg.Limit, searchMsg.Offset)
 		if err != nil {
 			log.Printf("listing items failure: %v", err)
 		}
-		bt, _ := json.Marshal(SearchResponse{Keys: keys, Offset: len(keys)})
+		offset := len(keys)
+		var meta []database.KeyMeta
+		if searchMsg.Sort != "" || searchMsg.Desc {
+			if keys, meta, err = a.sortByMeta(keys, searchMsg.Sort, searchMsg.Desc); err != nil {
+				log.Printf("sorting items failure: %v", err)
+				return AppMessage{Type: msg.Type, Body: err.Error()}
+			}
+		}
+		shown := a.shownKeys(keys)
+		resp := SearchResponse{
+			Keys: shown, IDs: rowIDs(shown), Offset: offset, Meta: a.shownMeta(meta), Labels: a.pageLabels(keys), Rendered: a.renderKeys(keys),
+		}
+		if searchMsg.Preview > 0 {
+			resp.Previews = a.previews(keys, searchMsg.Preview)
+		}
+		bt, _ := json.Marshal(resp)
 		log.Printf("found %d items", len(keys))
-		return AppMessage{msg.Type, string(bt)}
+		return AppMessage{Type: msg.Type, Body: string(bt)}
+	case TypeBackup:
+		return a.backup(msg)
+	case TypeRestore:
+		return a.restore(msg)
+	case TypeSettings:
+		return a.getSettings(msg)
+	case TypeSaveSettings:
+		return a.saveSettings(msg)
+	case TypeS3Credentials:
+		return a.setS3Credentials(msg)
+	case TypeBackupS3:
+		return a.backupS3(msg)
+	case TypeRestoreS3:
+		return a.restoreS3(msg)
+	case TypeListS3:
+		return a.listS3(msg)
+	case TypeReadTs:
+		if !a.db.IsRunning() {
+			log.Printf("db not running for read timestamp operation")
+			return AppMessage{Type: msg.Type, Body: NotRunningResponse}
+		}
+		var tsMsg MessageReadTs
+		if err := json.Unmarshal([]byte(msg.Body), &tsMsg); err != nil {
+			log.Printf("unmarshaling read timestamp message failure: %v", err)
+			return AppMessage{Type: msg.Type, Body: err.Error()}
+		}
+		if err := a.db.SetReadTs(tsMsg.Ts); err != nil {
+			log.Printf("setting read timestamp failure: %v", err)
+			return AppMessage{Type: msg.Type, Body: err.Error()}
+		}
+		log.Printf("reading db as of timestamp %d", tsMsg.Ts)
+		bt, _ := json.Marshal(ReadTsResponse{ReadTs: tsMsg.Ts, MaxVersion: a.db.MaxVersion()})
+		return AppMessage{Type: msg.Type, Body: string(bt)}
+	case TypeVlogFiles:
+		return a.vlogFiles(msg)
+	case TypeGC:
+		return a.runGC(msg)
+	case TypeSafeMode:
+		return a.setSafeMode(msg)
+	case TypeWritePassword:
+		return a.setWritePassword(msg)
+	case TypeUnlockWrites:
+		return a.unlockWrites(msg)
+	case TypeInfo:
+		if !a.db.IsRunning() {
+			log.Printf("db not running for info operation")
+			return AppMessage{Type: msg.Type, Body: NotRunningResponse}
+		}
+		info, err := a.db.Info()
+		if err != nil {
+			log.Printf("getting db info failure: %v", err)
+			return AppMessage{Type: msg.Type, Body: err.Error()}
+		}
+		bt, _ := json.Marshal(info)
+		return AppMessage{Type: msg.Type, Body: string(bt)}
+	case TypeOptions:
+		if !a.db.IsRunning() {
+			log.Printf("db not running for options operation")
+			return AppMessage{Type: msg.Type, Body: NotRunningResponse}
+		}
+		opts, err := a.db.Options()
+		if err != nil {
+			log.Printf("getting db options failure: %v", err)
+			return AppMessage{Type: msg.Type, Body: err.Error()}
+		}
+		bt, _ := json.Marshal(opts)
+		return AppMessage{Type: msg.Type, Body: string(bt)}
+	case TypeReopen:
+		return a.reopen(msg)
+	case TypeRepl:
+		return a.repl(msg)
+	case TypeActions:
+		return a.actions(msg)
+	case TypeMigrate:
+		return a.migrate(msg)
+	case TypeAggregate:
+		return a.aggregate(msg)
+	case TypeSampleStats:
+		return a.sampleStats(msg)
+	case TypeNamespaces:
+		return a.namespaces(msg)
+	case TypeExportKeys:
+		return a.exportKeys(msg)
+	case TypePresets:
+		return a.presets(msg)
+	case TypeTouch:
+		return a.touchKeys(msg)
+	case TypeDuplicate:
+		return a.duplicate(msg)
+	case TypeExportSettings:
+		return a.exportSettings(msg)
+	case TypeImportSettings:
+		return a.importSettings(msg)
+	case TypeHistogram:
+		return a.histogram(msg)
+	case TypeCompression:
+		return a.compressionReport(msg)
+	case TypeWatchExpiry:
+		return a.watchExpiry(msg)
+	case TypePurgeExpired:
+		return a.purgeExpired(msg)
+	case TypeSaveProfile:
+		return a.saveProfile(msg)
+	case TypeDropPrefix:
+		return a.dropPrefix(msg)
+	case TypeJobs:
+		return a.listJobs(msg)
+	case TypeStartJob:
+		return a.startJob(msg)
+	case TypePauseJob:
+		return a.stopJob(msg, JobPaused)
+	case TypeResumeJob:
+		return a.resumeJob(msg)
+	case TypeCancelJob:
+		return a.stopJob(msg, JobCanceled)
+	case TypeWriteBatching:
+		return a.setWriteBatching(msg)
+	case TypeFlushWrites:
+		return a.flushWrites(msg)
+	case TypeActivity:
+		return a.listActivity(msg)
+	case TypeMetrics:
+		return a.metrics(msg)
+	case TypeGlobalSearch:
+		return a.globalSearch(msg)
+	case TypeExportDelta:
+		return a.exportDelta(msg)
+	case TypeGenerate:
+		return a.generate(msg)
+	case TypePaste:
+		return a.paste(msg)
+	case TypeCollisions:
+		return a.renameCollisions(msg)
+	case TypeRetention:
+		return a.setRetention(msg)
+	case TypeRunRetention:
+		return a.runRetention(msg)
+	case TypeValueTemplate:
+		return a.setValueTemplate(msg)
+	case TypeNewValue:
+		return a.newValue(msg)
+	case TypeSchema:
+		return a.setSchema(msg)
+	case TypeHooks:
+		return a.setHooks(msg)
+	case TypeStaging:
+		return a.setStaging(msg)
+	case TypeCommitStaged:
+		return a.commitStaged(msg)
+	case TypeDiscardStaged:
+		return a.discardStaged(msg)
+	case TypeRecentKeys:
+		return a.recentKeys(msg)
+	case TypeOpenKey:
+		return a.setOpenKey(msg)
+	case TypeCapabilities:
+		return a.capabilities(msg)
+	case TypeCompareKey:
+		return a.compareKey(msg)
+	case TypeValueHistory:
+		return a.valueHistoryOf(msg)
+	case TypeRevert:
+		return a.revert(msg)
+	case TypeShareSnapshot:
+		return a.shareSnapshot(msg)
+	case TypeOpenSnapshot:
+		return a.openSnapshot(msg)
+	case TypeRefresh:
+		return a.refresh(msg)
+	case TypeIgnored:
+		return a.setIgnored(msg)
+	case TypeKeyLayout:
+		return a.setKeyLayout(msg)
+	case TypeRenderKey:
+		return a.renderKeyOf(msg)
+	case TypeDecoder:
+		return a.setDecoder(msg)
+	case TypeHexDump:
+		return a.hexDump(msg)
+	case TypeValueSearch:
+		return a.valueSearch(msg)
+	case TypeAdvice:
+		return a.advise(msg)
+	case TypeFlatten:
+		return a.flatten(msg)
+	case TypeSpaceEstimate:
+		return a.spaceEstimate(msg)
+	case TypeVirtual:
+		return a.setVirtual(msg)
+	case TypeUseVirtual:
+		return a.useVirtual(msg)
+	case TypeExport:
+		return a.export(msg)
+	case TypeLabel:
+		return a.labelPrefix(msg)
+	case TypeScope:
+		return a.setScope(msg)
+	case TypeColumns:
+		return a.columns(msg)
+	case TypeTreemap:
+		return a.treemap(msg)
+	case TypeOpenDemo:
+		return a.openDemo(msg)
+	case TypeCrashReports:
+		return a.crashReports(msg)
+	case TypeRevealCrash:
+		return a.revealCrash(msg)
+	case TypeInternalKeys:
+		var internalMsg MessageInternalKeys
+		if err := json.Unmarshal([]byte(msg.Body), &internalMsg); err != nil {
+			log.Printf("unmarshaling internal keys message failure: %v", err)
+			return AppMessage{Type: msg.Type, Body: err.Error()}
+		}
+		a.db.SetShowInternal(internalMsg.Show)
+		log.Printf("internal keys visible [%t]", internalMsg.Show)
+		return AppMessage{Type: msg.Type, Body: OkStatus}
+	case TypeCompactions:
+		bt, _ := json.Marshal(CompactionsResponse{Events: a.db.Compactions()})
+		return AppMessage{Type: msg.Type, Body: string(bt)}
+	case TypeVersions:
+		if !a.db.IsRunning() {
+			log.Printf("db not running for versions operation")
+			return AppMessage{Type: msg.Type, Body: NotRunningResponse}
+		}
+		var versionsMsg MessageGet
+		if err := json.Unmarshal([]byte(msg.Body), &versionsMsg); err != nil {
+			log.Printf("unmarshaling versions message failure: %v", err)
+			return AppMessage{Type: msg.Type, Body: err.Error()}
+		}
+		versionsMsg.Key = a.virtualKey(versionsMsg.Key)
+		versions, err := a.db.Versions(versionsMsg.Key)
+		if err != nil {
+			log.Printf("listing versions failure %s: %v", logKey(versionsMsg.Key), err)
+			return AppMessage{Type: msg.Type, Body: err.Error()}
+		}
+		bt, _ := json.Marshal(VersionsResponse{Key: a.shownKey(versionsMsg.Key), Versions: versions})
+		return AppMessage{Type: msg.Type, Body: string(bt)}
 	default:
 		log.Printf("unsupported message type: %s", msg.Type)
-		return AppMessage{"", UnknownMessageTypeResponse}
+		return AppMessage{Type: "", Body: UnknownMessageTypeResponse}
+	}
+}
+
+// checkedWriteResponse reports the outcome of a write made with an expected
+// version, returning the current value on conflict.
+func (a *App) checkedWriteResponse(t messageType, key string, version uint64, move *StorageMove, err error) AppMessage {
+	if errors.Is(err, database.ErrVersionChanged) {
+		log.Printf("%s of key %s rejected: changed since loaded", t, logKey(key))
+		conflict := ConflictResponse{Status: ConflictStatus, Key: a.shownKey(key), Version: version, Deleted: version == 0}
+		if value, err := a.db.Get(key); err == nil {
+			conflict.Value = string(value)
+		}
+		bt, _ := json.Marshal(conflict)
+		return AppMessage{Type: t, Body: string(bt)}
+	}
+	if err != nil {
+		log.Printf("%s of key %s failure: %v", t, logKey(key), err)
+		return AppMessage{Type: t, Body: err.Error()}
 	}
+	log.Printf("%s of key %s done at version %d", t, logKey(key), version)
+	bt, _ := json.Marshal(WriteResponse{Status: OkStatus, Version: version, StorageMove: move})
+	return AppMessage{Type: t, Body: string(bt)}
 }
 
+// storageMove tells whether writing size bytes to key moves its value across
+// the value threshold, nil when it stays where it is or the key is new.
+func (a *App) storageMove(key string, size int) *StorageMove {
+	meta, err := a.db.Meta(key)
+	if err != nil {
+		return nil
+	}
+	previous, next := a.db.ValueLocation(meta.Size), a.db.ValueLocation(int64(size))
+	if previous == next {
+		return nil
+	}
+	threshold := a.db.ValueThreshold()
+	return &StorageMove{
+		Storage:         next,
+		PreviousStorage: previous,
+		ValueThreshold:  threshold,
+		Warning: fmt.Sprintf(
+			"value moved from %s to %s crossing the %d bytes value threshold, the old copy stays until compaction or value log GC",
+			previous, next, threshold,
+		),
+	}
+}
+
+func (a *App) open(t messageType, openMsg MessageOpen) AppMessage {
+	// badger keeps its own copy of the key, ours is wiped whatever happens
+	defer openMsg.DecryptionKey.Wipe()
+	// \\?\ paths are the same databases as their short forms
+	openMsg.Path, openMsg.ValueDir = database.ShortPath(openMsg.Path), database.ShortPath(openMsg.ValueDir)
+	if pending, ok := a.stagedPending(t, openMsg.Path); ok {
+		return pending
+	}
+	if info, err := os.Stat(database.LongPath(openMsg.Path)); err == nil && !info.IsDir() {
+		return a.openBackupFile(t, openMsg)
+	}
+
+	var profile *config.Profile
+	if !openMsg.NoProfile && openMsg.Path != "" {
+		if p, ok := a.settings.Get().Profile(openMsg.Path); ok {
+			profile = &p
+			openMsg = applyProfile(openMsg, p)
+			log.Printf("applying profile of %s", p.Path)
+		}
+	}
+
+	var keyRotation time.Duration
+	if openMsg.KeyRotation != "" {
+		var err error
+		if keyRotation, err = time.ParseDuration(openMsg.KeyRotation); err != nil {
+			log.Printf("parsing key rotation failure: %v", err)
+			return AppMessage{Type: t, Body: err.Error()}
+		}
+	}
+
+	log.Printf(
+		"opening db at path: [%s], compression: %s, managed: %t",
+		openMsg.Path, openMsg.Compression, openMsg.Managed,
+	)
+	opts := database.OpenOptions{
+		Path:          openMsg.Path,
+		ValueDir:      openMsg.ValueDir,
+		EncryptionKey: openMsg.DecryptionKey,
+		Compression:   openMsg.Compression,
+		Managed:       openMsg.Managed,
+
+		ChecksumMode:        openMsg.ChecksumMode,
+		VerifyValueChecksum: openMsg.VerifyValueChecksum,
+		DetectConflicts:     openMsg.DetectConflicts,
+		SyncWrites:          openMsg.SyncWrites,
+		KeyRotation:         keyRotation,
+		ReadOnly:            openMsg.ReadOnly,
+		CopyFirst:           openMsg.CopyFirst,
+		BlockCacheSize:      openMsg.BlockCacheMB << 20,
+		IndexCacheSize:      openMsg.IndexCacheMB << 20,
+		PageSize:            openMsg.PageSize,
+		PrefetchSize:        openMsg.PrefetchSize,
+		NumCompactors:       openMsg.NumCompactors,
+		GC:                  gcPolicy(openMsg.GC),
+		IgnoredPrefixes:     ignoredPrefixes(profile),
+
+		CompactOnCloseWrites: a.settings.Get().CompactOnCloseThreshold(),
+	}
+	if diagnostic, ok := database.PreflightOpen(opts); !ok {
+		log.Printf("open pre-flight failure: %s, read-only available [%t]", diagnostic.Error, diagnostic.ReadOnlyAvailable)
+		bt, _ := json.Marshal(diagnostic)
+		return AppMessage{Type: t, Body: string(bt)}
+	}
+	warnings := database.CheckStorage(opts)
+	if len(warnings) > 0 && !opts.ReadOnly && !opts.CopyFirst && !openMsg.AcceptStorageWarnings {
+		log.Printf("open held back by %d storage warnings", len(warnings))
+		bt, _ := json.Marshal(StorageWarningResponse{Status: StorageWarningStatus, Warnings: warnings})
+		return AppMessage{Type: t, Body: string(bt)}
+	}
+	for _, w := range warnings {
+		log.Printf("opening despite storage warning: %s", w.Message)
+	}
+	if err := a.db.Open(opts); err != nil {
+		log.Printf("opening db failure: %v", err)
+		// a diagnostic lets users tell a lock from a permission or version
+		// problem without reading badger's error
+		diagnostic := database.DiagnoseOpen(opts, err)
+		log.Printf("open diagnostic: cause %s, hint: %s", diagnostic.Cause, diagnostic.Hint)
+		a.emitError("open", openMsg.Path, err)
+		bt, _ := json.Marshal(diagnostic)
+		return AppMessage{Type: t, Body: string(bt)}
+	}
+	if openMsg.ReadTs != 0 {
+		if err := a.db.SetReadTs(openMsg.ReadTs); err != nil {
+			log.Printf("setting read timestamp failure: %v", err)
+			return AppMessage{Type: t, Body: err.Error()}
+		}
+	}
+
+	lastOpen := openMsg
+	lastOpen.DecryptionKey = nil
+	a.startSession(&lastOpen)
+	a.emitOpened(false)
+
+	log.Printf("db opened with delimiter [%s], in memory [%t]", openMsg.Delimiter, a.db.IsInMemory())
+	degraded := a.db.Degraded()
+	if degraded != nil {
+		log.Printf("db opened degraded, step %d: block cache %s, index cache %s, %d memtables of %s",
+			degraded.Step, formatBytes(degraded.BlockCacheSize), formatBytes(degraded.IndexCacheSize),
+			degraded.NumMemtables, formatBytes(degraded.MemTableSize))
+	}
+	bt, _ := json.Marshal(OpenResponse{
+		Status:     OkStatus,
+		InMemory:   a.db.IsInMemory(),
+		Managed:    a.db.IsManaged(),
+		ReadOnly:   a.db.IsReadOnly(),
+		MaxVersion: a.db.MaxVersion(),
+		PageSize:   a.db.PageSize(),
+		Profile:    profile,
+		Warnings:   warnings,
+		Degraded:   degraded,
+	})
+	return AppMessage{Type: t, Body: string(bt)}
+}
+
+// startSession resets the state kept per connection once a database was
+// opened with lastOpen, and starts watching it. Staged changes survive a
+// reopen of the same database directory.
+func (a *App) startSession(lastOpen *MessageOpen) {
+	a.closeOpenKey()
+	a.mx.Lock()
+	if a.lastOpen == nil || lastOpen.Path == "" || a.lastOpen.Path != lastOpen.Path {
+		a.staging = nil
+	}
+	a.lastOpen = lastOpen
+	a.scope, a.virtual = "", ""
+	a.retentionRuns = nil
+	a.externalWrites = nil
+	a.mx.Unlock()
+	a.activity.reset()
+	a.access.reset()
+	a.history.reset()
+	a.startWatchers()
+}
+
+// close stops the background work before closing the database. Jobs still
+// running are paused at a checkpoint and calls being handled get a moment to
+// return, so no iterator outlives the database.
 func (a *App) close(_ context.Context) {
-	a.db.Close()
+	close(a.done)
+	a.stopHTTPServer()
+	a.stopDebugServer()
+	a.stopAutomation()
+	a.stopJobs(JobPaused)
+	a.waitIdle(shutdownTimeout)
+	a.saveJobs()
+	a.closeDB(ClosedShutdown)
 	log.Println("app closed")
 }
 
+// closeDB stops the watchers and following the key open in the editor, then
+// closes the database, if running, emitting db:closed with reason.
+func (a *App) closeDB(reason string) {
+	a.mx.Lock()
+	if a.stopWatchers != nil {
+		a.stopWatchers()
+		a.stopWatchers = nil
+	}
+	a.mx.Unlock()
+	a.closeOpenKey()
+	if !a.db.IsRunning() {
+		return
+	}
+	a.db.Close()
+	a.emitClosed(reason)
+}
+
 func isImage(data []byte) bool {
 	contentType := http.DetectContentType(data)
 	switch contentType {
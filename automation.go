@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// automationMaxMessage caps a request line, bodies carry whole values
+const automationMaxMessage = 64 << 20
+
+// automationServer serves the Call API on a local socket. Every line a
+// client writes is an AppMessage in JSON, answered with one line holding the
+// response. Calls go through Call, so safe mode, the write password and the
+// metrics apply to them as to the frontend's.
+type automationServer struct {
+	ln   net.Listener
+	path string
+
+	mx    *sync.Mutex
+	conns map[net.Conn]struct{}
+}
+
+// restartAutomation applies the automation settings, stopping the running
+// socket and listening on a new one when enabled. Unix sockets work on
+// Windows 10 and later too, so the same code serves every platform.
+func (a *App) restartAutomation() {
+	a.stopAutomation()
+
+	settings := a.settings.Get()
+	if !settings.Automation.Enabled {
+		return
+	}
+	path, err := settings.AutomationPath()
+	if err != nil {
+		log.Printf("automation socket path failure: %v", err)
+		return
+	}
+	if err := removeStaleSocket(path); err != nil {
+		log.Printf("automation socket failure: %v", err)
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		log.Printf("automation socket failure: %v", err)
+		return
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		log.Printf("automation socket listen failure: %v", err)
+		return
+	}
+	// only the current user may drive the app
+	if err := os.Chmod(path, 0600); err != nil {
+		log.Printf("automation socket permissions failure: %v", err)
+		_ = ln.Close()
+		return
+	}
+
+	srv := &automationServer{
+		ln: ln, path: path, mx: new(sync.Mutex), conns: make(map[net.Conn]struct{}),
+	}
+	go a.serveAutomation(srv)
+
+	a.mx.Lock()
+	a.automation = srv
+	a.mx.Unlock()
+	log.Printf("automation socket listening on %s", path)
+}
+
+func (a *App) stopAutomation() {
+	a.mx.Lock()
+	srv := a.automation
+	a.automation = nil
+	a.mx.Unlock()
+	if srv == nil {
+		return
+	}
+
+	_ = srv.ln.Close()
+	srv.mx.Lock()
+	for conn := range srv.conns {
+		_ = conn.Close()
+	}
+	srv.mx.Unlock()
+	// calls being handled still finish, only their answers are lost. They
+	// aren't waited for since one of them may be the save_settings
+	// restarting the socket.
+	_ = os.Remove(srv.path)
+	log.Printf("automation socket %s closed", srv.path)
+}
+
+func (a *App) serveAutomation(srv *automationServer) {
+	for {
+		conn, err := srv.ln.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				log.Printf("automation socket accept failure: %v", err)
+			}
+			return
+		}
+		srv.mx.Lock()
+		srv.conns[conn] = struct{}{}
+		srv.mx.Unlock()
+		go func() {
+			defer func() {
+				srv.mx.Lock()
+				delete(srv.conns, conn)
+				srv.mx.Unlock()
+				_ = conn.Close()
+			}()
+			a.handleAutomation(conn)
+		}()
+	}
+}
+
+// handleAutomation answers the calls of one client until it disconnects.
+func (a *App) handleAutomation(conn net.Conn) {
+	log.Printf("automation client connected")
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 0, 64<<10), automationMaxMessage)
+	enc := json.NewEncoder(conn)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		var msg AppMessage
+		if err := json.Unmarshal(line, &msg); err != nil {
+			log.Printf("unmarshaling automation message failure: %v", err)
+			if err := enc.Encode(AppMessage{Body: err.Error(), Version: APIVersion}); err != nil {
+				return
+			}
+			continue
+		}
+		if err := enc.Encode(a.Call(msg)); err != nil {
+			log.Printf("automation response failure: %v", err)
+			return
+		}
+	}
+	if err := scanner.Err(); err != nil && !errors.Is(err, net.ErrClosed) {
+		log.Printf("automation client failure: %v", err)
+	}
+	log.Printf("automation client disconnected")
+}
+
+// removeStaleSocket removes a socket file left behind by a crashed instance.
+// Other files at path are never touched, and a socket still answering
+// belongs to a running instance.
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode()&fs.ModeSocket == 0 {
+		return fmt.Errorf("%s exists and isn't a socket", path)
+	}
+	if conn, err := net.Dial("unix", path); err == nil {
+		_ = conn.Close()
+		return fmt.Errorf("%s is in use by another instance", path)
+	}
+	return os.Remove(path)
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/filinvadim/badger-gui/database"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+	"io"
+	"log"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	EventBackupProgress = "backup:progress"
+
+	// backupProgressInterval is the least time between progress events
+	backupProgressInterval = 500 * time.Millisecond
+)
+
+type MessageBackup struct {
+	Path       string `json:"path"`
+	Compress   bool   `json:"compress"`
+	Passphrase string `json:"passphrase"`
+}
+
+type MessageRestore struct {
+	Path       string `json:"path"`
+	Passphrase string `json:"passphrase"`
+	// Dir restores into a new database there instead of the open one, it
+	// must be empty or missing
+	Dir string `json:"dir"`
+	// AcceptLowSpace restores even though the disk may not fit the backup
+	AcceptLowSpace bool `json:"accept_low_space"`
+}
+
+type BackupResponse struct {
+	Status  string `json:"status"`
+	Version uint64 `json:"version"`
+}
+
+// BackupProgressEvent reports a running backup or restore. Total is the size
+// of the backup file for restores and the size of the database for backups,
+// which compressed or skipped stale data make end early.
+type BackupProgressEvent struct {
+	Op    string `json:"op"`
+	Path  string `json:"path"`
+	Bytes int64  `json:"bytes"`
+	Total int64  `json:"total"`
+	Done  bool   `json:"done"`
+}
+
+// backupProgress counts the bytes of a backup file going through it and
+// emits them at most every backupProgressInterval.
+type backupProgress struct {
+	a     *App
+	event BackupProgressEvent
+	bytes *atomic.Int64
+	last  time.Time
+}
+
+func (a *App) newBackupProgress(op, path string, total int64) *backupProgress {
+	return &backupProgress{a: a, event: BackupProgressEvent{Op: op, Path: path, Total: total}, bytes: new(atomic.Int64)}
+}
+
+func (p *backupProgress) add(n int) {
+	p.bytes.Add(int64(n))
+	if time.Since(p.last) < backupProgressInterval {
+		return
+	}
+	p.last = time.Now()
+	p.emit(false)
+}
+
+func (p *backupProgress) emit(done bool) {
+	event := p.event
+	event.Bytes, event.Done = p.bytes.Load(), done
+	runtime.EventsEmit(p.a.ctx, EventBackupProgress, event)
+}
+
+func (p *backupProgress) writer(w io.Writer) io.Writer {
+	return progressWriter{w: w, p: p}
+}
+
+func (p *backupProgress) reader(r io.Reader) io.Reader {
+	return progressReader{r: r, p: p}
+}
+
+type progressWriter struct {
+	w io.Writer
+	p *backupProgress
+}
+
+func (w progressWriter) Write(b []byte) (int, error) {
+	n, err := w.w.Write(b)
+	w.p.add(n)
+	return n, err
+}
+
+type progressReader struct {
+	r io.Reader
+	p *backupProgress
+}
+
+func (r progressReader) Read(b []byte) (int, error) {
+	n, err := r.r.Read(b)
+	r.p.add(n)
+	return n, err
+}
+
+func (a *App) backup(msg AppMessage) AppMessage {
+	if !a.db.IsRunning() {
+		log.Printf("db not running for backup operation")
+		return AppMessage{Type: msg.Type, Body: NotRunningResponse}
+	}
+	var backupMsg MessageBackup
+	if err := json.Unmarshal([]byte(msg.Body), &backupMsg); err != nil {
+		log.Printf("unmarshaling backup message failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+
+	f, err := os.OpenFile(database.LongPath(backupMsg.Path), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		log.Printf("creating backup file failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+	var total int64
+	if info, err := a.db.Info(); err == nil {
+		total = info.LSMSize + info.VlogSize
+	}
+	progress := a.newBackupProgress("backup", backupMsg.Path, total)
+	version, err := a.db.Backup(progress.writer(f), database.BackupOptions{
+		Compress:   backupMsg.Compress,
+		Passphrase: backupMsg.Passphrase,
+	})
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	progress.emit(true)
+	if err != nil {
+		log.Printf("backup failure: %v", err)
+		_ = os.Remove(database.LongPath(backupMsg.Path))
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+	log.Printf("backup written to %s, compressed [%t], encrypted [%t]",
+		backupMsg.Path, backupMsg.Compress, backupMsg.Passphrase != "")
+	bt, _ := json.Marshal(BackupResponse{Status: OkStatus, Version: version})
+	return AppMessage{Type: msg.Type, Body: string(bt)}
+}
+
+func (a *App) restore(msg AppMessage) AppMessage {
+	var restoreMsg MessageRestore
+	if err := json.Unmarshal([]byte(msg.Body), &restoreMsg); err != nil {
+		log.Printf("unmarshaling restore message failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+	if restoreMsg.Dir != "" {
+		return a.restoreDir(msg.Type, restoreMsg)
+	}
+	if !a.db.IsRunning() {
+		log.Printf("db not running for restore operation")
+		return AppMessage{Type: msg.Type, Body: NotRunningResponse}
+	}
+
+	f, err := os.Open(database.LongPath(restoreMsg.Path))
+	if err != nil {
+		log.Printf("opening backup file failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		log.Printf("reading backup file failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+	if held, ok := a.guardSpace(msg.Type, database.SpaceRestore, info.Size(), restoreMsg.AcceptLowSpace); !ok {
+		return held
+	}
+
+	progress := a.newBackupProgress("restore", restoreMsg.Path, info.Size())
+	err = a.db.Restore(progress.reader(f), restoreMsg.Passphrase)
+	progress.emit(true)
+	if err != nil {
+		log.Printf("restore failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+	log.Printf("backup %s restored", restoreMsg.Path)
+	return AppMessage{Type: msg.Type, Body: OkStatus}
+}
+
+// restoreDir restores a backup file into a new database directory, which
+// the frontend then offers to open. No database needs to be open.
+func (a *App) restoreDir(t messageType, restoreMsg MessageRestore) AppMessage {
+	f, err := os.Open(database.LongPath(restoreMsg.Path))
+	if err != nil {
+		log.Printf("opening backup file failure: %v", err)
+		return AppMessage{Type: t, Body: err.Error()}
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		log.Printf("reading backup file failure: %v", err)
+		return AppMessage{Type: t, Body: err.Error()}
+	}
+	estimate, err := database.EstimateRestoreDir(restoreMsg.Dir, info.Size())
+	if held, ok := holdLowSpace(t, estimate, err, restoreMsg.AcceptLowSpace); !ok {
+		return held
+	}
+
+	progress := a.newBackupProgress("restore", restoreMsg.Path, info.Size())
+	err = database.RestoreDir(restoreMsg.Dir, progress.reader(f), restoreMsg.Passphrase)
+	progress.emit(true)
+	if err != nil {
+		log.Printf("restore failure: %v", err)
+		return AppMessage{Type: t, Body: err.Error()}
+	}
+	log.Printf("backup %s restored into %s", restoreMsg.Path, restoreMsg.Dir)
+	return AppMessage{Type: t, Body: OkStatus}
+}
+
+// openBackupFile opens a backup file, or a shared snapshot, given as the path
+// of an open. The backup is restored into a read-only in-memory database, so
+// an archive is inspected without restoring it by hand. Nothing is written
+// to disk.
+func (a *App) openBackupFile(t messageType, openMsg MessageOpen) AppMessage {
+	if isSnapshotFile(openMsg.Path) {
+		return a.openSnapshotFile(t, MessageOpenSnapshot{
+			Path: openMsg.Path, Passphrase: openMsg.Passphrase, Delimiter: openMsg.Delimiter,
+		})
+	}
+
+	f, err := os.Open(database.LongPath(openMsg.Path))
+	if err != nil {
+		log.Printf("opening backup file failure: %v", err)
+		return AppMessage{Type: t, Body: err.Error()}
+	}
+	defer f.Close()
+
+	log.Printf("opening backup file %s in memory", openMsg.Path)
+	err = a.db.OpenBackup(f, openMsg.Passphrase, database.OpenOptions{
+		Compression:    openMsg.Compression,
+		Managed:        openMsg.Managed,
+		BlockCacheSize: openMsg.BlockCacheMB << 20,
+		IndexCacheSize: openMsg.IndexCacheMB << 20,
+		PageSize:       openMsg.PageSize,
+		PrefetchSize:   openMsg.PrefetchSize,
+	})
+	if err != nil {
+		log.Printf("opening backup file failure: %v", err)
+		a.emitError("open", openMsg.Path, err)
+		return AppMessage{Type: t, Body: err.Error()}
+	}
+
+	lastOpen := openMsg
+	lastOpen.DecryptionKey, lastOpen.Passphrase, lastOpen.ReadOnly = nil, "", true
+	a.startSession(&lastOpen)
+	a.emitOpened(false)
+
+	log.Printf("backup file %s opened, read-only", openMsg.Path)
+	bt, _ := json.Marshal(OpenResponse{
+		Status:     OkStatus,
+		InMemory:   true,
+		Managed:    a.db.IsManaged(),
+		ReadOnly:   true,
+		MaxVersion: a.db.MaxVersion(),
+		PageSize:   a.db.PageSize(),
+		Backup:     true,
+	})
+	return AppMessage{Type: t, Body: string(bt)}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/filinvadim/badger-gui/database"
+	"log"
+	"time"
+)
+
+type MessageWriteBatching struct {
+	Enabled bool `json:"enabled"`
+	// MaxEntries and IntervalMs bound how long writes stay buffered,
+	// 1000 entries and one second by default
+	MaxEntries int   `json:"max_entries"`
+	IntervalMs int64 `json:"interval_ms"`
+}
+
+type FlushWritesResponse struct {
+	Status  string `json:"status"`
+	Flushed int    `json:"flushed"`
+}
+
+// setWriteBatching routes the session's sets and deletes through a buffered
+// write batch, trading durability for speed during heavy manual editing.
+// Buffered writes aren't visible to reads until flushed.
+func (a *App) setWriteBatching(msg AppMessage) AppMessage {
+	if !a.db.IsRunning() {
+		log.Printf("db not running for write batching operation")
+		return AppMessage{Type: msg.Type, Body: NotRunningResponse}
+	}
+	var batchMsg MessageWriteBatching
+	if err := json.Unmarshal([]byte(msg.Body), &batchMsg); err != nil {
+		log.Printf("unmarshaling write batching message failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+
+	maxEntries := 0
+	if batchMsg.Enabled {
+		maxEntries = batchMsg.MaxEntries
+		if maxEntries <= 0 {
+			maxEntries = database.DefaultBatchEntries
+		}
+	}
+	interval := time.Duration(batchMsg.IntervalMs) * time.Millisecond
+	if err := a.db.SetBatching(maxEntries, interval); err != nil {
+		log.Printf("setting write batching failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+	status := a.db.Batching()
+	log.Printf("write batching enabled [%t], max entries %d", status.Enabled, status.MaxEntries)
+	bt, _ := json.Marshal(status)
+	return AppMessage{Type: msg.Type, Body: string(bt)}
+}
+
+func (a *App) flushWrites(msg AppMessage) AppMessage {
+	if !a.db.IsRunning() {
+		log.Printf("db not running for flush writes operation")
+		return AppMessage{Type: msg.Type, Body: NotRunningResponse}
+	}
+	flushed, err := a.db.FlushBatch()
+	if err != nil {
+		log.Printf("flushing batched writes failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+	log.Printf("flushed %d batched writes", flushed)
+	bt, _ := json.Marshal(FlushWritesResponse{Status: OkStatus, Flushed: flushed})
+	return AppMessage{Type: msg.Type, Body: string(bt)}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+)
+
+const (
+	// APIVersion is the version of the Call bridge, stamped on every
+	// response. It's bumped when a message changes incompatibly, new message
+	// types and optional fields don't bump it.
+	APIVersion = 1
+	// MinAPIVersion is the oldest version callers may still send
+	MinAPIVersion = 1
+)
+
+// schemaVersions are the body versions of the message types whose request or
+// response changed incompatibly since they were added, the others are at 1.
+var schemaVersions = map[messageType]int{}
+
+// MessageCapability describes a message type the backend handles.
+type MessageCapability struct {
+	Type          messageType `json:"type"`
+	SchemaVersion int         `json:"schema_version"`
+	NeedsDB       bool        `json:"needs_db"`
+	Mutating      bool        `json:"mutating"`
+	Destructive   bool        `json:"destructive"`
+}
+
+type CapabilitiesResponse struct {
+	APIVersion    int                 `json:"api_version"`
+	MinAPIVersion int                 `json:"min_api_version"`
+	Messages      []MessageCapability `json:"messages"`
+}
+
+// unsupportedVersion rejects calls made for an API version this backend
+// doesn't speak. Version 0 is sent by callers predating versioning and is
+// taken as the current one.
+func unsupportedVersion(msg AppMessage) (AppMessage, bool) {
+	if msg.Version == 0 || msg.Version >= MinAPIVersion && msg.Version <= APIVersion {
+		return AppMessage{}, false
+	}
+	log.Printf("%s rejected: API version %d isn't supported", msg.Type, msg.Version)
+	return AppMessage{
+		Type: msg.Type,
+		Body: fmt.Sprintf("API version %d isn't supported, the backend speaks versions %d through %d", msg.Version, MinAPIVersion, APIVersion),
+	}, true
+}
+
+// capabilities lists every message type with its schema version, so the
+// frontend and scripts can adapt to the backend they talk to.
+func (a *App) capabilities(msg AppMessage) AppMessage {
+	resp := CapabilitiesResponse{
+		APIVersion:    APIVersion,
+		MinAPIVersion: MinAPIVersion,
+		Messages:      make([]MessageCapability, 0, len(actionRegistry)),
+	}
+	for _, action := range actionRegistry {
+		capability := MessageCapability{Type: action.Type, SchemaVersion: 1, NeedsDB: action.NeedsDB}
+		if v, ok := schemaVersions[action.Type]; ok {
+			capability.SchemaVersion = v
+		}
+		_, capability.Mutating = mutatingTypes[action.Type]
+		_, capability.Destructive = destructiveTypes[action.Type]
+		resp.Messages = append(resp.Messages, capability)
+	}
+	bt, _ := json.Marshal(resp)
+	return AppMessage{Type: msg.Type, Body: string(bt)}
+}
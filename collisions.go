@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/filinvadim/badger-gui/database"
+	"log"
+	"regexp"
+	"strings"
+)
+
+const (
+	defaultCollisionsLimit = 100
+
+	// CollisionExisting is a target key that exists outside the renamed keys
+	// and would be overwritten
+	CollisionExisting = "existing"
+	// CollisionSource is a target key that is itself renamed, what ends up
+	// under it depends on the order the keys are written in
+	CollisionSource = "source"
+)
+
+type MessageRenameCollisions struct {
+	// Prefix, To and Match are as in a rename_prefix migration step
+	Prefix string `json:"prefix"`
+	To     string `json:"to"`
+	Match  string `json:"match"`
+	// Limit caps the collisions listed, 100 by default, all are counted
+	Limit int `json:"limit"`
+}
+
+type RenameCollision struct {
+	Key    string `json:"key"`
+	Target string `json:"target"`
+	Kind   string `json:"kind"`
+}
+
+type RenameCollisionsResponse struct {
+	// Renamed is the number of keys the rename would move
+	Renamed    int               `json:"renamed"`
+	Total      int               `json:"total"`
+	Collisions []RenameCollision `json:"collisions"`
+}
+
+// renameCollisions reports the keys a rename of one prefix into another
+// would clash with, to check before running the rename.
+func (a *App) renameCollisions(msg AppMessage) AppMessage {
+	if !a.db.IsRunning() {
+		log.Printf("db not running for rename collisions operation")
+		return AppMessage{Type: msg.Type, Body: NotRunningResponse}
+	}
+	var collisionsMsg MessageRenameCollisions
+	if err := json.Unmarshal([]byte(msg.Body), &collisionsMsg); err != nil {
+		log.Printf("unmarshaling rename collisions message failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+	if collisionsMsg.Prefix == "" {
+		return AppMessage{Type: msg.Type, Body: "rename_prefix needs a prefix"}
+	}
+	if collisionsMsg.Limit <= 0 {
+		collisionsMsg.Limit = defaultCollisionsLimit
+	}
+	step := MigrationStep{
+		Op: opRenamePrefix, Prefix: a.scoped(collisionsMsg.Prefix), To: a.scoped(collisionsMsg.To), Match: collisionsMsg.Match,
+	}
+	resp, err := findRenameCollisions(a.db, step, collisionsMsg.Limit)
+	if err != nil {
+		log.Printf("checking rename collisions failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+	log.Printf("renaming %d keys from [%s] to [%s] collides %d times", resp.Renamed, logKey(step.Prefix), logKey(step.To), resp.Total)
+	bt, _ := json.Marshal(resp)
+	return AppMessage{Type: msg.Type, Body: string(bt)}
+}
+
+// findRenameCollisions walks the keys a rename_prefix step would move and
+// looks up the key each would get, listing up to limit collisions or all of
+// them when limit isn't positive.
+func findRenameCollisions(db Storer, step MigrationStep, limit int) (resp RenameCollisionsResponse, err error) {
+	var match *regexp.Regexp
+	if step.Match != "" {
+		if match, err = regexp.Compile(step.Match); err != nil {
+			return resp, err
+		}
+	}
+	renamed := func(key string) bool {
+		return strings.HasPrefix(key, step.Prefix) && (match == nil || match.MatchString(key))
+	}
+
+	resp.Collisions = []RenameCollision{}
+	err = db.WalkAllKeys(step.Prefix, func(meta database.KeyMeta) error {
+		if !renamed(meta.Key) {
+			return nil
+		}
+		resp.Renamed++
+		target := step.To + strings.TrimPrefix(meta.Key, step.Prefix)
+		if target == meta.Key {
+			return nil
+		}
+		_, err := db.Meta(target)
+		if errors.Is(err, database.ErrKeyNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		kind := CollisionExisting
+		if renamed(target) {
+			kind = CollisionSource
+		}
+		resp.Total++
+		if limit <= 0 || len(resp.Collisions) < limit {
+			resp.Collisions = append(resp.Collisions, RenameCollision{Key: meta.Key, Target: target, Kind: kind})
+		}
+		return nil
+	})
+	return resp, err
+}
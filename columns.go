@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/filinvadim/badger-gui/database"
+	"log"
+	"sort"
+)
+
+const (
+	defaultColumnsLimit = 100
+	maxColumnsLimit     = 1000
+)
+
+var errPageFull = errors.New("page full")
+
+type MessageColumns struct {
+	Prefix string `json:"prefix"`
+	// Fields are dotted JSON paths, array elements by index as in
+	// items.0.sku. Empty takes the top-level fields of the page's values.
+	Fields []string `json:"fields"`
+	// Limit is the page size, 100 by default and 1000 at most
+	Limit int `json:"limit"`
+	// Cursor is the cursor of the previous page
+	Cursor string `json:"cursor"`
+}
+
+type ColumnsRow struct {
+	Key string `json:"key"`
+	// Values line up with the columns, missing fields are null
+	Values []any `json:"values"`
+	// Invalid is set when the value isn't JSON
+	Invalid bool `json:"invalid,omitempty"`
+}
+
+type ColumnsResponse struct {
+	Columns []string     `json:"columns"`
+	Rows    []ColumnsRow `json:"rows"`
+	// Cursor fetches the next page, empty on the last one
+	Cursor string `json:"cursor"`
+}
+
+// columns renders the JSON values under a prefix as a table, one row per key
+// with the chosen fields extracted, so records sharing a schema can be
+// browsed side by side.
+func (a *App) columns(msg AppMessage) AppMessage {
+	if !a.db.IsRunning() {
+		log.Printf("db not running for columns operation")
+		return AppMessage{Type: msg.Type, Body: NotRunningResponse}
+	}
+	var columnsMsg MessageColumns
+	if err := json.Unmarshal([]byte(msg.Body), &columnsMsg); err != nil {
+		log.Printf("unmarshaling columns message failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+	columnsMsg.Prefix = a.scoped(columnsMsg.Prefix)
+	limit := columnsMsg.Limit
+	if limit <= 0 {
+		limit = defaultColumnsLimit
+	}
+	limit = min(limit, maxColumnsLimit)
+
+	// one key past the page tells whether there's a next one
+	keys := make([]string, 0, limit+1)
+	err := a.db.WalkKeysFrom(columnsMsg.Prefix, columnsMsg.Cursor, func(meta database.KeyMeta) error {
+		keys = append(keys, meta.Key)
+		if len(keys) > limit {
+			return errPageFull
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errPageFull) {
+		log.Printf("listing columns keys failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+	resp := ColumnsResponse{Columns: columnsMsg.Fields, Rows: make([]ColumnsRow, 0, len(keys))}
+	if len(keys) > limit {
+		keys = keys[:limit]
+		resp.Cursor = keys[limit-1]
+	}
+
+	// docs line up with the rows
+	docs := make([]any, 0, len(keys))
+	for _, key := range keys {
+		value, err := a.db.Get(key)
+		if errors.Is(err, database.ErrKeyNotFound) {
+			// deleted since it was listed
+			continue
+		}
+		if err != nil {
+			log.Printf("reading columns value failure: %v", err)
+			return AppMessage{Type: msg.Type, Body: err.Error()}
+		}
+		var doc any
+		dec := json.NewDecoder(bytes.NewReader(value))
+		dec.UseNumber()
+		invalid := !json.Valid(value) || dec.Decode(&doc) != nil
+		resp.Rows = append(resp.Rows, ColumnsRow{Key: key, Invalid: invalid})
+		docs = append(docs, doc)
+	}
+	if len(resp.Columns) == 0 {
+		resp.Columns = topLevelFields(docs)
+	}
+	for i := range resp.Rows {
+		resp.Rows[i].Values = make([]any, len(resp.Columns))
+		if resp.Rows[i].Invalid {
+			continue
+		}
+		for j, field := range resp.Columns {
+			resp.Rows[i].Values[j], _ = jsonPath(docs[i], field)
+		}
+	}
+
+	log.Printf("extracted %d columns from %d rows", len(resp.Columns), len(resp.Rows))
+	bt, _ := json.Marshal(resp)
+	return AppMessage{Type: msg.Type, Body: string(bt)}
+}
+
+// topLevelFields returns the fields of the object documents in order of
+// first appearance, each object's own fields sorted.
+func topLevelFields(docs []any) []string {
+	fields := []string{}
+	seen := make(map[string]struct{})
+	for _, doc := range docs {
+		obj, ok := doc.(map[string]any)
+		if !ok {
+			continue
+		}
+		names := make([]string, 0, len(obj))
+		for name := range obj {
+			if _, ok := seen[name]; !ok {
+				names = append(names, name)
+				seen[name] = struct{}{}
+			}
+		}
+		sort.Strings(names)
+		fields = append(fields, names...)
+	}
+	return fields
+}
@@ -0,0 +1,330 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/filinvadim/badger-gui/database"
+	"log"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	defaultCompareContext = 3
+	// maxCompareDiffSize is the largest value rendered in a diff, bigger
+	// values are compared by hash only
+	maxCompareDiffSize = 256 << 10
+	// maxCompareDiffCells caps the LCS table of the differing lines, beyond
+	// it the whole middle is shown as replaced
+	maxCompareDiffCells = 4 << 20
+)
+
+type MessageCompareKey struct {
+	Key string `json:"key"`
+	// ID is the row ID of the key, for binary keys
+	ID string `json:"id"`
+	// Left is the database directory of the left side, the open database
+	// when empty
+	Left string `json:"left"`
+	// Right is the database directory the key is compared against
+	Right string `json:"right"`
+	// Context is the number of unchanged lines around each hunk, 3 by default
+	Context *int `json:"context"`
+}
+
+type CompareSide struct {
+	// Path is the database, empty for an in-memory connection
+	Path    string `json:"path"`
+	Found   bool   `json:"found"`
+	Size    int    `json:"size"`
+	SHA256  string `json:"sha256,omitempty"`
+	Version uint64 `json:"version,omitempty"`
+
+	value []byte
+}
+
+type CompareKeyResponse struct {
+	Key   string      `json:"key"`
+	Equal bool        `json:"equal"`
+	Left  CompareSide `json:"left"`
+	Right CompareSide `json:"right"`
+	// Binary is set when a value isn't text, Diff is empty then and
+	// FirstDifference is the offset of the first differing byte
+	Binary          bool `json:"binary,omitempty"`
+	FirstDifference *int `json:"first_difference,omitempty"`
+	// Diff is a unified diff of the values, JSON values indented first
+	Diff string `json:"diff,omitempty"`
+	// TooLarge is set when a value exceeds the diff size and only the hashes
+	// were compared
+	TooLarge bool `json:"too_large,omitempty"`
+}
+
+// compareKey fetches a key from two databases and reports whether the values
+// match, with their hashes, sizes and a diff, for checking a replica or a
+// restored backup against its source. Values are hashed while read, so big
+// ones are never copied.
+func (a *App) compareKey(msg AppMessage) AppMessage {
+	var compareMsg MessageCompareKey
+	if err := json.Unmarshal([]byte(msg.Body), &compareMsg); err != nil {
+		log.Printf("unmarshaling compare key message failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+	if compareMsg.ID != "" {
+		keys, err := keysOf([]string{compareMsg.ID})
+		if err != nil {
+			return AppMessage{Type: msg.Type, Body: err.Error()}
+		}
+		compareMsg.Key = keys[0]
+	}
+	if compareMsg.Key == "" {
+		return AppMessage{Type: msg.Type, Body: "key is required"}
+	}
+	if compareMsg.Right == "" {
+		return AppMessage{Type: msg.Type, Body: "right database is required"}
+	}
+	context := defaultCompareContext
+	if compareMsg.Context != nil && *compareMsg.Context >= 0 {
+		context = *compareMsg.Context
+	}
+
+	resp := CompareKeyResponse{Key: compareMsg.Key}
+	var err error
+	if compareMsg.Left == "" {
+		if !a.db.IsRunning() {
+			return AppMessage{Type: msg.Type, Body: NotRunningResponse}
+		}
+		resp.Left, err = readCompareSide(a.db, a.openPath(), compareMsg.Key)
+	} else {
+		resp.Left, err = a.readOtherSide(compareMsg.Left, compareMsg.Key)
+	}
+	if err != nil {
+		log.Printf("compare key failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+	resp.Right, err = a.readOtherSide(compareMsg.Right, compareMsg.Key)
+	if err != nil {
+		log.Printf("compare key failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+
+	resp.Equal = resp.Left.Found == resp.Right.Found && resp.Left.SHA256 == resp.Right.SHA256
+	switch {
+	case resp.Equal:
+	case resp.Left.Size > maxCompareDiffSize || resp.Right.Size > maxCompareDiffSize:
+		resp.TooLarge = true
+	case !utf8.Valid(resp.Left.value) || !utf8.Valid(resp.Right.value):
+		resp.Binary = true
+		offset := firstDifference(resp.Left.value, resp.Right.value)
+		resp.FirstDifference = &offset
+	default:
+		resp.Diff = unifiedDiff(
+			diffLines(resp.Left.value), diffLines(resp.Right.value),
+			sideName(resp.Left.Path, "left"), sideName(resp.Right.Path, "right"), context,
+		)
+	}
+	log.Printf("key %s compared between %s and %s, equal: %v", logKey(compareMsg.Key), resp.Left.Path, resp.Right.Path, resp.Equal)
+	bt, _ := json.Marshal(resp)
+	return AppMessage{Type: msg.Type, Body: string(bt)}
+}
+
+// readOtherSide reads the key from a database other than the open one,
+// opened read-only like for a global search.
+func (a *App) readOtherSide(path, key string) (CompareSide, error) {
+	path = filepath.Clean(path)
+	if openPath := a.openPath(); a.db.IsRunning() && openPath != "" && path == filepath.Clean(openPath) {
+		return readCompareSide(a.db, openPath, key)
+	}
+	profile, _ := a.settings.Get().Profile(path)
+	db, failure := openForSearch(path, profile.ValueDir)
+	if failure != nil {
+		return CompareSide{}, fmt.Errorf("opening %s: %s", path, failure.Error)
+	}
+	defer db.Close()
+	return readCompareSide(db, path, key)
+}
+
+// readCompareSide hashes the value of key, keeping a copy only when it's
+// small enough to be diffed.
+func readCompareSide(db Storer, path, key string) (CompareSide, error) {
+	side := CompareSide{Path: path}
+	err := db.ViewValue(key, func(value []byte, version uint64) error {
+		sum := sha256.Sum256(value)
+		side.Found = true
+		side.Size = len(value)
+		side.SHA256 = hex.EncodeToString(sum[:])
+		side.Version = version
+		if len(value) <= maxCompareDiffSize {
+			side.value = bytes.Clone(value)
+		}
+		return nil
+	})
+	if errors.Is(err, database.ErrKeyNotFound) {
+		return side, nil
+	}
+	return side, err
+}
+
+func sideName(path, fallback string) string {
+	if path == "" {
+		return fallback
+	}
+	return path
+}
+
+func firstDifference(a, b []byte) int {
+	n := min(len(a), len(b))
+	for i := 0; i < n; i++ {
+		if a[i] != b[i] {
+			return i
+		}
+	}
+	return n
+}
+
+// diffLines splits a value into lines, indenting JSON first so a one-line
+// document diffs by field.
+func diffLines(value []byte) []string {
+	if len(value) == 0 {
+		return nil
+	}
+	var indented bytes.Buffer
+	if json.Valid(value) && json.Indent(&indented, value, "", "  ") == nil {
+		value = indented.Bytes()
+	}
+	return strings.Split(strings.TrimSuffix(string(value), "\n"), "\n")
+}
+
+type diffOp struct {
+	kind byte // ' ', '-' or '+'
+	line string
+}
+
+// unifiedDiff renders the differences of a and b in the unified format with
+// context lines around each hunk.
+func unifiedDiff(a, b []string, aName, bName string, context int) string {
+	ops := diffOps(a, b)
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", aName, bName)
+	for i := 0; i < len(ops); {
+		if ops[i].kind == ' ' {
+			i++
+			continue
+		}
+		// a hunk runs from context lines before the change to context lines
+		// after the last change closer than twice the context
+		start := max(0, i-context)
+		end := i
+		for j := i; j < len(ops); j++ {
+			if ops[j].kind != ' ' {
+				end = j
+			} else if j-end > 2*context {
+				break
+			}
+		}
+		end = min(len(ops), end+context+1)
+
+		aStart, bStart := 1, 1
+		for _, op := range ops[:start] {
+			if op.kind != '+' {
+				aStart++
+			}
+			if op.kind != '-' {
+				bStart++
+			}
+		}
+		var aCount, bCount int
+		for _, op := range ops[start:end] {
+			if op.kind != '+' {
+				aCount++
+			}
+			if op.kind != '-' {
+				bCount++
+			}
+		}
+		// an empty range names the line before it
+		if aCount == 0 {
+			aStart--
+		}
+		if bCount == 0 {
+			bStart--
+		}
+		fmt.Fprintf(&out, "@@ -%d,%d +%d,%d @@\n", aStart, aCount, bStart, bCount)
+		for _, op := range ops[start:end] {
+			out.WriteByte(op.kind)
+			out.WriteString(op.line)
+			out.WriteByte('\n')
+		}
+		i = end
+	}
+	return out.String()
+}
+
+// diffOps is the edit script turning a into b, from the longest common
+// subsequence of the lines between their common prefix and suffix.
+func diffOps(a, b []string) []diffOp {
+	var prefix, suffix int
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	ops := make([]diffOp, 0, len(a)+len(b))
+	for _, line := range a[:prefix] {
+		ops = append(ops, diffOp{' ', line})
+	}
+	ma, mb := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+	if len(ma)*len(mb) > maxCompareDiffCells {
+		for _, line := range ma {
+			ops = append(ops, diffOp{'-', line})
+		}
+		for _, line := range mb {
+			ops = append(ops, diffOp{'+', line})
+		}
+	} else {
+		// lcs[i][j] is the LCS length of ma[i:] and mb[j:]
+		w := len(mb) + 1
+		lcs := make([]int32, (len(ma)+1)*w)
+		for i := len(ma) - 1; i >= 0; i-- {
+			for j := len(mb) - 1; j >= 0; j-- {
+				if ma[i] == mb[j] {
+					lcs[i*w+j] = lcs[(i+1)*w+j+1] + 1
+				} else {
+					lcs[i*w+j] = max(lcs[(i+1)*w+j], lcs[i*w+j+1])
+				}
+			}
+		}
+		i, j := 0, 0
+		for i < len(ma) && j < len(mb) {
+			switch {
+			case ma[i] == mb[j]:
+				ops = append(ops, diffOp{' ', ma[i]})
+				i++
+				j++
+			case lcs[(i+1)*w+j] >= lcs[i*w+j+1]:
+				ops = append(ops, diffOp{'-', ma[i]})
+				i++
+			default:
+				ops = append(ops, diffOp{'+', mb[j]})
+				j++
+			}
+		}
+		for ; i < len(ma); i++ {
+			ops = append(ops, diffOp{'-', ma[i]})
+		}
+		for ; j < len(mb); j++ {
+			ops = append(ops, diffOp{'+', mb[j]})
+		}
+	}
+	for _, line := range a[len(a)-suffix:] {
+		ops = append(ops, diffOp{' ', line})
+	}
+	return ops
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/filinvadim/badger-gui/database"
+	"log"
+)
+
+type MessageCompression struct {
+	// Delimiter defaults to the one the database was opened with
+	Delimiter string `json:"delimiter"`
+}
+
+type CompressionResponse struct {
+	Compression string                     `json:"compression"`
+	Namespaces  []database.CompressionStat `json:"namespaces"`
+	Total       database.CompressionStat   `json:"total"`
+}
+
+func (a *App) compressionReport(msg AppMessage) AppMessage {
+	if !a.db.IsRunning() {
+		log.Printf("db not running for compression operation")
+		return AppMessage{Type: msg.Type, Body: NotRunningResponse}
+	}
+	var compMsg MessageCompression
+	if msg.Body != "" {
+		if err := json.Unmarshal([]byte(msg.Body), &compMsg); err != nil {
+			log.Printf("unmarshaling compression message failure: %v", err)
+			return AppMessage{Type: msg.Type, Body: err.Error()}
+		}
+	}
+	if compMsg.Delimiter == "" {
+		compMsg.Delimiter = a.delimiter()
+	}
+
+	stats, total, err := a.db.CompressionByNamespace(compMsg.Delimiter)
+	if err != nil {
+		log.Printf("compression report failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+	total.Namespace = ""
+	log.Printf("compression ratio %.2f over %d tables", total.Ratio, total.Tables)
+	bt, _ := json.Marshal(CompressionResponse{
+		Compression: a.db.Compression(), Namespaces: stats, Total: total,
+	})
+	return AppMessage{Type: msg.Type, Body: string(bt)}
+}
@@ -0,0 +1,43 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+const bundleVersion = 1
+
+// Bundle is a portable copy of the working configuration shared between
+// machines. Secrets stay behind: the write password hash and the keychain
+// entries are never exported.
+type Bundle struct {
+	Version    int       `json:"version"`
+	ExportedAt time.Time `json:"exported_at"`
+	Settings   Settings  `json:"settings"`
+}
+
+// Export writes the current configuration as a bundle.
+func (s *Store) Export(w io.Writer) error {
+	bundle := Bundle{Version: bundleVersion, ExportedAt: time.Now().UTC(), Settings: s.Get()}
+	bundle.Settings.WritePasswordHash = ""
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(bundle)
+}
+
+// Import replaces the configuration with the one from a bundle, keeping the
+// local write password.
+func (s *Store) Import(r io.Reader) error {
+	var bundle Bundle
+	if err := json.NewDecoder(r).Decode(&bundle); err != nil {
+		return err
+	}
+	if bundle.Version < 1 || bundle.Version > bundleVersion {
+		return fmt.Errorf("unsupported settings bundle version %d", bundle.Version)
+	}
+	bundle.Settings.WritePasswordHash = s.Get().WritePasswordHash
+	return s.Update(bundle.Settings)
+}
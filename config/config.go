@@ -0,0 +1,222 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const (
+	appDirName       = "badger-gui"
+	settingsFileName = "settings.json"
+
+	defaultCompactOnCloseWrites = 1000
+	defaultHTTPAddr             = "127.0.0.1:8765"
+	defaultDebugAddr            = "127.0.0.1:6060"
+	defaultLogLevel             = "info"
+	automationSocketName        = "automation.sock"
+)
+
+type S3Settings struct {
+	Endpoint     string `json:"endpoint"`
+	Region       string `json:"region"`
+	Bucket       string `json:"bucket"`
+	Prefix       string `json:"prefix"`
+	UsePathStyle bool   `json:"use_path_style"`
+}
+
+// HTTPSettings configure the embedded HTTP server for external consumers.
+type HTTPSettings struct {
+	Enabled bool   `json:"enabled"`
+	Addr    string `json:"addr"`
+}
+
+// DebugSettings configure the pprof and expvar server used to profile the
+// app itself. It's off by default and only listens on loopback addresses.
+type DebugSettings struct {
+	Enabled bool   `json:"enabled"`
+	Addr    string `json:"addr"`
+	// LogLevel is how keys are logged: info hashes them, debug truncates
+	// them and trace logs them in full. Values are never logged.
+	LogLevel string `json:"log_level"`
+}
+
+// AutomationSettings configure the local socket scripts and test harnesses
+// drive the running app through, with the same messages as Call. It's off by
+// default and only the current user can connect.
+type AutomationSettings struct {
+	Enabled bool `json:"enabled"`
+	// Path is the socket file, automation.sock in the config directory by
+	// default
+	Path string `json:"path"`
+}
+
+// Webhook is fired with an HTTP POST whenever a key under Prefix changes.
+// Template is a text/template rendered with the change as the request body,
+// empty sends the change as JSON.
+type Webhook struct {
+	Prefix   string `json:"prefix"`
+	URL      string `json:"url"`
+	Template string `json:"template"`
+}
+
+// Bookmark points at a key or prefix of a database for quick navigation.
+type Bookmark struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+	Key  string `json:"key"`
+}
+
+// SavedQuery is a named search the frontend can replay.
+type SavedQuery struct {
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+	Prefix string `json:"prefix"`
+	// Body is the message body sent with Type, kept verbatim
+	Body string `json:"body"`
+}
+
+// Settings are persisted as JSON in the user config directory. Secrets are
+// never stored here, see keychain.go.
+type Settings struct {
+	S3       S3Settings    `json:"s3"`
+	Webhooks []Webhook     `json:"webhooks"`
+	HTTP     HTTPSettings  `json:"http"`
+	Debug    DebugSettings `json:"debug"`
+	// Automation is the local socket exposing the Call API
+	Automation AutomationSettings `json:"automation"`
+
+	Bookmarks    []Bookmark   `json:"bookmarks"`
+	SavedQueries []SavedQuery `json:"saved_queries"`
+	// Profiles are per-database defaults applied on open, see Profile
+	Profiles []Profile `json:"profiles"`
+	// IdleTimeoutMinutes closes the database after that long without
+	// activity, zero disables auto-close
+	IdleTimeoutMinutes int `json:"idle_timeout_minutes"`
+	// CompactOnClose flattens and garbage collects a database on close once
+	// at least CompactOnCloseWrites writes (default 1000) were made
+	CompactOnClose       bool `json:"compact_on_close"`
+	CompactOnCloseWrites int  `json:"compact_on_close_writes"`
+	// WritePasswordHash protects destructive operations, see HashPassword
+	WritePasswordHash string `json:"write_password_hash,omitempty"`
+}
+
+type Store struct {
+	mx       *sync.RWMutex
+	path     string
+	settings Settings
+}
+
+// Dir returns the directory of the app in the user config directory.
+func Dir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, appDirName), nil
+}
+
+// Load reads the settings file from the user config directory. A missing file
+// yields default settings.
+func Load() (*Store, error) {
+	dir, err := Dir()
+	if err != nil {
+		return nil, err
+	}
+	s := &Store{
+		mx:   new(sync.RWMutex),
+		path: filepath.Join(dir, settingsFileName),
+	}
+
+	bt, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(bt, &s.settings); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// CompactOnCloseThreshold returns the write count after which a database is
+// compacted on close, zero when the option is off.
+func (s Settings) CompactOnCloseThreshold() int {
+	if !s.CompactOnClose {
+		return 0
+	}
+	if s.CompactOnCloseWrites <= 0 {
+		return defaultCompactOnCloseWrites
+	}
+	return s.CompactOnCloseWrites
+}
+
+// HTTPAddr returns the embedded server address, 127.0.0.1:8765 by default.
+func (s Settings) HTTPAddr() string {
+	if s.HTTP.Addr == "" {
+		return defaultHTTPAddr
+	}
+	return s.HTTP.Addr
+}
+
+// DebugAddr returns the debug server address, 127.0.0.1:6060 by default.
+func (s Settings) DebugAddr() string {
+	if s.Debug.Addr == "" {
+		return defaultDebugAddr
+	}
+	return s.Debug.Addr
+}
+
+// LogLevel returns the log level, info by default.
+func (s Settings) LogLevel() string {
+	if s.Debug.LogLevel == "" {
+		return defaultLogLevel
+	}
+	return s.Debug.LogLevel
+}
+
+// AutomationPath returns the automation socket path, automation.sock in the
+// config directory by default.
+func (s Settings) AutomationPath() (string, error) {
+	if s.Automation.Path != "" {
+		return s.Automation.Path, nil
+	}
+	dir, err := Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, automationSocketName), nil
+}
+
+func (s *Store) Get() Settings {
+	s.mx.RLock()
+	defer s.mx.RUnlock()
+	return s.settings
+}
+
+// Update replaces the settings and writes them to disk.
+func (s *Store) Update(settings Settings) error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	bt, err := json.MarshalIndent(settings, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, bt, 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return err
+	}
+	s.settings = settings
+	return nil
+}
@@ -0,0 +1,79 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+const keychainService = "badger-gui"
+
+const (
+	KeyS3AccessKeyID     = "s3-access-key-id"
+	KeyS3SecretAccessKey = "s3-secret-access-key"
+)
+
+var ErrSecretNotFound = errors.New("secret not found in keychain")
+
+// SetSecret stores a secret in the OS keychain: Secret Service on Linux,
+// the login keychain on macOS and Credential Manager on Windows.
+func SetSecret(name, secret string) error {
+	switch runtime.GOOS {
+	case "linux":
+		cmd := exec.Command(
+			"secret-tool", "store", "--label", keychainService+" "+name,
+			"service", keychainService, "account", name,
+		)
+		cmd.Stdin = strings.NewReader(secret)
+		return runKeychainCmd(cmd)
+	case "darwin":
+		// a bare -w last prompts for the secret, so it's read from stdin
+		// instead of showing up in the process list; the prompt asks twice
+		cmd := exec.Command(
+			"security", "add-generic-password", "-U",
+			"-s", keychainService, "-a", name, "-w",
+		)
+		cmd.Stdin = strings.NewReader(secret + "\n" + secret + "\n")
+		return runKeychainCmd(cmd)
+	default:
+		return setCredential(keychainService+":"+name, secret)
+	}
+}
+
+// GetSecret reads a secret from the OS keychain.
+func GetSecret(name string) (string, error) {
+	switch runtime.GOOS {
+	case "linux":
+		out, err := exec.Command(
+			"secret-tool", "lookup", "service", keychainService, "account", name,
+		).Output()
+		if err != nil || len(out) == 0 {
+			return "", ErrSecretNotFound
+		}
+		return string(out), nil
+	case "darwin":
+		out, err := exec.Command(
+			"security", "find-generic-password", "-s", keychainService, "-a", name, "-w",
+		).Output()
+		if err != nil {
+			return "", ErrSecretNotFound
+		}
+		return strings.TrimSuffix(string(out), "\n"), nil
+	default:
+		return getCredential(keychainService + ":" + name)
+	}
+}
+
+func runKeychainCmd(cmd *exec.Cmd) error {
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return errors.New("keychain: " + msg)
+		}
+		return errors.New("keychain: " + err.Error())
+	}
+	return nil
+}
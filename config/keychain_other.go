@@ -0,0 +1,15 @@
+//go:build !windows
+
+package config
+
+import "errors"
+
+var errKeychainUnsupported = errors.New("keychain is not supported on this platform")
+
+func setCredential(_, _ string) error {
+	return errKeychainUnsupported
+}
+
+func getCredential(_ string) (string, error) {
+	return "", errKeychainUnsupported
+}
@@ -0,0 +1,52 @@
+package config
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"strings"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	passwordScheme  = "scrypt"
+	passwordSaltLen = 16
+	passwordKeyLen  = 32
+)
+
+var ErrMalformedHash = errors.New("malformed password hash")
+
+// HashPassword derives a storable "scrypt$salt$hash" string.
+func HashPassword(password string) (string, error) {
+	salt := make([]byte, passwordSaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key, err := scrypt.Key([]byte(password), salt, 1<<15, 8, 1, passwordKeyLen)
+	if err != nil {
+		return "", err
+	}
+	return strings.Join([]string{passwordScheme, hex.EncodeToString(salt), hex.EncodeToString(key)}, "$"), nil
+}
+
+func VerifyPassword(password, hash string) (bool, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 3 || parts[0] != passwordScheme {
+		return false, ErrMalformedHash
+	}
+	salt, err := hex.DecodeString(parts[1])
+	if err != nil {
+		return false, ErrMalformedHash
+	}
+	expected, err := hex.DecodeString(parts[2])
+	if err != nil {
+		return false, ErrMalformedHash
+	}
+	key, err := scrypt.Key([]byte(password), salt, 1<<15, 8, 1, len(expected))
+	if err != nil {
+		return false, err
+	}
+	return subtle.ConstantTimeCompare(key, expected) == 1, nil
+}
@@ -0,0 +1,291 @@
+package config
+
+import (
+	"encoding/json"
+	"path/filepath"
+)
+
+// Profile holds the per-database defaults applied whenever the database at
+// Path is opened, so a known database opens without any configuration.
+type Profile struct {
+	Path string `json:"path"`
+	// ValueDir is the value log directory when it's apart from Path
+	ValueDir    string `json:"value_dir,omitempty"`
+	Delimiter   string `json:"delimiter"`
+	Compression string `json:"compression"`
+	ReadOnly    bool   `json:"read_only"`
+	// Decoder hints how values should be rendered, see the presets
+	Decoder string `json:"decoder"`
+	// Decoders override Decoder for the values under a prefix, by prefix
+	Decoders map[string]string `json:"decoders,omitempty"`
+	// BlockCacheMB and IndexCacheMB override badger's cache sizes, zero
+	// keeps the defaults
+	BlockCacheMB  int64  `json:"block_cache_mb"`
+	IndexCacheMB  int64  `json:"index_cache_mb"`
+	DefaultPrefix string `json:"default_prefix"`
+	// PageSize is how many keys a page lists and PrefetchSize how many values
+	// iterators fetch ahead, zero keeps the defaults of 20 and 10
+	PageSize     int `json:"page_size,omitempty"`
+	PrefetchSize int `json:"prefetch_size,omitempty"`
+	// NumCompactors is how many compactions badger runs at once, zero keeps
+	// the default of 2
+	NumCompactors int `json:"num_compactors,omitempty"`
+	// GC is the periodic value log GC of the database, nil disables it
+	GC *GCPolicy `json:"gc,omitempty"`
+	// Labels are friendly names of prefixes, by prefix
+	Labels map[string]string `json:"labels,omitempty"`
+	// Retention are the rules deleting old entries of the database
+	Retention []RetentionRule `json:"retention,omitempty"`
+	// Templates are the values new keys start with in the editor, by prefix
+	Templates map[string]string `json:"templates,omitempty"`
+	// KeyLayouts describe the binary keys under a prefix so they're shown as
+	// tuples, by prefix
+	KeyLayouts map[string]string `json:"key_layouts,omitempty"`
+	// Schemas are the JSON Schemas values written under a prefix must
+	// match, by prefix
+	Schemas map[string]json.RawMessage `json:"schemas,omitempty"`
+	// Hooks update derived keys whenever a key is written from the GUI
+	Hooks []WriteHook `json:"hooks,omitempty"`
+	// Ignored are the prefixes listing, search, counts and exports skip,
+	// like huge machine-generated namespaces
+	Ignored []string `json:"ignored,omitempty"`
+	// Virtual are the prefixes browsed as databases of their own, like the
+	// tenants of a multi-tenant store, by name
+	Virtual map[string]string `json:"virtual,omitempty"`
+}
+
+// WriteHook writes the derived key Key with Value whenever a key matching
+// Match is set, both being templates over the written key and value.
+type WriteHook struct {
+	Name string `json:"name"`
+	// Match is a regular expression on the written key, its groups usable
+	// in the templates
+	Match string `json:"match"`
+	Key   string `json:"key"`
+	Value string `json:"value"`
+	// Cascade deletes the derived key along with the matching key, and the
+	// previous derived key when a set moves it, as index entries need
+	Cascade bool `json:"cascade,omitempty"`
+}
+
+// RetentionRule deletes the entries under Prefix older than MaxAgeDays. The
+// age is read from a timestamp in the key, the delimiter separated segment
+// KeySegment counting from 1, or from the JSON value's Field.
+type RetentionRule struct {
+	Name       string `json:"name"`
+	Prefix     string `json:"prefix"`
+	MaxAgeDays int    `json:"max_age_days"`
+	KeySegment int    `json:"key_segment,omitempty"`
+	Field      string `json:"field,omitempty"`
+	// Layout is the Go time layout of the timestamp, or unix, unix_ms,
+	// unix_us or unix_ns for Unix times in that unit; empty takes RFC 3339
+	Layout string `json:"layout,omitempty"`
+	// IntervalMinutes runs the rule on a schedule while the database is
+	// open, zero runs it on demand only
+	IntervalMinutes int `json:"interval_minutes,omitempty"`
+}
+
+// GCPolicy configures periodic value log GC. Zero values use the defaults: a
+// discard ratio of 0.5 every 60 minutes.
+type GCPolicy struct {
+	DiscardRatio    float64 `json:"discard_ratio"`
+	IntervalMinutes int     `json:"interval_minutes"`
+	// OnlyWhenIdle skips rounds while the database is being read or written
+	OnlyWhenIdle bool `json:"only_when_idle"`
+}
+
+// Profile returns the profile of the database at path.
+func (s Settings) Profile(path string) (Profile, bool) {
+	path = filepath.Clean(path)
+	for _, p := range s.Profiles {
+		if filepath.Clean(p.Path) == path {
+			return p, true
+		}
+	}
+	return Profile{}, false
+}
+
+// SaveProfile adds the profile or replaces the one with the same path.
+func (s *Store) SaveProfile(profile Profile) error {
+	profile.Path = filepath.Clean(profile.Path)
+	settings := s.Get()
+	profiles := make([]Profile, 0, len(settings.Profiles)+1)
+	for _, p := range settings.Profiles {
+		if filepath.Clean(p.Path) != profile.Path {
+			profiles = append(profiles, p)
+		}
+	}
+	settings.Profiles = append(profiles, profile)
+	return s.Update(settings)
+}
+
+// DeleteProfile removes the profile of the database at path, if any.
+func (s *Store) DeleteProfile(path string) error {
+	path = filepath.Clean(path)
+	settings := s.Get()
+	profiles := make([]Profile, 0, len(settings.Profiles))
+	for _, p := range settings.Profiles {
+		if filepath.Clean(p.Path) != path {
+			profiles = append(profiles, p)
+		}
+	}
+	settings.Profiles = profiles
+	return s.Update(settings)
+}
+
+// SetLabel names a prefix in the profile of the database at path, creating
+// the profile if needed. An empty label removes the name.
+func (s *Store) SetLabel(path, prefix, label string) (map[string]string, error) {
+	profile, ok := s.Get().Profile(path)
+	if !ok {
+		profile = Profile{Path: path}
+	}
+	labels := make(map[string]string, len(profile.Labels)+1)
+	for p, l := range profile.Labels {
+		labels[p] = l
+	}
+	if label == "" {
+		delete(labels, prefix)
+	} else {
+		labels[prefix] = label
+	}
+	profile.Labels = labels
+	return labels, s.SaveProfile(profile)
+}
+
+// SetTemplate sets the value template of a prefix in the profile of the
+// database at path, creating the profile if needed. An empty template
+// removes it.
+func (s *Store) SetTemplate(path, prefix, template string) (map[string]string, error) {
+	profile, ok := s.Get().Profile(path)
+	if !ok {
+		profile = Profile{Path: path}
+	}
+	templates := make(map[string]string, len(profile.Templates)+1)
+	for p, t := range profile.Templates {
+		templates[p] = t
+	}
+	if template == "" {
+		delete(templates, prefix)
+	} else {
+		templates[prefix] = template
+	}
+	profile.Templates = templates
+	return templates, s.SaveProfile(profile)
+}
+
+// SetDecoder assigns a value decoder to a prefix in the profile of the
+// database at path, creating the profile if needed. An empty decoder removes
+// the assignment.
+func (s *Store) SetDecoder(path, prefix, decoder string) (map[string]string, error) {
+	profile, ok := s.Get().Profile(path)
+	if !ok {
+		profile = Profile{Path: path}
+	}
+	decoders := make(map[string]string, len(profile.Decoders)+1)
+	for p, d := range profile.Decoders {
+		decoders[p] = d
+	}
+	if decoder == "" {
+		delete(decoders, prefix)
+	} else {
+		decoders[prefix] = decoder
+	}
+	profile.Decoders = decoders
+	return decoders, s.SaveProfile(profile)
+}
+
+// SetKeyLayout sets the key layout of a prefix in the profile of the
+// database at path, creating the profile if needed. An empty layout removes
+// it.
+func (s *Store) SetKeyLayout(path, prefix, layout string) (map[string]string, error) {
+	profile, ok := s.Get().Profile(path)
+	if !ok {
+		profile = Profile{Path: path}
+	}
+	layouts := make(map[string]string, len(profile.KeyLayouts)+1)
+	for p, l := range profile.KeyLayouts {
+		layouts[p] = l
+	}
+	if layout == "" {
+		delete(layouts, prefix)
+	} else {
+		layouts[prefix] = layout
+	}
+	profile.KeyLayouts = layouts
+	return layouts, s.SaveProfile(profile)
+}
+
+// SetVirtual sets the prefix of the virtual database name in the profile of
+// the database at path, creating the profile if needed. An empty prefix
+// removes it.
+func (s *Store) SetVirtual(path, name, prefix string) (map[string]string, error) {
+	profile, ok := s.Get().Profile(path)
+	if !ok {
+		profile = Profile{Path: path}
+	}
+	virtual := make(map[string]string, len(profile.Virtual)+1)
+	for n, p := range profile.Virtual {
+		virtual[n] = p
+	}
+	if prefix == "" {
+		delete(virtual, name)
+	} else {
+		virtual[name] = prefix
+	}
+	profile.Virtual = virtual
+	return virtual, s.SaveProfile(profile)
+}
+
+// SetSchema sets the JSON Schema of a prefix in the profile of the database
+// at path, creating the profile if needed. An empty schema removes it.
+func (s *Store) SetSchema(path, prefix string, schema json.RawMessage) (map[string]json.RawMessage, error) {
+	profile, ok := s.Get().Profile(path)
+	if !ok {
+		profile = Profile{Path: path}
+	}
+	schemas := make(map[string]json.RawMessage, len(profile.Schemas)+1)
+	for p, s := range profile.Schemas {
+		schemas[p] = s
+	}
+	if len(schema) == 0 {
+		delete(schemas, prefix)
+	} else {
+		schemas[prefix] = schema
+	}
+	profile.Schemas = schemas
+	return schemas, s.SaveProfile(profile)
+}
+
+// SetRetention replaces the retention rules in the profile of the database
+// at path, creating the profile if needed.
+func (s *Store) SetRetention(path string, rules []RetentionRule) error {
+	profile, ok := s.Get().Profile(path)
+	if !ok {
+		profile = Profile{Path: path}
+	}
+	profile.Retention = rules
+	return s.SaveProfile(profile)
+}
+
+// SetHooks replaces the write hooks in the profile of the database at path,
+// creating the profile if needed.
+func (s *Store) SetHooks(path string, hooks []WriteHook) error {
+	profile, ok := s.Get().Profile(path)
+	if !ok {
+		profile = Profile{Path: path}
+	}
+	profile.Hooks = hooks
+	return s.SaveProfile(profile)
+}
+
+// SetIgnored replaces the ignored prefixes in the profile of the database at
+// path, creating the profile if needed.
+func (s *Store) SetIgnored(path string, prefixes []string) error {
+	profile, ok := s.Get().Profile(path)
+	if !ok {
+		profile = Profile{Path: path}
+	}
+	profile.Ignored = prefixes
+	return s.SaveProfile(profile)
+}
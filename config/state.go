@@ -0,0 +1,44 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// SaveState writes v as JSON to the file name next to the settings. It keeps
+// runtime state, like job checkpoints, that isn't configuration.
+func (s *Store) SaveState(name string, v any) error {
+	bt, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	path := filepath.Join(filepath.Dir(s.path), name)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, bt, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// LoadState reads the state file name into v. A missing file leaves v as it
+// is.
+func (s *Store) LoadState(name string, v any) error {
+	s.mx.RLock()
+	bt, err := os.ReadFile(filepath.Join(filepath.Dir(s.path), name))
+	s.mx.RUnlock()
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(bt, v)
+}
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/filinvadim/badger-gui/config"
+	"github.com/filinvadim/badger-gui/database"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	goruntime "runtime"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	crashDirName     = "crashes"
+	crashFilePrefix  = "crash-"
+	crashFileExt     = ".json"
+	crashLogLines    = 200
+	crashReportLimit = 50
+
+	CrashedResponse       = "internal error, crash report saved"
+	CrashNotFoundResponse = "crash report not found"
+	EventCrash            = "app:crash"
+
+	// crash sources besides SourceCall and SourceJob
+	crashSourceFatal          = "fatal"
+	crashSourceWatchIdle      = "watch_idle"
+	crashSourceWatchHealth    = "watch_health"
+	crashSourceWatchExpiry    = "watch_expiry"
+	crashSourceWatchRetention = "watch_retention"
+	crashSourceWatchExternal  = "watch_external"
+)
+
+// recentLogs keeps the last log lines, redacted, for crash bundles. main
+// tees the standard logger into it.
+var recentLogs = &logRing{mx: new(sync.Mutex), lines: make([]string, 0, crashLogLines)}
+
+// CrashBundle is everything a bug report needs about a panic or a fatal
+// error. Keys are logged through logKey and the logs pass redactLogLine on
+// top, which is a heuristic: review a bundle before sharing it.
+type CrashBundle struct {
+	Time    time.Time                  `json:"time"`
+	Source  string                     `json:"source"`
+	Reason  string                     `json:"reason"`
+	Stack   string                     `json:"stack,omitempty"`
+	Logs    []string                   `json:"logs"`
+	Options *database.EffectiveOptions `json:"options,omitempty"`
+	System  CrashSystem                `json:"system"`
+}
+
+type CrashSystem struct {
+	OS         string `json:"os"`
+	Arch       string `json:"arch"`
+	GoVersion  string `json:"go_version"`
+	CPUs       int    `json:"cpus"`
+	Goroutines int    `json:"goroutines"`
+}
+
+type CrashReport struct {
+	Name   string    `json:"name"`
+	Time   time.Time `json:"time"`
+	Source string    `json:"source"`
+	Reason string    `json:"reason"`
+}
+
+type CrashReportsResponse struct {
+	Dir     string        `json:"dir"`
+	Reports []CrashReport `json:"reports"`
+}
+
+type MessageRevealCrash struct {
+	// Name is the crash report to select, the reports directory is opened
+	// when it's empty
+	Name string `json:"name"`
+}
+
+type logRing struct {
+	mx    *sync.Mutex
+	lines []string
+	next  int
+}
+
+// Write takes one line per call, the way the log package writes.
+func (r *logRing) Write(p []byte) (int, error) {
+	line := redactLogLine(strings.TrimRight(string(p), "\n"))
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	if len(r.lines) < crashLogLines {
+		r.lines = append(r.lines, line)
+		return len(p), nil
+	}
+	r.lines[r.next] = line
+	r.next = (r.next + 1) % crashLogLines
+	return len(p), nil
+}
+
+// snapshot returns the lines oldest first.
+func (r *logRing) snapshot() []string {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	return append(append([]string(nil), r.lines[r.next:]...), r.lines[:r.next]...)
+}
+
+// redactWords are the log words a key, a prefix or a value follows, as in
+// "key %s set" or "duplicating key failure %s".
+var redactWords = map[string]struct{}{
+	"key": {}, "prefix": {}, "value": {}, "to": {}, "failure": {},
+	"passphrase": {}, "password": {}, "secret": {},
+}
+
+var quotedString = regexp.MustCompile(`"(?:[^"\\]|\\.)*"`)
+
+// redactLogLine hides the words following redactWords and every quoted
+// string. Log lines already render keys with logKey, this is a backstop for
+// crash bundles over the app's own log messages, not a guarantee.
+func redactLogLine(line string) string {
+	fields := strings.Split(quotedString.ReplaceAllString(line, `"`+redacted+`"`), " ")
+	for i := 1; i < len(fields); i++ {
+		if _, ok := redactWords[strings.ToLower(fields[i-1])]; !ok {
+			continue
+		}
+		if _, ok := redactWords[strings.ToLower(fields[i])]; ok || fields[i] == "" {
+			continue
+		}
+		fields[i] = redacted + trailingPunct(fields[i])
+	}
+	return strings.Join(fields, " ")
+}
+
+func trailingPunct(word string) string {
+	if i := strings.LastIndexAny(word, ":,"); i == len(word)-1 && i > 0 {
+		return word[i:]
+	}
+	return ""
+}
+
+func crashDir() (string, error) {
+	dir, err := config.Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, crashDirName), nil
+}
+
+// writeCrashBundle stores a bundle in the crash reports directory and
+// returns its path. db may be nil when the crash happened before it existed.
+func writeCrashBundle(source, reason string, stack []byte, db Storer) (string, error) {
+	bundle := CrashBundle{
+		Time: time.Now().UTC(), Source: source, Reason: reason, Stack: string(stack),
+		Logs: recentLogs.snapshot(),
+		System: CrashSystem{
+			OS: goruntime.GOOS, Arch: goruntime.GOARCH, GoVersion: goruntime.Version(),
+			CPUs: goruntime.NumCPU(), Goroutines: goruntime.NumGoroutine(),
+		},
+	}
+	if db != nil && db.IsRunning() {
+		if opts, err := db.Options(); err == nil {
+			bundle.Options = &opts
+		}
+	}
+
+	dir, err := crashDir()
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	bt, err := json.MarshalIndent(bundle, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	name := crashFilePrefix + bundle.Time.Format("20060102-150405.000") + crashFileExt
+	path := filepath.Join(dir, name)
+	return path, os.WriteFile(path, bt, 0600)
+}
+
+// crash writes the bundle of a recovered panic and tells the frontend where
+// it is.
+func (a *App) crash(source string, r any) string {
+	stack := debug.Stack()
+	log.Printf("panic in %s: %v", source, r)
+	path, err := writeCrashBundle(source, fmt.Sprint(r), stack, a.db)
+	if err != nil {
+		log.Printf("writing crash bundle failure: %v", err)
+		return ""
+	}
+	log.Printf("crash bundle saved to %s", path)
+	if a.ctx != nil {
+		runtime.EventsEmit(a.ctx, EventCrash, path)
+	}
+	return path
+}
+
+// recoverCall turns a panic of a message handler into an error response.
+func (a *App) recoverCall(t messageType, r any) AppMessage {
+	path := a.crash(SourceCall+":"+string(t), r)
+	if path == "" {
+		return AppMessage{Type: t, Body: CrashedResponse}
+	}
+	return AppMessage{Type: t, Body: CrashedResponse + ": " + path}
+}
+
+// reportCrash is deferred by background goroutines. It writes the bundle and
+// panics again, a crashed loop leaves the app in an unknown state.
+func (a *App) reportCrash(source string) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	a.crash(source, r)
+	panic(r)
+}
+
+// fatal writes a bundle for an error the app can't start with, then exits.
+func fatal(format string, args ...any) {
+	reason := fmt.Sprintf(format, args...)
+	if path, err := writeCrashBundle(crashSourceFatal, reason, nil, nil); err == nil {
+		log.Printf("crash bundle saved to %s", path)
+	}
+	log.Fatal(reason)
+}
+
+func (a *App) crashReports(msg AppMessage) AppMessage {
+	dir, err := crashDir()
+	if err != nil {
+		log.Printf("crash reports dir failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Printf("reading crash reports failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+
+	reports := make([]CrashReport, 0, len(entries))
+	for _, e := range entries {
+		if e.IsDir() || !isCrashReport(e.Name()) {
+			continue
+		}
+		bt, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			continue
+		}
+		var bundle CrashBundle
+		if err := json.Unmarshal(bt, &bundle); err != nil {
+			continue
+		}
+		reports = append(reports, CrashReport{
+			Name: e.Name(), Time: bundle.Time, Source: bundle.Source, Reason: bundle.Reason,
+		})
+	}
+	sort.Slice(reports, func(i, j int) bool { return reports[i].Time.After(reports[j].Time) })
+	if len(reports) > crashReportLimit {
+		reports = reports[:crashReportLimit]
+	}
+	bt, _ := json.Marshal(CrashReportsResponse{Dir: dir, Reports: reports})
+	return AppMessage{Type: msg.Type, Body: string(bt)}
+}
+
+func isCrashReport(name string) bool {
+	return strings.HasPrefix(name, crashFilePrefix) && strings.HasSuffix(name, crashFileExt)
+}
+
+// revealCrash shows a crash report in the system file manager so it can be
+// dragged into a bug report.
+func (a *App) revealCrash(msg AppMessage) AppMessage {
+	var revealMsg MessageRevealCrash
+	if msg.Body != "" {
+		if err := json.Unmarshal([]byte(msg.Body), &revealMsg); err != nil {
+			log.Printf("unmarshaling reveal crash message failure: %v", err)
+			return AppMessage{Type: msg.Type, Body: err.Error()}
+		}
+	}
+	dir, err := crashDir()
+	if err != nil {
+		log.Printf("crash reports dir failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+	path := dir
+	if revealMsg.Name != "" {
+		if filepath.Base(revealMsg.Name) != revealMsg.Name || !isCrashReport(revealMsg.Name) {
+			return AppMessage{Type: msg.Type, Body: CrashNotFoundResponse}
+		}
+		path = filepath.Join(dir, revealMsg.Name)
+	}
+	if _, err := os.Stat(path); err != nil {
+		return AppMessage{Type: msg.Type, Body: CrashNotFoundResponse}
+	}
+
+	cmd := revealCommand(path, path != dir)
+	if err := cmd.Start(); err != nil {
+		log.Printf("revealing crash report failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+	go func() { _ = cmd.Wait() }()
+	return AppMessage{Type: msg.Type, Body: OkStatus}
+}
+
+// revealCommand opens the file manager at path, selecting the file where the
+// platform supports it.
+func revealCommand(path string, isFile bool) *exec.Cmd {
+	switch goruntime.GOOS {
+	case "darwin":
+		if isFile {
+			return exec.Command("open", "-R", path)
+		}
+		return exec.Command("open", path)
+	case "windows":
+		if isFile {
+			return exec.Command("explorer", "/select,"+path)
+		}
+		return exec.Command("explorer", path)
+	default:
+		if isFile {
+			path = filepath.Dir(path)
+		}
+		return exec.Command("xdg-open", path)
+	}
+}
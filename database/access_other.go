@@ -0,0 +1,14 @@
+//go:build !unix
+
+package database
+
+// dirWritable reports true, Windows ACLs are only checked by opening the
+// files themselves.
+func dirWritable(string) bool {
+	return true
+}
+
+// pathOwner returns nothing, owners aren't looked up outside unix.
+func pathOwner(string) string {
+	return ""
+}
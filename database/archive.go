@@ -0,0 +1,287 @@
+package database
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+	"golang.org/x/crypto/scrypt"
+)
+
+// Archive layout:
+//
+//	magic(8) | version(1) | flags(1) | [salt(16) | logN(1) | r(1) | p(1) | noncePrefix(4)] | payload
+//
+// The payload is the raw badger backup stream, optionally zstd-compressed
+// and then sealed with AES-256-GCM in chunks. Every chunk is prefixed with
+// its ciphertext length; the high bit of the length marks the final chunk so
+// that truncated archives are detected on restore.
+const (
+	archiveVersion = 1
+
+	archiveFlagCompressed byte = 1 << 0
+	archiveFlagEncrypted  byte = 1 << 1
+
+	archiveSaltSize        = 16
+	archiveNoncePrefixSize = 4
+	archiveChunkSize       = 64 << 10
+	archiveFinalChunk      = uint32(1 << 31)
+
+	scryptLogN = 15
+	scryptR    = 8
+	scryptP    = 1
+
+	ErrArchivePassphrase = DBError("archive is encrypted: passphrase required")
+	ErrArchiveCorrupted  = DBError("archive is corrupted or passphrase is wrong")
+)
+
+var archiveMagic = []byte("BDGRBAK\x00")
+
+type archiveWriter struct {
+	w       io.Writer
+	closers []io.Closer
+}
+
+// newArchiveWriter wraps w so that everything written to the returned writer
+// is compressed and/or encrypted according to the flags. Close must be called
+// to flush the trailing data.
+func newArchiveWriter(w io.Writer, compress bool, passphrase string) (*archiveWriter, error) {
+	var flags byte
+	if compress {
+		flags |= archiveFlagCompressed
+	}
+	if passphrase != "" {
+		flags |= archiveFlagEncrypted
+	}
+
+	header := append(append([]byte{}, archiveMagic...), archiveVersion, flags)
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+
+	aw := &archiveWriter{w: w}
+	if passphrase != "" {
+		salt := make([]byte, archiveSaltSize)
+		noncePrefix := make([]byte, archiveNoncePrefixSize)
+		if _, err := rand.Read(salt); err != nil {
+			return nil, err
+		}
+		if _, err := rand.Read(noncePrefix); err != nil {
+			return nil, err
+		}
+		params := append(append(salt, scryptLogN, scryptR, scryptP), noncePrefix...)
+		if _, err := w.Write(params); err != nil {
+			return nil, err
+		}
+		aead, err := newArchiveAEAD(passphrase, salt, scryptLogN, scryptR, scryptP)
+		if err != nil {
+			return nil, err
+		}
+		sw := &sealWriter{w: aw.w, aead: aead, noncePrefix: noncePrefix}
+		aw.w = sw
+		aw.closers = append(aw.closers, sw)
+	}
+	if compress {
+		enc, err := zstd.NewWriter(aw.w)
+		if err != nil {
+			return nil, err
+		}
+		aw.w = enc
+		aw.closers = append(aw.closers, enc)
+	}
+	return aw, nil
+}
+
+func (aw *archiveWriter) Write(p []byte) (int, error) {
+	return aw.w.Write(p)
+}
+
+func (aw *archiveWriter) Close() error {
+	for i := len(aw.closers) - 1; i >= 0; i-- {
+		if err := aw.closers[i].Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newArchiveReader detects the archive header and returns a reader yielding
+// the raw badger backup stream. Files without the header are treated as plain
+// badger backups so that archives produced by `badger backup` still load.
+func newArchiveReader(r io.Reader, passphrase string) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+	head, err := br.Peek(len(archiveMagic) + 2)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, bufio.ErrBufferFull) {
+		return nil, err
+	}
+	if len(head) < len(archiveMagic)+2 || !bytes.Equal(head[:len(archiveMagic)], archiveMagic) {
+		return io.NopCloser(br), nil
+	}
+	if head[len(archiveMagic)] != archiveVersion {
+		return nil, fmt.Errorf("unsupported archive version %d", head[len(archiveMagic)])
+	}
+	flags := head[len(archiveMagic)+1]
+	if _, err := br.Discard(len(head)); err != nil {
+		return nil, err
+	}
+
+	var out io.Reader = br
+	if flags&archiveFlagEncrypted != 0 {
+		if passphrase == "" {
+			return nil, ErrArchivePassphrase
+		}
+		params := make([]byte, archiveSaltSize+3+archiveNoncePrefixSize)
+		if _, err := io.ReadFull(br, params); err != nil {
+			return nil, ErrArchiveCorrupted
+		}
+		salt := params[:archiveSaltSize]
+		logN, r, p := params[archiveSaltSize], params[archiveSaltSize+1], params[archiveSaltSize+2]
+		aead, err := newArchiveAEAD(passphrase, salt, logN, r, p)
+		if err != nil {
+			return nil, err
+		}
+		out = &openReader{r: br, aead: aead, noncePrefix: params[archiveSaltSize+3:]}
+	}
+	if flags&archiveFlagCompressed != 0 {
+		dec, err := zstd.NewReader(out)
+		if err != nil {
+			return nil, err
+		}
+		return dec.IOReadCloser(), nil
+	}
+	return io.NopCloser(out), nil
+}
+
+func newArchiveAEAD(passphrase string, salt []byte, logN, r, p byte) (cipher.AEAD, error) {
+	if logN > 20 {
+		return nil, ErrArchiveCorrupted
+	}
+	key, err := scrypt.Key([]byte(passphrase), salt, 1<<logN, int(r), int(p), 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func chunkNonce(prefix []byte, counter uint64) []byte {
+	nonce := make([]byte, archiveNoncePrefixSize+8)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint64(nonce[archiveNoncePrefixSize:], counter)
+	return nonce
+}
+
+type sealWriter struct {
+	w           io.Writer
+	aead        cipher.AEAD
+	noncePrefix []byte
+	counter     uint64
+	buf         []byte
+}
+
+func (sw *sealWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		free := archiveChunkSize - len(sw.buf)
+		if free > len(p) {
+			free = len(p)
+		}
+		sw.buf = append(sw.buf, p[:free]...)
+		p = p[free:]
+		if len(sw.buf) == archiveChunkSize {
+			if err := sw.flush(false); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return n, nil
+}
+
+func (sw *sealWriter) flush(final bool) error {
+	length := make([]byte, 4)
+	aad := []byte{0}
+	if final {
+		aad[0] = 1
+	}
+	sealed := sw.aead.Seal(nil, chunkNonce(sw.noncePrefix, sw.counter), sw.buf, aad)
+	size := uint32(len(sealed))
+	if final {
+		size |= archiveFinalChunk
+	}
+	binary.BigEndian.PutUint32(length, size)
+	if _, err := sw.w.Write(length); err != nil {
+		return err
+	}
+	if _, err := sw.w.Write(sealed); err != nil {
+		return err
+	}
+	sw.counter++
+	sw.buf = sw.buf[:0]
+	return nil
+}
+
+func (sw *sealWriter) Close() error {
+	return sw.flush(true)
+}
+
+type openReader struct {
+	r           io.Reader
+	aead        cipher.AEAD
+	noncePrefix []byte
+	counter     uint64
+	buf         []byte
+	done        bool
+}
+
+func (or *openReader) Read(p []byte) (int, error) {
+	for len(or.buf) == 0 {
+		if or.done {
+			return 0, io.EOF
+		}
+		if err := or.next(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, or.buf)
+	or.buf = or.buf[n:]
+	return n, nil
+}
+
+func (or *openReader) next() error {
+	length := make([]byte, 4)
+	if _, err := io.ReadFull(or.r, length); err != nil {
+		return ErrArchiveCorrupted
+	}
+	size := binary.BigEndian.Uint32(length)
+	final := size&archiveFinalChunk != 0
+	size &^= archiveFinalChunk
+	if size > archiveChunkSize+uint32(or.aead.Overhead()) {
+		return ErrArchiveCorrupted
+	}
+	sealed := make([]byte, size)
+	if _, err := io.ReadFull(or.r, sealed); err != nil {
+		return ErrArchiveCorrupted
+	}
+	aad := []byte{0}
+	if final {
+		aad[0] = 1
+	}
+	plain, err := or.aead.Open(sealed[:0], chunkNonce(or.noncePrefix, or.counter), sealed, aad)
+	if err != nil {
+		return ErrArchiveCorrupted
+	}
+	or.counter++
+	or.buf = plain
+	or.done = final
+	return nil
+}
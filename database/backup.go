@@ -0,0 +1,138 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+const defaultMaxPendingWrites = 256
+
+type BackupOptions struct {
+	Compress   bool
+	Passphrase string
+}
+
+// Backup dumps a full backup of the database into w. When compression or a
+// passphrase is requested the stream is wrapped into an archive, otherwise
+// the plain badger backup format is written.
+func (db *DB) Backup(w io.Writer, opts BackupOptions) (version uint64, err error) {
+	if db == nil {
+		return 0, ErrNotRunning
+	}
+	if !db.isRunning.Load() {
+		return 0, ErrNotRunning
+	}
+
+	stream := db.newStream()
+	stream.LogPrefix = "DB.Backup"
+	if !opts.Compress && opts.Passphrase == "" {
+		return stream.Backup(w, 0)
+	}
+
+	aw, err := newArchiveWriter(w, opts.Compress, opts.Passphrase)
+	if err != nil {
+		return 0, err
+	}
+	version, err = stream.Backup(aw, 0)
+	if err != nil {
+		return 0, err
+	}
+	return version, aw.Close()
+}
+
+// Restore loads a backup produced by Backup (or by the badger CLI) into the
+// database. The passphrase is only needed for encrypted archives.
+func (db *DB) Restore(r io.Reader, passphrase string) error {
+	if db == nil {
+		return ErrNotRunning
+	}
+	if !db.isRunning.Load() {
+		return ErrNotRunning
+	}
+
+	if db.isReadOnly.Load() {
+		return ErrReadOnly
+	}
+
+	ar, err := newArchiveReader(r, passphrase)
+	if err != nil {
+		return err
+	}
+	defer ar.Close()
+
+	db.writes.Add(1)
+	return db.badger.Load(ar, defaultMaxPendingWrites)
+}
+
+// RestoreDir loads a backup into a new database in dir, which must be empty
+// or missing, without touching the open connection. The database is closed
+// again once loaded, ready to be opened. A directory created for a failed
+// restore is removed, an existing one is emptied again.
+func RestoreDir(dir string, r io.Reader, passphrase string) (err error) {
+	dir = LongPath(dir)
+	entries, err := os.ReadDir(dir)
+	created := errors.Is(err, os.ErrNotExist)
+	if err != nil && !created {
+		return err
+	}
+	if len(entries) > 0 {
+		return fmt.Errorf("%s is not empty, restore into a new directory", ShortPath(dir))
+	}
+	defer func() {
+		if err == nil {
+			return
+		}
+		if created {
+			_ = os.RemoveAll(dir)
+			return
+		}
+		// the directory was empty, whatever is in it now is the failed restore
+		partial, _ := os.ReadDir(dir)
+		for _, entry := range partial {
+			_ = os.RemoveAll(filepath.Join(dir, entry.Name()))
+		}
+	}()
+
+	ar, err := newArchiveReader(r, passphrase)
+	if err != nil {
+		return err
+	}
+	defer ar.Close()
+
+	bdb, err := badger.Open(badger.DefaultOptions(dir).WithLogger(newEventLogger()))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := bdb.Close(); err == nil {
+			err = closeErr
+		}
+	}()
+	return bdb.Load(ar, defaultMaxPendingWrites)
+}
+
+// OpenBackup opens a new in-memory connection holding the backup read from r
+// and then makes it read-only, so an archived snapshot is inspected as it was
+// taken. Only the tuning options of o apply.
+func (db *DB) OpenBackup(r io.Reader, passphrase string, o OpenOptions) error {
+	o.Path, o.ValueDir, o.EncryptionKey, o.ReadOnly, o.CopyFirst, o.GC = "", "", nil, false, false, nil
+	if err := db.Open(o); err != nil {
+		return err
+	}
+	ar, err := newArchiveReader(r, passphrase)
+	if err == nil {
+		err = db.badger.Load(ar, defaultMaxPendingWrites)
+		_ = ar.Close()
+	}
+	if err != nil {
+		db.Close()
+		return err
+	}
+	db.isReadOnly.Store(true)
+	return nil
+}
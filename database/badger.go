@@ -8,7 +8,10 @@ import (
 	"github.com/dgraph-io/badger/v4/options"
 	"log"
 	"math"
+	"os"
+	"path/filepath"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -21,11 +24,25 @@ const (
 	defaultIntervalGC     = time.Hour
 	defaultSleepGC        = time.Second
 	defaultLimit          = 20
-
-	ErrNotRunning    = DBError("DB is not running")
-	ErrWrongPassword = DBError("wrong username or password")
+	defaultPrefetchSize   = 10
+	updateAttempts        = 3
+	// closeWaitTimeout bounds how long Close waits for open transactions
+	closeWaitTimeout = 10 * time.Second
+	closeWaitPoll    = 10 * time.Millisecond
+
+	ErrNotRunning     = DBError("DB is not running")
+	ErrWrongPassword  = DBError("wrong username or password")
+	ErrReadOnlyTs     = DBError("DB is browsed at a past timestamp, writes are disabled")
+	ErrReadOnly       = DBError("DB is opened read-only")
+	ErrKeyExists      = DBError("key already exists")
+	ErrUnhealthy      = DBError("DB connection is unhealthy, reopen it")
+	ErrVersionChanged = DBError("value changed since it was loaded")
+	ErrTooBig         = DBError("changes don't fit in one transaction, commit fewer at once")
 )
 
+// ErrKeyNotFound is returned by reads of missing keys.
+var ErrKeyNotFound = badger.ErrKeyNotFound
+
 type Key = string
 
 type DBError string
@@ -40,17 +57,120 @@ type Options struct {
 	sleepGC        time.Duration
 }
 
+type OpenOptions struct {
+	Path string
+	// ValueDir is the value log directory of databases that keep it apart
+	// from the LSM tree in Path, empty when both live in Path.
+	ValueDir string
+	// EncryptionKey is raw or hex encoded. Open never retains this slice, so
+	// the caller may wipe it as soon as Open returns.
+	EncryptionKey []byte
+	Compression   string
+	// Managed opens the database with badger.OpenManaged, which is required
+	// for stores written by Dgraph-style applications that set commit
+	// timestamps themselves.
+	Managed bool
+	// ChecksumMode is one of "none", "table", "block" or "table_and_block",
+	// empty keeps badger's default (none).
+	ChecksumMode        string
+	VerifyValueChecksum bool
+	// DetectConflicts defaults to true, disabling it speeds up bulk writes.
+	DetectConflicts *bool
+	// SyncWrites defaults to true, every commit waits for fsync. Disabling
+	// it makes imports much faster on slow disks at the risk of losing the
+	// last writes on a crash.
+	SyncWrites *bool
+	// ReadOnly opens the database without taking the write lock.
+	ReadOnly bool
+	// CopyFirst snapshots the directory into a temp location and opens the
+	// copy read-only, so a database held by a running process can be read.
+	CopyFirst bool
+	// CompactOnCloseWrites makes Close flatten the LSM tree and run value
+	// log GC when at least that many writes went through this connection,
+	// zero disables it.
+	CompactOnCloseWrites int
+	// KeyRotation is how often badger generates a new data key for
+	// encrypted databases, zero keeps badger's default of ten days.
+	KeyRotation time.Duration
+	// BlockCacheSize and IndexCacheSize in bytes override badger's cache
+	// sizes, zero keeps the defaults.
+	BlockCacheSize int64
+	IndexCacheSize int64
+	// GC enables periodic value log GC, nil leaves GC to explicit requests.
+	// It's ignored for read-only and in-memory connections.
+	GC *GCPolicy
+	// PageSize is how many keys List and Search return when no limit is
+	// given, zero keeps 20.
+	PageSize int
+	// PrefetchSize is how many values iterators reading values fetch ahead,
+	// zero keeps 10. Stores of large values want fewer, of tiny ones more.
+	PrefetchSize int
+	// IgnoredPrefixes are skipped by listing, searching, counting and key
+	// walks unless asked for explicitly, see SetIgnoredPrefixes.
+	IgnoredPrefixes []string
+	// NumCompactors is how many compactions badger runs at once, zero
+	// keeps 2.
+	NumCompactors int
+}
+
 type DB struct {
 	badger *badger.DB
 
-	isRunning, isInMemory *atomic.Bool
+	isRunning, isInMemory, isManaged, isReadOnly, showInternal *atomic.Bool
+	// readTs pins reads to a commit timestamp, zero means latest
+	readTs *atomic.Uint64
+	// pageSize and prefetchSize are the iteration defaults of the connection
+	pageSize, prefetchSize *atomic.Int64
+
+	badgerOpts badger.Options
+	// encryptionKey is owned by badger while the DB is open and wiped on close
+	encryptionKey        []byte
+	keyRotation          time.Duration
+	writes               *atomic.Int64
+	compactOnCloseWrites int
+	// copyDir is the temp snapshot opened instead of copyOf, removed on close
+	copyDir, copyOf string
+	// valueCopyDir is the snapshot of a separate value log directory
+	valueCopyDir string
+	// source watches the directory of read-only and copied connections for
+	// other processes writing it
+	source sourceWatch
+	// ignored are the prefixes listing and key walks skip
+	ignored *atomic.Pointer[ignoredPrefixes]
+	// degraded are the reduced memory settings of the connection, nil when
+	// it runs with the requested ones. memoryErrors counts its memory
+	// errors and degradeFrom is the step the next open of its path starts
+	// at.
+	degraded     *atomic.Pointer[Degraded]
+	memoryErrors *atomic.Int64
+	degradeFrom  *atomic.Pointer[degradeStart]
 
-	badgerOpts     badger.Options
 	discardRatioGC float64
 	intervalGC     time.Duration
 	sleepGC        time.Duration
-
-	stopChan chan struct{}
+	// gcRatio is the discard ratio of the connection, discardRatioGC unless
+	// its GC policy overrides it
+	gcRatio float64
+	// gcDone is closed when the periodic GC of the connection has stopped
+	gcDone     chan struct{}
+	lastAccess *atomic.Int64
+
+	// batch buffers Set and Delete while write batching is on, see
+	// SetBatching
+	batchMx *sync.Mutex
+	batch   *writeBuffer
+
+	logger   *eventLogger
+	health   *healthMonitor
+	gcNotify *gcNotifier
+
+	// conn is canceled when the connection closes. Every Open starts a new
+	// one, so work bound to a connection never carries over to the next.
+	// It's swapped while readers load it, hence the atomic.
+	conn *atomic.Pointer[connection]
+	// readers counts the transactions and iterators in flight, Close waits
+	// for them before closing badger under them
+	readers *atomic.Int64
 }
 
 func New(o *Options) (*DB, error) {
@@ -58,6 +178,7 @@ func New(o *Options) (*DB, error) {
 		o = &Options{}
 	}
 
+	logger := newEventLogger()
 	defaultOpts := badger.
 		DefaultOptions("").
 		WithDir("").
@@ -66,7 +187,7 @@ func New(o *Options) (*DB, error) {
 		WithSyncWrites(true).
 		WithIndexCacheSize(256 << 20).
 		WithNumCompactors(2).
-		WithLoggingLevel(badger.ERROR).
+		WithLogger(logger).
 		WithBlockCacheSize(512 << 20)
 
 	if o.intervalGC == 0 {
@@ -80,24 +201,56 @@ func New(o *Options) (*DB, error) {
 	}
 
 	storage := &DB{
-		badger: nil, stopChan: make(chan struct{}), isRunning: new(atomic.Bool),
-		isInMemory: new(atomic.Bool), badgerOpts: defaultOpts,
-		discardRatioGC: o.discardRatioGC, intervalGC: o.intervalGC, sleepGC: o.sleepGC,
+		badger: nil, isRunning: new(atomic.Bool), readers: new(atomic.Int64),
+		isInMemory: new(atomic.Bool), isManaged: new(atomic.Bool), isReadOnly: new(atomic.Bool), showInternal: new(atomic.Bool), readTs: new(atomic.Uint64), pageSize: new(atomic.Int64), prefetchSize: new(atomic.Int64), writes: new(atomic.Int64), lastAccess: new(atomic.Int64), batchMx: new(sync.Mutex),
+		badgerOpts: defaultOpts, logger: logger, health: newHealthMonitor(), gcNotify: &gcNotifier{mx: new(sync.Mutex)}, discardRatioGC: o.discardRatioGC, intervalGC: o.intervalGC, sleepGC: o.sleepGC, source: sourceWatch{mx: new(sync.Mutex)}, ignored: new(atomic.Pointer[ignoredPrefixes]),
+		degraded: new(atomic.Pointer[Degraded]), memoryErrors: new(atomic.Int64), degradeFrom: new(atomic.Pointer[degradeStart]),
+		conn: new(atomic.Pointer[connection]),
 	}
 	storage.isInMemory.Store(true)
+	storage.pageSize.Store(defaultLimit)
+	storage.prefetchSize.Store(defaultPrefetchSize)
+	// no connection yet, the context is done until the first Open
+	first := newConnection("")
+	first.close()
+	storage.conn.Store(first)
 	return storage, nil
 }
 
-func (db *DB) Open(dbPath, key, compression string) (err error) {
-	if dbPath != "" {
-		db.isInMemory.Store(false)
-		db.badgerOpts = db.badgerOpts.WithDir(dbPath).WithValueDir(dbPath).WithInMemory(false)
-		if key != "" {
-			if hexKey, err := hex.DecodeString(key); err == nil {
-				key = string(hexKey)
+func (db *DB) Open(o OpenOptions) (err error) {
+	dbPath, valueDir, compression := LongPath(o.Path), LongPath(o.ValueDir), o.Compression
+	if valueDir == "" || valueDir == dbPath {
+		valueDir = ""
+	} else if info, statErr := os.Stat(valueDir); statErr != nil || !info.IsDir() {
+		// badger would create it and open the tree without its values
+		return fmt.Errorf("value log directory %s doesn't exist", o.ValueDir)
+	}
+	sources := sourceDirs(o)
+	stamps, stampErr := stampDirs(sources)
+	if stampErr != nil {
+		sources = nil
+	}
+	if dbPath != "" && o.CopyFirst {
+		if db.copyDir, err = copyDirRetrying(dbPath); err != nil {
+			return fmt.Errorf("copying database: %w", err)
+		}
+		dbPath = db.copyDir
+		if valueDir != "" {
+			if db.valueCopyDir, err = copyDirRetrying(valueDir); err != nil {
+				db.removeCopy()
+				return fmt.Errorf("copying value log directory: %w", err)
 			}
-			db.badgerOpts = db.badgerOpts.WithEncryptionKey([]byte(key))
+			valueDir = db.valueCopyDir
 		}
+	}
+	if valueDir == "" {
+		valueDir = dbPath
+	}
+	// the key is never stored in badgerOpts so it doesn't outlive the connection
+	opts := db.badgerOpts.WithEncryptionKey(nil)
+	if dbPath != "" {
+		db.isInMemory.Store(false)
+		db.badgerOpts = db.badgerOpts.WithDir(dbPath).WithValueDir(valueDir).WithInMemory(false)
 		if compression != "" {
 			switch strings.ToLower(compression) {
 			case "snappy":
@@ -108,27 +261,329 @@ func (db *DB) Open(dbPath, key, compression string) (err error) {
 				db.badgerOpts = db.badgerOpts.WithCompression(options.None)
 			}
 		}
+		opts = db.badgerOpts
+		if len(o.EncryptionKey) > 0 {
+			db.encryptionKey = decodeEncryptionKey(o.EncryptionKey)
+			opts = opts.WithEncryptionKey(db.encryptionKey)
+		}
+	} else {
+		// an earlier connection may have pointed the options to a directory
+		db.isInMemory.Store(true)
+		db.badgerOpts = db.badgerOpts.WithDir("").WithValueDir("").WithInMemory(true)
+		opts = db.badgerOpts.WithEncryptionKey(nil)
 	}
 
-	db.badger, err = badger.Open(db.badgerOpts)
+	opts = opts.
+		WithChecksumVerificationMode(checksumMode(o.ChecksumMode)).
+		WithVerifyValueChecksum(o.VerifyValueChecksum)
+	if o.DetectConflicts != nil {
+		opts = opts.WithDetectConflicts(*o.DetectConflicts)
+	}
+	if o.SyncWrites != nil {
+		opts = opts.WithSyncWrites(*o.SyncWrites)
+	}
+	// a copy is opened writable since badger has to truncate the memtable
+	// log of a live database, read-only is then enforced on our side
+	if o.ReadOnly && dbPath != "" && !o.CopyFirst {
+		opts = opts.WithReadOnly(true)
+	}
+	if o.KeyRotation > 0 {
+		opts = opts.WithEncryptionKeyRotationDuration(o.KeyRotation)
+	}
+	if o.BlockCacheSize > 0 {
+		opts = opts.WithBlockCacheSize(o.BlockCacheSize)
+	}
+	if o.IndexCacheSize > 0 {
+		opts = opts.WithIndexCacheSize(o.IndexCacheSize)
+	}
+	if o.NumCompactors > 0 {
+		opts = opts.WithNumCompactors(o.NumCompactors)
+	}
+	db.pageSize.Store(defaultLimit)
+	if o.PageSize > 0 {
+		db.pageSize.Store(int64(o.PageSize))
+	}
+	db.prefetchSize.Store(defaultPrefetchSize)
+	if o.PrefetchSize > 0 {
+		db.prefetchSize.Store(int64(o.PrefetchSize))
+	}
+
+	var degraded *Degraded
+	from := 0
+	if d := db.degradeFrom.Load(); d != nil && d.path == filepath.Clean(o.Path) {
+		// the memory errors were another database's otherwise
+		from = d.step
+	}
+	db.badger, degraded, err = openBadger(opts, o.Managed, from)
+	if err != nil {
+		db.wipeEncryptionKey()
+		db.removeCopy()
+	}
+	db.keyRotation = opts.EncryptionKeyRotationDuration
 	if errors.Is(err, badger.ErrEncryptionKeyMismatch) {
 		return ErrWrongPassword
 	}
 	if err != nil {
 		return err
 	}
+	db.conn.Store(newConnection(o.Path))
+	db.isReadOnly.Store(o.ReadOnly || o.CopyFirst)
+	db.writes.Store(0)
+	db.compactOnCloseWrites = o.CompactOnCloseWrites
+	db.copyOf = ""
+	if db.copyDir != "" {
+		db.copyOf = o.Path
+	}
+	db.isManaged.Store(o.Managed)
+	db.setSourceWatch(sources, stamps)
+	db.SetIgnoredPrefixes(o.IgnoredPrefixes)
+	db.readTs.Store(0)
+	db.health.unhealthy.Store(false)
+	db.degraded.Store(degraded)
+	db.memoryErrors.Store(0)
+	db.degradeFrom.Store(nil)
+	db.startGC(o.GC)
 	db.isRunning.Store(true)
 	return nil
 }
 
+// startGC applies the GC policy of a new connection.
+func (db *DB) startGC(policy *GCPolicy) {
+	db.gcRatio, db.gcDone = db.discardRatioGC, nil
+	if policy == nil {
+		return
+	}
+	p := *policy
+	if p.DiscardRatio <= 0 || p.DiscardRatio >= 1 {
+		p.DiscardRatio = db.discardRatioGC
+	}
+	if p.Interval <= 0 {
+		p.Interval = db.intervalGC
+	}
+	db.gcRatio = p.DiscardRatio
+	if db.isReadOnly.Load() || db.isInMemory.Load() {
+		return
+	}
+	db.touch()
+	db.gcDone = make(chan struct{})
+	go db.runPeriodicGC(p, db.connected().Done(), db.gcDone)
+}
+
+func checksumMode(mode string) options.ChecksumVerificationMode {
+	switch strings.ToLower(mode) {
+	case "table":
+		return options.OnTableRead
+	case "block":
+		return options.OnBlockRead
+	case "table_and_block":
+		return options.OnTableAndBlockRead
+	default:
+		return options.NoVerification
+	}
+}
+
+// decodeEncryptionKey returns a private copy of the key, hex decoded when
+// possible, without creating intermediate strings that can't be wiped.
+func decodeEncryptionKey(raw []byte) []byte {
+	decoded := make([]byte, hex.DecodedLen(len(raw)))
+	if n, err := hex.Decode(decoded, raw); err == nil {
+		return decoded[:n]
+	}
+	clear(decoded)
+	return append([]byte(nil), raw...)
+}
+
+func (db *DB) removeCopy() {
+	for _, dir := range []string{db.copyDir, db.valueCopyDir} {
+		if dir == "" {
+			continue
+		}
+		if err := os.RemoveAll(dir); err != nil {
+			log.Printf("database: removing copy %s: %v", dir, err)
+		}
+	}
+	db.copyDir, db.valueCopyDir = "", ""
+}
+
+func (db *DB) wipeEncryptionKey() {
+	clear(db.encryptionKey)
+	db.encryptionKey = nil
+}
+
+// connection is the context of one connection with its cancel and the path
+// it was opened with.
+type connection struct {
+	ctx   context.Context
+	close context.CancelFunc
+	path  string
+}
+
+func newConnection(path string) *connection {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &connection{ctx: ctx, close: cancel, path: path}
+}
+
+// connected returns the context of the current connection, done once it
+// closes.
+func (db *DB) connected() context.Context {
+	return db.conn.Load().ctx
+}
+
 func (db *DB) IsRunning() bool {
 	return db.isRunning.Load()
 }
 
+// acquire registers a reader or writer of the current connection, failing
+// once the connection is closing. The returned release must be called when
+// it's done with badger.
+func (db *DB) acquire() (release func(), err error) {
+	db.readers.Add(1)
+	if db.connected().Err() != nil {
+		db.readers.Add(-1)
+		return nil, ErrNotRunning
+	}
+	return func() { db.readers.Add(-1) }, nil
+}
+
+// waitReaders waits for the transactions and iterators of a closing
+// connection, giving up after closeWaitTimeout.
+func (db *DB) waitReaders() {
+	deadline := time.Now().Add(closeWaitTimeout)
+	for db.readers.Load() > 0 {
+		if time.Now().After(deadline) {
+			log.Printf("database: closing with %d transactions still open", db.readers.Load())
+			return
+		}
+		time.Sleep(closeWaitPoll)
+	}
+}
+
 func (db *DB) IsInMemory() bool {
 	return db.isInMemory.Load()
 }
 
+func (db *DB) IsReadOnly() bool {
+	return db.isReadOnly.Load()
+}
+
+func (db *DB) IsManaged() bool {
+	return db.isManaged.Load()
+}
+
+// SetReadTs makes all reads observe the keyspace as of the given commit
+// timestamp (version). Zero resets reads to the latest version.
+func (db *DB) SetReadTs(ts uint64) error {
+	if db == nil {
+		return ErrNotRunning
+	}
+	if !db.isRunning.Load() {
+		return ErrNotRunning
+	}
+	db.readTs.Store(ts)
+	return nil
+}
+
+func (db *DB) ReadTs() uint64 {
+	return db.readTs.Load()
+}
+
+func (db *DB) MaxVersion() uint64 {
+	if db == nil || !db.isRunning.Load() {
+		return 0
+	}
+	return db.badger.MaxVersion()
+}
+
+func (db *DB) currentReadTs() uint64 {
+	if ts := db.readTs.Load(); ts != 0 {
+		return ts
+	}
+	return math.MaxUint64
+}
+
+func (db *DB) newReadTxn() *badger.Txn {
+	if db.isManaged.Load() {
+		return db.badger.NewTransactionAt(db.currentReadTs(), false)
+	}
+	return db.badger.NewTransaction(false)
+}
+
+func (db *DB) view(fn func(txn *badger.Txn) error) error {
+	if db.badger.IsClosed() {
+		return db.checkHealth(badger.ErrDBClosed)
+	}
+	release, err := db.acquire()
+	if err != nil {
+		return err
+	}
+	defer release()
+	db.touch()
+	txn := db.newReadTxn()
+	defer txn.Discard()
+	return db.checkHealth(fn(txn))
+}
+
+// update runs fn in a read-write transaction, running it again when the
+// commit conflicts with a concurrent writer. Managed databases have no
+// oracle assigning commit timestamps, so the next version after the current
+// maximum is used.
+func (db *DB) update(fn func(txn *badger.Txn) error) error {
+	_, err := db.updateSince(fn)
+	return err
+}
+
+// updateSince is update returning a timestamp just below the commit, which
+// versionSince finds the committed versions with.
+func (db *DB) updateSince(fn func(txn *badger.Txn) error) (since uint64, err error) {
+	if db.isReadOnly.Load() {
+		return 0, ErrReadOnly
+	}
+	if db.readTs.Load() != 0 {
+		return 0, ErrReadOnlyTs
+	}
+	db.writes.Add(1)
+	db.touch()
+	for attempt := 0; attempt < updateAttempts; attempt++ {
+		if since, err = db.updateOnce(fn); !errors.Is(err, badger.ErrConflict) {
+			return since, err
+		}
+		log.Printf("database: transaction conflict, retrying")
+	}
+	return since, err
+}
+
+func (db *DB) updateOnce(fn func(txn *badger.Txn) error) (since uint64, err error) {
+	release, err := db.acquire()
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+	if !db.isManaged.Load() {
+		err = db.badger.Update(func(txn *badger.Txn) error {
+			since = txn.ReadTs()
+			return fn(txn)
+		})
+		return since, db.checkHealth(err)
+	}
+	if db.badger.IsClosed() {
+		return 0, db.checkHealth(badger.ErrDBClosed)
+	}
+	txn := db.badger.NewTransactionAt(math.MaxUint64, true)
+	defer txn.Discard()
+	if err := fn(txn); err != nil {
+		return 0, db.checkHealth(err)
+	}
+	since = db.badger.MaxVersion()
+	return since, db.checkHealth(txn.CommitAt(since+1, nil))
+}
+
+func (db *DB) newStream() *badger.Stream {
+	if db.isManaged.Load() {
+		return db.badger.NewStreamAt(db.currentReadTs())
+	}
+	return db.badger.NewStream()
+}
+
 func (db *DB) Set(key string, value []byte) error {
 	if db == nil {
 		return ErrNotRunning
@@ -137,22 +592,40 @@ func (db *DB) Set(key string, value []byte) error {
 		return ErrNotRunning
 	}
 
-	return db.badger.Update(func(txn *badger.Txn) error {
+	if ok, err := db.batched(func(wb *badger.WriteBatch) error {
+		return wb.Set([]byte(key), value)
+	}); ok {
+		return err
+	}
+	return db.update(func(txn *badger.Txn) error {
 		e := badger.NewEntry([]byte(key), value)
 		return txn.SetEntry(e)
 	})
 }
 
 func (db *DB) Get(key string) ([]byte, error) {
+	value, _, err := db.GetVersioned(key)
+	return value, err
+}
+
+// GetVersioned returns the value of key together with its commit version,
+// which can be passed back to SetChecked and DeleteChecked.
+func (db *DB) GetVersioned(key string) ([]byte, uint64, error) {
 	if db == nil {
-		return nil, ErrNotRunning
+		return nil, 0, ErrNotRunning
 	}
 	if !db.isRunning.Load() {
-		return nil, ErrNotRunning
+		return nil, 0, ErrNotRunning
+	}
+	if db.isHistoric() {
+		return db.getAt(key, db.readTs.Load())
 	}
 
-	var result []byte
-	err := db.badger.View(func(txn *badger.Txn) error {
+	var (
+		result  []byte
+		version uint64
+	)
+	err := db.view(func(txn *badger.Txn) error {
 		item, err := txn.Get([]byte(key))
 		if err != nil {
 			return err
@@ -163,12 +636,13 @@ func (db *DB) Get(key string) ([]byte, error) {
 			return err
 		}
 		result = append([]byte{}, val...)
+		version = item.Version()
 		return nil
 	})
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
-	return result, nil
+	return result, version, nil
 }
 
 func (db *DB) Delete(key string) error {
@@ -179,7 +653,12 @@ func (db *DB) Delete(key string) error {
 		return ErrNotRunning
 	}
 
-	return db.badger.Update(func(txn *badger.Txn) error {
+	if ok, err := db.batched(func(wb *badger.WriteBatch) error {
+		return wb.Delete([]byte(key))
+	}); ok {
+		return err
+	}
+	return db.update(func(txn *badger.Txn) error {
 		return txn.Delete([]byte(key))
 	})
 }
@@ -195,11 +674,25 @@ func (db *DB) List(limit *int, startCursor *string) (keys []Key, cursor string,
 		count   = 0
 		lastKey string
 	)
+	if limit == nil {
+		limit = func(i int) *int { return &i }(db.PageSize())
+	}
+
+	if db.isHistoric() {
+		keys, err = db.listAt(limit, startCursor, db.readTs.Load())
+		if len(keys) > 0 {
+			lastKey = keys[len(keys)-1]
+		}
+		if limit != nil && len(keys) < *limit {
+			lastKey = "end"
+		}
+		return keys, lastKey, err
+	}
 
-	err = db.badger.View(func(txn *badger.Txn) error {
-		opts := badger.DefaultIteratorOptions
-		opts.PrefetchSize = 10
+	err = db.view(func(txn *badger.Txn) error {
+		opts := db.iteratorOptions()
 		opts.PrefetchValues = false
+		opts.InternalAccess = db.showInternal.Load()
 
 		it := txn.NewIterator(opts)
 		defer it.Close()
@@ -213,7 +706,11 @@ func (db *DB) List(limit *int, startCursor *string) (keys []Key, cursor string,
 			it.Rewind()
 		}
 
+		ignored := db.ignoredUnder(nil)
 		for ; it.Valid(); it.Next() {
+			if !ignored.skip(it, false) {
+				break
+			}
 			item := it.Item()
 			key := string(item.Key())
 
@@ -243,10 +740,13 @@ func (db *DB) Search(prefix string, limit *int, offset int) (keys []Key, err err
 		return nil, ErrNotRunning
 	}
 	if limit == nil {
-		limit = func(i int) *int { return &i }(defaultLimit)
+		limit = func(i int) *int { return &i }(db.PageSize())
+	}
+	if db.isHistoric() {
+		return db.searchAt(prefix, *limit, offset, db.readTs.Load())
 	}
 
-	tx := db.badger.NewTransaction(false)
+	tx := db.newReadTxn()
 	results, err := db.query(tx, dsq.Query{
 		Prefix:            prefix,
 		Limit:             *limit,
@@ -270,6 +770,38 @@ func (db *DB) Search(prefix string, limit *int, offset int) (keys []Key, err err
 	return keys, nil
 }
 
+// PageSize is how many keys List and Search return when no limit is given.
+func (db *DB) PageSize() int {
+	return int(db.pageSize.Load())
+}
+
+// iteratorOptions are badger's defaults with the prefetch size of the
+// connection.
+func (db *DB) iteratorOptions() badger.IteratorOptions {
+	opts := badger.DefaultIteratorOptions
+	opts.PrefetchSize = int(db.prefetchSize.Load())
+	return opts
+}
+
+// Count returns the number of keys starting with prefix.
+func (db *DB) Count(prefix string) (count int, err error) {
+	if db == nil {
+		return 0, ErrNotRunning
+	}
+	if !db.isRunning.Load() {
+		return 0, ErrNotRunning
+	}
+
+	err = db.view(func(txn *badger.Txn) error {
+		db.eachKey(txn, []byte(prefix), func(*badger.Item) bool {
+			count++
+			return true
+		})
+		return nil
+	})
+	return count, err
+}
+
 func (db *DB) query(tx *badger.Txn, q dsq.Query) (_ dsq.Results, err error) {
 	defer func() {
 		if r := recover(); r != nil {
@@ -281,9 +813,10 @@ func (db *DB) query(tx *badger.Txn, q dsq.Query) (_ dsq.Results, err error) {
 	if !db.IsRunning() {
 		return nil, ErrNotRunning
 	}
-	opt := badger.DefaultIteratorOptions
+	opt := db.iteratorOptions()
 	opt.PrefetchValues = !q.KeysOnly
 	opt.Prefix = []byte(q.Prefix)
+	opt.InternalAccess = db.showInternal.Load()
 
 	// Handle ordering
 	if len(q.Orders) > 0 {
@@ -320,8 +853,17 @@ func (db *DB) query(tx *badger.Txn, q dsq.Query) (_ dsq.Results, err error) {
 		}
 	}
 
+	release, err := db.acquire()
+	if err != nil {
+		return nil, err
+	}
+	// the results are read after query returns, they belong to the
+	// connection the query was made on
+	closed := db.connected().Done()
+	ignored := db.ignoredUnder(opt.Prefix)
 	it := tx.NewIterator(opt)
 	results := dsq.ResultsWithContext(q, func(ctx context.Context, output chan<- dsq.Result) {
+		defer release()
 		defer tx.Discard()
 		defer it.Close()
 
@@ -331,6 +873,9 @@ func (db *DB) query(tx *badger.Txn, q dsq.Query) (_ dsq.Results, err error) {
 			if !db.IsRunning() {
 				return
 			}
+			if !ignored.skip(it, opt.Reverse) {
+				break
+			}
 
 			if len(q.Filters) == 0 {
 				skipped++
@@ -363,7 +908,7 @@ func (db *DB) query(tx *badger.Txn, q dsq.Query) (_ dsq.Results, err error) {
 			if err != nil {
 				select {
 				case output <- dsq.Result{Error: err}:
-				case <-db.stopChan:
+				case <-closed:
 					return
 				case <-ctx.Done():
 					return
@@ -378,6 +923,9 @@ func (db *DB) query(tx *badger.Txn, q dsq.Query) (_ dsq.Results, err error) {
 			if !db.IsRunning() {
 				return
 			}
+			if !ignored.skip(it, opt.Reverse) {
+				break
+			}
 			item := it.Item()
 			e := dsq.Entry{Key: string(item.Key())}
 
@@ -406,7 +954,7 @@ func (db *DB) query(tx *badger.Txn, q dsq.Query) (_ dsq.Results, err error) {
 			select {
 			case output <- result:
 				sent++
-			case <-db.stopChan:
+			case <-closed:
 				return
 			case <-ctx.Done():
 				return
@@ -417,6 +965,32 @@ func (db *DB) query(tx *badger.Txn, q dsq.Query) (_ dsq.Results, err error) {
 	return results, nil
 }
 
+// compactOnClose leaves a heavily modified directory tidy for its owning
+// application: everything is flattened into one level and the value log
+// garbage collected.
+func (db *DB) compactOnClose() {
+	if db.compactOnCloseWrites <= 0 || db.isReadOnly.Load() || db.isInMemory.Load() {
+		return
+	}
+	writes := db.writes.Load()
+	if writes < int64(db.compactOnCloseWrites) {
+		return
+	}
+	log.Printf("database: compacting on close after %d writes", writes)
+	if err := db.badger.Flatten(db.badgerOpts.NumCompactors); err != nil {
+		log.Printf("database: flatten on close: %v", err)
+		return
+	}
+	for {
+		if err := db.badger.RunValueLogGC(db.gcRatio); err != nil {
+			if !errors.Is(err, badger.ErrNoRewrite) {
+				log.Printf("database: value log gc on close: %v", err)
+			}
+			return
+		}
+	}
+}
+
 func filter(filters []dsq.Filter, entry dsq.Entry) bool {
 	for _, f := range filters {
 		if !f.Filter(entry) {
@@ -446,12 +1020,25 @@ func (db *DB) Close() {
 	if !db.isRunning.Load() {
 		return
 	}
-	close(db.stopChan)
+	db.conn.Load().close()
+	db.waitReaders()
+	db.closeBatch()
+	if db.gcDone != nil {
+		// a GC round must not touch the value log while badger closes it
+		<-db.gcDone
+	}
+	if !db.health.unhealthy.Load() {
+		db.compactOnClose()
+	}
 
+	// a failed close still leaves the database unusable, so the key and the
+	// copy go anyway
 	if err := db.badger.Close(); err != nil {
 		log.Printf("database: close: %v", err)
-		return
 	}
+	// the handle stays, closed, for readers still racing the close: view
+	// answers them ErrDBClosed instead of dereferencing nil
 	db.isRunning.Store(false)
-	db.badger = nil
+	db.wipeEncryptionKey()
+	db.removeCopy()
 }
@@ -0,0 +1,226 @@
+package database
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+const (
+	ErrBatchingManaged = DBError("write batching isn't available for managed databases")
+
+	DefaultBatchEntries  = 1000
+	DefaultBatchInterval = time.Second
+)
+
+// BatchStatus describes the write batching mode of the connection.
+type BatchStatus struct {
+	Enabled    bool  `json:"enabled"`
+	MaxEntries int   `json:"max_entries"`
+	IntervalMs int64 `json:"interval_ms"`
+	Pending    int   `json:"pending"`
+}
+
+// writeBuffer routes Set and Delete through a badger WriteBatch, committed
+// every maxEntries entries, every interval and on Flush. Buffered writes are
+// invisible to reads until they're flushed.
+type writeBuffer struct {
+	mx         sync.Mutex
+	wb         *badger.WriteBatch
+	pending    int
+	maxEntries int
+	interval   time.Duration
+	// err is the failure of a background flush, reported by the next Flush
+	err error
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// SetBatching switches write batching on, or off with maxEntries zero, for
+// the rest of the connection. Switching it off flushes the pending writes.
+func (db *DB) SetBatching(maxEntries int, interval time.Duration) error {
+	if db == nil {
+		return ErrNotRunning
+	}
+	if !db.isRunning.Load() {
+		return ErrNotRunning
+	}
+	if db.isReadOnly.Load() {
+		return ErrReadOnly
+	}
+	if maxEntries > 0 && db.isManaged.Load() {
+		return ErrBatchingManaged
+	}
+
+	db.batchMx.Lock()
+	defer db.batchMx.Unlock()
+	if db.batch != nil {
+		if _, err := db.batch.close(); err != nil {
+			return err
+		}
+		db.batch = nil
+	}
+	if maxEntries <= 0 {
+		return nil
+	}
+	if interval <= 0 {
+		interval = DefaultBatchInterval
+	}
+	b := &writeBuffer{
+		wb: db.badger.NewWriteBatch(), maxEntries: maxEntries, interval: interval,
+		stop: make(chan struct{}), done: make(chan struct{}),
+	}
+	go b.flushPeriodically(db.badger)
+	db.batch = b
+	return nil
+}
+
+// Batching reports the write batching mode.
+func (db *DB) Batching() BatchStatus {
+	db.batchMx.Lock()
+	defer db.batchMx.Unlock()
+	if db.batch == nil {
+		return BatchStatus{}
+	}
+	db.batch.mx.Lock()
+	defer db.batch.mx.Unlock()
+	return BatchStatus{
+		Enabled: true, MaxEntries: db.batch.maxEntries,
+		IntervalMs: db.batch.interval.Milliseconds(), Pending: db.batch.pending,
+	}
+}
+
+// FlushBatch commits the buffered writes and returns how many there were.
+func (db *DB) FlushBatch() (int, error) {
+	if db == nil {
+		return 0, ErrNotRunning
+	}
+	if !db.isRunning.Load() {
+		return 0, ErrNotRunning
+	}
+	db.batchMx.Lock()
+	defer db.batchMx.Unlock()
+	if db.batch == nil {
+		return 0, nil
+	}
+	return db.batch.flush(db.badger)
+}
+
+// DiscardBatch drops the buffered writes without committing them and returns
+// how many there were. Batching stays on. Writes badger already committed on
+// its own, when the batch outgrew a transaction, aren't undone.
+func (db *DB) DiscardBatch() int {
+	if db == nil {
+		return 0
+	}
+	db.batchMx.Lock()
+	defer db.batchMx.Unlock()
+	if db.batch == nil {
+		return 0
+	}
+	return db.batch.discard(db.badger)
+}
+
+// batched adds a write to the buffer, reporting false when batching is off.
+func (db *DB) batched(fn func(wb *badger.WriteBatch) error) (bool, error) {
+	db.batchMx.Lock()
+	defer db.batchMx.Unlock()
+	if db.batch == nil {
+		return false, nil
+	}
+	if db.readTs.Load() != 0 {
+		return true, ErrReadOnlyTs
+	}
+	db.writes.Add(1)
+	db.touch()
+	return true, db.batch.add(db.badger, fn)
+}
+
+// closeBatch flushes and stops the buffer of a closing connection.
+func (db *DB) closeBatch() {
+	db.batchMx.Lock()
+	defer db.batchMx.Unlock()
+	if db.batch == nil {
+		return
+	}
+	if n, err := db.batch.close(); err != nil {
+		log.Printf("database: flushing %d batched writes on close: %v", n, err)
+	}
+	db.batch = nil
+}
+
+func (b *writeBuffer) add(bdb *badger.DB, fn func(wb *badger.WriteBatch) error) error {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+	if err := fn(b.wb); err != nil {
+		return err
+	}
+	b.pending++
+	if b.pending < b.maxEntries {
+		return nil
+	}
+	_, err := b.flushLocked(bdb)
+	return err
+}
+
+func (b *writeBuffer) flush(bdb *badger.DB) (int, error) {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+	return b.flushLocked(bdb)
+}
+
+// flushLocked commits the batch and starts a new one, a WriteBatch can't be
+// used after Flush.
+func (b *writeBuffer) flushLocked(bdb *badger.DB) (int, error) {
+	n, err := b.pending, b.wb.Flush()
+	b.pending = 0
+	if bdb != nil {
+		b.wb = bdb.NewWriteBatch()
+	}
+	if err == nil {
+		err, b.err = b.err, nil
+	}
+	return n, err
+}
+
+func (b *writeBuffer) discard(bdb *badger.DB) int {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+	n := b.pending
+	b.wb.Cancel()
+	b.wb, b.pending, b.err = bdb.NewWriteBatch(), 0, nil
+	return n
+}
+
+func (b *writeBuffer) flushPeriodically(bdb *badger.DB) {
+	defer close(b.done)
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-b.stop:
+			return
+		case <-ticker.C:
+		}
+		b.mx.Lock()
+		if b.pending > 0 {
+			if n, err := b.flushLocked(bdb); err != nil {
+				log.Printf("database: flushing %d batched writes: %v", n, err)
+				b.err = err
+			}
+		}
+		b.mx.Unlock()
+	}
+}
+
+// close stops the periodic flush and commits what's left.
+func (b *writeBuffer) close() (int, error) {
+	close(b.stop)
+	<-b.done
+	b.mx.Lock()
+	defer b.mx.Unlock()
+	return b.flushLocked(nil)
+}
@@ -0,0 +1,12 @@
+package database
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// cloneFile reflinks src into dst on copy-on-write filesystems (btrfs, xfs).
+func cloneFile(dst, src *os.File) error {
+	return unix.IoctlFileClone(int(dst.Fd()), int(src.Fd()))
+}
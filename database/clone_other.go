@@ -0,0 +1,12 @@
+//go:build !linux
+
+package database
+
+import (
+	"errors"
+	"os"
+)
+
+func cloneFile(_, _ *os.File) error {
+	return errors.ErrUnsupported
+}
@@ -0,0 +1,151 @@
+package database
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+const compactionFeedSize = 100
+
+const (
+	CompactionStarted   = "started"
+	CompactionProgress  = "progress"
+	CompactionSummary   = "summary"
+	CompactionDone      = "done"
+	CompactionFailed    = "failed"
+	CompactionFlattened = "flattened"
+)
+
+// Badger's compaction log formats. The event logger matches on the format
+// string rather than the rendered message so arguments can be read directly.
+const (
+	fmtCompactAttempt  = "Attempting to compact with %+v\n"
+	fmtCompactKeys     = "[%d] LOG Compact. Added %d keys. Skipped %d keys. Iteration took: %v"
+	fmtCompactDone     = "[Compactor: %d] Compaction for level: %d DONE"
+	fmtCompactFailed   = "[Compactor: %d] LOG Compact FAILED with error: %+v: %+v"
+	fmtCompactFlatten  = "All tables consolidated into one level. Flattening done.\n"
+	fmtCompactSummary  = "[%d]%s LOG Compact %d->%d (%d, %d -> %d tables with %d splits)."
+	compactSummaryArgs = 12
+)
+
+type CompactionEvent struct {
+	Time         time.Time `json:"time"`
+	Kind         string    `json:"kind"`
+	Compactor    int       `json:"compactor"`
+	FromLevel    int       `json:"from_level"`
+	ToLevel      int       `json:"to_level"`
+	TopTables    int       `json:"top_tables"`
+	BotTables    int       `json:"bot_tables"`
+	NewTables    int       `json:"new_tables"`
+	AddedKeys    int       `json:"added_keys"`
+	SkippedKeys  int       `json:"skipped_keys"`
+	DeletedBytes int64     `json:"deleted_bytes"`
+	Took         string    `json:"took"`
+	Message      string    `json:"message"`
+}
+
+// eventLogger implements badger.Logger. Errors go to the standard log as
+// before, compaction related messages are turned into CompactionEvent.
+type eventLogger struct {
+	mx      *sync.Mutex
+	feed    []CompactionEvent
+	handler func(CompactionEvent)
+}
+
+func newEventLogger() *eventLogger {
+	return &eventLogger{mx: new(sync.Mutex)}
+}
+
+func (l *eventLogger) Errorf(f string, v ...interface{}) {
+	log.Printf("badger ERROR: "+f, v...)
+	if f == fmtCompactFailed && len(v) == 3 {
+		l.emit(CompactionEvent{Kind: CompactionFailed, Compactor: toInt(v[0]), Message: fmt.Sprint(v[1])})
+	}
+}
+
+func (l *eventLogger) Warningf(f string, v ...interface{}) {
+	if f == fmtCompactFailed && len(v) == 3 {
+		l.emit(CompactionEvent{Kind: CompactionFailed, Compactor: toInt(v[0]), Message: fmt.Sprint(v[1])})
+	}
+}
+
+func (l *eventLogger) Infof(f string, v ...interface{}) {
+	l.parse(f, v)
+}
+
+func (l *eventLogger) Debugf(f string, v ...interface{}) {
+	l.parse(f, v)
+}
+
+func (l *eventLogger) parse(f string, v []interface{}) {
+	switch {
+	case f == fmtCompactAttempt:
+		l.emit(CompactionEvent{Kind: CompactionStarted, Message: fmt.Sprintf(f, v...)})
+	case f == fmtCompactKeys && len(v) == 4:
+		l.emit(CompactionEvent{
+			Kind: CompactionProgress, Compactor: toInt(v[0]),
+			AddedKeys: toInt(v[1]), SkippedKeys: toInt(v[2]), Took: fmt.Sprint(v[3]),
+		})
+	case f == fmtCompactDone && len(v) == 2:
+		l.emit(CompactionEvent{Kind: CompactionDone, Compactor: toInt(v[0]), FromLevel: toInt(v[1])})
+	case f == fmtCompactFlatten:
+		l.emit(CompactionEvent{Kind: CompactionFlattened})
+	case strings.HasPrefix(f, fmtCompactSummary) && len(v) == compactSummaryArgs:
+		l.emit(CompactionEvent{
+			Kind: CompactionSummary, Compactor: toInt(v[0]),
+			FromLevel: toInt(v[2]), ToLevel: toInt(v[3]),
+			TopTables: toInt(v[4]), BotTables: toInt(v[5]), NewTables: toInt(v[6]),
+			Took: fmt.Sprint(v[10]), DeletedBytes: int64(toInt(v[11])),
+		})
+	}
+}
+
+func (l *eventLogger) emit(e CompactionEvent) {
+	e.Time = time.Now()
+
+	l.mx.Lock()
+	l.feed = append(l.feed, e)
+	if len(l.feed) > compactionFeedSize {
+		l.feed = l.feed[len(l.feed)-compactionFeedSize:]
+	}
+	handler := l.handler
+	l.mx.Unlock()
+
+	if handler != nil {
+		handler(e)
+	}
+}
+
+func toInt(v interface{}) int {
+	switch n := v.(type) {
+	case int:
+		return n
+	case int32:
+		return int(n)
+	case int64:
+		return int(n)
+	case uint32:
+		return int(n)
+	case uint64:
+		return int(n)
+	default:
+		return 0
+	}
+}
+
+// OnCompaction registers a handler called for every compaction event.
+func (db *DB) OnCompaction(fn func(CompactionEvent)) {
+	db.logger.mx.Lock()
+	defer db.logger.mx.Unlock()
+	db.logger.handler = fn
+}
+
+// Compactions returns the most recent compaction events, oldest first.
+func (db *DB) Compactions() []CompactionEvent {
+	db.logger.mx.Lock()
+	defer db.logger.mx.Unlock()
+	return append([]CompactionEvent{}, db.logger.feed...)
+}
@@ -0,0 +1,88 @@
+package database
+
+import (
+	"bytes"
+	"sort"
+
+	"github.com/dgraph-io/badger/v4/options"
+	"github.com/dgraph-io/badger/v4/y"
+)
+
+// MixedNamespace collects tables whose key range spans several namespaces.
+const MixedNamespace = "(mixed)"
+
+type CompressionStat struct {
+	Namespace        string  `json:"namespace"`
+	Tables           int     `json:"tables"`
+	OnDiskBytes      int64   `json:"on_disk_bytes"`
+	UncompressedSize int64   `json:"uncompressed_bytes"`
+	Ratio            float64 `json:"ratio"`
+}
+
+func (s *CompressionStat) add(onDisk, uncompressed uint32) {
+	s.Tables++
+	s.OnDiskBytes += int64(onDisk)
+	s.UncompressedSize += int64(uncompressed)
+	if s.OnDiskBytes > 0 {
+		s.Ratio = float64(s.UncompressedSize) / float64(s.OnDiskBytes)
+	}
+}
+
+// Compression returns the name of the block compression in use.
+func (db *DB) Compression() string {
+	return compressionName(db.badgerOpts.Compression)
+}
+
+func compressionName(c options.CompressionType) string {
+	switch c {
+	case options.Snappy:
+		return "snappy"
+	case options.ZSTD:
+		return "zstd"
+	default:
+		return "none"
+	}
+}
+
+// CompressionByNamespace compares the on-disk and uncompressed size of the
+// SST tables, attributed to the first key segment their key range lies in.
+// Values kept in the value log are not block compressed and not counted.
+func (db *DB) CompressionByNamespace(delimiter string) (stats []CompressionStat, total CompressionStat, err error) {
+	if db == nil {
+		return nil, total, ErrNotRunning
+	}
+	if !db.isRunning.Load() {
+		return nil, total, ErrNotRunning
+	}
+
+	namespace := func(key []byte) string {
+		key = y.ParseKey(key)
+		if bytes.HasPrefix(key, []byte(internalKeyPrefix)) {
+			return internalKeyPrefix
+		}
+		return string(firstSegment(key, delimiter))
+	}
+
+	groups := make(map[string]*CompressionStat)
+	for _, t := range db.badger.Tables() {
+		name := namespace(t.Left)
+		if name != namespace(t.Right) {
+			name = MixedNamespace
+		}
+		s, ok := groups[name]
+		if !ok {
+			s = &CompressionStat{Namespace: name}
+			groups[name] = s
+		}
+		s.add(t.OnDiskSize, t.UncompressedSize)
+		total.add(t.OnDiskSize, t.UncompressedSize)
+	}
+
+	for _, s := range groups {
+		stats = append(stats, *s)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].OnDiskBytes > stats[j].OnDiskBytes
+	})
+	return stats, total, nil
+}
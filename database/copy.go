@@ -0,0 +1,100 @@
+package database
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	lockFileName    = "LOCK"
+	sstFileExt      = ".sst"
+	copyDirPattern  = "badger-gui-copy-*"
+	copyDirAttempts = 3
+)
+
+// copyDirRetrying is copyDir retried a few times, a live database may
+// compact files away while they're copied.
+func copyDirRetrying(src string) (dst string, err error) {
+	for attempt := 0; attempt < copyDirAttempts; attempt++ {
+		if dst, err = copyDir(src); err == nil {
+			return dst, nil
+		}
+	}
+	return "", err
+}
+
+// copyDir snapshots a (possibly live) database directory into a fresh temp
+// directory. SSTables are immutable, so they are hard linked when src and the
+// temp dir share a filesystem; everything else is reflinked where supported
+// and copied otherwise. The directory lock is never copied.
+func copyDir(src string) (dst string, err error) {
+	dst, err = os.MkdirTemp("", copyDirPattern)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		if err != nil {
+			_ = os.RemoveAll(dst)
+		}
+	}()
+
+	entries, err := os.ReadDir(src)
+	if err != nil {
+		return "", err
+	}
+	// the MANIFEST goes first so it never references tables newer than the
+	// ones linked below; tables removed in between are caught by open
+	sortManifestFirst(entries)
+	for _, e := range entries {
+		if e.IsDir() || e.Name() == lockFileName {
+			continue
+		}
+		from, to := filepath.Join(src, e.Name()), filepath.Join(dst, e.Name())
+		if strings.HasSuffix(e.Name(), sstFileExt) {
+			if err := os.Link(from, to); err == nil {
+				continue
+			}
+		}
+		if err := copyFile(from, to); err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				// compacted away while copying
+				continue
+			}
+			return "", err
+		}
+	}
+	return dst, nil
+}
+
+func sortManifestFirst(entries []os.DirEntry) {
+	for i, e := range entries {
+		if e.Name() == "MANIFEST" {
+			entries[0], entries[i] = entries[i], entries[0]
+			return
+		}
+	}
+}
+
+func copyFile(from, to string) error {
+	in, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(to, os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if err := cloneFile(out, in); err == nil {
+		return out.Close()
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		_ = out.Close()
+		return err
+	}
+	return out.Close()
+}
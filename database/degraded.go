@@ -0,0 +1,149 @@
+package database
+
+import (
+	"errors"
+	"log"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// memoryErrorBudget is how many memory errors a connection takes before
+// it's reported unhealthy, its next open starting degraded.
+const memoryErrorBudget = 3
+
+// Degraded are the reduced memory settings a connection fell back to after
+// badger ran out of memory or address space for its mmaps.
+type Degraded struct {
+	// Step is 1 for reduced caches, 2 for the smallest ones
+	Step int `json:"step"`
+	// Cause is the error of the open that failed before
+	Cause          string `json:"cause"`
+	BlockCacheSize int64  `json:"block_cache_size"`
+	IndexCacheSize int64  `json:"index_cache_size"`
+	NumMemtables   int    `json:"num_memtables"`
+	MemTableSize   int64  `json:"memtable_size"`
+	// ValueLogFileSize only applies to new value log files, the existing
+	// ones are mapped at their size
+	ValueLogFileSize int64 `json:"value_log_file_size"`
+}
+
+// degradeSteps are tried in turn while the open keeps failing for memory.
+var degradeSteps = []Degraded{
+	{Step: 1, BlockCacheSize: 64 << 20, IndexCacheSize: 32 << 20, NumMemtables: 3, MemTableSize: 32 << 20, ValueLogFileSize: 256 << 20},
+	{Step: 2, BlockCacheSize: 16 << 20, IndexCacheSize: 8 << 20, NumMemtables: 2, MemTableSize: 16 << 20, ValueLogFileSize: 64 << 20},
+}
+
+// memoryErrorTexts are in the errors of failed allocations and mmaps, badger
+// wraps them into strings more often than not. An mmap failing for another
+// reason, a permission or a truncated file, isn't one.
+var memoryErrorTexts = []string{
+	"cannot allocate memory", "out of memory", "not enough memory", "paging file is too small",
+	"insufficient system resources",
+}
+
+// degradeStart is the degradeSteps step the next open of path starts at.
+type degradeStart struct {
+	path string
+	step int
+}
+
+func isMemoryError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, syscall.ENOMEM) {
+		return true
+	}
+	msg := strings.ToLower(err.Error())
+	for _, text := range memoryErrorTexts {
+		if strings.Contains(msg, text) {
+			return true
+		}
+	}
+	return false
+}
+
+// apply lowers the memory settings of opts to the step's, smaller ones are
+// kept. A zero index cache keeps every table index on the heap, so it's
+// bounded too.
+func (d Degraded) apply(opts badger.Options) badger.Options {
+	index := d.IndexCacheSize
+	if opts.IndexCacheSize > 0 {
+		index = min(index, opts.IndexCacheSize)
+	}
+	return opts.
+		WithBlockCacheSize(min(opts.BlockCacheSize, d.BlockCacheSize)).
+		WithIndexCacheSize(index).
+		WithNumMemtables(min(opts.NumMemtables, d.NumMemtables)).
+		WithMemTableSize(min(opts.MemTableSize, d.MemTableSize)).
+		WithValueLogFileSize(min(opts.ValueLogFileSize, d.ValueLogFileSize))
+}
+
+// openBadger opens badger with opts, retrying with the degradeSteps from
+// step from on while it fails for memory, instead of failing outright on
+// small machines. The settings it fell back to are returned, nil when opts
+// went through.
+func openBadger(opts badger.Options, managed bool, from int) (*badger.DB, *Degraded, error) {
+	open := badger.Open
+	if managed {
+		open = badger.OpenManaged
+	}
+	var (
+		cause string
+		err   error
+	)
+	if from == 0 {
+		db, err := open(opts)
+		if !isMemoryError(err) {
+			return db, nil, err
+		}
+		cause = err.Error()
+		from = 1
+	} else {
+		cause = "memory errors on the previous connection"
+	}
+	for _, step := range degradeSteps[min(from, len(degradeSteps))-1:] {
+		stepOpts := step.apply(opts)
+		log.Printf("database: opening with reduced caches, step %d, after: %s", step.Step, cause)
+		var db *badger.DB
+		if db, err = open(stepOpts); err == nil {
+			step.Cause = cause
+			step.BlockCacheSize, step.IndexCacheSize = stepOpts.BlockCacheSize, stepOpts.IndexCacheSize
+			step.NumMemtables, step.MemTableSize = stepOpts.NumMemtables, stepOpts.MemTableSize
+			step.ValueLogFileSize = stepOpts.ValueLogFileSize
+			return db, &step, nil
+		}
+		if !isMemoryError(err) {
+			return nil, nil, err
+		}
+		cause = err.Error()
+	}
+	return nil, nil, err
+}
+
+// countMemoryError spends the memory error budget of the connection on err.
+// Once it's spent the connection is reported unhealthy and the next open
+// starts a step further down.
+func (db *DB) countMemoryError(err error) bool {
+	if !isMemoryError(err) || db.memoryErrors.Add(1) < memoryErrorBudget {
+		return false
+	}
+	step := 0
+	if d := db.degraded.Load(); d != nil {
+		step = d.Step
+	}
+	db.degradeFrom.Store(&degradeStart{path: filepath.Clean(db.conn.Load().path), step: step + 1})
+	return true
+}
+
+// Degraded returns the reduced memory settings the connection runs with,
+// nil when it got the requested ones.
+func (db *DB) Degraded() *Degraded {
+	if db == nil || !db.isRunning.Load() {
+		return nil
+	}
+	return db.degraded.Load()
+}
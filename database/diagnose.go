@@ -0,0 +1,164 @@
+package database
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+const (
+	CauseEncryptionRequired = "encryption_required"
+	CauseWrongKey           = "wrong_key"
+	CausePermissionDenied   = "permission_denied"
+	CauseLocked             = "locked"
+	CauseUnsupportedVersion = "unsupported_version"
+	CauseMissingManifest    = "missing_manifest"
+	CauseNotFound           = "not_found"
+	CauseUnknown            = "unknown"
+
+	// supportedManifestVersion is the badger v4 on-disk format version
+	supportedManifestVersion = 8
+)
+
+var (
+	manifestMagic = []byte("Bdgr")
+	// registrySanity is stored in plain text after the IV of unencrypted key
+	// registries
+	registrySanity = []byte("Hello Badger")
+)
+
+// OpenDiagnostic explains why a database couldn't be opened. Error is the raw
+// badger error, Cause one of the Cause constants, and the other fields are
+// whatever could be found out about the directory.
+type OpenDiagnostic struct {
+	Error string `json:"error"`
+	Cause string `json:"cause"`
+	Hint  string `json:"hint"`
+	Path  string `json:"path"`
+
+	ManifestMissing bool `json:"manifest_missing"`
+	// ManifestVersion is the on-disk format version, 0 when unreadable
+	ManifestVersion  int `json:"manifest_version,omitempty"`
+	SupportedVersion int `json:"supported_version"`
+	// PermissionDenied is the first file that can't be accessed, Inaccessible
+	// all of them
+	PermissionDenied string             `json:"permission_denied,omitempty"`
+	Inaccessible     []InaccessibleFile `json:"inaccessible,omitempty"`
+	// ReadOnlyAvailable is set when the files can be read but not written,
+	// so opening read-only would work
+	ReadOnlyAvailable bool `json:"read_only_available,omitempty"`
+	// LockHolderPID is read from the LOCK file, 0 when unknown
+	LockHolderPID      int  `json:"lock_holder_pid,omitempty"`
+	EncryptionRequired bool `json:"encryption_required"`
+}
+
+// DiagnoseOpen inspects the database directory after Open failed with err.
+func DiagnoseOpen(o OpenOptions, err error) OpenDiagnostic {
+	d := OpenDiagnostic{
+		Error: err.Error(), Cause: CauseUnknown, Path: o.Path,
+		SupportedVersion: supportedManifestVersion,
+	}
+	if o.Path == "" {
+		return d
+	}
+	msg := strings.ToLower(err.Error())
+	path, valueDir := LongPath(o.Path), LongPath(o.ValueDir)
+
+	info, statErr := os.Stat(path)
+	switch {
+	case errors.Is(statErr, fs.ErrNotExist):
+		d.Cause, d.Hint = CauseNotFound, "the directory doesn't exist, read-only databases aren't created"
+		return d
+	case statErr == nil && !info.IsDir():
+		d.Cause, d.Hint = CauseNotFound, "the path is a file, select the database directory"
+		return d
+	}
+
+	if valueDir != "" && valueDir != path {
+		info, statErr := os.Stat(valueDir)
+		if errors.Is(statErr, fs.ErrNotExist) || statErr == nil && !info.IsDir() {
+			d.Cause, d.Hint = CauseNotFound, "the value log directory doesn't exist"
+			return d
+		}
+	}
+	d.Inaccessible = inaccessibleFiles(path, valueDir, o.ReadOnly || o.CopyFirst)
+	if len(d.Inaccessible) > 0 {
+		d.PermissionDenied = d.Inaccessible[0].Path
+	}
+	d.EncryptionRequired = registryEncrypted(path)
+	d.ManifestVersion, d.ManifestMissing = manifestVersion(path)
+
+	switch {
+	case errors.Is(err, ErrWrongPassword) && len(o.EncryptionKey) == 0:
+		d.Cause, d.Hint = CauseEncryptionRequired, "the database is encrypted, provide its key"
+	case errors.Is(err, ErrWrongPassword):
+		d.Cause, d.Hint = CauseWrongKey, "the key doesn't match the one the database was encrypted with"
+	case d.PermissionDenied != "" || strings.Contains(msg, "permission denied"):
+		d.Cause = CausePermissionDenied
+		d.Hint = "the current user can't access the database files, fix the ownership or open read-only"
+	case strings.Contains(msg, "another process is using this badger database"):
+		d.Cause, d.LockHolderPID = CauseLocked, lockHolder(path)
+		d.Hint = "another process holds the directory lock, close it or open with copy_first"
+	case d.ManifestVersion != 0 && d.ManifestVersion != supportedManifestVersion,
+		strings.Contains(msg, "manifest has unsupported version"):
+		d.Cause = CauseUnsupportedVersion
+		d.Hint = "the database was written by a different badger major version"
+	case d.ManifestMissing:
+		d.Cause, d.Hint = CauseMissingManifest, "data files exist without a MANIFEST, restore it from a backup"
+	}
+	return d
+}
+
+// manifestVersion reads the format version from the MANIFEST header. The
+// manifest counts as missing only when tables or value logs exist without it.
+func manifestVersion(dir string) (version int, missing bool) {
+	f, err := os.Open(filepath.Join(dir, badger.ManifestFilename))
+	if errors.Is(err, fs.ErrNotExist) {
+		tables, _ := filepath.Glob(filepath.Join(dir, "*"+sstFileExt))
+		vlogs, _ := filepath.Glob(filepath.Join(dir, "*.vlog"))
+		return 0, len(tables)+len(vlogs) > 0
+	}
+	if err != nil {
+		return 0, false
+	}
+	defer f.Close()
+
+	var header [8]byte
+	if _, err := io.ReadFull(f, header[:]); err != nil || !bytes.Equal(header[:4], manifestMagic) {
+		return 0, false
+	}
+	return int(binary.BigEndian.Uint16(header[6:8])), false
+}
+
+// registryEncrypted tells whether the key registry's sanity text is
+// encrypted, which means the database can't be opened without a key.
+func registryEncrypted(dir string) bool {
+	f, err := os.Open(filepath.Join(dir, badger.KeyRegistryFileName))
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	buf := make([]byte, 16+len(registrySanity))
+	if _, err := io.ReadFull(f, buf); err != nil {
+		return false
+	}
+	return !bytes.Equal(buf[16:], registrySanity)
+}
+
+func lockHolder(dir string) int {
+	bt, err := os.ReadFile(filepath.Join(dir, lockFileName))
+	if err != nil {
+		return 0
+	}
+	pid, _ := strconv.Atoi(strings.TrimSpace(string(bt)))
+	return pid
+}
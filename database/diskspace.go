@@ -0,0 +1,132 @@
+package database
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+const (
+	SpaceRestore = "restore"
+	SpaceImport  = "import"
+	SpaceFlatten = "flatten"
+
+	// restoreExpansion is how many times its size a backup is taken to need
+	// once loaded: its values go into the value log and the LSM tree before
+	// compactions drop what's superseded. Compressed archives may grow more.
+	restoreExpansion = 3
+	// importExpansion is the same for raw imported keys and values
+	importExpansion = 2
+	// spaceHeadroom is kept free on top of every estimate, for memtable
+	// flushes, manifest rewrites and a fresh value log file
+	spaceHeadroom = 256 << 20
+)
+
+// SpaceEstimate compares the disk space a write operation may take with the
+// free space of the database directory that has the least of it.
+type SpaceEstimate struct {
+	Operation string `json:"operation"`
+	Dir       string `json:"dir"`
+	// Input is the size the estimate is based on: the backup or the imported
+	// data, the LSM tree for a flatten
+	Input      int64  `json:"input"`
+	Required   uint64 `json:"required"`
+	Free       uint64 `json:"free"`
+	Sufficient bool   `json:"sufficient"`
+	// Unknown is set when the free space can't be read here, the estimate
+	// holds nothing back then
+	Unknown bool `json:"unknown,omitempty"`
+}
+
+// EstimateSpace estimates the disk space operation takes for input bytes,
+// the size of the backup or of the imported data, and checks it against the
+// free space. A flatten rewrites the whole LSM tree before dropping the old
+// tables, its input is ignored. Badger handles running out of disk badly, it
+// can leave the value log or the manifest truncated, so the estimates are
+// conservative. In-memory databases always have room.
+func (db *DB) EstimateSpace(operation string, input int64) (SpaceEstimate, error) {
+	estimate := SpaceEstimate{Operation: operation, Input: input, Sufficient: true}
+	if db == nil {
+		return estimate, ErrNotRunning
+	}
+	if !db.isRunning.Load() {
+		return estimate, ErrNotRunning
+	}
+	if db.isInMemory.Load() {
+		return estimate, nil
+	}
+
+	if err := estimate.require(input); err != nil {
+		return estimate, err
+	}
+	if operation == SpaceFlatten {
+		lsm, _ := db.badger.Size()
+		estimate.Input = lsm
+		estimate.Required = uint64(lsm) + spaceHeadroom
+	}
+
+	dirs := []string{db.badgerOpts.Dir}
+	if db.badgerOpts.ValueDir != db.badgerOpts.Dir {
+		dirs = append(dirs, db.badgerOpts.ValueDir)
+	}
+	estimate.check(dirs)
+	return estimate, nil
+}
+
+// EstimateRestoreDir estimates the disk space a restore of input bytes into
+// the new database directory dir takes, checked against the free space of
+// dir or, while it doesn't exist yet, of its nearest existing parent. No
+// connection is needed.
+func EstimateRestoreDir(dir string, input int64) (SpaceEstimate, error) {
+	estimate := SpaceEstimate{Operation: SpaceRestore, Input: input, Sufficient: true}
+	if err := estimate.require(input); err != nil {
+		return estimate, err
+	}
+	dir = filepath.Clean(dir)
+	for {
+		if _, err := os.Stat(LongPath(dir)); err == nil {
+			break
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+	estimate.check([]string{dir})
+	return estimate, nil
+}
+
+// require sets the space the operation of the estimate takes for input
+// bytes.
+func (e *SpaceEstimate) require(input int64) error {
+	switch e.Operation {
+	case SpaceRestore:
+		e.Required = uint64(max(input, 0)) * restoreExpansion
+	case SpaceImport:
+		e.Required = uint64(max(input, 0)) * importExpansion
+	case SpaceFlatten:
+	default:
+		return fmt.Errorf("unknown operation %q", e.Operation)
+	}
+	e.Required += spaceHeadroom
+	return nil
+}
+
+// check compares the required space with the free space of the dir that
+// has the least of it.
+func (e *SpaceEstimate) check(dirs []string) {
+	for i, dir := range dirs {
+		free, err := freeSpace(dir)
+		if err != nil {
+			log.Printf("database: reading free space of %s: %v", dir, err)
+			e.Unknown, e.Sufficient = true, true
+			return
+		}
+		if i == 0 || free < e.Free {
+			e.Dir, e.Free = dir, free
+		}
+	}
+	e.Sufficient = e.Free >= e.Required
+}
@@ -0,0 +1,10 @@
+//go:build !linux && !darwin && !windows
+
+package database
+
+import "errors"
+
+// freeSpace isn't implemented here, estimates are reported as unknown.
+func freeSpace(string) (uint64, error) {
+	return 0, errors.ErrUnsupported
+}
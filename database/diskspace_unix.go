@@ -0,0 +1,14 @@
+//go:build linux || darwin
+
+package database
+
+import "golang.org/x/sys/unix"
+
+// freeSpace returns the bytes of dir's filesystem available to the user.
+func freeSpace(dir string) (uint64, error) {
+	var st unix.Statfs_t
+	if err := unix.Statfs(dir, &st); err != nil {
+		return 0, err
+	}
+	return uint64(st.Bavail) * uint64(st.Bsize), nil
+}
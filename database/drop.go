@@ -0,0 +1,21 @@
+package database
+
+// DropPrefix deletes every key under prefix at once. Badger blocks writes
+// while it drops the matching tables and memtable entries, which is much
+// faster than deleting the keys one by one but can't be undone.
+func (db *DB) DropPrefix(prefix string) error {
+	if db == nil {
+		return ErrNotRunning
+	}
+	if !db.isRunning.Load() {
+		return ErrNotRunning
+	}
+	if db.isReadOnly.Load() {
+		return ErrReadOnly
+	}
+	if db.readTs.Load() != 0 {
+		return ErrReadOnlyTs
+	}
+	db.writes.Add(1)
+	return db.checkHealth(db.badger.DropPrefix([]byte(prefix)))
+}
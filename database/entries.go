@@ -0,0 +1,174 @@
+package database
+
+import (
+	"errors"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// Touch rewrites the given keys with their current value and UserMeta but a
+// new TTL, all in one transaction. A zero ttl removes the expiry. Keys that
+// don't exist are skipped and returned as missing.
+func (db *DB) Touch(keys []string, ttl time.Duration) (missing []string, err error) {
+	if db == nil {
+		return nil, ErrNotRunning
+	}
+	if !db.isRunning.Load() {
+		return nil, ErrNotRunning
+	}
+
+	err = db.update(func(txn *badger.Txn) error {
+		missing = missing[:0]
+		for _, key := range keys {
+			item, err := txn.Get([]byte(key))
+			if errors.Is(err, badger.ErrKeyNotFound) {
+				missing = append(missing, key)
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			value, err := item.ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			e := badger.NewEntry([]byte(key), value).WithMeta(item.UserMeta())
+			if ttl > 0 {
+				e = e.WithTTL(ttl)
+			}
+			if err := txn.SetEntry(e); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return missing, err
+}
+
+// Duplicate copies the value, UserMeta and expiry of src to dst, leaving src
+// untouched. An existing dst is only replaced when overwrite is set.
+func (db *DB) Duplicate(src, dst string, overwrite bool) error {
+	if db == nil {
+		return ErrNotRunning
+	}
+	if !db.isRunning.Load() {
+		return ErrNotRunning
+	}
+
+	return db.update(func(txn *badger.Txn) error {
+		if !overwrite {
+			_, err := txn.Get([]byte(dst))
+			if err == nil {
+				return ErrKeyExists
+			}
+			if !errors.Is(err, badger.ErrKeyNotFound) {
+				return err
+			}
+		}
+		item, err := txn.Get([]byte(src))
+		if err != nil {
+			return err
+		}
+		value, err := item.ValueCopy(nil)
+		if err != nil {
+			return err
+		}
+		e := badger.NewEntry([]byte(dst), value).WithMeta(item.UserMeta())
+		e.ExpiresAt = item.ExpiresAt()
+		return txn.SetEntry(e)
+	})
+}
+
+// SetChecked writes key only if its current version is still expected, so an
+// edit based on a stale read doesn't silently overwrite a concurrent change.
+// Zero expected skips the check. The current version is returned alongside
+// ErrVersionChanged, and the new version on success.
+func (db *DB) SetChecked(key string, value []byte, expected uint64) (version uint64, err error) {
+	return db.writeChecked(key, expected, func(txn *badger.Txn) error {
+		return txn.Set([]byte(key), value)
+	})
+}
+
+// DeleteChecked is SetChecked for deletes.
+func (db *DB) DeleteChecked(key string, expected uint64) (version uint64, err error) {
+	return db.writeChecked(key, expected, func(txn *badger.Txn) error {
+		return txn.Delete([]byte(key))
+	})
+}
+
+func (db *DB) writeChecked(key string, expected uint64, write func(txn *badger.Txn) error) (version uint64, err error) {
+	var current uint64
+	version, err = db.UpdateKey(key, func(txn *Txn) error {
+		if expected == 0 {
+			return write(txn.txn)
+		}
+		var err error
+		if current, err = txn.Version(key); err != nil {
+			return err
+		}
+		if current != expected {
+			return ErrVersionChanged
+		}
+		return write(txn.txn)
+	})
+	if errors.Is(err, ErrVersionChanged) {
+		return current, err
+	}
+	return version, err
+}
+
+// SetMany writes the entries in as few transactions as badger allows. Keys
+// that already exist are skipped and returned as existing unless overwrite is
+// set, checked in the transaction writing them so a key created meanwhile is
+// never overwritten. Entries marked Delete are ignored.
+func (db *DB) SetMany(entries []Change, overwrite bool) (existing []string, err error) {
+	if db == nil {
+		return nil, ErrNotRunning
+	}
+	if !db.isRunning.Load() {
+		return nil, ErrNotRunning
+	}
+
+	for len(entries) > 0 {
+		var (
+			done    int
+			skipped []string
+		)
+		err := db.update(func(txn *badger.Txn) error {
+			done, skipped = 0, skipped[:0]
+			for _, e := range entries {
+				if e.Delete {
+					done++
+					continue
+				}
+				if !overwrite {
+					_, err := txn.Get([]byte(e.Key))
+					if err == nil {
+						skipped = append(skipped, e.Key)
+						done++
+						continue
+					}
+					if !errors.Is(err, badger.ErrKeyNotFound) {
+						return err
+					}
+				}
+				err := txn.SetEntry(e.entry())
+				if errors.Is(err, badger.ErrTxnTooBig) && done > 0 {
+					return nil
+				}
+				if err != nil {
+					return err
+				}
+				done++
+			}
+			return nil
+		})
+		if err != nil {
+			return existing, err
+		}
+		existing = append(existing, skipped...)
+		entries = entries[done:]
+	}
+	return existing, nil
+}
@@ -0,0 +1,113 @@
+package database
+
+import (
+	"errors"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// ExpiredStats reports entries whose TTL passed but which compaction hasn't
+// discarded yet. They're hidden from reads but still counted by the tables.
+type ExpiredStats struct {
+	Scanned int   `json:"scanned"`
+	Expired int   `json:"expired"`
+	Bytes   int64 `json:"bytes"`
+	Deleted int   `json:"deleted"`
+	// Keys lists the first expired keys, at most maxExpiredKeys
+	Keys []KeyMeta `json:"keys"`
+}
+
+const maxExpiredKeys = 1000
+
+// ExpiredKeys finds the keys under prefix whose newest version has expired.
+// With purge set they're deleted, leaving tombstones that let compaction
+// drop all of their versions.
+func (db *DB) ExpiredKeys(prefix string, purge bool) (stats ExpiredStats, err error) {
+	if db == nil {
+		return stats, ErrNotRunning
+	}
+	if !db.isRunning.Load() {
+		return stats, ErrNotRunning
+	}
+	if purge && db.isReadOnly.Load() {
+		return stats, ErrReadOnly
+	}
+
+	now := uint64(time.Now().Unix())
+	var expired []string
+	err = db.view(func(txn *badger.Txn) error {
+		// expired entries are only visible when iterating all versions
+		it := txn.NewIterator(db.allVersionsOptions([]byte(prefix)))
+		defer it.Close()
+
+		var lastKey []byte
+		for it.Rewind(); it.Valid(); it.Next() {
+			item := it.Item()
+			if lastKey != nil && string(item.Key()) == string(lastKey) {
+				continue
+			}
+			lastKey = item.KeyCopy(lastKey[:0])
+			stats.Scanned++
+
+			expiresAt := item.ExpiresAt()
+			if expiresAt == 0 || expiresAt > now {
+				continue
+			}
+			stats.Expired++
+			stats.Bytes += item.EstimatedSize()
+			if len(stats.Keys) < maxExpiredKeys {
+				stats.Keys = append(stats.Keys, KeyMeta{
+					Key: string(lastKey), Size: item.ValueSize(), ExpiresAt: expiresAt, Version: item.Version(),
+				})
+			}
+			if purge {
+				expired = append(expired, string(lastKey))
+			}
+		}
+		return nil
+	})
+	if err != nil || len(expired) == 0 {
+		return stats, err
+	}
+	stats.Deleted, err = db.purgeExpired(expired)
+	return stats, err
+}
+
+// purgeExpired deletes the keys that are still expired, checked in the
+// transaction deleting them, so a key written again since the scan stays.
+func (db *DB) purgeExpired(keys []string) (deleted int, err error) {
+	for len(keys) > 0 {
+		var done, n int
+		err := db.update(func(txn *badger.Txn) error {
+			done, n = 0, 0
+			for _, key := range keys {
+				// expired entries read as missing
+				_, err := txn.Get([]byte(key))
+				if err == nil {
+					done++
+					continue
+				}
+				if !errors.Is(err, badger.ErrKeyNotFound) {
+					return err
+				}
+				err = txn.Delete([]byte(key))
+				if errors.Is(err, badger.ErrTxnTooBig) && done > 0 {
+					return nil
+				}
+				if err != nil {
+					return err
+				}
+				done++
+				n++
+			}
+			return nil
+		})
+		if err != nil {
+			return deleted, err
+		}
+		deleted += n
+		keys = keys[done:]
+	}
+	return deleted, nil
+}
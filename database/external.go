@@ -0,0 +1,125 @@
+package database
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// fileStamp is the size and modification time of a data file.
+type fileStamp struct {
+	size    int64
+	modTime time.Time
+}
+
+// sourceWatch remembers the data files of the database directory of a
+// read-only or copied connection as they were at open.
+type sourceWatch struct {
+	mx     *sync.Mutex
+	dirs   []string
+	stamps map[string]fileStamp
+}
+
+// ExternalWrites describes the changes another process made to the database
+// directory since the connection opened it.
+type ExternalWrites struct {
+	Path string `json:"path"`
+	// Changed are the data files added or written, Removed those deleted
+	Changed []string `json:"changed"`
+	Removed []string `json:"removed"`
+	// MaxVersion is the version the connection serves data up to, the
+	// versions written since are missing from it
+	MaxVersion uint64 `json:"max_version"`
+}
+
+// stampDirs reads the stamps of the badger data files in dirs.
+func stampDirs(dirs []string) (map[string]fileStamp, error) {
+	stamps := make(map[string]fileStamp)
+	for _, dir := range dirs {
+		entries, err := os.ReadDir(LongPath(dir))
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			name := entry.Name()
+			switch {
+			case name == "MANIFEST", strings.HasSuffix(name, ".sst"), strings.HasSuffix(name, ".vlog"),
+				strings.HasSuffix(name, ".mem"):
+			default:
+				continue
+			}
+			info, err := entry.Info()
+			if err != nil {
+				continue
+			}
+			stamps[filepath.Join(dir, name)] = fileStamp{size: info.Size(), modTime: info.ModTime()}
+		}
+	}
+	return stamps, nil
+}
+
+// sourceDirs are the directories of a read-only or copied connection, which
+// it never writes, nil for the others.
+func sourceDirs(o OpenOptions) []string {
+	if o.Path == "" || !o.ReadOnly && !o.CopyFirst {
+		return nil
+	}
+	dirs := []string{o.Path}
+	if o.ValueDir != "" && filepath.Clean(o.ValueDir) != filepath.Clean(o.Path) {
+		dirs = append(dirs, o.ValueDir)
+	}
+	return dirs
+}
+
+// setSourceWatch starts comparing dirs against stamps, taken before the
+// connection opened so changes made while a copy was taken count too.
+func (db *DB) setSourceWatch(dirs []string, stamps map[string]fileStamp) {
+	db.source.mx.Lock()
+	defer db.source.mx.Unlock()
+	if len(dirs) == 0 {
+		stamps = nil
+	}
+	db.source.dirs, db.source.stamps = dirs, stamps
+}
+
+// ExternalWrites compares the database directory with its state at open and
+// returns the changes, nil when there are none. Only read-only and copied
+// connections are checked: they never write the directory, so any change
+// comes from another process, and their data doesn't follow it until they
+// are reopened. A writable connection holds badger's directory lock instead.
+func (db *DB) ExternalWrites() (*ExternalWrites, error) {
+	if db == nil || !db.isRunning.Load() {
+		return nil, ErrNotRunning
+	}
+	db.source.mx.Lock()
+	dirs, stamps := db.source.dirs, db.source.stamps
+	db.source.mx.Unlock()
+	if stamps == nil {
+		return nil, nil
+	}
+
+	current, err := stampDirs(dirs)
+	if err != nil {
+		return nil, err
+	}
+	writes := ExternalWrites{Path: dirs[0], Changed: []string{}, Removed: []string{}, MaxVersion: db.MaxVersion()}
+	for path, stamp := range current {
+		if was, ok := stamps[path]; !ok || was.size != stamp.size || !was.modTime.Equal(stamp.modTime) {
+			writes.Changed = append(writes.Changed, filepath.Base(path))
+		}
+	}
+	for path := range stamps {
+		if _, ok := current[path]; !ok {
+			writes.Removed = append(writes.Removed, filepath.Base(path))
+		}
+	}
+	if len(writes.Changed) == 0 && len(writes.Removed) == 0 {
+		return nil, nil
+	}
+	sort.Strings(writes.Changed)
+	sort.Strings(writes.Removed)
+	return &writes, nil
+}
@@ -0,0 +1,104 @@
+package database
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// gcIdleAfter is how long a connection must go without reads or writes to
+// count as idle for GCPolicy.OnlyWhenIdle.
+const gcIdleAfter = time.Minute
+
+// GCPolicy enables periodic value log GC for a connection. A zero
+// DiscardRatio or Interval uses the defaults of 0.5 and one hour.
+type GCPolicy struct {
+	DiscardRatio float64
+	Interval     time.Duration
+	// OnlyWhenIdle skips rounds while the connection is in use
+	OnlyWhenIdle bool
+}
+
+// GCEvent reports a finished value log GC, periodic or requested. Rewritten
+// counts the value log files rewritten.
+type GCEvent struct {
+	Periodic     bool          `json:"periodic"`
+	DiscardRatio float64       `json:"discard_ratio"`
+	Rewritten    int           `json:"rewritten"`
+	Took         time.Duration `json:"took"`
+	Error        string        `json:"error,omitempty"`
+}
+
+type gcNotifier struct {
+	mx      *sync.Mutex
+	handler func(GCEvent)
+}
+
+// OnGC registers fn to be called after every value log GC.
+func (db *DB) OnGC(fn func(GCEvent)) {
+	db.gcNotify.mx.Lock()
+	defer db.gcNotify.mx.Unlock()
+	db.gcNotify.handler = fn
+}
+
+func (db *DB) notifyGC(event GCEvent) {
+	db.gcNotify.mx.Lock()
+	fn := db.gcNotify.handler
+	db.gcNotify.mx.Unlock()
+	if fn != nil {
+		fn(event)
+	}
+}
+
+// touch records an access for the idle check of the GC policy.
+func (db *DB) touch() {
+	db.lastAccess.Store(time.Now().UnixNano())
+}
+
+// runPeriodicGC runs value log GC every interval until stop is closed. Each
+// round rewrites files until badger finds nothing more worth rewriting,
+// pausing sleepGC between files to leave the disk to the owning application.
+func (db *DB) runPeriodicGC(policy GCPolicy, stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(policy.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		if policy.OnlyWhenIdle && time.Since(time.Unix(0, db.lastAccess.Load())) < gcIdleAfter {
+			continue
+		}
+
+		start := time.Now()
+		event := GCEvent{Periodic: true, DiscardRatio: policy.DiscardRatio}
+		for {
+			err := db.badger.RunValueLogGC(policy.DiscardRatio)
+			if errors.Is(err, badger.ErrNoRewrite) || errors.Is(err, badger.ErrRejected) {
+				break
+			}
+			if err != nil {
+				log.Printf("database: periodic value log gc: %v", err)
+				event.Error = err.Error()
+				break
+			}
+			event.Rewritten++
+			select {
+			case <-stop:
+				return
+			case <-time.After(db.sleepGC):
+			}
+		}
+		if event.Rewritten > 0 {
+			log.Printf("database: periodic value log gc rewrote %d files", event.Rewritten)
+		}
+		event.Took = time.Since(start)
+		db.notifyGC(event)
+	}
+}
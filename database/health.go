@@ -0,0 +1,69 @@
+package database
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"sync/atomic"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// healthMonitor notices when badger stops serving requests behind our back,
+// e.g. after a panic in one of its background goroutines closed the DB.
+type healthMonitor struct {
+	unhealthy *atomic.Bool
+	mx        *sync.Mutex
+	handler   func(error)
+}
+
+func newHealthMonitor() *healthMonitor {
+	return &healthMonitor{unhealthy: new(atomic.Bool), mx: new(sync.Mutex)}
+}
+
+// OnUnhealthy registers fn to be called once per connection when badger
+// unexpectedly reports itself closed or blocked.
+func (db *DB) OnUnhealthy(fn func(error)) {
+	db.health.mx.Lock()
+	defer db.health.mx.Unlock()
+	db.health.handler = fn
+}
+
+// Health returns nil while the open connection serves requests.
+func (db *DB) Health() error {
+	if db == nil {
+		return ErrNotRunning
+	}
+	if !db.isRunning.Load() {
+		return ErrNotRunning
+	}
+	if db.badger.IsClosed() {
+		return db.checkHealth(badger.ErrDBClosed)
+	}
+	if db.health.unhealthy.Load() {
+		return ErrUnhealthy
+	}
+	return nil
+}
+
+// checkHealth inspects an error returned by badger and reports the
+// connection unhealthy if it says the DB went away while we still consider
+// it running, or once it ran out of memory too often. err is returned
+// unchanged.
+func (db *DB) checkHealth(err error) error {
+	if !errors.Is(err, badger.ErrDBClosed) && !errors.Is(err, badger.ErrBlockedWrites) && !db.countMemoryError(err) {
+		return err
+	}
+	if !db.isRunning.Load() || db.health.unhealthy.Swap(true) {
+		return err
+	}
+	log.Printf("database: connection unhealthy: %v", err)
+
+	db.health.mx.Lock()
+	handler := db.health.handler
+	db.health.mx.Unlock()
+	if handler != nil {
+		handler(err)
+	}
+	return err
+}
@@ -0,0 +1,104 @@
+package database
+
+import (
+	"bytes"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// ignoredPrefixes are the namespaces listing, searching, counting and key
+// walks skip. The iterator seeks past them, so their keys aren't even read.
+type ignoredPrefixes [][]byte
+
+// SetIgnoredPrefixes replaces the ignored prefixes of the connection. Empty
+// prefixes are dropped, they would hide every key.
+func (db *DB) SetIgnoredPrefixes(prefixes []string) {
+	ignored := make(ignoredPrefixes, 0, len(prefixes))
+	for _, p := range prefixes {
+		if p != "" {
+			ignored = append(ignored, []byte(p))
+		}
+	}
+	db.ignored.Store(&ignored)
+}
+
+// IgnoredPrefixes returns the ignored prefixes of the connection.
+func (db *DB) IgnoredPrefixes() []string {
+	ignored := db.ignored.Load()
+	if ignored == nil {
+		return []string{}
+	}
+	prefixes := make([]string, len(*ignored))
+	for i, p := range *ignored {
+		prefixes[i] = string(p)
+	}
+	return prefixes
+}
+
+// ignoredUnder returns the ignored prefixes applying to an iteration over
+// prefix. Those prefix lies inside of are left out: asking for keys of an
+// ignored namespace explicitly still gets them.
+func (db *DB) ignoredUnder(prefix []byte) ignoredPrefixes {
+	ignored := db.ignored.Load()
+	if ignored == nil {
+		return nil
+	}
+	var under ignoredPrefixes
+	for _, p := range *ignored {
+		if !bytes.HasPrefix(prefix, p) {
+			under = append(under, p)
+		}
+	}
+	return under
+}
+
+// skip moves it past the ignored keys at its position and reports whether
+// it's still valid.
+func (p ignoredPrefixes) skip(it *badger.Iterator, reverse bool) bool {
+	if len(p) == 0 {
+		return it.Valid()
+	}
+	for it.Valid() {
+		key := it.Item().Key()
+		var match []byte
+		for _, prefix := range p {
+			if bytes.HasPrefix(key, prefix) {
+				match = prefix
+				break
+			}
+		}
+		if match == nil {
+			return true
+		}
+		if !reverse {
+			if end := prefixEnd(match); end != nil {
+				it.Seek(end)
+				continue
+			}
+			for it.Valid() && bytes.HasPrefix(it.Item().Key(), match) {
+				it.Next()
+			}
+			continue
+		}
+		// in reverse Seek lands on the last key at or before the prefix,
+		// which is the prefix itself when it's a key
+		it.Seek(match)
+		if it.Valid() && bytes.Equal(it.Item().Key(), match) {
+			it.Next()
+		}
+	}
+	return false
+}
+
+// prefixEnd is the first key after every key starting with prefix, nil when
+// there's none.
+func prefixEnd(prefix []byte) []byte {
+	end := bytes.Clone(prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+	return nil
+}
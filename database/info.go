@@ -0,0 +1,108 @@
+package database
+
+import (
+	"math"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+const (
+	DurabilitySync    = "sync"
+	DurabilityAsync   = "async"
+	DurabilityBatched = "batched"
+)
+
+type Info struct {
+	Dir        string `json:"dir"`
+	ValueDir   string `json:"value_dir"`
+	InMemory   bool   `json:"in_memory"`
+	ReadOnly   bool   `json:"read_only"`
+	CopyOf     string `json:"copy_of,omitempty"`
+	Managed    bool   `json:"managed"`
+	ReadTs     uint64 `json:"read_ts"`
+	MaxVersion uint64 `json:"max_version"`
+	LSMSize    int64  `json:"lsm_size"`
+	VlogSize   int64  `json:"vlog_size"`
+	// Durability is sync when every commit is fsynced, async when badger
+	// syncs in the background and batched while write batching is on
+	Durability string `json:"durability"`
+	SyncWrites bool   `json:"sync_writes"`
+
+	Encrypted       bool       `json:"encrypted"`
+	KeyRotation     string     `json:"key_rotation,omitempty"`
+	DataKeyCreated  *time.Time `json:"data_key_created,omitempty"`
+	NextKeyRotation *time.Time `json:"next_key_rotation,omitempty"`
+}
+
+// Info describes the open connection for the info panel.
+func (db *DB) Info() (Info, error) {
+	if db == nil {
+		return Info{}, ErrNotRunning
+	}
+	if !db.isRunning.Load() {
+		return Info{}, ErrNotRunning
+	}
+
+	lsm, vlog := db.badger.Size()
+	info := Info{
+		Dir:        db.badgerOpts.Dir,
+		ValueDir:   db.badgerOpts.ValueDir,
+		InMemory:   db.isInMemory.Load(),
+		ReadOnly:   db.isReadOnly.Load(),
+		CopyOf:     db.copyOf,
+		Managed:    db.isManaged.Load(),
+		ReadTs:     db.readTs.Load(),
+		MaxVersion: db.badger.MaxVersion(),
+		LSMSize:    lsm,
+		VlogSize:   vlog,
+		Encrypted:  len(db.encryptionKey) > 0,
+		SyncWrites: db.badger.Opts().SyncWrites,
+	}
+	switch {
+	case db.Batching().Enabled:
+		info.Durability = DurabilityBatched
+	case info.SyncWrites:
+		info.Durability = DurabilitySync
+	default:
+		info.Durability = DurabilityAsync
+	}
+	if !info.Encrypted {
+		return info, nil
+	}
+
+	info.KeyRotation = db.keyRotation.String()
+	created, err := db.dataKeyCreatedAt()
+	if err != nil {
+		return info, err
+	}
+	if !created.IsZero() {
+		next := created.Add(db.keyRotation)
+		info.DataKeyCreated, info.NextKeyRotation = &created, &next
+	}
+	return info, nil
+}
+
+// dataKeyCreatedAt reads the creation time of the current data key from the
+// key registry. Badger rotates the key lazily, on the first write after the
+// rotation period elapsed.
+func (db *DB) dataKeyCreatedAt() (time.Time, error) {
+	kr, err := badger.OpenKeyRegistry(badger.KeyRegistryOptions{
+		Dir:           db.badgerOpts.Dir,
+		ReadOnly:      true,
+		EncryptionKey: db.encryptionKey,
+		// never let the read-only copy consider the key expired
+		EncryptionKeyRotationDuration: time.Duration(math.MaxInt64),
+		InMemory:                      db.isInMemory.Load(),
+	})
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer kr.Close()
+
+	dk, err := kr.LatestDataKey()
+	if err != nil || dk == nil {
+		return time.Time{}, err
+	}
+	return time.Unix(dk.CreatedAt, 0), nil
+}
@@ -0,0 +1,64 @@
+package database
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+// Badger keeps its own bookkeeping entries in the keyspace under the
+// "!badger!" prefix. Iterators skip them unless internal access is requested.
+const (
+	internalKeyPrefix = "!badger!"
+	internalTxnKey    = internalKeyPrefix + "txn"
+	internalBannedKey = internalKeyPrefix + "banned"
+	internalHeadKey   = internalKeyPrefix + "head"
+	internalMovePfx   = internalKeyPrefix + "move"
+
+	valuePointerSize = 12
+)
+
+func IsInternalKey(key string) bool {
+	return strings.HasPrefix(key, internalKeyPrefix)
+}
+
+// DecodeInternalKey describes a badger internal entry in human readable form.
+// Head and move keys are only written by badger v1/v2 but still linger in
+// databases that were upgraded in place.
+func DecodeInternalKey(key string, value []byte) string {
+	switch {
+	case key == internalTxnKey:
+		return "transaction commit marker"
+	case strings.HasPrefix(key, internalBannedKey):
+		ns := []byte(key[len(internalBannedKey):])
+		if len(ns) != 8 {
+			return "banned namespace (malformed)"
+		}
+		return fmt.Sprintf("banned namespace %d", binary.BigEndian.Uint64(ns))
+	case key == internalHeadKey:
+		if len(value) != valuePointerSize {
+			return "value log head (malformed)"
+		}
+		return fmt.Sprintf(
+			"value log head: fid %d, len %d, offset %d",
+			binary.BigEndian.Uint32(value[0:4]),
+			binary.BigEndian.Uint32(value[4:8]),
+			binary.BigEndian.Uint32(value[8:12]),
+		)
+	case strings.HasPrefix(key, internalMovePfx):
+		return fmt.Sprintf("value log GC move of key %q", key[len(internalMovePfx):])
+	case IsInternalKey(key):
+		return "unknown badger internal key"
+	default:
+		return ""
+	}
+}
+
+// SetShowInternal toggles whether List and Search return badger internal keys.
+func (db *DB) SetShowInternal(show bool) {
+	db.showInternal.Store(show)
+}
+
+func (db *DB) ShowInternal() bool {
+	return db.showInternal.Load()
+}
@@ -0,0 +1,151 @@
+package database
+
+import (
+	"github.com/dgraph-io/badger/v4"
+)
+
+const (
+	LocationLSM  = "lsm"
+	LocationVlog = "vlog"
+
+	// warmUpPrefetch is how many values a warm-up fetches ahead, far more
+	// than browsing since every value is read anyway
+	warmUpPrefetch = 100
+)
+
+type KeyMeta struct {
+	Key       string `json:"key"`
+	Size      int64  `json:"size"`
+	ExpiresAt uint64 `json:"expires_at"`
+	// Version is the commit timestamp of the latest write
+	Version uint64 `json:"version"`
+}
+
+// WalkKeys calls fn for every key under prefix in key order without reading
+// any values. Iteration stops at the first error returned by fn.
+func (db *DB) WalkKeys(prefix string, fn func(KeyMeta) error) error {
+	return db.WalkKeysFrom(prefix, "", fn)
+}
+
+// WalkKeysFrom is WalkKeys resuming after the key after, so a long walk can
+// be split across transactions. An empty after starts at the prefix. Both
+// skip the ignored prefixes.
+func (db *DB) WalkKeysFrom(prefix, after string, fn func(KeyMeta) error) error {
+	return db.walkKeysFrom(prefix, after, db.ignoredUnder([]byte(prefix)), 0, fn)
+}
+
+// WarmUpFrom is WalkKeysFrom reading every value, fetched warmUpPrefetch
+// ahead. It pulls the tables and value log pages under prefix into badger's
+// caches and the page cache, so browsing them afterwards doesn't wait on a
+// slow or remote disk.
+func (db *DB) WarmUpFrom(prefix, after string, fn func(KeyMeta) error) error {
+	return db.walkKeysFrom(prefix, after, db.ignoredUnder([]byte(prefix)), warmUpPrefetch, fn)
+}
+
+// WalkAllKeys is WalkKeys including the ignored prefixes, for previews of
+// writes that reach them.
+func (db *DB) WalkAllKeys(prefix string, fn func(KeyMeta) error) error {
+	return db.walkKeysFrom(prefix, "", nil, 0, fn)
+}
+
+// walkKeysFrom reads the values as well when prefetch is positive.
+func (db *DB) walkKeysFrom(prefix, after string, ignored ignoredPrefixes, prefetch int, fn func(KeyMeta) error) error {
+	if db == nil {
+		return ErrNotRunning
+	}
+	if !db.isRunning.Load() {
+		return ErrNotRunning
+	}
+
+	// the smallest key greater than after
+	seek := []byte(after)
+	if after != "" {
+		seek = append(seek, 0)
+	}
+	conn := db.connected()
+	err := db.view(func(txn *badger.Txn) (err error) {
+		db.eachKeyFrom(txn, []byte(prefix), seek, ignored, prefetch, func(item *badger.Item) bool {
+			if prefetch > 0 {
+				if err = item.Value(func([]byte) error { return nil }); err != nil {
+					return false
+				}
+			}
+			err = fn(KeyMeta{
+				Key:       string(item.Key()),
+				Size:      item.ValueSize(),
+				ExpiresAt: item.ExpiresAt(),
+				Version:   item.Version(),
+			})
+			return err == nil
+		})
+		return err
+	})
+	if err == nil && conn.Err() != nil {
+		// the walk was cut short by Close
+		return ErrNotRunning
+	}
+	return err
+}
+
+// Meta returns the metadata of a single key without reading its value.
+func (db *DB) Meta(key string) (meta KeyMeta, err error) {
+	if db == nil {
+		return meta, ErrNotRunning
+	}
+	if !db.isRunning.Load() {
+		return meta, ErrNotRunning
+	}
+
+	err = db.view(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte(key))
+		if err != nil {
+			return err
+		}
+		meta = KeyMeta{Key: key, Size: item.ValueSize(), ExpiresAt: item.ExpiresAt(), Version: item.Version()}
+		return nil
+	})
+	return meta, err
+}
+
+// ValueThreshold is the value size from which badger stores values in the
+// value log instead of inline in the LSM tree.
+func (db *DB) ValueThreshold() int64 {
+	return db.badgerOpts.ValueThreshold
+}
+
+// ValueLocation tells where a value of the given size ends up.
+func (db *DB) ValueLocation(size int64) string {
+	if db.isInMemory.Load() || size < db.badgerOpts.ValueThreshold {
+		return LocationLSM
+	}
+	return LocationVlog
+}
+
+// ViewValue calls fn with the value of key while the read transaction is
+// still open. Values kept in the value log are handed out straight from the
+// memory-mapped file, so fn must not retain the slice.
+func (db *DB) ViewValue(key string, fn func(value []byte, version uint64) error) error {
+	if db == nil {
+		return ErrNotRunning
+	}
+	if !db.isRunning.Load() {
+		return ErrNotRunning
+	}
+	if db.isHistoric() {
+		value, version, err := db.getAt(key, db.readTs.Load())
+		if err != nil {
+			return err
+		}
+		return fn(value, version)
+	}
+
+	return db.view(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte(key))
+		if err != nil {
+			return err
+		}
+		return item.Value(func(val []byte) error {
+			return fn(val, item.Version())
+		})
+	})
+}
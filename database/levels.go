@@ -0,0 +1,62 @@
+package database
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// Level is the shape of one level of the LSM tree.
+type Level struct {
+	Level      int   `json:"level"`
+	Tables     int   `json:"tables"`
+	Size       int64 `json:"size"`
+	TargetSize int64 `json:"target_size"`
+	// Score is how far the level is over its target, compactions pick the
+	// levels scoring above 1
+	Score float64 `json:"score"`
+	// StaleSize is the data of the level's tables shadowed by newer versions
+	// or deletes
+	StaleSize int64 `json:"stale_size"`
+	Base      bool  `json:"base"`
+}
+
+// Levels returns the shape of the LSM tree, level 0 first.
+func (db *DB) Levels() ([]Level, error) {
+	if db == nil {
+		return nil, ErrNotRunning
+	}
+	if !db.isRunning.Load() {
+		return nil, ErrNotRunning
+	}
+	infos := db.badger.Levels()
+	levels := make([]Level, 0, len(infos))
+	for _, info := range infos {
+		levels = append(levels, Level{
+			Level: info.Level, Tables: info.NumTables, Size: info.Size, TargetSize: info.TargetSize,
+			Score: info.Score, StaleSize: info.StaleDatSize, Base: info.IsBaseLevel,
+		})
+	}
+	return levels, nil
+}
+
+// Flatten compacts every table of the LSM tree into a single level, so the
+// versions of a key sit together and stale data is dropped. Badger stops its
+// own compactions meanwhile, writes keep going into level 0.
+func (db *DB) Flatten() error {
+	if db == nil {
+		return ErrNotRunning
+	}
+	if !db.isRunning.Load() {
+		return ErrNotRunning
+	}
+	if db.isReadOnly.Load() {
+		return ErrReadOnly
+	}
+	start := time.Now()
+	if err := db.badger.Flatten(db.badger.Opts().NumCompactors); err != nil {
+		return db.checkHealth(fmt.Errorf("flattening: %w", err))
+	}
+	log.Printf("database: LSM tree flattened in %s", time.Since(start).Round(time.Millisecond))
+	return nil
+}
@@ -0,0 +1,13 @@
+//go:build !windows
+
+package database
+
+// LongPath returns path as is, only Windows limits the length of paths.
+func LongPath(path string) string {
+	return path
+}
+
+// ShortPath returns path as is, see LongPath.
+func ShortPath(path string) string {
+	return path
+}
@@ -0,0 +1,48 @@
+package database
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+const (
+	extendedPrefix    = `\\?\`
+	extendedUNCPrefix = `\\?\UNC\`
+	uncPrefix         = `\\`
+
+	// maxDirPath is MAX_PATH less room for an 8.3 file name, the longest
+	// directory the Win32 API takes without the extended prefix
+	maxDirPath = 248
+)
+
+// LongPath returns path in the extended form Windows needs for paths longer
+// than MAX_PATH: absolute and prefixed with \\?\, or \\?\UNC\ for network
+// shares. Short local paths are only made absolute.
+func LongPath(path string) string {
+	if path == "" || strings.HasPrefix(path, extendedPrefix) {
+		return path
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	switch {
+	case strings.HasPrefix(abs, uncPrefix):
+		return extendedUNCPrefix + abs[len(uncPrefix):]
+	case len(abs) >= maxDirPath:
+		return extendedPrefix + abs
+	}
+	return abs
+}
+
+// ShortPath undoes LongPath, giving the form shown to users and used to key
+// profiles, so both forms of a path find the same database.
+func ShortPath(path string) string {
+	switch {
+	case strings.HasPrefix(path, extendedUNCPrefix):
+		return uncPrefix + path[len(extendedUNCPrefix):]
+	case strings.HasPrefix(path, extendedPrefix):
+		return path[len(extendedPrefix):]
+	}
+	return path
+}
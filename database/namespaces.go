@@ -0,0 +1,81 @@
+package database
+
+import (
+	"bytes"
+	"sort"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+type Namespace struct {
+	Name  string `json:"name"`
+	Keys  int64  `json:"keys"`
+	Bytes int64  `json:"bytes"`
+}
+
+// Namespaces groups all keys by their first delimiter segment and returns the
+// top largest groups by key count, with everything else summed into other.
+// Keys without the delimiter form a namespace of their own.
+func (db *DB) Namespaces(delimiter string, top int) (namespaces []Namespace, other Namespace, err error) {
+	if db == nil {
+		return nil, other, ErrNotRunning
+	}
+	if !db.isRunning.Load() {
+		return nil, other, ErrNotRunning
+	}
+
+	groups := make(map[string]*Namespace)
+	err = db.view(func(txn *badger.Txn) error {
+		db.eachKey(txn, nil, func(item *badger.Item) bool {
+			key := item.Key()
+			name := firstSegment(key, delimiter)
+			ns, ok := groups[string(name)]
+			if !ok {
+				ns = &Namespace{Name: string(name)}
+				groups[ns.Name] = ns
+			}
+			ns.Keys++
+			ns.Bytes += int64(len(key)) + item.ValueSize()
+			return true
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, other, err
+	}
+
+	for _, ns := range groups {
+		namespaces = append(namespaces, *ns)
+	}
+	sort.Slice(namespaces, func(i, j int) bool {
+		if namespaces[i].Keys != namespaces[j].Keys {
+			return namespaces[i].Keys > namespaces[j].Keys
+		}
+		return namespaces[i].Name < namespaces[j].Name
+	})
+	if top > 0 && len(namespaces) > top {
+		for _, ns := range namespaces[top:] {
+			other.Keys += ns.Keys
+			other.Bytes += ns.Bytes
+		}
+		namespaces = namespaces[:top]
+	}
+	return namespaces, other, nil
+}
+
+// firstSegment returns key up to its first delimiter, all of it without one.
+// A leading delimiter belongs to the segment, so "/users/1" is in "/users"
+// rather than in an empty namespace.
+func firstSegment(key []byte, delimiter string) []byte {
+	if delimiter == "" {
+		return key
+	}
+	skip := 0
+	if bytes.HasPrefix(key, []byte(delimiter)) {
+		skip = len(delimiter)
+	}
+	if i := bytes.Index(key[skip:], []byte(delimiter)); i >= 0 {
+		return key[:skip+i]
+	}
+	return key
+}
@@ -0,0 +1,26 @@
+package database
+
+import (
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// networkFilesystems maps the filesystem type names of network filesystems
+// to display names.
+var networkFilesystems = map[string]string{
+	"nfs":    "NFS",
+	"smbfs":  "SMB",
+	"afpfs":  "AFP",
+	"webdav": "WebDAV",
+}
+
+// networkFilesystem tells whether dir is on a network filesystem.
+func networkFilesystem(dir string) (string, bool) {
+	var st unix.Statfs_t
+	if err := unix.Statfs(dir, &st); err != nil {
+		return "", false
+	}
+	name, ok := networkFilesystems[strings.TrimRight(string(st.Fstypename[:]), "\x00")]
+	return name, ok
+}
@@ -0,0 +1,25 @@
+package database
+
+import "golang.org/x/sys/unix"
+
+// networkFilesystems maps the statfs magic numbers of network filesystems
+// to their names.
+var networkFilesystems = map[int64]string{
+	unix.NFS_SUPER_MAGIC:  "NFS",
+	unix.SMB_SUPER_MAGIC:  "SMB",
+	unix.SMB2_SUPER_MAGIC: "SMB",
+	unix.CIFS_SUPER_MAGIC: "CIFS",
+	unix.AFS_SUPER_MAGIC:  "AFS",
+	unix.CEPH_SUPER_MAGIC: "CephFS",
+	unix.V9FS_MAGIC:       "9P",
+}
+
+// networkFilesystem tells whether dir is on a network filesystem.
+func networkFilesystem(dir string) (string, bool) {
+	var st unix.Statfs_t
+	if err := unix.Statfs(dir, &st); err != nil {
+		return "", false
+	}
+	name, ok := networkFilesystems[int64(st.Type)]
+	return name, ok
+}
@@ -0,0 +1,8 @@
+//go:build !linux && !darwin && !windows
+
+package database
+
+// networkFilesystem reports false, filesystems aren't inspected here.
+func networkFilesystem(string) (string, bool) {
+	return "", false
+}
@@ -0,0 +1,25 @@
+package database
+
+import (
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/windows"
+)
+
+// networkFilesystem tells whether dir is on a network share, a UNC path or
+// a mapped network drive.
+func networkFilesystem(dir string) (string, bool) {
+	dir = ShortPath(dir)
+	if strings.HasPrefix(dir, uncPrefix) {
+		return "SMB", true
+	}
+	root, err := windows.UTF16PtrFromString(filepath.VolumeName(dir) + `\`)
+	if err != nil {
+		return "", false
+	}
+	if windows.GetDriveType(root) == windows.DRIVE_REMOTE {
+		return "SMB", true
+	}
+	return "", false
+}
@@ -0,0 +1,121 @@
+package database
+
+import (
+	"github.com/dgraph-io/badger/v4/options"
+)
+
+// EffectiveOptions are the badger options of the open connection after
+// defaults and overrides were applied. The encryption key is never included.
+type EffectiveOptions struct {
+	Dir      string `json:"dir"`
+	ValueDir string `json:"value_dir"`
+
+	SyncWrites        bool   `json:"sync_writes"`
+	NumVersionsToKeep int    `json:"num_versions_to_keep"`
+	ReadOnly          bool   `json:"read_only"`
+	Compression       string `json:"compression"`
+	InMemory          bool   `json:"in_memory"`
+	MetricsEnabled    bool   `json:"metrics_enabled"`
+	NumGoroutines     int    `json:"num_goroutines"`
+
+	MemTableSize        int64 `json:"mem_table_size"`
+	BaseTableSize       int64 `json:"base_table_size"`
+	BaseLevelSize       int64 `json:"base_level_size"`
+	LevelSizeMultiplier int   `json:"level_size_multiplier"`
+	TableSizeMultiplier int   `json:"table_size_multiplier"`
+	MaxLevels           int   `json:"max_levels"`
+
+	VLogPercentile     float64 `json:"vlog_percentile"`
+	ValueThreshold     int64   `json:"value_threshold"`
+	NumMemtables       int     `json:"num_memtables"`
+	BlockSize          int     `json:"block_size"`
+	BloomFalsePositive float64 `json:"bloom_false_positive"`
+	BlockCacheSize     int64   `json:"block_cache_size"`
+	IndexCacheSize     int64   `json:"index_cache_size"`
+
+	NumLevelZeroTables      int `json:"num_level_zero_tables"`
+	NumLevelZeroTablesStall int `json:"num_level_zero_tables_stall"`
+
+	ValueLogFileSize   int64  `json:"value_log_file_size"`
+	ValueLogMaxEntries uint32 `json:"value_log_max_entries"`
+
+	NumCompactors        int  `json:"num_compactors"`
+	CompactL0OnClose     bool `json:"compact_l0_on_close"`
+	LmaxCompaction       bool `json:"lmax_compaction"`
+	ZSTDCompressionLevel int  `json:"zstd_compression_level"`
+
+	VerifyValueChecksum      bool   `json:"verify_value_checksum"`
+	ChecksumVerificationMode string `json:"checksum_verification_mode"`
+	Encrypted                bool   `json:"encrypted"`
+	KeyRotation              string `json:"key_rotation"`
+	DetectConflicts          bool   `json:"detect_conflicts"`
+	NamespaceOffset          int    `json:"namespace_offset"`
+	ExternalMagicVersion     uint16 `json:"external_magic_version"`
+	Managed                  bool   `json:"managed"`
+}
+
+// Options returns the options badger actually runs the connection with.
+func (db *DB) Options() (EffectiveOptions, error) {
+	if db == nil {
+		return EffectiveOptions{}, ErrNotRunning
+	}
+	if !db.isRunning.Load() {
+		return EffectiveOptions{}, ErrNotRunning
+	}
+
+	o := db.badger.Opts()
+	return EffectiveOptions{
+		Dir:                      o.Dir,
+		ValueDir:                 o.ValueDir,
+		SyncWrites:               o.SyncWrites,
+		NumVersionsToKeep:        o.NumVersionsToKeep,
+		ReadOnly:                 o.ReadOnly,
+		Compression:              compressionName(o.Compression),
+		InMemory:                 o.InMemory,
+		MetricsEnabled:           o.MetricsEnabled,
+		NumGoroutines:            o.NumGoroutines,
+		MemTableSize:             o.MemTableSize,
+		BaseTableSize:            o.BaseTableSize,
+		BaseLevelSize:            o.BaseLevelSize,
+		LevelSizeMultiplier:      o.LevelSizeMultiplier,
+		TableSizeMultiplier:      o.TableSizeMultiplier,
+		MaxLevels:                o.MaxLevels,
+		VLogPercentile:           o.VLogPercentile,
+		ValueThreshold:           o.ValueThreshold,
+		NumMemtables:             o.NumMemtables,
+		BlockSize:                o.BlockSize,
+		BloomFalsePositive:       o.BloomFalsePositive,
+		BlockCacheSize:           o.BlockCacheSize,
+		IndexCacheSize:           o.IndexCacheSize,
+		NumLevelZeroTables:       o.NumLevelZeroTables,
+		NumLevelZeroTablesStall:  o.NumLevelZeroTablesStall,
+		ValueLogFileSize:         o.ValueLogFileSize,
+		ValueLogMaxEntries:       o.ValueLogMaxEntries,
+		NumCompactors:            o.NumCompactors,
+		CompactL0OnClose:         o.CompactL0OnClose,
+		LmaxCompaction:           o.LmaxCompaction,
+		ZSTDCompressionLevel:     o.ZSTDCompressionLevel,
+		VerifyValueChecksum:      o.VerifyValueChecksum,
+		ChecksumVerificationMode: checksumModeName(o.ChecksumVerificationMode),
+		Encrypted:                len(o.EncryptionKey) > 0,
+		KeyRotation:              o.EncryptionKeyRotationDuration.String(),
+		DetectConflicts:          o.DetectConflicts,
+		NamespaceOffset:          o.NamespaceOffset,
+		ExternalMagicVersion:     o.ExternalMagicVersion,
+		Managed:                  db.isManaged.Load(),
+	}, nil
+}
+
+// checksumModeName is the reverse of checksumMode.
+func checksumModeName(mode options.ChecksumVerificationMode) string {
+	switch mode {
+	case options.OnTableRead:
+		return "table"
+	case options.OnBlockRead:
+		return "block"
+	case options.OnTableAndBlockRead:
+		return "table_and_block"
+	default:
+		return "none"
+	}
+}
@@ -0,0 +1,108 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+const (
+	AccessRead  = "read"
+	AccessWrite = "write"
+)
+
+// InaccessibleFile is a database file, or the directory itself, the current
+// user can't open with the access Open needs. Owner is the account owning
+// it, when the platform tells.
+type InaccessibleFile struct {
+	Path   string `json:"path"`
+	Access string `json:"access"`
+	Owner  string `json:"owner,omitempty"`
+}
+
+// PreflightOpen checks that the current user can access the database
+// directory and every file in it before Open touches any of them. Stores
+// owned by a service account otherwise fail halfway through opening. When
+// something is denied, it returns the permission_denied diagnostic listing
+// every inaccessible file and whether a read-only open would work.
+func PreflightOpen(o OpenOptions) (OpenDiagnostic, bool) {
+	path, valueDir := LongPath(o.Path), LongPath(o.ValueDir)
+	if path == "" {
+		return OpenDiagnostic{}, true
+	}
+	if info, err := os.Stat(path); err != nil || !info.IsDir() {
+		// missing directories are Open's and DiagnoseOpen's to report
+		return OpenDiagnostic{}, true
+	}
+	readOnly := o.ReadOnly || o.CopyFirst
+	files := inaccessibleFiles(path, valueDir, readOnly)
+	if len(files) == 0 {
+		return OpenDiagnostic{}, true
+	}
+
+	d := OpenDiagnostic{
+		Error:            fmt.Sprintf("%d database paths can't be accessed by the current user", len(files)),
+		Cause:            CausePermissionDenied,
+		Path:             o.Path,
+		SupportedVersion: supportedManifestVersion,
+		PermissionDenied: files[0].Path,
+		Inaccessible:     files,
+	}
+	owner := files[0].Owner
+	if owner == "" {
+		owner = "another user"
+	}
+	switch {
+	case readOnly:
+		d.Hint = fmt.Sprintf("the files can't be read, run as %s or grant the current user read access", owner)
+	case len(inaccessibleFiles(path, valueDir, true)) == 0:
+		d.ReadOnlyAvailable = true
+		d.Hint = fmt.Sprintf("the files are owned by %s and can only be read, open read-only or run as that user", owner)
+	default:
+		d.Hint = fmt.Sprintf("the files can't be read or written, run as %s or fix the ownership", owner)
+	}
+	return d, false
+}
+
+// inaccessibleFiles lists what can't be accessed in the database directory
+// and the value log directory, when it's separate.
+func inaccessibleFiles(dir, valueDir string, readOnly bool) []InaccessibleFile {
+	files := inaccessibleIn(dir, readOnly)
+	if valueDir != "" && valueDir != dir {
+		files = append(files, inaccessibleIn(valueDir, readOnly)...)
+	}
+	return files
+}
+
+// inaccessibleIn lists the files in dir that can't be opened with the access
+// the database needs. Writable opens also need to create files in dir.
+func inaccessibleIn(dir string, readOnly bool) []InaccessibleFile {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrPermission) {
+		return []InaccessibleFile{{Path: ShortPath(dir), Access: AccessRead, Owner: pathOwner(dir)}}
+	}
+	var files []InaccessibleFile
+	flag, access := os.O_RDWR, AccessWrite
+	if readOnly {
+		flag, access = os.O_RDONLY, AccessRead
+	} else if !dirWritable(dir) {
+		files = append(files, InaccessibleFile{Path: ShortPath(dir), Access: AccessWrite, Owner: pathOwner(dir)})
+	}
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		path := filepath.Join(dir, e.Name())
+		f, err := os.OpenFile(path, flag, 0)
+		if errors.Is(err, fs.ErrPermission) {
+			files = append(files, InaccessibleFile{Path: ShortPath(path), Access: access, Owner: pathOwner(path)})
+			continue
+		}
+		if err == nil {
+			_ = f.Close()
+		}
+	}
+	return files
+}
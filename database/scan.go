@@ -0,0 +1,27 @@
+package database
+
+import (
+	"github.com/dgraph-io/badger/v4"
+)
+
+// Scan streams every key under prefix with its value to fn, honouring the
+// pinned read timestamp. Values are only valid for the duration of the call.
+// Iteration stops at the first error returned by fn.
+func (db *DB) Scan(prefix string, fn func(key string, value []byte) error) error {
+	if db == nil {
+		return ErrNotRunning
+	}
+	if !db.isRunning.Load() {
+		return ErrNotRunning
+	}
+
+	return db.view(func(txn *badger.Txn) (err error) {
+		db.eachKey(txn, []byte(prefix), func(item *badger.Item) bool {
+			err = item.Value(func(val []byte) error {
+				return fn(string(item.Key()), val)
+			})
+			return err == nil
+		})
+		return err
+	})
+}
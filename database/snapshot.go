@@ -0,0 +1,214 @@
+package database
+
+import (
+	"bytes"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// Normal (non-managed) databases don't allow choosing the read timestamp of a
+// transaction, so point-in-time reads iterate over all retained versions and
+// pick the newest one at or below the pinned timestamp. Only versions that
+// compaction hasn't discarded yet are visible.
+
+type Version struct {
+	Version   uint64 `json:"version"`
+	Size      int64  `json:"size"`
+	ExpiresAt uint64 `json:"expires_at"`
+	Deleted   bool   `json:"deleted"`
+}
+
+func (db *DB) isHistoric() bool {
+	return !db.isManaged.Load() && db.readTs.Load() != 0
+}
+
+func (db *DB) allVersionsOptions(prefix []byte) badger.IteratorOptions {
+	opts := badger.DefaultIteratorOptions
+	opts.AllVersions = true
+	opts.PrefetchValues = false
+	opts.Prefix = prefix
+	opts.InternalAccess = db.showInternal.Load()
+	return opts
+}
+
+// iterateAt calls fn for every key visible at ts, in key order, starting at
+// seek. Iteration stops when fn returns false.
+func iterateAt(it *badger.Iterator, seek []byte, ts uint64, ignored ignoredPrefixes, fn func(item *badger.Item) bool) {
+	var lastKey []byte
+	for it.Seek(seek); it.Valid(); it.Next() {
+		if !ignored.skip(it, false) {
+			return
+		}
+		item := it.Item()
+		if lastKey != nil && bytes.Equal(item.Key(), lastKey) {
+			continue
+		}
+		if item.Version() > ts {
+			continue
+		}
+		lastKey = item.KeyCopy(lastKey[:0])
+		if item.IsDeletedOrExpired() {
+			continue
+		}
+		if !fn(item) {
+			return
+		}
+	}
+}
+
+// eachKey calls fn for every key under prefix visible in txn, honouring the
+// pinned read timestamp of normal databases and skipping the ignored
+// prefixes. Iteration stops when fn returns false.
+func (db *DB) eachKey(txn *badger.Txn, prefix []byte, fn func(item *badger.Item) bool) {
+	db.eachKeyFrom(txn, prefix, prefix, db.ignoredUnder(prefix), 0, fn)
+}
+
+// eachKeyFrom is eachKey starting at the first key at or after seek, skipping
+// the ignored prefixes given. A positive prefetch has the iterator fetch that
+// many values ahead of fn.
+func (db *DB) eachKeyFrom(txn *badger.Txn, prefix, seek []byte, ignored ignoredPrefixes, prefetch int, fn func(item *badger.Item) bool) {
+	if bytes.Compare(seek, prefix) < 0 {
+		seek = prefix
+	}
+	if db.isHistoric() {
+		it := txn.NewIterator(db.allVersionsOptions(prefix))
+		defer it.Close()
+		iterateAt(it, seek, db.readTs.Load(), ignored, fn)
+		return
+	}
+
+	opts := badger.DefaultIteratorOptions
+	opts.PrefetchValues, opts.PrefetchSize = prefetch > 0, prefetch
+	opts.Prefix = prefix
+	opts.InternalAccess = db.showInternal.Load()
+
+	closed := db.connected().Done()
+	it := txn.NewIterator(opts)
+	defer it.Close()
+	for it.Seek(seek); it.Valid(); it.Next() {
+		select {
+		case <-closed:
+			// the connection is closing, Close waits for the iterator
+			return
+		default:
+		}
+		if !ignored.skip(it, false) {
+			return
+		}
+		if !fn(it.Item()) {
+			return
+		}
+	}
+}
+
+func (db *DB) getAt(key string, ts uint64) (result []byte, version uint64, err error) {
+	release, err := db.acquire()
+	if err != nil {
+		return nil, 0, err
+	}
+	defer release()
+	err = db.badger.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(db.allVersionsOptions([]byte(key)))
+		defer it.Close()
+
+		found := false
+		iterateAt(it, []byte(key), ts, nil, func(item *badger.Item) bool {
+			if string(item.Key()) != key {
+				return false
+			}
+			result, err = item.ValueCopy(nil)
+			version = item.Version()
+			found = true
+			return false
+		})
+		if err != nil {
+			return err
+		}
+		if !found {
+			return badger.ErrKeyNotFound
+		}
+		return nil
+	})
+	return result, version, err
+}
+
+func (db *DB) listAt(limit *int, startCursor *string, ts uint64) (keys []Key, err error) {
+	release, err := db.acquire()
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	err = db.badger.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(db.allVersionsOptions(nil))
+		defer it.Close()
+
+		var seek []byte
+		if startCursor != nil {
+			seek = []byte(*startCursor)
+		}
+		iterateAt(it, seek, ts, db.ignoredUnder(nil), func(item *badger.Item) bool {
+			key := string(item.Key())
+			if startCursor != nil && key == *startCursor {
+				return true
+			}
+			keys = append(keys, key)
+			return limit == nil || len(keys) < *limit
+		})
+		return nil
+	})
+	return keys, err
+}
+
+func (db *DB) searchAt(prefix string, limit, offset int, ts uint64) (keys []Key, err error) {
+	release, err := db.acquire()
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	err = db.badger.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(db.allVersionsOptions([]byte(prefix)))
+		defer it.Close()
+
+		skipped := 0
+		iterateAt(it, []byte(prefix), ts, db.ignoredUnder([]byte(prefix)), func(item *badger.Item) bool {
+			if skipped < offset {
+				skipped++
+				return true
+			}
+			keys = append(keys, string(item.Key()))
+			return limit <= 0 || len(keys) < limit
+		})
+		return nil
+	})
+	return keys, err
+}
+
+// Versions returns all retained versions of a key, newest first.
+func (db *DB) Versions(key string) (versions []Version, err error) {
+	if db == nil {
+		return nil, ErrNotRunning
+	}
+	if !db.isRunning.Load() {
+		return nil, ErrNotRunning
+	}
+
+	err = db.view(func(txn *badger.Txn) error {
+		it := txn.NewIterator(db.allVersionsOptions([]byte(key)))
+		defer it.Close()
+
+		for it.Seek([]byte(key)); it.Valid(); it.Next() {
+			item := it.Item()
+			if string(item.Key()) != key {
+				break
+			}
+			versions = append(versions, Version{
+				Version:   item.Version(),
+				Size:      item.ValueSize(),
+				ExpiresAt: item.ExpiresAt(),
+				Deleted:   item.IsDeletedOrExpired(),
+			})
+		}
+		return nil
+	})
+	return versions, err
+}
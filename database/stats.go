@@ -0,0 +1,146 @@
+package database
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"sort"
+	"time"
+	"unicode/utf8"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/dgraph-io/badger/v4/y"
+)
+
+const (
+	DefaultSampleFraction = 0.01
+
+	minSamples = 1000
+	maxSamples = 200000
+)
+
+// SampleStats are estimates over a sample of the keyspace.
+type SampleStats struct {
+	Fraction      float64 `json:"fraction"`
+	EstimatedKeys uint64  `json:"estimated_keys"`
+	Sampled       int     `json:"sampled"`
+	AvgKeyLen     float64 `json:"avg_key_len"`
+	AvgValueSize  float64 `json:"avg_value_size"`
+	TTLRatio      float64 `json:"ttl_ratio"`
+	JSONRatio     float64 `json:"json_ratio"`
+	TextRatio     float64 `json:"text_ratio"`
+	BinaryRatio   float64 `json:"binary_ratio"`
+	DurationMs    int64   `json:"duration_ms"`
+}
+
+// SampleStats estimates keyspace statistics without a full scan. The table
+// key counts give the size of the keyspace, then short runs of keys are read
+// starting at the left key of every table until fraction of the keys (within
+// sane bounds) have been seen.
+func (db *DB) SampleStats(fraction float64) (stats SampleStats, err error) {
+	if db == nil {
+		return stats, ErrNotRunning
+	}
+	if !db.isRunning.Load() {
+		return stats, ErrNotRunning
+	}
+	if fraction <= 0 || fraction > 1 {
+		fraction = DefaultSampleFraction
+	}
+	start := time.Now()
+	stats.Fraction = fraction
+
+	seeks, estimated := db.tableSeeks(nil)
+	stats.EstimatedKeys = estimated
+	if len(seeks) == 0 {
+		// everything still lives in the memtables
+		seeks = [][]byte{nil}
+	}
+
+	target := int(math.Ceil(float64(stats.EstimatedKeys) * fraction))
+	target = min(max(target, minSamples), maxSamples)
+	perSeek := (target + len(seeks) - 1) / len(seeks)
+
+	var keyLen, valueSize int64
+	var withTTL, jsonValues, textValues int
+	err = db.view(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		var last []byte
+		for _, seek := range seeks {
+			if last != nil && bytes.Compare(seek, last) <= 0 {
+				// the previous run already went past this table's start
+				continue
+			}
+			n := 0
+			for it.Seek(seek); it.Valid() && n < perSeek; it.Next() {
+				item := it.Item()
+				keyLen += int64(len(item.Key()))
+				valueSize += item.ValueSize()
+				if item.ExpiresAt() > 0 {
+					withTTL++
+				}
+				err := item.Value(func(val []byte) error {
+					switch {
+					case json.Valid(val):
+						jsonValues++
+					case utf8.Valid(val):
+						textValues++
+					}
+					return nil
+				})
+				if err != nil {
+					return err
+				}
+				last = item.KeyCopy(last[:0])
+				n++
+				stats.Sampled++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return stats, err
+	}
+
+	if stats.Sampled > 0 {
+		n := float64(stats.Sampled)
+		stats.AvgKeyLen = float64(keyLen) / n
+		stats.AvgValueSize = float64(valueSize) / n
+		stats.TTLRatio = float64(withTTL) / n
+		stats.JSONRatio = float64(jsonValues) / n
+		stats.TextRatio = float64(textValues) / n
+		stats.BinaryRatio = float64(stats.Sampled-jsonValues-textValues) / n
+	}
+	if stats.EstimatedKeys < uint64(stats.Sampled) {
+		stats.EstimatedKeys = uint64(stats.Sampled)
+	}
+	stats.DurationMs = time.Since(start).Milliseconds()
+	return stats, nil
+}
+
+// tableSeeks returns the sorted start keys, within prefix, of the tables
+// holding keys of prefix and the sum of their key counts. Tables straddling
+// the prefix boundary are counted whole, the count is an upper bound.
+func (db *DB) tableSeeks(prefix []byte) (seeks [][]byte, estimated uint64) {
+	for _, t := range db.badger.Tables() {
+		left, right := y.ParseKey(t.Left), y.ParseKey(t.Right)
+		if len(prefix) > 0 {
+			if bytes.Compare(right, prefix) < 0 || (!bytes.HasPrefix(left, prefix) && bytes.Compare(left, prefix) > 0) {
+				continue
+			}
+			if bytes.Compare(left, prefix) < 0 {
+				left = prefix
+			}
+		}
+		estimated += uint64(t.KeyCount)
+		if !bytes.HasPrefix(left, []byte(internalKeyPrefix)) {
+			seeks = append(seeks, left)
+		}
+	}
+	sort.Slice(seeks, func(i, j int) bool { return bytes.Compare(seeks[i], seeks[j]) < 0 })
+	return seeks, estimated
+}
@@ -0,0 +1,84 @@
+package database
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	WarningSymlink           = "symlink"
+	WarningNetworkFilesystem = "network_filesystem"
+)
+
+// StorageWarning is a property of where the database lives that badger
+// doesn't cope with well. Path is the directory concerned.
+type StorageWarning struct {
+	Kind    string `json:"kind"`
+	Path    string `json:"path"`
+	Message string `json:"message"`
+	// Resolved is the directory a symlinked path points to
+	Resolved string `json:"resolved,omitempty"`
+	// Filesystem names the network filesystem
+	Filesystem string `json:"filesystem,omitempty"`
+}
+
+// CheckStorage looks for symlinks in the paths of the database and value log
+// directories, other than the OS's own top-level ones, and for directories on
+// NFS or SMB shares. Badger mmaps its
+// files and relies on flock for its directory lock, both unreliable on
+// network filesystems, and a symlink may hide that the files live on one.
+func CheckStorage(o OpenOptions) []StorageWarning {
+	if o.Path == "" {
+		return nil
+	}
+	warnings := checkDir(o.Path)
+	if o.ValueDir != "" && o.ValueDir != o.Path {
+		warnings = append(warnings, checkDir(o.ValueDir)...)
+	}
+	return warnings
+}
+
+func checkDir(dir string) []StorageWarning {
+	var warnings []StorageWarning
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil
+	}
+	resolved, err := filepath.EvalSymlinks(abs)
+	if err != nil {
+		// missing directories are Open's to report
+		return nil
+	}
+	if withSystemLinks(abs) != resolved {
+		warnings = append(warnings, StorageWarning{
+			Kind: WarningSymlink, Path: dir, Resolved: resolved,
+			Message: fmt.Sprintf("%s resolves through a symlink to %s", dir, resolved),
+		})
+	}
+	if fs, network := networkFilesystem(resolved); network {
+		warnings = append(warnings, StorageWarning{
+			Kind: WarningNetworkFilesystem, Path: dir, Filesystem: fs,
+			Message: fmt.Sprintf("%s is on a %s share, badger's memory mapping and locking are unreliable there", dir, fs),
+		})
+	}
+	return warnings
+}
+
+// withSystemLinks resolves the top-level directory of abs. Symlinks there are
+// the OS's own, such as /tmp and /var into /private on macOS or /lib into
+// /usr/lib, and aren't worth a warning.
+func withSystemLinks(abs string) string {
+	abs = filepath.Clean(abs)
+	vol := filepath.VolumeName(abs)
+	sep := string(filepath.Separator)
+	top, below, _ := strings.Cut(strings.TrimPrefix(abs[len(vol):], sep), sep)
+	if top == "" {
+		return abs
+	}
+	root, err := filepath.EvalSymlinks(vol + sep + top)
+	if err != nil {
+		return abs
+	}
+	return filepath.Join(root, below)
+}
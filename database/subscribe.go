@@ -0,0 +1,65 @@
+package database
+
+import (
+	"context"
+	"errors"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/dgraph-io/badger/v4/pb"
+)
+
+type KeyChange struct {
+	Key       string `json:"key"`
+	Value     []byte `json:"-"`
+	UserMeta  byte   `json:"user_meta"`
+	Version   uint64 `json:"version"`
+	ExpiresAt uint64 `json:"expires_at"`
+	Deleted   bool   `json:"deleted"`
+}
+
+// Subscribe calls fn for every write under one of the prefixes, an empty
+// prefix matches everything. It blocks until ctx is done or the DB closes.
+func (db *DB) Subscribe(ctx context.Context, prefixes []string, fn func(KeyChange)) error {
+	if db == nil {
+		return ErrNotRunning
+	}
+	if !db.isRunning.Load() {
+		return ErrNotRunning
+	}
+
+	// the subscription ends with the connection it was made on
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stop := context.AfterFunc(db.connected(), cancel)
+	defer stop()
+
+	matches := make([]pb.Match, 0, len(prefixes))
+	for _, p := range prefixes {
+		matches = append(matches, pb.Match{Prefix: []byte(p)})
+	}
+	err := db.badger.Subscribe(ctx, func(kvs *badger.KVList) error {
+		for _, kv := range kvs.Kv {
+			change := KeyChange{
+				Key:       string(kv.Key),
+				Value:     kv.Value,
+				Version:   kv.Version,
+				ExpiresAt: kv.ExpiresAt,
+			}
+			if len(kv.Meta) > 0 {
+				change.UserMeta = kv.Meta[0]
+			}
+			// the publisher doesn't carry the delete bit, an empty value
+			// is told apart from a delete by looking the key up
+			if len(kv.Value) == 0 {
+				_, err := db.Get(change.Key)
+				change.Deleted = errors.Is(err, badger.ErrKeyNotFound)
+			}
+			fn(change)
+		}
+		return nil
+	}, matches)
+	if errors.Is(err, context.Canceled) {
+		return nil
+	}
+	return err
+}
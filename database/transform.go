@@ -0,0 +1,172 @@
+package database
+
+import (
+	"errors"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+const transformBatchSize = 1000
+
+// Change is the outcome of a TransformFunc for one key. A nil Change keeps the
+// entry untouched.
+type Change struct {
+	Key    string
+	Value  []byte
+	Delete bool
+	// Keep leaves the original in place when Key renames the entry
+	Keep bool
+	// TTL expires a written entry, it never expires when zero
+	TTL time.Duration
+}
+
+func (c Change) entry() *badger.Entry {
+	e := badger.NewEntry([]byte(c.Key), c.Value)
+	if c.TTL > 0 {
+		e = e.WithTTL(c.TTL)
+	}
+	return e
+}
+
+type TransformFunc func(key string, value []byte) (*Change, error)
+
+type TransformStats struct {
+	Scanned  int `json:"scanned"`
+	Changed  int `json:"changed"`
+	Renamed  int `json:"renamed"`
+	Copied   int `json:"copied"`
+	Deleted  int `json:"deleted"`
+	Rewrites int `json:"rewrites"`
+}
+
+// Transform calls fn for every key under prefix and applies the returned
+// changes in batches. The keys are read from a single snapshot, so entries
+// written by the transform itself are never visited again. With dryRun set
+// nothing is written and only the stats are collected. progress, when not
+// nil, is called after every batch with the stats so far.
+func (db *DB) Transform(prefix string, fn TransformFunc, dryRun bool, progress func(TransformStats)) (stats TransformStats, err error) {
+	if db == nil {
+		return stats, ErrNotRunning
+	}
+	if !db.isRunning.Load() {
+		return stats, ErrNotRunning
+	}
+	if !dryRun && db.isReadOnly.Load() {
+		return stats, ErrReadOnly
+	}
+
+	var pending []Change
+	flush := func() error {
+		if len(pending) == 0 {
+			return nil
+		}
+		if !dryRun {
+			if err := db.applyChanges(pending); err != nil {
+				return err
+			}
+		}
+		pending = pending[:0]
+		if progress != nil {
+			progress(stats)
+		}
+		return nil
+	}
+
+	err = db.view(func(txn *badger.Txn) error {
+		opts := db.iteratorOptions()
+		opts.Prefix = []byte(prefix)
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Rewind(); it.Valid(); it.Next() {
+			item := it.Item()
+			key := string(item.Key())
+			value, err := item.ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			stats.Scanned++
+
+			change, err := fn(key, value)
+			if err != nil {
+				return err
+			}
+			if change == nil {
+				continue
+			}
+			stats.Changed++
+			switch {
+			case change.Delete:
+				stats.Deleted++
+				pending = append(pending, Change{Key: key, Delete: true})
+			case change.Key != key && change.Keep:
+				stats.Copied++
+				pending = append(pending, Change{Key: change.Key, Value: change.Value})
+			case change.Key != key:
+				stats.Renamed++
+				pending = append(pending,
+					Change{Key: key, Delete: true},
+					Change{Key: change.Key, Value: change.Value},
+				)
+			default:
+				stats.Rewrites++
+				pending = append(pending, Change{Key: key, Value: change.Value})
+			}
+
+			if len(pending) >= transformBatchSize {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return stats, err
+	}
+	return stats, flush()
+}
+
+// Apply writes and deletes the changes in as few transactions as badger
+// allows.
+func (db *DB) Apply(changes []Change) error {
+	if db == nil {
+		return ErrNotRunning
+	}
+	if !db.isRunning.Load() {
+		return ErrNotRunning
+	}
+	return db.applyChanges(changes)
+}
+
+// applyChanges writes changes in as few transactions as badger allows.
+func (db *DB) applyChanges(changes []Change) error {
+	for len(changes) > 0 {
+		var applied int
+		err := db.update(func(txn *badger.Txn) error {
+			applied = 0
+			for _, c := range changes {
+				var err error
+				if c.Delete {
+					err = txn.Delete([]byte(c.Key))
+				} else {
+					err = txn.SetEntry(c.entry())
+				}
+				if errors.Is(err, badger.ErrTxnTooBig) && applied > 0 {
+					return nil
+				}
+				if err != nil {
+					return err
+				}
+				applied++
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		changes = changes[applied:]
+	}
+	return nil
+}
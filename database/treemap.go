@@ -0,0 +1,188 @@
+package database
+
+import (
+	"bytes"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+const (
+	DefaultTreemapDepth    = 3
+	DefaultTreemapChildren = 20
+
+	treemapOther = "(other)"
+)
+
+// TreemapNode is a prefix of the keyspace with the keys and bytes below it.
+// Keys and Bytes include the children, the keys stopping at this prefix are
+// the difference.
+type TreemapNode struct {
+	Name   string `json:"name"`
+	Prefix string `json:"prefix"`
+	Keys   int64  `json:"keys"`
+	Bytes  int64  `json:"bytes"`
+	// Label is the user's name of the prefix, filled in by the app
+	Label string `json:"label,omitempty"`
+	// Other groups the smallest children past the children limit
+	Other    bool           `json:"other,omitempty"`
+	Children []*TreemapNode `json:"children,omitempty"`
+
+	byName map[string]*TreemapNode
+}
+
+type Treemap struct {
+	Root *TreemapNode `json:"root"`
+	// Exact is set when every key was read, otherwise the sizes are scaled
+	// up from a sample
+	Exact      bool    `json:"exact"`
+	Sampled    int     `json:"sampled"`
+	Scale      float64 `json:"scale"`
+	DurationMs int64   `json:"duration_ms"`
+}
+
+// Treemap nests the keys under prefix by delimiter segments, depth levels
+// deep, with their key and value bytes. Large keyspaces are sampled the way
+// SampleStats does, with fraction of the keys read in runs from every table
+// start, and the sizes scaled up. Every node keeps at most maxChildren
+// children, the largest by bytes.
+func (db *DB) Treemap(prefix, delimiter string, depth, maxChildren int, fraction float64) (tm Treemap, err error) {
+	if db == nil {
+		return tm, ErrNotRunning
+	}
+	if !db.isRunning.Load() {
+		return tm, ErrNotRunning
+	}
+	if depth <= 0 {
+		depth = DefaultTreemapDepth
+	}
+	if maxChildren <= 0 {
+		maxChildren = DefaultTreemapChildren
+	}
+	if fraction <= 0 || fraction > 1 {
+		fraction = DefaultSampleFraction
+	}
+	start := time.Now()
+
+	seeks, estimated := db.tableSeeks([]byte(prefix))
+	target := int(math.Ceil(float64(estimated) * fraction))
+	target = min(max(target, minSamples), maxSamples)
+	// small keyspaces and ones still in the memtables are read whole
+	perSeek := 0
+	if len(seeks) == 0 || estimated <= uint64(target) {
+		seeks = [][]byte{[]byte(prefix)}
+	} else {
+		perSeek = (target + len(seeks) - 1) / len(seeks)
+	}
+
+	root := &TreemapNode{Name: prefix, Prefix: prefix}
+	showInternal := db.showInternal.Load()
+	err = db.view(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		opts.Prefix = []byte(prefix)
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		var last []byte
+		for _, seek := range seeks {
+			if last != nil && bytes.Compare(seek, last) <= 0 {
+				continue
+			}
+			n := 0
+			for it.Seek(seek); it.Valid() && (perSeek == 0 || n < perSeek); it.Next() {
+				item := it.Item()
+				last = item.KeyCopy(last[:0])
+				n++
+				if !showInternal && IsInternalKey(string(last)) {
+					continue
+				}
+				root.add(string(last[len(prefix):]), delimiter, depth, int64(len(last))+item.ValueSize())
+				tm.Sampled++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return tm, err
+	}
+
+	tm.Exact, tm.Scale = perSeek == 0, 1
+	if !tm.Exact && tm.Sampled > 0 && estimated > uint64(tm.Sampled) {
+		tm.Scale = float64(estimated) / float64(tm.Sampled)
+		root.scale(tm.Scale)
+	}
+	root.prune(maxChildren)
+	tm.Root = root
+	tm.DurationMs = time.Since(start).Milliseconds()
+	return tm, nil
+}
+
+// add counts a key, rest being the part of it below n, on n and on the
+// nodes of its first depth segments.
+func (n *TreemapNode) add(rest, delimiter string, depth int, size int64) {
+	for node := n; ; depth-- {
+		node.Keys++
+		node.Bytes += size
+		if depth == 0 || delimiter == "" {
+			return
+		}
+		// a leading delimiter belongs to the segment, as in firstSegment
+		skip := 0
+		if strings.HasPrefix(rest, delimiter) {
+			skip = len(delimiter)
+		}
+		i := strings.Index(rest[skip:], delimiter)
+		if i < 0 {
+			return
+		}
+		i += skip
+		segment := rest[:i+len(delimiter)]
+		rest = rest[i+len(delimiter):]
+
+		child, ok := node.byName[segment]
+		if !ok {
+			if node.byName == nil {
+				node.byName = make(map[string]*TreemapNode)
+			}
+			child = &TreemapNode{Name: segment[:i], Prefix: node.Prefix + segment}
+			node.byName[segment] = child
+			node.Children = append(node.Children, child)
+		}
+		node = child
+	}
+}
+
+func (n *TreemapNode) scale(factor float64) {
+	n.Keys = int64(math.Round(float64(n.Keys) * factor))
+	n.Bytes = int64(math.Round(float64(n.Bytes) * factor))
+	for _, child := range n.Children {
+		child.scale(factor)
+	}
+}
+
+// prune sorts the children by bytes and folds the ones past maxChildren into
+// an other node.
+func (n *TreemapNode) prune(maxChildren int) {
+	n.byName = nil
+	sort.Slice(n.Children, func(i, j int) bool {
+		if n.Children[i].Bytes != n.Children[j].Bytes {
+			return n.Children[i].Bytes > n.Children[j].Bytes
+		}
+		return n.Children[i].Name < n.Children[j].Name
+	})
+	if len(n.Children) > maxChildren {
+		other := &TreemapNode{Name: treemapOther, Prefix: n.Prefix, Other: true}
+		for _, child := range n.Children[maxChildren:] {
+			other.Keys += child.Keys
+			other.Bytes += child.Bytes
+		}
+		n.Children = append(n.Children[:maxChildren], other)
+	}
+	for _, child := range n.Children {
+		child.prune(maxChildren)
+	}
+}
@@ -0,0 +1,128 @@
+package database
+
+import (
+	"errors"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// Txn is a read-write transaction of Update. Keys read through it are checked
+// for conflicting writes when it commits.
+type Txn struct {
+	txn *badger.Txn
+}
+
+// Get returns the value of key and its version, ErrKeyNotFound when missing.
+func (t *Txn) Get(key string) ([]byte, uint64, error) {
+	item, err := t.txn.Get([]byte(key))
+	if err != nil {
+		return nil, 0, err
+	}
+	value, err := item.ValueCopy(nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	return value, item.Version(), nil
+}
+
+// Version returns the version of key, zero when it doesn't exist.
+func (t *Txn) Version(key string) (uint64, error) {
+	item, err := t.txn.Get([]byte(key))
+	switch {
+	case errors.Is(err, badger.ErrKeyNotFound):
+		return 0, nil
+	case err != nil:
+		return 0, err
+	}
+	return item.Version(), nil
+}
+
+// Set writes key, expiring after ttl when it's positive.
+func (t *Txn) Set(key string, value []byte, ttl time.Duration) error {
+	e := badger.NewEntry([]byte(key), value)
+	if ttl > 0 {
+		e = e.WithTTL(ttl)
+	}
+	return tooBig(t.txn.SetEntry(e))
+}
+
+// Delete removes key.
+func (t *Txn) Delete(key string) error {
+	return tooBig(t.txn.Delete([]byte(key)))
+}
+
+// Apply writes or deletes the change.
+func (t *Txn) Apply(c Change) error {
+	if c.Delete {
+		return t.Delete(c.Key)
+	}
+	return t.Set(c.Key, c.Value, 0)
+}
+
+func tooBig(err error) error {
+	if errors.Is(err, badger.ErrTxnTooBig) {
+		return ErrTooBig
+	}
+	return err
+}
+
+// Update runs fn in one read-write transaction, so its reads and writes
+// commit together or not at all. fn runs again when a key it read was
+// changed by a concurrent writer before the commit.
+func (db *DB) Update(fn func(txn *Txn) error) error {
+	if db == nil {
+		return ErrNotRunning
+	}
+	if !db.isRunning.Load() {
+		return ErrNotRunning
+	}
+	return db.update(func(txn *badger.Txn) error {
+		return fn(&Txn{txn: txn})
+	})
+}
+
+// UpdateKey is Update for a transaction writing key, returning the version
+// key was committed at, zero when it was deleted. key is read first, so a
+// concurrent write of it makes fn run again.
+func (db *DB) UpdateKey(key string, fn func(txn *Txn) error) (version uint64, err error) {
+	if db == nil {
+		return 0, ErrNotRunning
+	}
+	if !db.isRunning.Load() {
+		return 0, ErrNotRunning
+	}
+	since, err := db.updateSince(func(txn *badger.Txn) error {
+		t := &Txn{txn: txn}
+		if _, err := t.Version(key); err != nil {
+			return err
+		}
+		return fn(t)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return db.versionSince(key, since)
+}
+
+// versionSince returns the oldest version of key committed after since, zero
+// when it's a delete. A transaction that read key before writing it can't
+// commit after a concurrent write of key, so that's its own version.
+func (db *DB) versionSince(key string, since uint64) (version uint64, err error) {
+	err = db.view(func(txn *badger.Txn) error {
+		it := txn.NewIterator(db.allVersionsOptions([]byte(key)))
+		defer it.Close()
+		for it.Seek([]byte(key)); it.Valid(); it.Next() {
+			item := it.Item()
+			if string(item.Key()) != key || item.Version() <= since {
+				break
+			}
+			version = item.Version()
+			if item.IsDeletedOrExpired() {
+				version = 0
+			}
+		}
+		return nil
+	})
+	return version, err
+}
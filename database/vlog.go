@@ -0,0 +1,134 @@
+package database
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+const (
+	vlogFileExt      = ".vlog"
+	discardFileName  = "DISCARD"
+	discardEntrySize = 16
+)
+
+type VlogFile struct {
+	Fid          uint32  `json:"fid"`
+	Name         string  `json:"name"`
+	Size         int64   `json:"size"`
+	DiscardBytes uint64  `json:"discard_bytes"`
+	DeadRatio    float64 `json:"dead_ratio"`
+}
+
+// VlogFiles lists the value log files along with the amount of dead data
+// badger has accounted for them in its discard stats.
+func (db *DB) VlogFiles() ([]VlogFile, error) {
+	if db == nil {
+		return nil, ErrNotRunning
+	}
+	if !db.isRunning.Load() {
+		return nil, ErrNotRunning
+	}
+	if db.isInMemory.Load() {
+		return nil, nil
+	}
+
+	dir := db.badgerOpts.ValueDir
+	discards, err := readDiscardStats(filepath.Join(dir, discardFileName))
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []VlogFile
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), vlogFileExt) {
+			continue
+		}
+		fid, err := strconv.ParseUint(strings.TrimSuffix(e.Name(), vlogFileExt), 10, 32)
+		if err != nil {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			return nil, err
+		}
+		f := VlogFile{
+			Fid:          uint32(fid),
+			Name:         e.Name(),
+			Size:         info.Size(),
+			DiscardBytes: discards[fid],
+		}
+		if f.Size > 0 {
+			f.DeadRatio = float64(f.DiscardBytes) / float64(f.Size)
+		}
+		files = append(files, f)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Fid < files[j].Fid })
+	return files, nil
+}
+
+// readDiscardStats parses badger's DISCARD file: sorted big-endian
+// (fid, discard bytes) pairs terminated by an empty slot.
+func readDiscardStats(path string) (map[uint64]uint64, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return map[uint64]uint64{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	stats := make(map[uint64]uint64)
+	for off := 0; off+discardEntrySize <= len(data); off += discardEntrySize {
+		fid := binary.BigEndian.Uint64(data[off : off+8])
+		if fid == 0 {
+			break
+		}
+		stats[fid] = binary.BigEndian.Uint64(data[off+8 : off+discardEntrySize])
+	}
+	return stats, nil
+}
+
+// RunGC runs value log GC rounds until badger finds nothing more to rewrite.
+// A zero ratio uses the one of the connection's GC policy. It reports whether any file was
+// rewritten.
+func (db *DB) RunGC(discardRatio float64) (rewritten bool, err error) {
+	if db == nil {
+		return false, ErrNotRunning
+	}
+	if !db.isRunning.Load() {
+		return false, ErrNotRunning
+	}
+	if discardRatio <= 0 || discardRatio >= 1 {
+		discardRatio = db.gcRatio
+	}
+	start := time.Now()
+	event := GCEvent{DiscardRatio: discardRatio}
+	defer func() {
+		if err != nil {
+			event.Error = err.Error()
+		}
+		event.Took = time.Since(start)
+		db.notifyGC(event)
+	}()
+	for {
+		err = db.badger.RunValueLogGC(discardRatio)
+		if errors.Is(err, badger.ErrNoRewrite) {
+			return event.Rewritten > 0, nil
+		}
+		if err != nil {
+			return event.Rewritten > 0, err
+		}
+		event.Rewritten++
+	}
+}
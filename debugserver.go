@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"log"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"sync"
+	"time"
+)
+
+var publishVarsOnce sync.Once
+
+// restartDebugServer applies the debug settings. The server exposes pprof
+// and expvar (badger publishes its metrics there) so maintainers can profile
+// hangs and memory blowups on user machines. It only ever listens on a
+// loopback address.
+func (a *App) restartDebugServer() {
+	a.stopDebugServer()
+
+	settings := a.settings.Get()
+	if !settings.Debug.Enabled {
+		return
+	}
+	addr := settings.DebugAddr()
+	if !isLoopback(addr) {
+		log.Printf("debug server refused: %s isn't a loopback address", addr)
+		return
+	}
+
+	publishVarsOnce.Do(func() {
+		expvar.Publish("latency", expvar.Func(func() any { return a.latency.summary(false) }))
+	})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		log.Printf("debug server listen failure: %v", err)
+		return
+	}
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("debug server failure: %v", err)
+		}
+	}()
+
+	a.mx.Lock()
+	a.debugServer = srv
+	a.mx.Unlock()
+	log.Printf("debug server listening on %s", addr)
+}
+
+func (a *App) stopDebugServer() {
+	a.mx.Lock()
+	srv := a.debugServer
+	a.debugServer = nil
+	a.mx.Unlock()
+	if srv == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), httpShutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Printf("debug server shutdown failure: %v", err)
+	}
+}
+
+func isLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// knownDecoders are the value decoders a prefix can be assigned.
+var knownDecoders = []string{decoderRaw, decoderText, decoderJSON, decoderHex, decoderBase64, decoderProtobuf}
+
+type MessageDecoder struct {
+	Prefix string `json:"prefix"`
+	// Decoder renders the values under the prefix, empty removes the
+	// assignment
+	Decoder string `json:"decoder"`
+}
+
+// DecodersResponse is the decoder layout of a database, how its values and
+// keys are rendered.
+type DecodersResponse struct {
+	// Decoder is the default decoder of the database
+	Decoder    string            `json:"decoder"`
+	Decoders   map[string]string `json:"decoders"`
+	KeyLayouts map[string]string `json:"key_layouts"`
+}
+
+// setDecoder assigns a value decoder to a prefix of the open database and
+// reports the assignments, kept in its profile so configuring them isn't
+// lost between sessions. Without a body the assignments are only reported.
+func (a *App) setDecoder(msg AppMessage) AppMessage {
+	path := a.openPath()
+	if path == "" {
+		log.Printf("assigning decoder failure: %s", NoProfileResponse)
+		return AppMessage{Type: msg.Type, Body: NoProfileResponse}
+	}
+	if msg.Body != "" {
+		var decoderMsg MessageDecoder
+		if err := json.Unmarshal([]byte(msg.Body), &decoderMsg); err != nil {
+			log.Printf("unmarshaling decoder message failure: %v", err)
+			return AppMessage{Type: msg.Type, Body: err.Error()}
+		}
+		if decoderMsg.Decoder != "" && !isKnownDecoder(decoderMsg.Decoder) {
+			err := fmt.Errorf("unknown decoder %q, expected one of %s", decoderMsg.Decoder, strings.Join(knownDecoders, ", "))
+			log.Printf("assigning decoder failure: %v", err)
+			return AppMessage{Type: msg.Type, Body: err.Error()}
+		}
+		decoders, err := a.settings.SetDecoder(path, decoderMsg.Prefix, decoderMsg.Decoder)
+		if err != nil {
+			log.Printf("assigning decoder failure: %v", err)
+			return AppMessage{Type: msg.Type, Body: err.Error()}
+		}
+		log.Printf("decoder of prefix [%s] set to %q, %d assignments", logKey(decoderMsg.Prefix), decoderMsg.Decoder, len(decoders))
+	}
+
+	profile, _ := a.settings.Get().Profile(path)
+	resp := DecodersResponse{Decoder: profile.Decoder, Decoders: profile.Decoders, KeyLayouts: profile.KeyLayouts}
+	if resp.Decoders == nil {
+		resp.Decoders = map[string]string{}
+	}
+	if resp.KeyLayouts == nil {
+		resp.KeyLayouts = map[string]string{}
+	}
+	bt, _ := json.Marshal(resp)
+	return AppMessage{Type: msg.Type, Body: string(bt)}
+}
+
+func isKnownDecoder(decoder string) bool {
+	for _, d := range knownDecoders {
+		if d == decoder {
+			return true
+		}
+	}
+	return false
+}
+
+// decoderOf returns the decoder the profile of the open database assigns to
+// the longest prefix of key, its default decoder when none matches.
+func (a *App) decoderOf(key string) string {
+	path := a.openPath()
+	if path == "" {
+		return ""
+	}
+	profile, _ := a.settings.Get().Profile(path)
+	var matched string
+	decoder := profile.Decoder
+	for prefix, d := range profile.Decoders {
+		if strings.HasPrefix(key, prefix) && len(prefix) >= len(matched) {
+			matched, decoder = prefix, d
+		}
+	}
+	return decoder
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/filinvadim/badger-gui/database"
+	"image"
+	"image/color"
+	"image/png"
+	"log"
+	"math/rand/v2"
+	"time"
+)
+
+const demoDelimiter = ":"
+
+// DemoKeyspace describes one sample prefix of the demo database.
+type DemoKeyspace struct {
+	Prefix      string `json:"prefix"`
+	Keys        int    `json:"keys"`
+	Description string `json:"description"`
+}
+
+type DemoResponse struct {
+	OpenResponse
+	Delimiter string         `json:"delimiter"`
+	Keys      int            `json:"keys"`
+	Keyspaces []DemoKeyspace `json:"keyspaces"`
+}
+
+// demoEntry is a sample key, TTL zero never expires.
+type demoEntry struct {
+	key   string
+	value []byte
+	ttl   time.Duration
+}
+
+// openDemo opens an in-memory database filled with sample data so every
+// feature can be tried before pointing the app at real data. Nothing is
+// written to disk and the data is gone on close.
+func (a *App) openDemo(msg AppMessage) AppMessage {
+	if a.db.IsRunning() {
+		log.Printf(AlreadyRunningResponse)
+		return AppMessage{Type: msg.Type, Body: AlreadyRunningResponse}
+	}
+	if pending, ok := a.stagedPending(msg.Type, ""); ok {
+		return pending
+	}
+	if err := a.db.Open(database.OpenOptions{}); err != nil {
+		log.Printf("opening demo db failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+
+	keyspaces, entries := demoData(rand.New(rand.NewPCG(1, 2)))
+	if err := a.seedDemo(entries); err != nil {
+		log.Printf("seeding demo db failure: %v", err)
+		a.db.Close()
+		a.emitClosedAt("", ClosedInvalid)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+
+	a.startSession(&MessageOpen{Delimiter: demoDelimiter})
+	a.emitOpened(true)
+
+	log.Printf("demo db opened with %d keys", len(entries))
+	bt, _ := json.Marshal(DemoResponse{
+		OpenResponse: OpenResponse{
+			Status: OkStatus, InMemory: a.db.IsInMemory(), MaxVersion: a.db.MaxVersion(), PageSize: a.db.PageSize(),
+		},
+		Delimiter: demoDelimiter,
+		Keys:      len(entries),
+		Keyspaces: keyspaces,
+	})
+	return AppMessage{Type: msg.Type, Body: string(bt)}
+}
+
+// seedDemo writes the entries and then sets the TTLs, grouped so each TTL
+// takes one transaction.
+func (a *App) seedDemo(entries []demoEntry) error {
+	byTTL := make(map[time.Duration][]string)
+	for _, e := range entries {
+		if err := a.db.Set(e.key, e.value); err != nil {
+			return err
+		}
+		if e.ttl > 0 {
+			byTTL[e.ttl] = append(byTTL[e.ttl], e.key)
+		}
+	}
+	for ttl, keys := range byTTL {
+		if _, err := a.db.Touch(keys, ttl); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// demoData generates the sample keyspaces. rnd is seeded so every demo
+// database looks the same.
+func demoData(rnd *rand.Rand) ([]DemoKeyspace, []demoEntry) {
+	var (
+		keyspaces []DemoKeyspace
+		entries   []demoEntry
+	)
+	add := func(prefix, description string, generated []demoEntry) {
+		keyspaces = append(keyspaces, DemoKeyspace{Prefix: prefix, Keys: len(generated), Description: description})
+		entries = append(entries, generated...)
+	}
+	add("users:", "JSON user records", demoUsers(rnd))
+	add("shop:", "JSON orders under deep region and month prefixes", demoOrders(rnd))
+	add("blobs:", "random binary values from 256 bytes to 64KB", demoBlobs(rnd))
+	add("images:", "PNG images", demoImages())
+	add("sessions:", "JSON sessions expiring within minutes to hours", demoSessions(rnd))
+	add("counters:", "big endian uint64 counters", demoCounters(rnd))
+	add("config:", "plain text settings", demoConfig())
+	return keyspaces, entries
+}
+
+var (
+	demoNames    = []string{"ada", "alan", "grace", "linus", "ken", "barbara", "edsger", "margaret", "dennis", "frances"}
+	demoCities   = []string{"Berlin", "Lisbon", "Osaka", "Toronto", "Nairobi", "Lima", "Oslo", "Austin"}
+	demoPlans    = []string{"free", "pro", "team", "enterprise"}
+	demoRegions  = []string{"eu", "us", "apac"}
+	demoProducts = []string{"keyboard", "monitor", "cable", "dock", "mouse", "headset"}
+	demoStatuses = []string{"pending", "paid", "shipped", "delivered", "refunded"}
+	demoEpoch    = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+)
+
+func pick[T any](rnd *rand.Rand, s []T) T {
+	return s[rnd.IntN(len(s))]
+}
+
+func mustJSON(v any) []byte {
+	bt, _ := json.Marshal(v)
+	return bt
+}
+
+func demoUsers(rnd *rand.Rand) []demoEntry {
+	entries := make([]demoEntry, 0, 200)
+	for i := 1; i <= 200; i++ {
+		name := pick(rnd, demoNames)
+		entries = append(entries, demoEntry{
+			key: fmt.Sprintf("users:%04d", i),
+			value: mustJSON(map[string]any{
+				"id":         i,
+				"name":       name,
+				"email":      fmt.Sprintf("%s%d@example.com", name, i),
+				"plan":       pick(rnd, demoPlans),
+				"created_at": demoEpoch.Add(time.Duration(rnd.IntN(365*24)) * time.Hour),
+				"tags":       []string{pick(rnd, demoPlans), pick(rnd, demoRegions)},
+				"address":    map[string]string{"city": pick(rnd, demoCities)},
+			}),
+		})
+	}
+	return entries
+}
+
+func demoOrders(rnd *rand.Rand) []demoEntry {
+	entries := make([]demoEntry, 0, 300)
+	for i := 1; i <= 300; i++ {
+		at := demoEpoch.Add(time.Duration(rnd.IntN(365*24)) * time.Hour)
+		items := make([]map[string]any, 1+rnd.IntN(4))
+		for j := range items {
+			items[j] = map[string]any{"product": pick(rnd, demoProducts), "qty": 1 + rnd.IntN(3), "price_cents": 500 + rnd.IntN(50000)}
+		}
+		entries = append(entries, demoEntry{
+			key: fmt.Sprintf("shop:%s:orders:%s:%06d", pick(rnd, demoRegions), at.Format("2006-01"), i),
+			value: mustJSON(map[string]any{
+				"id": i, "user": fmt.Sprintf("users:%04d", 1+rnd.IntN(200)),
+				"status": pick(rnd, demoStatuses), "created_at": at, "items": items,
+			}),
+		})
+	}
+	return entries
+}
+
+func demoBlobs(rnd *rand.Rand) []demoEntry {
+	entries := make([]demoEntry, 0, 50)
+	for i := 1; i <= 50; i++ {
+		value := make([]byte, 256+rnd.IntN(64<<10-256))
+		for j := range value {
+			value[j] = byte(rnd.Uint32())
+		}
+		entries = append(entries, demoEntry{key: fmt.Sprintf("blobs:%03d.bin", i), value: value})
+	}
+	return entries
+}
+
+func demoImages() []demoEntry {
+	entries := []demoEntry{{key: "images:icon.png", value: icon}}
+	colors := map[string]color.RGBA{
+		"red": {R: 220, G: 50, B: 47, A: 255}, "green": {R: 133, G: 153, B: 0, A: 255}, "blue": {R: 38, G: 139, B: 210, A: 255},
+	}
+	for name, c := range colors {
+		img := image.NewRGBA(image.Rect(0, 0, 64, 64))
+		for y := 0; y < 64; y++ {
+			for x := 0; x < 64; x++ {
+				shade := uint8(x * 4)
+				img.Set(x, y, color.RGBA{R: c.R ^ shade, G: c.G ^ uint8(y*4), B: c.B, A: c.A})
+			}
+		}
+		var buf bytes.Buffer
+		_ = png.Encode(&buf, img)
+		entries = append(entries, demoEntry{key: "images:thumbs:" + name + ".png", value: buf.Bytes()})
+	}
+	return entries
+}
+
+func demoSessions(rnd *rand.Rand) []demoEntry {
+	ttls := []time.Duration{2 * time.Minute, 10 * time.Minute, time.Hour, 24 * time.Hour}
+	entries := make([]demoEntry, 0, 100)
+	for i := 0; i < 100; i++ {
+		token := make([]byte, 16)
+		for j := range token {
+			token[j] = byte(rnd.Uint32())
+		}
+		entries = append(entries, demoEntry{
+			key:   "sessions:" + hex.EncodeToString(token),
+			value: mustJSON(map[string]any{"user": fmt.Sprintf("users:%04d", 1+rnd.IntN(200)), "ip": fmt.Sprintf("10.0.%d.%d", rnd.IntN(256), rnd.IntN(256))}),
+			ttl:   pick(rnd, ttls),
+		})
+	}
+	return entries
+}
+
+func demoCounters(rnd *rand.Rand) []demoEntry {
+	names := []string{"page_views", "signups", "orders", "refunds", "api_calls"}
+	entries := make([]demoEntry, 0, len(names))
+	for _, name := range names {
+		value := make([]byte, 8)
+		binary.BigEndian.PutUint64(value, rnd.Uint64N(1_000_000))
+		entries = append(entries, demoEntry{key: "counters:" + name, value: value})
+	}
+	return entries
+}
+
+func demoConfig() []demoEntry {
+	return []demoEntry{
+		{key: "config:app:name", value: []byte("badger demo shop")},
+		{key: "config:app:feature_flags", value: []byte("checkout_v2=true\nnew_search=false\ndark_mode=true\n")},
+		{key: "config:app:maintenance_window", value: []byte("sunday 02:00-04:00 UTC")},
+		{key: "config:limits:max_upload_mb", value: []byte("25")},
+	}
+}
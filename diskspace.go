@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/filinvadim/badger-gui/database"
+	"log"
+	"os"
+)
+
+const LowDiskSpaceStatus = "low_disk_space"
+
+type MessageSpaceEstimate struct {
+	// Operation is restore, import or flatten
+	Operation string `json:"operation"`
+	// Path is the backup file of a restore, Bytes the size of the data to
+	// restore or import otherwise
+	Path  string `json:"path"`
+	Bytes int64  `json:"bytes"`
+}
+
+// LowDiskSpaceResponse answers a write operation held back because the disk
+// may not fit it. Sending it again with accept_low_space proceeds.
+type LowDiskSpaceResponse struct {
+	Status   string                 `json:"status"`
+	Estimate database.SpaceEstimate `json:"estimate"`
+}
+
+type MessageFlatten struct {
+	AcceptLowSpace bool `json:"accept_low_space"`
+}
+
+// spaceEstimate answers how much disk space an operation is expected to take
+// and whether it fits, before it's started.
+func (a *App) spaceEstimate(msg AppMessage) AppMessage {
+	if !a.db.IsRunning() {
+		return AppMessage{Type: msg.Type, Body: NotRunningResponse}
+	}
+	var estimateMsg MessageSpaceEstimate
+	if err := json.Unmarshal([]byte(msg.Body), &estimateMsg); err != nil {
+		log.Printf("unmarshaling space estimate message failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+	if estimateMsg.Path != "" {
+		info, err := os.Stat(database.LongPath(estimateMsg.Path))
+		if err != nil {
+			log.Printf("reading backup file failure: %v", err)
+			return AppMessage{Type: msg.Type, Body: err.Error()}
+		}
+		estimateMsg.Bytes = info.Size()
+	}
+	estimate, err := a.db.EstimateSpace(estimateMsg.Operation, estimateMsg.Bytes)
+	if err != nil {
+		log.Printf("estimating disk space failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+	bt, _ := json.Marshal(estimate)
+	return AppMessage{Type: msg.Type, Body: string(bt)}
+}
+
+// guardSpace checks that operation on input bytes fits on the disk and
+// returns the answer holding it back when it doesn't and low space wasn't
+// accepted. Badger fills a disk ungracefully, so failing to estimate holds
+// the operation back too.
+func (a *App) guardSpace(t messageType, operation string, input int64, accept bool) (AppMessage, bool) {
+	estimate, err := a.db.EstimateSpace(operation, input)
+	return holdLowSpace(t, estimate, err, accept)
+}
+
+// holdLowSpace is guardSpace for an estimate made already.
+func holdLowSpace(t messageType, estimate database.SpaceEstimate, err error, accept bool) (AppMessage, bool) {
+	if err != nil {
+		log.Printf("estimating disk space failure: %v", err)
+		return AppMessage{Type: t, Body: err.Error()}, false
+	}
+	operation := estimate.Operation
+	if estimate.Sufficient {
+		return AppMessage{}, true
+	}
+	if accept {
+		log.Printf("%s going ahead on low disk space: %s free in %s, about %s needed",
+			operation, formatBytes(int64(estimate.Free)), estimate.Dir, formatBytes(int64(estimate.Required)))
+		return AppMessage{}, true
+	}
+	log.Printf("%s held back by low disk space: %s free in %s, about %s needed",
+		operation, formatBytes(int64(estimate.Free)), estimate.Dir, formatBytes(int64(estimate.Required)))
+	bt, _ := json.Marshal(LowDiskSpaceResponse{Status: LowDiskSpaceStatus, Estimate: estimate})
+	return AppMessage{Type: t, Body: string(bt)}, false
+}
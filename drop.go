@@ -0,0 +1,106 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"github.com/filinvadim/badger-gui/database"
+	"log"
+	"time"
+)
+
+const (
+	defaultDropPreviewKeys = 100
+	dropTokenTTL           = 5 * time.Minute
+
+	DropTokenInvalidResponse = "drop token is invalid or expired, request a new preview"
+)
+
+type MessageDropPrefix struct {
+	Prefix string `json:"prefix"`
+	// Limit is how many affected keys the preview lists, 100 by default
+	Limit int `json:"limit"`
+	// Token confirms a previous preview of the same prefix, without it
+	// nothing is dropped
+	Token string `json:"token"`
+}
+
+type DropPreviewResponse struct {
+	Prefix string   `json:"prefix"`
+	Count  int      `json:"count"`
+	Keys   []string `json:"keys"`
+	// Token must be sent back with the same prefix to execute the drop
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type pendingDrop struct {
+	prefix, token string
+	expiresAt     time.Time
+}
+
+// dropPrefix previews a DropPrefix and executes it only when confirmed with
+// the server-generated token of that preview, so a scripted Call can't wipe
+// a namespace by accident.
+func (a *App) dropPrefix(msg AppMessage) AppMessage {
+	if !a.db.IsRunning() {
+		log.Printf("db not running for drop prefix operation")
+		return AppMessage{Type: msg.Type, Body: NotRunningResponse}
+	}
+	var dropMsg MessageDropPrefix
+	if err := json.Unmarshal([]byte(msg.Body), &dropMsg); err != nil {
+		log.Printf("unmarshaling drop prefix message failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+	// in a virtual database the prefix is within its own, empty drops all of it
+	dropMsg.Prefix = a.virtualKey(dropMsg.Prefix)
+	if dropMsg.Token != "" {
+		return a.confirmDrop(msg.Type, dropMsg)
+	}
+
+	limit := dropMsg.Limit
+	if limit <= 0 {
+		limit = defaultDropPreviewKeys
+	}
+	preview := DropPreviewResponse{Prefix: a.shownKey(dropMsg.Prefix), Keys: make([]string, 0, limit)}
+	err := a.db.WalkAllKeys(dropMsg.Prefix, func(meta database.KeyMeta) error {
+		if len(preview.Keys) < limit {
+			preview.Keys = append(preview.Keys, a.shownKey(meta.Key))
+		}
+		preview.Count++
+		return nil
+	})
+	if err != nil {
+		log.Printf("previewing drop prefix failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+
+	preview.Token = rand.Text()
+	preview.ExpiresAt = time.Now().Add(dropTokenTTL)
+	a.mx.Lock()
+	a.pendingDrop = &pendingDrop{prefix: dropMsg.Prefix, token: preview.Token, expiresAt: preview.ExpiresAt}
+	a.mx.Unlock()
+
+	log.Printf("drop of prefix %q previewed, %d keys affected", logKey(dropMsg.Prefix), preview.Count)
+	bt, _ := json.Marshal(preview)
+	return AppMessage{Type: msg.Type, Body: string(bt)}
+}
+
+func (a *App) confirmDrop(t messageType, dropMsg MessageDropPrefix) AppMessage {
+	a.mx.Lock()
+	pending := a.pendingDrop
+	// a token is good for a single attempt
+	a.pendingDrop = nil
+	a.mx.Unlock()
+
+	if pending == nil || pending.token != dropMsg.Token || pending.prefix != dropMsg.Prefix ||
+		time.Now().After(pending.expiresAt) {
+		log.Printf("dropping prefix rejected: %s", DropTokenInvalidResponse)
+		return AppMessage{Type: t, Body: DropTokenInvalidResponse}
+	}
+	if err := a.db.DropPrefix(dropMsg.Prefix); err != nil {
+		log.Printf("dropping prefix failure %q: %v", logKey(dropMsg.Prefix), err)
+		return AppMessage{Type: t, Body: err.Error()}
+	}
+	log.Printf("prefix %q dropped", logKey(dropMsg.Prefix))
+	return AppMessage{Type: t, Body: OkStatus}
+}
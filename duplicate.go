@@ -0,0 +1,45 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+)
+
+type MessageDuplicate struct {
+	Key    string `json:"key"`
+	NewKey string `json:"new_key"`
+	// Overwrite allows replacing an existing new_key
+	Overwrite bool `json:"overwrite"`
+}
+
+func (a *App) duplicate(msg AppMessage) AppMessage {
+	if !a.db.IsRunning() {
+		log.Printf("db not running for duplicate operation")
+		return AppMessage{Type: msg.Type, Body: NotRunningResponse}
+	}
+	var dupMsg MessageDuplicate
+	if err := json.Unmarshal([]byte(msg.Body), &dupMsg); err != nil {
+		log.Printf("unmarshaling duplicate message failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+	dupMsg.Key, dupMsg.NewKey = a.virtualKey(dupMsg.Key), a.virtualKey(dupMsg.NewKey)
+	if dupMsg.Overwrite && a.isWriteProtected(TypeDelete) {
+		log.Printf("overwriting duplicate rejected: write password required")
+		return AppMessage{Type: msg.Type, Body: WriteProtectedResponse}
+	}
+	if a.isStaging() {
+		if err := a.stageDuplicate(dupMsg.Key, dupMsg.NewKey, dupMsg.Overwrite); err != nil {
+			log.Printf("staging duplicate of key failure %s: %v", logKey(dupMsg.Key), err)
+			return AppMessage{Type: msg.Type, Body: err.Error()}
+		}
+		log.Printf("duplicate of key %s to %s staged", logKey(dupMsg.Key), logKey(dupMsg.NewKey))
+		bt, _ := json.Marshal(WriteResponse{Status: StagedStatus})
+		return AppMessage{Type: msg.Type, Body: string(bt)}
+	}
+	if err := a.db.Duplicate(dupMsg.Key, dupMsg.NewKey, dupMsg.Overwrite); err != nil {
+		log.Printf("duplicating key failure %s: %v", logKey(dupMsg.Key), err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+	log.Printf("key %s duplicated to %s", logKey(dupMsg.Key), logKey(dupMsg.NewKey))
+	return AppMessage{Type: msg.Type, Body: OkStatus}
+}
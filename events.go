@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/filinvadim/badger-gui/database"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+	"log"
+	"time"
+)
+
+// Lifecycle events, so the frontend learns about state changes without
+// polling. job:progress is emitted by the jobs, see EventJobProgress.
+const (
+	EventDBOpened   = "db:opened"
+	EventDBClosed   = "db:closed"
+	EventDBError    = "db:error"
+	EventGCDone     = "gc:done"
+	EventKeyChanged = "key:changed"
+
+	ClosedIdle        = "idle"
+	ClosedUnhealthy   = "unhealthy"
+	ClosedRefresh     = "refresh"
+	ClosedReconfigure = "reconfigure"
+	// ClosedInvalid is a snapshot or demo closed again because loading it
+	// failed after it was opened
+	ClosedInvalid  = "invalid"
+	ClosedShutdown = "shutdown"
+
+	// keyChangedInterval batches key:changed events, a bulk import would
+	// flood the frontend otherwise
+	keyChangedInterval = 250 * time.Millisecond
+	keyChangedMaxBatch = 1000
+)
+
+type DBOpenedEvent struct {
+	Path       string `json:"path"`
+	InMemory   bool   `json:"inmemory"`
+	Managed    bool   `json:"managed"`
+	ReadOnly   bool   `json:"read_only"`
+	MaxVersion uint64 `json:"max_version"`
+	Demo       bool   `json:"demo,omitempty"`
+	// Virtual is the virtual database switched to, shown as an entry of
+	// its own with its Prefix
+	Virtual string `json:"virtual,omitempty"`
+	Prefix  string `json:"prefix,omitempty"`
+}
+
+type DBClosedEvent struct {
+	Path string `json:"path"`
+	// Reason is why the app closed the database, idle, unhealthy,
+	// refresh, reconfigure, invalid or shutdown
+	Reason string `json:"reason"`
+}
+
+type DBErrorEvent struct {
+	Path string `json:"path"`
+	// Op is what failed: open, health or gc
+	Op    string `json:"op"`
+	Error string `json:"error"`
+}
+
+// KeyChangedEvent carries the writes made since the previous one, values
+// left out. Dropped counts the changes beyond the batch limit.
+type KeyChangedEvent struct {
+	Changes []database.KeyChange `json:"changes"`
+	Dropped int                  `json:"dropped,omitempty"`
+}
+
+func (a *App) emitOpened(demo bool) {
+	a.mx.Lock()
+	virtual, prefix := a.virtual, a.scope
+	a.mx.Unlock()
+	if virtual == "" {
+		prefix = ""
+	}
+	runtime.EventsEmit(a.ctx, EventDBOpened, DBOpenedEvent{
+		Path: a.openPath(), InMemory: a.db.IsInMemory(), Managed: a.db.IsManaged(),
+		ReadOnly: a.db.IsReadOnly(), MaxVersion: a.db.MaxVersion(), Demo: demo,
+		Virtual: virtual, Prefix: prefix,
+	})
+}
+
+func (a *App) emitClosed(reason string) {
+	a.emitClosedAt(a.openPath(), reason)
+}
+
+// emitClosedAt is emitClosed for a database that never became the open one,
+// its path isn't the session's.
+func (a *App) emitClosedAt(path, reason string) {
+	runtime.EventsEmit(a.ctx, EventDBClosed, DBClosedEvent{Path: path, Reason: reason})
+}
+
+func (a *App) emitError(op, path string, err error) {
+	runtime.EventsEmit(a.ctx, EventDBError, DBErrorEvent{Path: path, Op: op, Error: err.Error()})
+}
+
+// onGC forwards finished value log GC runs, failed ones also as db:error.
+func (a *App) onGC(event database.GCEvent) {
+	runtime.EventsEmit(a.ctx, EventGCDone, event)
+	if event.Error != "" {
+		a.emitError("gc", a.openPath(), errors.New(event.Error))
+	}
+}
+
+// emitKeyChanges emits key:changed for every write to the open database
+// until ctx is done, batched by keyChangedInterval.
+func (a *App) emitKeyChanges(ctx context.Context) {
+	// the batching stops with the subscription, which ends on close too
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	changes := make(chan database.KeyChange, keyChangedMaxBatch)
+	go func() {
+		var pending KeyChangedEvent
+		ticker := time.NewTicker(keyChangedInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				if event := a.virtualChanges(pending); len(event.Changes) > 0 {
+					runtime.EventsEmit(a.ctx, EventKeyChanged, event)
+				}
+				return
+			case change := <-changes:
+				if len(pending.Changes) >= keyChangedMaxBatch {
+					pending.Dropped++
+					continue
+				}
+				change.Value = nil
+				pending.Changes = append(pending.Changes, change)
+			case <-ticker.C:
+				if len(pending.Changes) == 0 {
+					continue
+				}
+				if event := a.virtualChanges(pending); len(event.Changes) > 0 || event.Dropped > 0 {
+					runtime.EventsEmit(a.ctx, EventKeyChanged, event)
+				}
+				pending = KeyChangedEvent{}
+			}
+		}
+	}()
+
+	err := a.db.Subscribe(ctx, []string{""}, func(change database.KeyChange) {
+		select {
+		case changes <- change:
+		case <-ctx.Done():
+		}
+	})
+	if err != nil {
+		log.Printf("watching key changes failure: %v", err)
+	}
+}
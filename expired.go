@@ -0,0 +1,48 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+)
+
+type MessagePurgeExpired struct {
+	Prefix string `json:"prefix"`
+	// Purge deletes the expired entries, otherwise they're only reported
+	Purge bool `json:"purge"`
+}
+
+// purgeExpired reconciles the table key counts with what applications see by
+// reporting, and optionally deleting, entries that expired but linger until
+// compaction.
+func (a *App) purgeExpired(msg AppMessage) AppMessage {
+	if !a.db.IsRunning() {
+		log.Printf("db not running for purge expired operation")
+		return AppMessage{Type: msg.Type, Body: NotRunningResponse}
+	}
+	var purgeMsg MessagePurgeExpired
+	if msg.Body != "" {
+		if err := json.Unmarshal([]byte(msg.Body), &purgeMsg); err != nil {
+			log.Printf("unmarshaling purge expired message failure: %v", err)
+			return AppMessage{Type: msg.Type, Body: err.Error()}
+		}
+	}
+	if purgeMsg.Purge && a.isWriteLocked(TypeDelete) {
+		log.Printf("purging expired keys rejected: safe mode is on")
+		return AppMessage{Type: msg.Type, Body: SafeModeOnResponse}
+	}
+	if purgeMsg.Purge && a.isWriteProtected(TypeDelete) {
+		log.Printf("purging expired keys rejected: write password required")
+		return AppMessage{Type: msg.Type, Body: WriteProtectedResponse}
+	}
+
+	purgeMsg.Prefix = a.scoped(purgeMsg.Prefix)
+	stats, err := a.db.ExpiredKeys(purgeMsg.Prefix, purgeMsg.Purge)
+	if err != nil {
+		log.Printf("purging expired keys failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+	log.Printf("found %d expired of %d keys, %d deleted", stats.Expired, stats.Scanned, stats.Deleted)
+	stats.Keys = a.shownMeta(stats.Keys)
+	bt, _ := json.Marshal(stats)
+	return AppMessage{Type: msg.Type, Body: string(bt)}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/filinvadim/badger-gui/database"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+	"log"
+	"sort"
+	"time"
+)
+
+const (
+	expiryCheckInterval = 5 * time.Second
+	defaultExpiryLead   = time.Minute
+)
+
+type MessageWatchExpiry struct {
+	Keys []string `json:"keys"`
+	// Unwatch removes the keys instead of adding them
+	Unwatch bool `json:"unwatch"`
+	// Lead is how long before expiry to warn, a Go duration, one minute by default
+	Lead string `json:"lead"`
+}
+
+type WatchExpiryResponse struct {
+	Keys []ExpiryWatch `json:"keys"`
+}
+
+type ExpiryWatch struct {
+	Key       string `json:"key"`
+	ExpiresAt uint64 `json:"expires_at"`
+	Lead      string `json:"lead"`
+
+	lead   time.Duration
+	warned bool
+}
+
+// ExpiryEvent is emitted as key:expiring shortly before a watched key expires
+// and as key:expired once it's gone.
+type ExpiryEvent struct {
+	Key       string `json:"key"`
+	ExpiresAt uint64 `json:"expires_at"`
+	In        string `json:"in,omitempty"`
+}
+
+func (a *App) watchExpiry(msg AppMessage) AppMessage {
+	var watchMsg MessageWatchExpiry
+	if err := json.Unmarshal([]byte(msg.Body), &watchMsg); err != nil {
+		log.Printf("unmarshaling watch expiry message failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+	lead := defaultExpiryLead
+	if watchMsg.Lead != "" {
+		var err error
+		if lead, err = time.ParseDuration(watchMsg.Lead); err != nil {
+			log.Printf("parsing expiry lead failure: %v", err)
+			return AppMessage{Type: msg.Type, Body: err.Error()}
+		}
+	}
+
+	prefix := a.virtualPrefix()
+	a.mx.Lock()
+	if a.expiryWatches == nil {
+		a.expiryWatches = make(map[string]*ExpiryWatch)
+	}
+	for _, key := range watchMsg.Keys {
+		key = prefix + key
+		if watchMsg.Unwatch {
+			delete(a.expiryWatches, key)
+			continue
+		}
+		a.expiryWatches[key] = &ExpiryWatch{Key: key, Lead: lead.String(), lead: lead}
+	}
+	watches := a.expiryWatchList()
+	a.mx.Unlock()
+
+	log.Printf("watching expiry of %d keys", len(watches))
+	// a virtual database answers its own watches
+	shown := make([]ExpiryWatch, 0, len(watches))
+	for _, w := range watches {
+		var ok bool
+		if w.Key, ok = relativeTo(prefix, w.Key); ok {
+			shown = append(shown, w)
+		}
+	}
+	bt, _ := json.Marshal(WatchExpiryResponse{Keys: shown})
+	return AppMessage{Type: msg.Type, Body: string(bt)}
+}
+
+// expiryWatchList must be called with a.mx held.
+func (a *App) expiryWatchList() []ExpiryWatch {
+	watches := make([]ExpiryWatch, 0, len(a.expiryWatches))
+	for _, w := range a.expiryWatches {
+		watches = append(watches, *w)
+	}
+	sort.Slice(watches, func(i, j int) bool { return watches[i].Key < watches[j].Key })
+	return watches
+}
+
+// watchExpiries checks the watched keys and notifies the frontend before and
+// after they expire. A key that disappeared is no longer watched.
+func (a *App) watchExpiries() {
+	defer a.reportCrash(crashSourceWatchExpiry)
+	ticker := time.NewTicker(expiryCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-a.done:
+			return
+		case <-ticker.C:
+		}
+		if !a.db.IsRunning() {
+			continue
+		}
+
+		a.mx.Lock()
+		watches := a.expiryWatchList()
+		a.mx.Unlock()
+
+		for _, w := range watches {
+			meta, err := a.db.Meta(w.Key)
+			if errors.Is(err, database.ErrKeyNotFound) {
+				a.mx.Lock()
+				delete(a.expiryWatches, w.Key)
+				a.mx.Unlock()
+				if key, ok := a.relativeKey(w.Key); ok {
+					runtime.EventsEmit(a.ctx, EventKeyExpired, ExpiryEvent{Key: key, ExpiresAt: w.ExpiresAt})
+				}
+				continue
+			}
+			if err != nil {
+				log.Printf("checking expiry of watched key failure: %v", err)
+				continue
+			}
+
+			left := time.Until(time.Unix(int64(meta.ExpiresAt), 0))
+			warn := meta.ExpiresAt > 0 && left <= w.lead && !(w.warned && meta.ExpiresAt == w.ExpiresAt)
+			a.mx.Lock()
+			if current, ok := a.expiryWatches[w.Key]; ok {
+				// a refreshed TTL arms the warning again
+				current.warned = warn || (current.warned && meta.ExpiresAt == current.ExpiresAt)
+				current.ExpiresAt = meta.ExpiresAt
+			}
+			a.mx.Unlock()
+			// watches of other tenants stay quiet in a virtual database
+			if key, ok := a.relativeKey(w.Key); warn && ok {
+				runtime.EventsEmit(a.ctx, EventKeyExpiring, ExpiryEvent{
+					Key: key, ExpiresAt: meta.ExpiresAt, In: left.Round(time.Second).String(),
+				})
+			}
+		}
+	}
+}
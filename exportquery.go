@@ -0,0 +1,269 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/filinvadim/badger-gui/database"
+	"log"
+	"os"
+	"regexp"
+	"strconv"
+	"unicode/utf8"
+)
+
+const (
+	exportFormatJSONL  = "jsonl"
+	exportFormatNDJSON = "ndjson"
+	exportFormatJSON   = "json"
+	exportFormatCSV    = "csv"
+)
+
+var exportQueryColumns = []string{"key", "size", "expires_at", "version", "value", "encoding"}
+
+// MessageExportQuery is the params of an export_query job: the keys under
+// Prefix passing every set filter are written to Path.
+type MessageExportQuery struct {
+	Path   string `json:"path"`
+	Prefix string `json:"prefix"`
+	// Match keeps the keys matching the regexp
+	Match string `json:"match"`
+	// Contains keeps the keys whose value holds this text
+	Contains string `json:"contains"`
+	// ValueMatch keeps the keys whose value matches the regexp
+	ValueMatch string `json:"value_match"`
+	// Format is jsonl (or ndjson), the default, json for a single array or
+	// csv with a header row
+	Format string `json:"format"`
+	// WithValues adds the values, raw when they're valid UTF-8 and in
+	// BinaryEncoding otherwise
+	WithValues bool `json:"with_values"`
+	// BinaryEncoding is base64, the default, or hex
+	BinaryEncoding string `json:"binary_encoding"`
+}
+
+// MessageExport exports the keys and values under Prefix to Path as an
+// export_query job, binary values in hex.
+type MessageExport struct {
+	Path   string `json:"path"`
+	Prefix string `json:"prefix"`
+	// Format is json, ndjson, the default, or csv
+	Format string `json:"format"`
+}
+
+// ExportQueryRow is one exported key.
+type ExportQueryRow struct {
+	Key       string `json:"key"`
+	Size      int64  `json:"size"`
+	ExpiresAt uint64 `json:"expires_at"`
+	Version   uint64 `json:"version"`
+	Value     string `json:"value,omitempty"`
+	Encoding  string `json:"encoding,omitempty"`
+}
+
+// exportQueryTask writes the keys matching a query, reading values only when
+// a value filter or the output needs them.
+type exportQueryTask struct {
+	db         Storer
+	msg        MessageExportQuery
+	match      *regexp.Regexp
+	valueMatch *regexp.Regexp
+	f          *os.File
+	w          *bufio.Writer
+	offset     int64
+	written    int64
+
+	// csvBuf holds the csv encoding of one row
+	csvBuf bytes.Buffer
+	csv    *csv.Writer
+}
+
+func newExportQueryTask(db Storer, params json.RawMessage, offset, rows int64) (jobTask, error) {
+	var queryMsg MessageExportQuery
+	if err := json.Unmarshal(params, &queryMsg); err != nil {
+		return nil, err
+	}
+	if queryMsg.Path == "" {
+		return nil, errors.New("export path is required")
+	}
+	switch queryMsg.Format {
+	case "", exportFormatNDJSON:
+		queryMsg.Format = exportFormatJSONL
+	case exportFormatJSONL, exportFormatJSON, exportFormatCSV:
+	default:
+		return nil, fmt.Errorf("unknown export format %q", queryMsg.Format)
+	}
+	switch queryMsg.BinaryEncoding {
+	case "":
+		queryMsg.BinaryEncoding = encodingBase64
+	case encodingBase64, encodingHex:
+	default:
+		return nil, fmt.Errorf("unknown binary encoding %q, expected base64 or hex", queryMsg.BinaryEncoding)
+	}
+	t := &exportQueryTask{db: db, msg: queryMsg}
+	var err error
+	if queryMsg.Match != "" {
+		if t.match, err = regexp.Compile(queryMsg.Match); err != nil {
+			return nil, err
+		}
+	}
+	if queryMsg.ValueMatch != "" {
+		if t.valueMatch, err = regexp.Compile(queryMsg.ValueMatch); err != nil {
+			return nil, err
+		}
+	}
+	t.csv = csv.NewWriter(&t.csvBuf)
+
+	if t.f, err = openJobOutput(queryMsg.Path, offset); err != nil {
+		return nil, err
+	}
+	t.w, t.offset, t.written = bufio.NewWriter(t.f), offset, rows
+	if queryMsg.Format == exportFormatJSON && offset == 0 {
+		if err := t.write([]byte("[\n")); err != nil {
+			_ = t.f.Close()
+			return nil, err
+		}
+	}
+	if queryMsg.Format == exportFormatCSV && offset == 0 {
+		header := exportQueryColumns
+		if !queryMsg.WithValues {
+			header = header[:4]
+		}
+		if err := t.writeCSV(header); err != nil {
+			_ = t.f.Close()
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+func (t *exportQueryTask) visit(meta database.KeyMeta) error {
+	if t.match != nil && !t.match.MatchString(meta.Key) {
+		return nil
+	}
+	row := ExportQueryRow{Key: inventoryKey(meta.Key), Size: meta.Size, ExpiresAt: meta.ExpiresAt, Version: meta.Version}
+	if t.msg.Contains != "" || t.valueMatch != nil || t.msg.WithValues {
+		value, err := t.db.Get(meta.Key)
+		if errors.Is(err, database.ErrKeyNotFound) {
+			// deleted or expired since it was listed
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if t.msg.Contains != "" && !bytes.Contains(value, []byte(t.msg.Contains)) {
+			return nil
+		}
+		if t.valueMatch != nil && !t.valueMatch.Match(value) {
+			return nil
+		}
+		if t.msg.WithValues {
+			switch {
+			case utf8.Valid(value):
+				row.Value, row.Encoding = string(value), encodingRaw
+			case t.msg.BinaryEncoding == encodingHex:
+				row.Value, row.Encoding = hex.EncodeToString(value), encodingHex
+			default:
+				row.Value, row.Encoding = base64.StdEncoding.EncodeToString(value), encodingBase64
+			}
+		}
+	}
+
+	separator := t.msg.Format == exportFormatJSON && t.written > 0
+	t.written++
+	if t.msg.Format == exportFormatCSV {
+		record := []string{
+			row.Key, strconv.FormatInt(row.Size, 10),
+			strconv.FormatUint(row.ExpiresAt, 10), strconv.FormatUint(row.Version, 10),
+		}
+		if t.msg.WithValues {
+			record = append(record, row.Value, row.Encoding)
+		}
+		return t.writeCSV(record)
+	}
+	bt, err := json.Marshal(row)
+	if err != nil {
+		return err
+	}
+	if separator {
+		// the array's rows end their line once the next one comes
+		bt = append([]byte(",\n"), bt...)
+	}
+	if t.msg.Format == exportFormatJSONL {
+		bt = append(bt, '\n')
+	}
+	return t.write(bt)
+}
+
+func (t *exportQueryTask) write(b []byte) error {
+	n, err := t.w.Write(b)
+	t.offset += int64(n)
+	return err
+}
+
+func (t *exportQueryTask) writeCSV(record []string) error {
+	t.csvBuf.Reset()
+	if err := t.csv.Write(record); err != nil {
+		return err
+	}
+	t.csv.Flush()
+	if err := t.csv.Error(); err != nil {
+		return err
+	}
+	return t.write(t.csvBuf.Bytes())
+}
+
+func (t *exportQueryTask) flush() (int64, error) {
+	return t.offset, t.w.Flush()
+}
+
+func (t *exportQueryTask) rows() int64 {
+	return t.written
+}
+
+// close ends the array of a json export unless it's paused, which continues
+// it. A canceled or failed export is left a valid array of the rows so far.
+func (t *exportQueryTask) close(paused bool) error {
+	var err error
+	if !paused && t.msg.Format == exportFormatJSON {
+		err = t.write([]byte("\n]\n"))
+	}
+	if flushErr := t.w.Flush(); err == nil {
+		err = flushErr
+	}
+	if closeErr := t.f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// export writes the keys and values under a prefix to a file in the
+// background, as an export_query job the job messages pause and cancel. It
+// answers the job.
+func (a *App) export(msg AppMessage) AppMessage {
+	if !a.db.IsRunning() {
+		log.Printf("db not running for export operation")
+		return AppMessage{Type: msg.Type, Body: NotRunningResponse}
+	}
+	var exportMsg MessageExport
+	if err := json.Unmarshal([]byte(msg.Body), &exportMsg); err != nil {
+		log.Printf("unmarshaling export message failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+	params, _ := json.Marshal(MessageExportQuery{
+		Path: exportMsg.Path, Prefix: a.scoped(exportMsg.Prefix), Format: exportMsg.Format,
+		WithValues: true, BinaryEncoding: encodingHex,
+	})
+	job, err := a.launchJob(JobExportQuery, params)
+	if err != nil {
+		log.Printf("starting export failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+	bt, _ := json.Marshal(job)
+	return AppMessage{Type: msg.Type, Body: string(bt)}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+	"log"
+	"time"
+)
+
+const (
+	// EventExternalWrites warns that another process writes the directory
+	// of a read-only or copied connection, whose data is getting stale
+	EventExternalWrites = "db:external_writes"
+
+	externalWritesInterval = 15 * time.Second
+)
+
+type RefreshResponse struct {
+	Status string `json:"status"`
+	// Reopened is set when the connection was reopened to read what the
+	// other process wrote. Writable connections see their data already, the
+	// refresh only clears the warning for them.
+	Reopened           bool   `json:"reopened"`
+	PreviousMaxVersion uint64 `json:"previous_max_version"`
+	MaxVersion         uint64 `json:"max_version"`
+}
+
+// watchExternalWrites checks the directory of read-only and copied
+// connections for writes by other processes, a setup badger doesn't support
+// but that's common when browsing a live database. The frontend shows a
+// banner on the first db:external_writes until refresh is sent.
+func (a *App) watchExternalWrites() {
+	defer a.reportCrash(crashSourceWatchExternal)
+	ticker := time.NewTicker(externalWritesInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-a.done:
+			return
+		case <-ticker.C:
+		}
+		if !a.db.IsRunning() {
+			continue
+		}
+		a.mx.Lock()
+		noticed := a.externalWrites != nil
+		a.mx.Unlock()
+		if noticed {
+			continue
+		}
+		writes, err := a.db.ExternalWrites()
+		if err != nil || writes == nil {
+			continue
+		}
+		a.mx.Lock()
+		a.externalWrites = writes
+		a.mx.Unlock()
+		log.Printf("db directory %s written by another process: %d files changed, %d removed",
+			writes.Path, len(writes.Changed), len(writes.Removed))
+		runtime.EventsEmit(a.ctx, EventExternalWrites, writes)
+	}
+}
+
+// refresh reopens a read-only or copied connection so it serves what another
+// process wrote since it was opened, and clears the external writes warning.
+// The frontend reloads its stats and views afterwards. The body is that of
+// reopen, encrypted databases need their key again.
+func (a *App) refresh(msg AppMessage) AppMessage {
+	if !a.db.IsRunning() {
+		return AppMessage{Type: msg.Type, Body: NotRunningResponse}
+	}
+	resp := RefreshResponse{Status: OkStatus, PreviousMaxVersion: a.db.MaxVersion()}
+	if a.db.IsInMemory() || !a.db.IsReadOnly() {
+		a.mx.Lock()
+		a.externalWrites = nil
+		a.mx.Unlock()
+		resp.MaxVersion = resp.PreviousMaxVersion
+		bt, _ := json.Marshal(resp)
+		return AppMessage{Type: msg.Type, Body: string(bt)}
+	}
+
+	log.Printf("closing db to refresh it")
+	a.db.Close()
+	a.emitClosed(ClosedRefresh)
+	reopened := a.reopen(msg)
+	if !a.db.IsRunning() {
+		return reopened
+	}
+	resp.Reopened, resp.MaxVersion = true, a.db.MaxVersion()
+	log.Printf("db refreshed, max version %d to %d", resp.PreviousMaxVersion, resp.MaxVersion)
+	bt, _ := json.Marshal(resp)
+	return AppMessage{Type: msg.Type, Body: string(bt)}
+}
@@ -5,3 +5,9 @@ import {main} from '../models';
 export function Call(arg1:main.AppMessage):Promise<main.AppMessage>;
 
 export function OpenDirectoryDialog():Promise<string>;
+
+export function OpenFileDialog():Promise<string>;
+
+export function SaveExportDialog(arg1:string):Promise<string>;
+
+export function SaveFileDialog():Promise<string>;
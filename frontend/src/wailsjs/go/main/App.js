@@ -9,3 +9,15 @@ export function Call(arg1) {
 export function OpenDirectoryDialog() {
   return window['go']['main']['App']['OpenDirectoryDialog']();
 }
+
+export function OpenFileDialog() {
+  return window['go']['main']['App']['OpenFileDialog']();
+}
+
+export function SaveExportDialog(arg1) {
+  return window['go']['main']['App']['SaveExportDialog'](arg1);
+}
+
+export function SaveFileDialog() {
+  return window['go']['main']['App']['SaveFileDialog']();
+}
@@ -3,6 +3,7 @@ export namespace main {
 	export class AppMessage {
 	    type: string;
 	    body: string;
+	    version?: number;
 	
 	    static createFrom(source: any = {}) {
 	        return new AppMessage(source);
@@ -12,6 +13,7 @@ export namespace main {
 	        if ('string' === typeof source) source = JSON.parse(source);
 	        this.type = source["type"];
 	        this.body = source["body"];
+	        this.version = source["version"];
 	    }
 	}
 
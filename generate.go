@@ -0,0 +1,181 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/filinvadim/badger-gui/database"
+	"log"
+	mrand "math/rand/v2"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+const (
+	maxGenerateCount = 100_000
+	// generateSample is how many generated entries are echoed back
+	generateSample = 5
+)
+
+// placeholder matches {name} and {name:arg} in a generator template.
+var placeholder = regexp.MustCompile(`\{(n|uuid|now|unix|rand)(?::(\d+))?\}`)
+
+type MessageGenerate struct {
+	// Key is the key template. {n} is the counter, {n:6} zero padded to six
+	// digits, {uuid} a random UUID, {now} the RFC 3339 time, {unix} the Unix
+	// time and {rand} or {rand:100} a random number, below 100 in the latter.
+	// Every placeholder is drawn once per entry, so the key and the value
+	// share it.
+	Key string `json:"key"`
+	// Value is the value template, with the same placeholders
+	Value string `json:"value"`
+	Count int    `json:"count"`
+	// Start is the first counter value, 1 by default
+	Start *int `json:"start"`
+	// TTL is a Go duration like "1h", empty never expires
+	TTL string `json:"ttl"`
+	// Overwrite replaces existing keys, they are skipped otherwise
+	Overwrite bool `json:"overwrite"`
+	// DryRun only renders the sample
+	DryRun bool `json:"dry_run"`
+}
+
+type GeneratedEntry struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+type GenerateResponse struct {
+	Written int `json:"written"`
+	// Staged counts the keys added to the changeset while staging is on
+	Staged int `json:"staged"`
+	// Existing counts the keys skipped since they already existed
+	Existing int              `json:"existing"`
+	Sample   []GeneratedEntry `json:"sample"`
+}
+
+// generate fabricates keys from a template, for filling a scratch database
+// with fixtures.
+func (a *App) generate(msg AppMessage) AppMessage {
+	if !a.db.IsRunning() {
+		log.Printf("db not running for generate operation")
+		return AppMessage{Type: msg.Type, Body: NotRunningResponse}
+	}
+	var genMsg MessageGenerate
+	if err := json.Unmarshal([]byte(msg.Body), &genMsg); err != nil {
+		log.Printf("unmarshaling generate message failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+	if genMsg.Key == "" {
+		return AppMessage{Type: msg.Type, Body: "key template is required"}
+	}
+	if genMsg.Count <= 0 || genMsg.Count > maxGenerateCount {
+		return AppMessage{Type: msg.Type, Body: fmt.Sprintf("count must be between 1 and %d", maxGenerateCount)}
+	}
+	if genMsg.Count > 1 && !placeholder.MatchString(genMsg.Key) {
+		return AppMessage{Type: msg.Type, Body: "key template has no placeholder, every entry would get the same key"}
+	}
+	var ttl time.Duration
+	if genMsg.TTL != "" {
+		var err error
+		if ttl, err = time.ParseDuration(genMsg.TTL); err != nil {
+			log.Printf("parsing ttl failure: %v", err)
+			return AppMessage{Type: msg.Type, Body: err.Error()}
+		}
+	}
+	if genMsg.Overwrite && a.isWriteProtected(TypeDelete) {
+		log.Printf("overwriting generated keys rejected: write password required")
+		return AppMessage{Type: msg.Type, Body: WriteProtectedResponse}
+	}
+	start := 1
+	if genMsg.Start != nil {
+		start = *genMsg.Start
+	}
+
+	entries := make([]database.Change, 0, genMsg.Count)
+	seen := make(map[string]struct{}, genMsg.Count)
+	now := time.Now()
+	schemas := a.schemas()
+	for i := 0; i < genMsg.Count; i++ {
+		values := make(map[string]string)
+		key := renderTemplate(genMsg.Key, values, start+i, now)
+		if _, ok := seen[key]; ok {
+			return AppMessage{Type: msg.Type, Body: fmt.Sprintf("key template renders %q twice", key)}
+		}
+		seen[key] = struct{}{}
+		value := []byte(renderTemplate(genMsg.Value, values, start+i, now))
+		if _, violations := schemas.validate(key, value); len(violations) > 0 {
+			return AppMessage{Type: msg.Type, Body: fmt.Sprintf("key %s doesn't match its schema: %v", key, violationsError(violations))}
+		}
+		entries = append(entries, database.Change{Key: key, Value: value, TTL: ttl})
+	}
+
+	resp := GenerateResponse{Sample: make([]GeneratedEntry, 0, generateSample)}
+	for _, e := range entries[:min(len(entries), generateSample)] {
+		resp.Sample = append(resp.Sample, GeneratedEntry{Key: e.Key, Value: string(e.Value)})
+	}
+	if !genMsg.DryRun {
+		existing, staged, err := a.stageMany(entries, genMsg.Overwrite)
+		if !staged {
+			existing, err = a.db.SetMany(entries, genMsg.Overwrite)
+		}
+		if err != nil {
+			log.Printf("writing generated keys failure: %v", err)
+			return AppMessage{Type: msg.Type, Body: err.Error()}
+		}
+		resp.Existing = len(existing)
+		if staged {
+			resp.Staged = len(entries) - len(existing)
+		} else {
+			resp.Written = len(entries) - len(existing)
+		}
+	}
+
+	log.Printf("generated %d keys, %d written, %d staged", len(entries), resp.Written, resp.Staged)
+	bt, _ := json.Marshal(resp)
+	return AppMessage{Type: msg.Type, Body: string(bt)}
+}
+
+// renderTemplate fills in the placeholders of template for the entry with
+// counter n. values holds the placeholders drawn so far for the entry.
+func renderTemplate(template string, values map[string]string, n int, now time.Time) string {
+	return placeholder.ReplaceAllStringFunc(template, func(p string) string {
+		if v, ok := values[p]; ok {
+			return v
+		}
+		m := placeholder.FindStringSubmatch(p)
+		v := placeholderValue(m[1], m[2], n, now)
+		values[p] = v
+		return v
+	})
+}
+
+// placeholderValue renders one placeholder for the entry with counter n.
+func placeholderValue(name, arg string, n int, now time.Time) string {
+	switch name {
+	case "n":
+		if width, err := strconv.Atoi(arg); err == nil {
+			return fmt.Sprintf("%0*d", width, n)
+		}
+		return strconv.Itoa(n)
+	case "uuid":
+		var u [16]byte
+		_, _ = rand.Read(u[:])
+		u[6] = u[6]&0x0f | 0x40
+		u[8] = u[8]&0x3f | 0x80
+		s := hex.EncodeToString(u[:])
+		return s[:8] + "-" + s[8:12] + "-" + s[12:16] + "-" + s[16:20] + "-" + s[20:]
+	case "now":
+		return now.Format(time.RFC3339)
+	case "unix":
+		return strconv.FormatInt(now.Unix(), 10)
+	case "rand":
+		if limit, err := strconv.ParseInt(arg, 10, 64); err == nil && limit > 0 {
+			return strconv.FormatInt(mrand.Int64N(limit), 10)
+		}
+		return strconv.FormatInt(mrand.Int64(), 10)
+	}
+	return ""
+}
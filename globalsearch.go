@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/filinvadim/badger-gui/database"
+	"log"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+const defaultGlobalSearchLimit = 100
+
+type MessageGlobalSearch struct {
+	// Paths are the other database directories to search besides the open
+	// one, each opened read-only for the search only
+	Paths  []string `json:"paths"`
+	Prefix string   `json:"prefix"`
+	// Contains keeps the keys whose value holds this text
+	Contains string `json:"contains"`
+	// Limit caps the hits per database, 100 by default
+	Limit int `json:"limit"`
+}
+
+type GlobalSearchHit struct {
+	// Path is the database the key was found in, empty for an in-memory
+	// connection
+	Path string `json:"path"`
+	Key  string `json:"key"`
+}
+
+type GlobalSearchFailure struct {
+	Path  string `json:"path"`
+	Error string `json:"error"`
+	// Cause is the open diagnostic cause when the database couldn't be opened
+	Cause string `json:"cause,omitempty"`
+}
+
+type GlobalSearchResponse struct {
+	Hits     []GlobalSearchHit     `json:"hits"`
+	Failures []GlobalSearchFailure `json:"failures"`
+	// Truncated lists the databases with more hits than the limit
+	Truncated []string `json:"truncated"`
+}
+
+// globalSearch runs one key or value query against several databases at
+// once, for users comparing the data dirs of several nodes, and merges the
+// hits tagged by database.
+func (a *App) globalSearch(msg AppMessage) AppMessage {
+	var searchMsg MessageGlobalSearch
+	if err := json.Unmarshal([]byte(msg.Body), &searchMsg); err != nil {
+		log.Printf("unmarshaling global search message failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+	if searchMsg.Limit <= 0 {
+		searchMsg.Limit = defaultGlobalSearchLimit
+	}
+
+	openPath := a.openPath()
+	paths := make([]string, 0, len(searchMsg.Paths))
+	seen := make(map[string]struct{})
+	for _, path := range searchMsg.Paths {
+		path = filepath.Clean(path)
+		if _, ok := seen[path]; ok || (openPath != "" && path == filepath.Clean(openPath)) {
+			continue
+		}
+		seen[path] = struct{}{}
+		paths = append(paths, path)
+	}
+
+	var (
+		mx   sync.Mutex
+		wg   sync.WaitGroup
+		resp = GlobalSearchResponse{
+			Hits: []GlobalSearchHit{}, Failures: []GlobalSearchFailure{}, Truncated: []string{},
+		}
+	)
+	collect := func(path string, keys []string, truncated bool, failure *GlobalSearchFailure) {
+		mx.Lock()
+		defer mx.Unlock()
+		if failure != nil {
+			resp.Failures = append(resp.Failures, *failure)
+			return
+		}
+		for _, key := range keys {
+			resp.Hits = append(resp.Hits, GlobalSearchHit{Path: path, Key: key})
+		}
+		if truncated {
+			resp.Truncated = append(resp.Truncated, path)
+		}
+	}
+
+	if a.db.IsRunning() {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			keys, truncated, err := searchStorer(a.db, a.scoped(searchMsg.Prefix), searchMsg.Contains, searchMsg.Limit)
+			if err != nil {
+				collect(openPath, nil, false, &GlobalSearchFailure{Path: openPath, Error: err.Error()})
+				return
+			}
+			collect(openPath, keys, truncated, nil)
+		}()
+	}
+	settings := a.settings.Get()
+	for _, path := range paths {
+		profile, _ := settings.Profile(path)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			db, failure := openForSearch(path, profile.ValueDir)
+			if failure != nil {
+				collect(path, nil, false, failure)
+				return
+			}
+			defer db.Close()
+			keys, truncated, err := searchStorer(db, searchMsg.Prefix, searchMsg.Contains, searchMsg.Limit)
+			if err != nil {
+				collect(path, nil, false, &GlobalSearchFailure{Path: path, Error: err.Error()})
+				return
+			}
+			collect(path, keys, truncated, nil)
+		}()
+	}
+	wg.Wait()
+
+	sort.Slice(resp.Hits, func(i, j int) bool {
+		if resp.Hits[i].Key != resp.Hits[j].Key {
+			return resp.Hits[i].Key < resp.Hits[j].Key
+		}
+		return resp.Hits[i].Path < resp.Hits[j].Path
+	})
+	sort.Slice(resp.Failures, func(i, j int) bool { return resp.Failures[i].Path < resp.Failures[j].Path })
+	sort.Strings(resp.Truncated)
+	log.Printf("global search found %d keys, %d databases failed", len(resp.Hits), len(resp.Failures))
+	bt, _ := json.Marshal(resp)
+	return AppMessage{Type: msg.Type, Body: string(bt)}
+}
+
+// openForSearch opens a database read-only, from a copy when another process
+// holds its lock. valueDir is the value log directory of its profile.
+func openForSearch(path, valueDir string) (*database.DB, *GlobalSearchFailure) {
+	db, err := database.New(nil)
+	if err != nil {
+		return nil, &GlobalSearchFailure{Path: path, Error: err.Error()}
+	}
+	opts := database.OpenOptions{Path: path, ValueDir: valueDir, ReadOnly: true}
+	err = db.Open(opts)
+	if err != nil && database.DiagnoseOpen(opts, err).Cause == database.CauseLocked {
+		opts.CopyFirst = true
+		err = db.Open(opts)
+	}
+	if err != nil {
+		return nil, &GlobalSearchFailure{Path: path, Error: err.Error(), Cause: database.DiagnoseOpen(opts, err).Cause}
+	}
+	return db, nil
+}
+
+// searchStorer returns up to limit keys under prefix, only those whose value
+// holds contains when it's set, and whether there were more.
+func searchStorer(db Storer, prefix, contains string, limit int) (keys []string, truncated bool, err error) {
+	if contains == "" {
+		n := limit + 1
+		keys, err = db.Search(prefix, &n, 0)
+		if len(keys) > limit {
+			keys, truncated = keys[:limit], true
+		}
+		return keys, truncated, err
+	}
+	needle := []byte(contains)
+	err = db.Scan(prefix, func(key string, value []byte) error {
+		if !bytes.Contains(value, needle) {
+			return nil
+		}
+		if len(keys) == limit {
+			truncated = true
+			return errPageFull
+		}
+		keys = append(keys, key)
+		return nil
+	})
+	if errors.Is(err, errPageFull) {
+		err = nil
+	}
+	return keys, truncated, err
+}
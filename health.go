@@ -0,0 +1,47 @@
+package main
+
+import (
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+	"log"
+	"time"
+)
+
+const healthCheckInterval = 10 * time.Second
+
+// UnhealthyEvent tells the frontend to offer a reopen with the last
+// parameters.
+type UnhealthyEvent struct {
+	Path  string `json:"path"`
+	Error string `json:"error"`
+}
+
+func (a *App) onUnhealthy(err error) {
+	event := UnhealthyEvent{Error: err.Error()}
+	a.mx.Lock()
+	if a.lastOpen != nil {
+		event.Path = a.lastOpen.Path
+	}
+	a.mx.Unlock()
+	log.Printf("db unhealthy: %v", err)
+	runtime.EventsEmit(a.ctx, EventUnhealthy, event)
+	a.emitError("health", event.Path, err)
+}
+
+// watchHealth probes the open connection so a badger that died in the
+// background is noticed even while the user isn't doing anything.
+func (a *App) watchHealth() {
+	defer a.reportCrash(crashSourceWatchHealth)
+	ticker := time.NewTicker(healthCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-a.done:
+			return
+		case <-ticker.C:
+		}
+		if a.db.IsRunning() {
+			_ = a.db.Health()
+		}
+	}
+}
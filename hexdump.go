@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+)
+
+const (
+	hexDumpWidth = 16
+	// defaultHexDumpLength is the bytes a page holds without a length,
+	// maxHexDumpLength the most it can hold
+	defaultHexDumpLength = 4 << 10
+	maxHexDumpLength     = 64 << 10
+)
+
+type MessageHexDump struct {
+	Key string `json:"key"`
+	// ID is the row ID of the key, for binary keys
+	ID string `json:"id"`
+	// Offset is where the page starts, rounded down to a line
+	Offset int64 `json:"offset"`
+	// Length is the bytes of the page, 4 KiB by default and 64 KiB at most
+	Length int `json:"length"`
+}
+
+type HexDumpResponse struct {
+	Key string `json:"key"`
+	// Size is the size of the whole value
+	Size   int64 `json:"size"`
+	Offset int64 `json:"offset"`
+	Length int   `json:"length"`
+	// Lines are the page in canonical hex dump form: the offset, 16 bytes in
+	// hex and the printable ones in an ASCII gutter
+	Lines []string `json:"lines"`
+	// Next is the offset of the next page, 0 after the last one
+	Next int64 `json:"next"`
+}
+
+// hexDump renders a page of a value as a hex dump, so huge binary values are
+// browsed without sending them whole or formatting bytes in the frontend.
+func (a *App) hexDump(msg AppMessage) AppMessage {
+	if !a.db.IsRunning() {
+		return AppMessage{Type: msg.Type, Body: NotRunningResponse}
+	}
+	var dumpMsg MessageHexDump
+	if err := json.Unmarshal([]byte(msg.Body), &dumpMsg); err != nil {
+		log.Printf("unmarshaling hex dump message failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+	if dumpMsg.ID != "" {
+		keys, err := keysOf([]string{dumpMsg.ID})
+		if err != nil {
+			return AppMessage{Type: msg.Type, Body: err.Error()}
+		}
+		dumpMsg.Key = keys[0]
+	}
+	length := dumpMsg.Length
+	if length <= 0 {
+		length = defaultHexDumpLength
+	}
+	length = min(length, maxHexDumpLength)
+	offset := max(dumpMsg.Offset, 0)
+	offset -= offset % hexDumpWidth
+
+	resp := HexDumpResponse{Key: dumpMsg.Key, Offset: offset}
+	err := a.db.ViewValue(a.virtualKey(dumpMsg.Key), func(value []byte, _ uint64) error {
+		resp.Size = int64(len(value))
+		if offset > resp.Size {
+			return fmt.Errorf("offset %d is past the end of the %d bytes value", offset, resp.Size)
+		}
+		page := value[offset:min(offset+int64(length), resp.Size)]
+		resp.Length = len(page)
+		resp.Lines = hexDumpLines(page, offset, resp.Size)
+		if end := offset + int64(len(page)); end < resp.Size {
+			resp.Next = end
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("hex dump failure %s: %v", logKey(dumpMsg.Key), err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+	bt, _ := json.Marshal(resp)
+	return AppMessage{Type: msg.Type, Body: string(bt)}
+}
+
+// hexDumpLines formats data found at offset of a value of size bytes like
+// hexdump -C, the offsets wide enough for the whole value.
+func hexDumpLines(data []byte, offset, size int64) []string {
+	digits := max(8, len(fmt.Sprintf("%x", size)))
+	lines := make([]string, 0, (len(data)+hexDumpWidth-1)/hexDumpWidth)
+	var b strings.Builder
+	for start := 0; start < len(data); start += hexDumpWidth {
+		line := data[start:min(start+hexDumpWidth, len(data))]
+		b.Reset()
+		fmt.Fprintf(&b, "%0*x  ", digits, offset+int64(start))
+		for i := 0; i < hexDumpWidth; i++ {
+			if i == hexDumpWidth/2 {
+				b.WriteByte(' ')
+			}
+			if i < len(line) {
+				fmt.Fprintf(&b, "%02x ", line[i])
+			} else {
+				b.WriteString("   ")
+			}
+		}
+		b.WriteString(" |")
+		for _, c := range line {
+			if c < 0x20 || c > 0x7e {
+				c = '.'
+			}
+			b.WriteByte(c)
+		}
+		b.WriteByte('|')
+		lines = append(lines, b.String())
+	}
+	return lines
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/filinvadim/badger-gui/database"
+	"log"
+	"math"
+	"math/bits"
+)
+
+type MessageHistogram struct {
+	Prefix string `json:"prefix"`
+}
+
+// Bucket counts sizes in [Min, Max).
+type Bucket struct {
+	Min   int64 `json:"min"`
+	Max   int64 `json:"max"`
+	Count int64 `json:"count"`
+}
+
+// Histogram mirrors badger's PrintHistogram as data, with power of two
+// buckets.
+type Histogram struct {
+	Count   int64    `json:"count"`
+	Min     int64    `json:"min"`
+	Max     int64    `json:"max"`
+	Mean    float64  `json:"mean"`
+	Sum     int64    `json:"sum"`
+	Buckets []Bucket `json:"buckets"`
+}
+
+type HistogramResponse struct {
+	Prefix     string    `json:"prefix"`
+	KeySizes   Histogram `json:"key_sizes"`
+	ValueSizes Histogram `json:"value_sizes"`
+}
+
+func newHistogram() Histogram {
+	return Histogram{Min: math.MaxInt64}
+}
+
+func (h *Histogram) add(size int64) {
+	h.Count++
+	h.Sum += size
+	h.Min = min(h.Min, size)
+	h.Max = max(h.Max, size)
+
+	// bucket 0 holds zero sizes, bucket i holds [2^(i-1), 2^i)
+	i := 0
+	if size > 0 {
+		i = bits.Len64(uint64(size))
+	}
+	for len(h.Buckets) <= i {
+		n := len(h.Buckets)
+		b := Bucket{Max: 1}
+		if n > 0 {
+			b = Bucket{Min: 1 << (n - 1), Max: 1 << n}
+		}
+		h.Buckets = append(h.Buckets, b)
+	}
+	h.Buckets[i].Count++
+}
+
+// finish drops the empty buckets and computes the mean.
+func (h *Histogram) finish() {
+	if h.Count == 0 {
+		h.Min = 0
+		return
+	}
+	h.Mean = float64(h.Sum) / float64(h.Count)
+	buckets := h.Buckets[:0]
+	for _, b := range h.Buckets {
+		if b.Count > 0 {
+			buckets = append(buckets, b)
+		}
+	}
+	h.Buckets = buckets
+}
+
+func (a *App) histogram(msg AppMessage) AppMessage {
+	if !a.db.IsRunning() {
+		log.Printf("db not running for histogram operation")
+		return AppMessage{Type: msg.Type, Body: NotRunningResponse}
+	}
+	var histMsg MessageHistogram
+	if msg.Body != "" {
+		if err := json.Unmarshal([]byte(msg.Body), &histMsg); err != nil {
+			log.Printf("unmarshaling histogram message failure: %v", err)
+			return AppMessage{Type: msg.Type, Body: err.Error()}
+		}
+	}
+
+	histMsg.Prefix = a.scoped(histMsg.Prefix)
+	resp := HistogramResponse{Prefix: a.shownKey(histMsg.Prefix), KeySizes: newHistogram(), ValueSizes: newHistogram()}
+	err := a.db.WalkKeys(histMsg.Prefix, func(meta database.KeyMeta) error {
+		resp.KeySizes.add(int64(len(meta.Key)))
+		resp.ValueSizes.add(meta.Size)
+		return nil
+	})
+	if err != nil {
+		log.Printf("building histogram failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+	resp.KeySizes.finish()
+	resp.ValueSizes.finish()
+
+	log.Printf("histogram built over %d keys", resp.KeySizes.Count)
+	bt, _ := json.Marshal(resp)
+	return AppMessage{Type: msg.Type, Body: string(bt)}
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/filinvadim/badger-gui/database"
+	"log"
+	"sort"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// historyPerKey caps the previous values kept per key, oldest dropped
+	// first
+	historyPerKey = 20
+	// historyTrackedKeys caps the keys with a history, the least recently
+	// edited are forgotten first
+	historyTrackedKeys = 500
+	// historyMaxValue is the largest value kept, bigger ones leave no undo
+	historyMaxValue = 1 << 20
+	// historyMaxBytes caps the values kept across all keys
+	historyMaxBytes = 64 << 20
+)
+
+// HistoryEntry is a value a key held before an edit of the session.
+type HistoryEntry struct {
+	// ID identifies the entry for revert, increasing across the session
+	ID   uint64    `json:"id"`
+	Time time.Time `json:"time"`
+	// Op is the edit that replaced the value: set, delete or revert
+	Op messageType `json:"op"`
+	// Absent is set when the key didn't exist before the edit
+	Absent bool `json:"absent,omitempty"`
+	// Value is the value as is when it's valid UTF-8, Encoding raw, and
+	// base64 encoded otherwise
+	Value    string `json:"value,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+	Size     int    `json:"size"`
+	value    []byte
+}
+
+type MessageValueHistory struct {
+	Key string `json:"key"`
+}
+
+type ValueHistoryResponse struct {
+	Key string `json:"key"`
+	// Entries are newest first
+	Entries []HistoryEntry `json:"entries"`
+}
+
+type MessageRevert struct {
+	Key string `json:"key"`
+	// Entry is the ID of the history entry to bring back, the newest one
+	// when 0
+	Entry uint64 `json:"entry"`
+	// ExpectedVersion rejects the revert when the key changed since the
+	// editor loaded it, as for set
+	ExpectedVersion uint64 `json:"expected_version"`
+}
+
+// valueHistory keeps the previous values of the keys edited in the session,
+// a local undo for databases keeping a single version. It lives in memory
+// only and is bounded by historyPerKey, historyTrackedKeys and
+// historyMaxBytes.
+type valueHistory struct {
+	mx     *sync.Mutex
+	keys   map[string][]HistoryEntry
+	edited map[string]time.Time
+	size   int
+	nextID uint64
+}
+
+func newValueHistory() *valueHistory {
+	return &valueHistory{
+		mx: new(sync.Mutex), keys: make(map[string][]HistoryEntry), edited: make(map[string]time.Time),
+	}
+}
+
+// valueSnapshot is the value of a key read before writing it.
+type valueSnapshot struct {
+	value  []byte
+	absent bool
+	// skip is set when the value can't be kept, too large or unreadable
+	skip bool
+}
+
+// snapshot reads the value key holds before an edit.
+func snapshot(db Storer, key string) valueSnapshot {
+	meta, err := db.Meta(key)
+	if errors.Is(err, database.ErrKeyNotFound) {
+		return valueSnapshot{absent: true}
+	}
+	if err != nil || meta.Size > historyMaxValue {
+		return valueSnapshot{skip: true}
+	}
+	value, err := db.Get(key)
+	if errors.Is(err, database.ErrKeyNotFound) {
+		return valueSnapshot{absent: true}
+	}
+	if err != nil {
+		return valueSnapshot{skip: true}
+	}
+	return valueSnapshot{value: value}
+}
+
+// push records the value key held before an edit made by op.
+func (h *valueHistory) push(op messageType, key string, s valueSnapshot) {
+	if s.skip {
+		return
+	}
+	h.mx.Lock()
+	defer h.mx.Unlock()
+	if _, ok := h.keys[key]; !ok && len(h.keys) >= historyTrackedKeys {
+		h.evictKey()
+	}
+	h.nextID++
+	now := time.Now()
+	h.keys[key] = append(h.keys[key], HistoryEntry{
+		ID: h.nextID, Time: now, Op: op, Absent: s.absent, Size: len(s.value), value: s.value,
+	})
+	h.edited[key] = now
+	h.size += len(s.value)
+	if len(h.keys[key]) > historyPerKey {
+		h.size -= h.keys[key][0].Size
+		h.keys[key] = h.keys[key][1:]
+	}
+	for h.size > historyMaxBytes && len(h.keys) > 0 {
+		h.evictKey()
+	}
+}
+
+// evictKey forgets the history of the key edited least recently.
+func (h *valueHistory) evictKey() {
+	var (
+		oldest string
+		at     time.Time
+	)
+	for key, edited := range h.edited {
+		if oldest == "" || edited.Before(at) {
+			oldest, at = key, edited
+		}
+	}
+	for _, entry := range h.keys[oldest] {
+		h.size -= entry.Size
+	}
+	delete(h.keys, oldest)
+	delete(h.edited, oldest)
+}
+
+// entries returns the history of key with its values encoded, newest first.
+func (h *valueHistory) entries(key string) []HistoryEntry {
+	h.mx.Lock()
+	defer h.mx.Unlock()
+	entries := make([]HistoryEntry, len(h.keys[key]))
+	copy(entries, h.keys[key])
+	for i, entry := range entries {
+		switch {
+		case entry.Absent:
+		case utf8.Valid(entry.value):
+			entries[i].Value, entries[i].Encoding = string(entry.value), encodingRaw
+		default:
+			entries[i].Value, entries[i].Encoding = base64.StdEncoding.EncodeToString(entry.value), encodingBase64
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].ID > entries[j].ID })
+	return entries
+}
+
+// entry returns the entry id of key, the newest one when id is 0.
+func (h *valueHistory) entry(key string, id uint64) (HistoryEntry, bool) {
+	h.mx.Lock()
+	defer h.mx.Unlock()
+	entries := h.keys[key]
+	if len(entries) == 0 {
+		return HistoryEntry{}, false
+	}
+	if id == 0 {
+		return entries[len(entries)-1], true
+	}
+	for _, entry := range entries {
+		if entry.ID == id {
+			return entry, true
+		}
+	}
+	return HistoryEntry{}, false
+}
+
+func (h *valueHistory) reset() {
+	h.mx.Lock()
+	defer h.mx.Unlock()
+	h.keys = make(map[string][]HistoryEntry)
+	h.edited = make(map[string]time.Time)
+	h.size = 0
+}
+
+// valueHistoryOf lists the previous values of a key edited in the session.
+func (a *App) valueHistoryOf(msg AppMessage) AppMessage {
+	var historyMsg MessageValueHistory
+	if err := json.Unmarshal([]byte(msg.Body), &historyMsg); err != nil {
+		log.Printf("unmarshaling value history message failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+	key := a.virtualKey(historyMsg.Key)
+	bt, _ := json.Marshal(ValueHistoryResponse{Key: historyMsg.Key, Entries: a.history.entries(key)})
+	return AppMessage{Type: msg.Type, Body: string(bt)}
+}
+
+// revert writes a previous value of a key back, or deletes the key when it
+// didn't exist then. The value replaced goes to the history too, so a revert
+// can be reverted. Staging and the write hooks apply as for set and delete.
+func (a *App) revert(msg AppMessage) AppMessage {
+	if !a.db.IsRunning() {
+		return AppMessage{Type: msg.Type, Body: NotRunningResponse}
+	}
+	var revertMsg MessageRevert
+	if err := json.Unmarshal([]byte(msg.Body), &revertMsg); err != nil {
+		log.Printf("unmarshaling revert message failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+	shown := revertMsg.Key
+	revertMsg.Key = a.virtualKey(revertMsg.Key)
+	entry, ok := a.history.entry(revertMsg.Key, revertMsg.Entry)
+	if !ok {
+		return AppMessage{Type: msg.Type, Body: fmt.Sprintf("no history entry %d for key %s", revertMsg.Entry, shown)}
+	}
+	// reverting to an absent entry deletes the key
+	if entry.Absent && a.isWriteProtected(TypeDelete) {
+		log.Printf("revert of key %s rejected: write password required", logKey(revertMsg.Key))
+		return AppMessage{Type: msg.Type, Body: WriteProtectedResponse}
+	}
+	var value []byte
+	if !entry.Absent {
+		value = append([]byte{}, entry.value...)
+	}
+	if staged, ok := a.stage(msg.Type, revertMsg.Key, value, revertMsg.ExpectedVersion); ok {
+		return staged
+	}
+
+	a.ownWrite(revertMsg.Key, value)
+	before := snapshot(a.db, revertMsg.Key)
+	version, err := a.writeKey(revertMsg.Key, value, revertMsg.ExpectedVersion)
+	if err == nil {
+		log.Printf("key %s reverted to history entry %d", logKey(revertMsg.Key), entry.ID)
+		a.history.push(msg.Type, revertMsg.Key, before)
+	}
+	return a.checkedWriteResponse(msg.Type, revertMsg.Key, version, nil, err)
+}
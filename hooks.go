@@ -0,0 +1,262 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/filinvadim/badger-gui/config"
+	"github.com/filinvadim/badger-gui/database"
+	"log"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// hookPlaceholder matches the placeholders of a hook template: {key} and
+// {value} are the written entry, {field:a.b} a field of its JSON value, {1}
+// the first group of the hook's Match, and the generator's placeholders.
+var hookPlaceholder = regexp.MustCompile(`\{(key|value|field|\d|n|uuid|now|unix|rand)(?::([^{}]+))?\}`)
+
+type MessageHooks struct {
+	// Hooks replace the hooks of the open database, without them the hooks
+	// are only reported
+	Hooks []config.WriteHook `json:"hooks"`
+}
+
+type HooksResponse struct {
+	Hooks []config.WriteHook `json:"hooks"`
+}
+
+// setHooks reports or replaces the write hooks of the open database.
+func (a *App) setHooks(msg AppMessage) AppMessage {
+	path := a.openPath()
+	if path == "" {
+		log.Printf("setting hooks failure: %s", NoProfileResponse)
+		return AppMessage{Type: msg.Type, Body: NoProfileResponse}
+	}
+	var hooksMsg MessageHooks
+	if msg.Body != "" {
+		if err := json.Unmarshal([]byte(msg.Body), &hooksMsg); err != nil {
+			log.Printf("unmarshaling hooks message failure: %v", err)
+			return AppMessage{Type: msg.Type, Body: err.Error()}
+		}
+	}
+	if hooksMsg.Hooks != nil {
+		if err := validateHooks(hooksMsg.Hooks); err != nil {
+			log.Printf("validating hooks failure: %v", err)
+			return AppMessage{Type: msg.Type, Body: err.Error()}
+		}
+		if err := a.settings.SetHooks(path, hooksMsg.Hooks); err != nil {
+			log.Printf("saving hooks failure: %v", err)
+			return AppMessage{Type: msg.Type, Body: err.Error()}
+		}
+		log.Printf("%d write hooks saved", len(hooksMsg.Hooks))
+	}
+	hooks := []config.WriteHook{}
+	if profile, ok := a.settings.Get().Profile(path); ok && profile.Hooks != nil {
+		hooks = profile.Hooks
+	}
+	bt, _ := json.Marshal(HooksResponse{Hooks: hooks})
+	return AppMessage{Type: msg.Type, Body: string(bt)}
+}
+
+func validateHooks(hooks []config.WriteHook) error {
+	names := make(map[string]struct{}, len(hooks))
+	for i, hook := range hooks {
+		switch {
+		case hook.Name == "":
+			return fmt.Errorf("hook %d has no name", i+1)
+		case hook.Match == "":
+			return fmt.Errorf("hook %s has no match", hook.Name)
+		case hook.Key == "":
+			return fmt.Errorf("hook %s has no key template", hook.Name)
+		}
+		if _, err := regexp.Compile(hook.Match); err != nil {
+			return fmt.Errorf("hook %s: %w", hook.Name, err)
+		}
+		if _, ok := names[hook.Name]; ok {
+			return fmt.Errorf("hook %s is defined twice", hook.Name)
+		}
+		names[hook.Name] = struct{}{}
+	}
+	return nil
+}
+
+type writeHook struct {
+	config.WriteHook
+	match *regexp.Regexp
+}
+
+type writeHooks []writeHook
+
+// writeHooks returns the hooks of the open database matching key.
+func (a *App) writeHooks(key string) writeHooks {
+	path := a.openPath()
+	if path == "" {
+		return nil
+	}
+	profile, _ := a.settings.Get().Profile(path)
+	var hooks writeHooks
+	for _, hook := range profile.Hooks {
+		match, err := regexp.Compile(hook.Match)
+		if err != nil {
+			log.Printf("compiling hook %s failure: %v", hook.Name, err)
+			continue
+		}
+		if match.MatchString(key) {
+			hooks = append(hooks, writeHook{WriteHook: hook, match: match})
+		}
+	}
+	return hooks
+}
+
+// changes returns the writes of the keys derived from key set to value, or
+// deleted when value is nil. prev is the value the key held before, needed
+// when a hook has to delete the derived key of that value. The derived
+// writes don't run hooks themselves.
+func (h writeHooks) changes(key string, prev, value []byte) []database.Change {
+	var (
+		deletes []database.Change
+		sets    []database.Change
+		now     = time.Now()
+	)
+	for _, hook := range h {
+		groups := hook.match.FindStringSubmatch(key)
+		var derived string
+		if value != nil {
+			values := make(map[string]string)
+			k, okKey := renderHook(hook.Key, key, value, groups, values, now)
+			v, okValue := renderHook(hook.Value, key, value, groups, values, now)
+			if okKey && okValue && k != "" && k != key {
+				derived = k
+				sets = append(sets, database.Change{Key: k, Value: []byte(v)})
+			} else {
+				log.Printf("hook %s skipped for key %s", hook.Name, logKey(key))
+			}
+		}
+		if hook.Cascade && prev != nil {
+			old, ok := renderHook(hook.Key, key, prev, groups, make(map[string]string), now)
+			if ok && old != "" && old != key && old != derived {
+				deletes = append(deletes, database.Change{Key: old, Delete: true})
+			}
+		}
+	}
+	return append(deletes, sets...)
+}
+
+// applyHooks writes the keys derived from key in the transaction writing
+// key, so they commit together.
+func (h writeHooks) applyHooks(txn *database.Txn, key string, prev, value []byte) error {
+	if len(h) == 0 {
+		return nil
+	}
+	changes := h.changes(key, prev, value)
+	for _, c := range changes {
+		if err := txn.Apply(c); err != nil {
+			return fmt.Errorf("updating derived keys of %s: %w", key, err)
+		}
+	}
+	log.Printf("hooks of key %s wrote %d derived keys", logKey(key), len(changes))
+	return nil
+}
+
+// writeKey sets key, or deletes it when value is nil, checking its version
+// against a non-zero expected as SetChecked does. Keys with write hooks are
+// written in one transaction with their derived keys. The committed version
+// is returned for checked writes, the current one with ErrVersionChanged.
+func (a *App) writeKey(key string, value []byte, expected uint64) (version uint64, err error) {
+	hooks := a.writeHooks(key)
+	if len(hooks) == 0 {
+		switch {
+		case expected != 0 && value == nil:
+			return a.db.DeleteChecked(key, expected)
+		case expected != 0:
+			return a.db.SetChecked(key, value, expected)
+		case value == nil:
+			return 0, a.db.Delete(key)
+		default:
+			return 0, a.db.Set(key, value)
+		}
+	}
+
+	var current uint64
+	version, err = a.db.UpdateKey(key, func(txn *database.Txn) error {
+		prev, v, err := txn.Get(key)
+		if errors.Is(err, database.ErrKeyNotFound) {
+			prev, v, err = nil, 0, nil
+		}
+		if err != nil {
+			return err
+		}
+		current = v
+		if expected != 0 && v != expected {
+			return database.ErrVersionChanged
+		}
+		if value == nil {
+			err = txn.Delete(key)
+		} else {
+			err = txn.Set(key, value, 0)
+		}
+		if err != nil {
+			return err
+		}
+		return hooks.applyHooks(txn, key, prev, value)
+	})
+	if errors.Is(err, database.ErrVersionChanged) {
+		return current, err
+	}
+	return version, err
+}
+
+// renderHook fills in the placeholders of a hook template for the entry
+// written. It fails when a field or group the template uses is missing.
+func renderHook(template, key string, value []byte, groups []string, values map[string]string, now time.Time) (string, bool) {
+	ok := true
+	var (
+		doc    any
+		parsed bool
+	)
+	out := hookPlaceholder.ReplaceAllStringFunc(template, func(p string) string {
+		m := hookPlaceholder.FindStringSubmatch(p)
+		switch name, arg := m[1], m[2]; name {
+		case "key":
+			return key
+		case "value":
+			return string(value)
+		case "field":
+			if !parsed {
+				parsed = true
+				dec := json.NewDecoder(bytes.NewReader(value))
+				dec.UseNumber()
+				if err := dec.Decode(&doc); err != nil {
+					doc = nil
+				}
+			}
+			v, found := jsonPath(doc, arg)
+			if !found || v == nil {
+				ok = false
+				return ""
+			}
+			if s, isString := v.(string); isString {
+				return s
+			}
+			return compactJSON(v)
+		case "n", "uuid", "now", "unix", "rand":
+			if v, drawn := values[p]; drawn {
+				return v
+			}
+			v := placeholderValue(name, arg, 1, now)
+			values[p] = v
+			return v
+		default:
+			i, _ := strconv.Atoi(name)
+			if i >= len(groups) {
+				ok = false
+				return ""
+			}
+			return groups[i]
+		}
+	})
+	return out, ok
+}
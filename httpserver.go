@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/filinvadim/badger-gui/database"
+	"github.com/gorilla/websocket"
+	"log"
+	"net"
+	"net/http"
+	"time"
+)
+
+const (
+	httpShutdownTimeout = 5 * time.Second
+	watchWriteTimeout   = 10 * time.Second
+	watchPingInterval   = 30 * time.Second
+)
+
+var upgrader = websocket.Upgrader{}
+
+// restartHTTPServer applies the HTTP settings, stopping the running server
+// and starting a new one when enabled. The endpoints have no authentication,
+// so like the debug server it only ever listens on a loopback address.
+func (a *App) restartHTTPServer() {
+	a.stopHTTPServer()
+
+	settings := a.settings.Get()
+	if !settings.HTTP.Enabled {
+		return
+	}
+
+	addr := settings.HTTPAddr()
+	if !isLoopback(addr) {
+		log.Printf("http server refused: %s isn't a loopback address", addr)
+		return
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/watch", a.handleWatch)
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		log.Printf("http server listen failure: %v", err)
+		return
+	}
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("http server failure: %v", err)
+		}
+	}()
+
+	a.mx.Lock()
+	a.httpServer = srv
+	a.mx.Unlock()
+	log.Printf("http server listening on %s", addr)
+}
+
+func (a *App) stopHTTPServer() {
+	a.mx.Lock()
+	srv := a.httpServer
+	a.httpServer = nil
+	a.mx.Unlock()
+	if srv == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), httpShutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Printf("http server shutdown failure: %v", err)
+	}
+}
+
+// handleWatch streams key changes under the `prefix` query parameter as JSON
+// messages over a WebSocket until the client disconnects or the DB closes.
+func (a *App) handleWatch(w http.ResponseWriter, r *http.Request) {
+	if !a.db.IsRunning() {
+		http.Error(w, NotRunningResponse, http.StatusServiceUnavailable)
+		return
+	}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("watch upgrade failure: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	prefix := r.URL.Query().Get("prefix")
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	// the reader only notices the client going away
+	go func() {
+		defer cancel()
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	changes := make(chan database.KeyChange, 64)
+	go func() {
+		defer cancel()
+		err := a.db.Subscribe(ctx, []string{prefix}, func(change database.KeyChange) {
+			select {
+			case changes <- change:
+			case <-ctx.Done():
+			}
+		})
+		if err != nil {
+			log.Printf("watch subscription failure: %v", err)
+		}
+	}()
+
+	log.Printf("watch client connected for prefix [%s]", logKey(prefix))
+	ping := time.NewTicker(watchPingInterval)
+	defer ping.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			_ = conn.WriteControl(
+				websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""),
+				time.Now().Add(watchWriteTimeout),
+			)
+			log.Printf("watch client for prefix [%s] disconnected", logKey(prefix))
+			return
+		case <-ping.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(watchWriteTimeout)); err != nil {
+				return
+			}
+		case change := <-changes:
+			_ = conn.SetWriteDeadline(time.Now().Add(watchWriteTimeout))
+			if err := conn.WriteJSON(change); err != nil {
+				return
+			}
+		}
+	}
+}
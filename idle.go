@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+	"log"
+	"time"
+)
+
+const idleCheckInterval = 30 * time.Second
+
+type MessageReopen struct {
+	// DecryptionKey has to be supplied again for encrypted databases since
+	// keys are never kept after open
+	DecryptionKey Secret `json:"decryption_key"`
+	// NumCompactors reopens with that many compactors, a healthy connection
+	// is closed first
+	NumCompactors int `json:"num_compactors"`
+}
+
+type IdleClosedEvent struct {
+	Path string `json:"path"`
+}
+
+func (a *App) touch() {
+	a.lastActivity.Store(time.Now().UnixNano())
+}
+
+// watchIdle closes the database once it has been inactive for longer than
+// the configured timeout, releasing the directory lock for its owner. A
+// running job or a call being handled keeps it open.
+func (a *App) watchIdle() {
+	defer a.reportCrash(crashSourceWatchIdle)
+	ticker := time.NewTicker(idleCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-a.done:
+			return
+		case <-ticker.C:
+		}
+
+		timeout := time.Duration(a.settings.Get().IdleTimeoutMinutes) * time.Minute
+		if timeout <= 0 || !a.db.IsRunning() {
+			continue
+		}
+		idle := time.Since(time.Unix(0, a.lastActivity.Load()))
+		// a long call in flight isn't idle either, whatever its start
+		if idle < timeout || a.runningJobs() > 0 || a.inflight.Load() > 0 {
+			continue
+		}
+
+		log.Printf("db idle for %s, closing", idle.Round(time.Second))
+		var event IdleClosedEvent
+		a.mx.Lock()
+		if a.lastOpen != nil {
+			event.Path = a.lastOpen.Path
+		}
+		a.mx.Unlock()
+		a.closeDB(ClosedIdle)
+		runtime.EventsEmit(a.ctx, EventIdleClosed, event)
+	}
+}
+
+// reopen opens the database again with the parameters of the last open. An
+// unhealthy connection is closed first, a healthy one only while no job runs
+// and no change is staged.
+func (a *App) reopen(msg AppMessage) AppMessage {
+	var reopenMsg MessageReopen
+	if msg.Body != "" {
+		if err := json.Unmarshal([]byte(msg.Body), &reopenMsg); err != nil {
+			log.Printf("unmarshaling reopen message failure: %v", err)
+			return AppMessage{Type: msg.Type, Body: err.Error()}
+		}
+	}
+	if a.db.IsRunning() {
+		switch err := a.db.Health(); {
+		case err == nil && reopenMsg.NumCompactors == 0:
+			log.Printf(AlreadyRunningResponse)
+			return AppMessage{Type: msg.Type, Body: AlreadyRunningResponse}
+		case err == nil:
+			// a healthy connection is only closed with nothing depending on it
+			if n := a.runningJobs(); n > 0 {
+				reopenMsg.DecryptionKey.Wipe()
+				log.Printf("reopen rejected: %d jobs are running", n)
+				return AppMessage{Type: msg.Type, Body: fmt.Sprintf("%d jobs are running, pause them first", n)}
+			}
+			if pending, ok := a.stagedPending(msg.Type, ""); ok {
+				reopenMsg.DecryptionKey.Wipe()
+				return pending
+			}
+			log.Printf("closing db to reopen it with %d compactors", reopenMsg.NumCompactors)
+			a.db.Close()
+			a.emitClosed(ClosedReconfigure)
+		default:
+			log.Printf("closing unhealthy db before reopen")
+			a.db.Close()
+			a.emitClosed(ClosedUnhealthy)
+		}
+	}
+
+	a.mx.Lock()
+	lastOpen := a.lastOpen
+	a.mx.Unlock()
+	if lastOpen == nil {
+		reopenMsg.DecryptionKey.Wipe()
+		log.Printf("reopen requested before any database was opened")
+		return AppMessage{Type: msg.Type, Body: NotRunningResponse}
+	}
+
+	openMsg := *lastOpen
+	openMsg.DecryptionKey = reopenMsg.DecryptionKey
+	if reopenMsg.NumCompactors > 0 {
+		openMsg.NumCompactors = reopenMsg.NumCompactors
+	}
+	return a.open(msg.Type, openMsg)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/filinvadim/badger-gui/config"
+	"log"
+)
+
+type MessageIgnored struct {
+	// Prefixes replace the ignored prefixes of the open database, without
+	// them the prefixes are only reported
+	Prefixes []string `json:"prefixes"`
+}
+
+type IgnoredResponse struct {
+	Prefixes []string `json:"prefixes"`
+}
+
+// setIgnored reports or replaces the prefixes of the open database that
+// listing, search, counts and exports skip, kept in its profile and applied
+// to the connection right away. Asking for a prefix inside an ignored one
+// explicitly still lists it.
+func (a *App) setIgnored(msg AppMessage) AppMessage {
+	if !a.db.IsRunning() {
+		return AppMessage{Type: msg.Type, Body: NotRunningResponse}
+	}
+	path := a.openPath()
+	if path == "" {
+		log.Printf("setting ignored prefixes failure: %s", NoProfileResponse)
+		return AppMessage{Type: msg.Type, Body: NoProfileResponse}
+	}
+	var ignoredMsg MessageIgnored
+	if msg.Body != "" {
+		if err := json.Unmarshal([]byte(msg.Body), &ignoredMsg); err != nil {
+			log.Printf("unmarshaling ignored message failure: %v", err)
+			return AppMessage{Type: msg.Type, Body: err.Error()}
+		}
+	}
+	if ignoredMsg.Prefixes != nil {
+		for _, prefix := range ignoredMsg.Prefixes {
+			if prefix == "" {
+				err := errors.New("an empty prefix would ignore every key")
+				log.Printf("validating ignored prefixes failure: %v", err)
+				return AppMessage{Type: msg.Type, Body: err.Error()}
+			}
+		}
+		if err := a.settings.SetIgnored(path, ignoredMsg.Prefixes); err != nil {
+			log.Printf("saving ignored prefixes failure: %v", err)
+			return AppMessage{Type: msg.Type, Body: err.Error()}
+		}
+		a.db.SetIgnoredPrefixes(ignoredMsg.Prefixes)
+		log.Printf("%d ignored prefixes saved", len(ignoredMsg.Prefixes))
+	}
+	bt, _ := json.Marshal(IgnoredResponse{Prefixes: a.db.IgnoredPrefixes()})
+	return AppMessage{Type: msg.Type, Body: string(bt)}
+}
+
+// ignoredPrefixes are the prefixes the profile applied on open ignores.
+func ignoredPrefixes(profile *config.Profile) []string {
+	if profile == nil {
+		return nil
+	}
+	return profile.Ignored
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/filinvadim/badger-gui/database"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MessageImport is the params of an import job: the rows of a jsonl (or
+// ndjson) export_query or export with values are written back, in batches
+// of a progress step.
+type MessageImport struct {
+	Path string `json:"path"`
+	// Prefix is put in front of every imported key
+	Prefix string `json:"prefix"`
+	// Overwrite replaces existing keys, they are skipped otherwise
+	Overwrite bool `json:"overwrite"`
+	// AcceptLowSpace imports even though the disk may not fit the file
+	AcceptLowSpace bool `json:"accept_low_space"`
+}
+
+// jobSource is a task feeding its job rows of its own instead of the keys of
+// the database, walking them like WalkKeysFrom.
+type jobSource interface {
+	walk(prefix, after string, fn func(database.KeyMeta) error) error
+}
+
+// importTask reads the rows of an export file from offset and writes them on
+// every flush, so the checkpoint's offset always follows written rows.
+type importTask struct {
+	db  Storer
+	msg MessageImport
+	f   *os.File
+	r   *bufio.Reader
+	// offset is how far the file is read, the rows before it are pending or
+	// written
+	offset int64
+	// row is the row the walk is at and next the offset after it
+	row     database.Change
+	next    int64
+	pending []database.Change
+	written int64
+	skipped int64
+}
+
+func newImportTask(db Storer, params json.RawMessage, offset, rows int64) (jobTask, error) {
+	var importMsg MessageImport
+	if err := json.Unmarshal(params, &importMsg); err != nil {
+		return nil, err
+	}
+	if importMsg.Path == "" {
+		return nil, errors.New("import path is required")
+	}
+	f, err := os.Open(database.LongPath(importMsg.Path))
+	if err != nil {
+		return nil, err
+	}
+	// a checkpoint saved before a restart may outlive the file as it was
+	if info, err := f.Stat(); err != nil || info.Size() < offset {
+		_ = f.Close()
+		if err == nil {
+			err = fmt.Errorf("import file is shorter than the %d bytes already imported, it changed since", offset)
+		}
+		return nil, err
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return &importTask{db: db, msg: importMsg, f: f, r: bufio.NewReader(f), offset: offset, written: rows}, nil
+}
+
+// walk reads the rows after offset, expired ones are left out.
+func (t *importTask) walk(_, _ string, fn func(database.KeyMeta) error) error {
+	for {
+		line, err := t.r.ReadBytes('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+		if len(line) == 0 {
+			return nil
+		}
+		t.next = t.offset + int64(len(line))
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			meta, expired, parseErr := t.parse(line)
+			if parseErr != nil {
+				return fmt.Errorf("import row at offset %d: %w", t.offset, parseErr)
+			}
+			if !expired {
+				if err := fn(meta); err != nil {
+					return err
+				}
+			}
+		}
+		// a row left out by the job's filters is read all the same
+		t.offset = t.next
+	}
+}
+
+// parse reads an ExportQueryRow into t.row, keys quoted by the export
+// unquoted.
+func (t *importTask) parse(line []byte) (meta database.KeyMeta, expired bool, err error) {
+	var row ExportQueryRow
+	if err := json.Unmarshal(line, &row); err != nil {
+		return meta, false, err
+	}
+	key := row.Key
+	if strings.HasPrefix(key, `"`) {
+		if key, err = strconv.Unquote(key); err != nil {
+			return meta, false, err
+		}
+	}
+	if key == "" {
+		return meta, false, errors.New("empty key")
+	}
+	var value []byte
+	switch row.Encoding {
+	case encodingRaw:
+		value = []byte(row.Value)
+	case encodingBase64:
+		value, err = base64.StdEncoding.DecodeString(row.Value)
+	case encodingHex:
+		value, err = hex.DecodeString(row.Value)
+	case "":
+		err = errors.New("row has no value, export with values to import it")
+	default:
+		err = fmt.Errorf("unknown encoding %q", row.Encoding)
+	}
+	if err != nil {
+		return meta, false, err
+	}
+
+	t.row = database.Change{Key: t.msg.Prefix + key, Value: value}
+	if row.ExpiresAt > 0 {
+		// the key keeps its expiry, not its TTL
+		t.row.TTL = time.Until(time.Unix(int64(row.ExpiresAt), 0))
+		if t.row.TTL <= 0 {
+			return meta, true, nil
+		}
+	}
+	meta = database.KeyMeta{Key: t.row.Key, Size: int64(len(value)), ExpiresAt: row.ExpiresAt, Version: row.Version}
+	return meta, false, nil
+}
+
+func (t *importTask) visit(database.KeyMeta) error {
+	t.pending = append(t.pending, t.row)
+	t.offset = t.next
+	return nil
+}
+
+func (t *importTask) flush() (int64, error) {
+	if len(t.pending) == 0 {
+		return t.offset, nil
+	}
+	existing, err := t.db.SetMany(t.pending, t.msg.Overwrite)
+	if err != nil {
+		return t.offset, err
+	}
+	t.written += int64(len(t.pending) - len(existing))
+	t.skipped += int64(len(existing))
+	t.pending = t.pending[:0]
+	return t.offset, nil
+}
+
+func (t *importTask) rows() int64 {
+	return t.written
+}
+
+func (t *importTask) close(bool) error {
+	if t.skipped > 0 {
+		log.Printf("import skipped %d existing keys", t.skipped)
+	}
+	return t.f.Close()
+}
+
+// importRejected holds an import job back, when it starts or resumes, in
+// safe mode, while staging, overwriting without the write password or on low
+// disk space.
+func (a *App) importRejected(t messageType, params json.RawMessage) (AppMessage, bool) {
+	var importMsg MessageImport
+	if err := json.Unmarshal(params, &importMsg); err != nil {
+		return AppMessage{Type: t, Body: err.Error()}, true
+	}
+	if a.isWriteLocked(TypeSet) {
+		log.Printf("import rejected: safe mode is on")
+		return AppMessage{Type: t, Body: SafeModeOnResponse}, true
+	}
+	if importMsg.Overwrite && a.isWriteProtected(TypeDelete) {
+		log.Printf("overwriting imported keys rejected: write password required")
+		return AppMessage{Type: t, Body: WriteProtectedResponse}, true
+	}
+	if a.isStaging() {
+		log.Printf("import rejected: staging is on")
+		return AppMessage{Type: t, Body: "imports can't be staged, turn staging off to run them"}, true
+	}
+	info, err := os.Stat(database.LongPath(importMsg.Path))
+	if err != nil {
+		return AppMessage{Type: t, Body: err.Error()}, true
+	}
+	if held, ok := a.guardSpace(t, database.SpaceImport, info.Size(), importMsg.AcceptLowSpace); !ok {
+		return held, true
+	}
+	return AppMessage{}, false
+}
+
+// flushJob is task.flush, refused to an import while safe mode is on: its
+// pending rows are dropped and read again by a resume.
+func (a *App) flushJob(job *Job, task jobTask) (int64, error) {
+	if job.Kind == JobImport && a.isWriteLocked(TypeSet) {
+		return 0, errors.New(SafeModeOnResponse)
+	}
+	return task.flush()
+}
+
+// pauseImports pauses the running import jobs, they stop at the next row.
+func (a *App) pauseImports() {
+	a.mx.Lock()
+	defer a.mx.Unlock()
+	for _, job := range a.jobs {
+		if job.Kind != JobImport || job.Status != JobRunning {
+			continue
+		}
+		select {
+		case job.stop <- JobPaused:
+		default:
+			// a stop is already pending
+		}
+		log.Printf("job %s paused for safe mode", job.ID)
+	}
+}
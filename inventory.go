@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"github.com/filinvadim/badger-gui/database"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+type MessageExportKeys struct {
+	Path   string `json:"path"`
+	Prefix string `json:"prefix"`
+	// WithSize and WithExpiry append tab separated columns to every line
+	WithSize   bool `json:"with_size"`
+	WithExpiry bool `json:"with_expiry"`
+}
+
+type ExportKeysResponse struct {
+	Status string `json:"status"`
+	Keys   int    `json:"keys"`
+}
+
+// exportKeys writes a key inventory, one key per line in key order, so two
+// environments can be compared with diff or comm.
+func (a *App) exportKeys(msg AppMessage) AppMessage {
+	if !a.db.IsRunning() {
+		log.Printf("db not running for export keys operation")
+		return AppMessage{Type: msg.Type, Body: NotRunningResponse}
+	}
+	var exportMsg MessageExportKeys
+	if err := json.Unmarshal([]byte(msg.Body), &exportMsg); err != nil {
+		log.Printf("unmarshaling export keys message failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+	exportMsg.Prefix = a.scoped(exportMsg.Prefix)
+
+	f, err := os.OpenFile(database.LongPath(exportMsg.Path), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		log.Printf("creating key inventory file failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+	w := bufio.NewWriter(f)
+	count := 0
+	version := a.db.MaxVersion()
+	err = a.db.WalkKeys(exportMsg.Prefix, func(meta database.KeyMeta) error {
+		count++
+		_, err := w.WriteString(exportMsg.line(meta))
+		return err
+	})
+	if err == nil {
+		err = w.Flush()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		log.Printf("exporting keys failure: %v", err)
+		_ = os.Remove(database.LongPath(exportMsg.Path))
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+	query, _ := json.Marshal(exportMsg)
+	err = writeExportManifest(ExportManifest{
+		Kind: JobExportKeys, Query: query, Database: a.openPath(), Path: exportMsg.Path,
+		Rows: int64(count), MaxVersion: version,
+	})
+	if err != nil {
+		log.Printf("writing key inventory manifest failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+	log.Printf("exported %d keys to %s", count, exportMsg.Path)
+	bt, _ := json.Marshal(ExportKeysResponse{Status: OkStatus, Keys: count})
+	return AppMessage{Type: msg.Type, Body: string(bt)}
+}
+
+// line renders one inventory line, newline included.
+func (m MessageExportKeys) line(meta database.KeyMeta) string {
+	line := inventoryKey(meta.Key)
+	if m.WithSize {
+		line += "\t" + strconv.FormatInt(meta.Size, 10)
+	}
+	if m.WithExpiry {
+		line += "\t" + strconv.FormatUint(meta.ExpiresAt, 10)
+	}
+	return line + "\n"
+}
+
+// inventoryKey keeps printable keys as they are and quotes the rest so every
+// key stays on a single line.
+func inventoryKey(key string) string {
+	printable := strings.IndexFunc(key, func(r rune) bool {
+		return r == unicode.ReplacementChar || r == '"' || !unicode.IsPrint(r)
+	}) < 0
+	if printable {
+		return key
+	}
+	return strconv.Quote(key)
+}
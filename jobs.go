@@ -0,0 +1,539 @@
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/filinvadim/badger-gui/database"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"time"
+)
+
+const (
+	JobExportKeys  = "export_keys"
+	JobExportQuery = "export_query"
+	JobScan        = "scan"
+	JobWarmUp      = "warm_up"
+	JobImport      = "import"
+
+	JobRunning  = "running"
+	JobPaused   = "paused"
+	JobDone     = "done"
+	JobFailed   = "failed"
+	JobCanceled = "canceled"
+
+	EventJobProgress = "job:progress"
+
+	// jobProgressEvery is how many keys pass between progress events
+	jobProgressEvery = 1000
+
+	// jobsStateFile keeps the checkpoints of unfinished jobs across restarts
+	jobsStateFile = "jobs.json"
+
+	JobNotFoundResponse   = "job not found"
+	JobNotRunningResponse = "job is not running"
+	JobFinishedResponse   = "job already finished"
+)
+
+// errJobStopped ends the key walk of a paused or canceled job.
+var errJobStopped = errors.New("job stopped")
+
+// Job is a long running walk over the keys under a prefix, or over the rows
+// of a file for an import. Checkpoint is the last key fully processed, a
+// paused job resumes right after it in a new transaction, so it doesn't hold
+// a read snapshot or the disk while paused.
+// Unfinished jobs are persisted with their checkpoint and come back paused
+// after a restart.
+type Job struct {
+	ID     string          `json:"id"`
+	Kind   string          `json:"kind"`
+	Status string          `json:"status"`
+	Params json.RawMessage `json:"params"`
+	// Path is the database the job runs against
+	Path       string `json:"path"`
+	Checkpoint string `json:"checkpoint"`
+	// Offset is the length of the job's output file at the checkpoint, a
+	// resumed job cuts off anything written after it. For an import it's how
+	// far the input file is written to the database, a resume reads on from
+	// there
+	Offset    int64     `json:"offset"`
+	Processed int64     `json:"processed"`
+	Bytes     int64     `json:"bytes"`
+	Error     string    `json:"error,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	// Rows is the number of output rows at the checkpoint
+	Rows int64 `json:"rows"`
+	// StartVersion is the database's version when the job started, recorded
+	// in the manifest of an export
+	StartVersion uint64 `json:"start_version"`
+
+	// stop receives JobPaused or JobCanceled while the job runs
+	stop chan string
+}
+
+// jobParams are the fields every job kind's params share.
+type jobParams struct {
+	Prefix string `json:"prefix"`
+	// SinceVersion skips the keys not written after it
+	SinceVersion uint64 `json:"since_version"`
+}
+
+// jobTask does the kind specific work for every key a job visits.
+type jobTask interface {
+	visit(meta database.KeyMeta) error
+	// flush makes the output of every visited key durable before the
+	// checkpoint is persisted and returns the output length
+	flush() (offset int64, err error)
+	// rows returns the number of output rows written
+	rows() int64
+	// close releases the task's resources whenever the job stops, paused
+	// tells whether its output is continued by a resume; a finished,
+	// canceled or failed job leaves it complete. A resume cuts the output
+	// back to the checkpoint's offset either way.
+	close(paused bool) error
+}
+
+type MessageStartJob struct {
+	// Kind is export_keys, with the export_keys message as params,
+	// export_query, with MessageExportQuery as params, scan, which counts
+	// keys and value bytes under params.prefix, warm_up, which reads every
+	// value under params.prefix into the caches before browsing, or import,
+	// with MessageImport as params. Only an import writes to the database,
+	// it's held back on low disk space like paste
+	Kind   string          `json:"kind"`
+	Params json.RawMessage `json:"params"`
+}
+
+type MessageJob struct {
+	ID string `json:"id"`
+}
+
+type JobsResponse struct {
+	Jobs []Job `json:"jobs"`
+}
+
+// newJobTask prepares the task of a job, resume continues the output of an
+// earlier run instead of starting over.
+func newJobTask(db Storer, job *Job, resume bool) (jobTask, error) {
+	var offset, rows int64
+	if resume {
+		offset, rows = job.Offset, job.Rows
+	}
+	switch job.Kind {
+	case JobScan, JobWarmUp:
+		return scanTask{}, nil
+	case JobExportKeys:
+		var exportMsg MessageExportKeys
+		if err := json.Unmarshal(job.Params, &exportMsg); err != nil {
+			return nil, err
+		}
+		f, err := openJobOutput(exportMsg.Path, offset)
+		if err != nil {
+			return nil, err
+		}
+		return &exportKeysTask{msg: exportMsg, f: f, w: bufio.NewWriter(f), offset: offset, written: rows}, nil
+	case JobExportQuery:
+		return newExportQueryTask(db, job.Params, offset, rows)
+	case JobImport:
+		return newImportTask(db, job.Params, offset, rows)
+	}
+	return nil, fmt.Errorf("unknown job kind %q", job.Kind)
+}
+
+// openJobOutput opens the output file of a job cut to offset and positioned
+// there.
+func openJobOutput(path string, offset int64) (*os.File, error) {
+	f, err := os.OpenFile(database.LongPath(path), os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if err := f.Truncate(offset); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// scanTask only lets the job count keys and bytes, a warm-up reads the
+// values in its walk.
+type scanTask struct{}
+
+func (scanTask) visit(database.KeyMeta) error { return nil }
+func (scanTask) flush() (int64, error)        { return 0, nil }
+func (scanTask) rows() int64                  { return 0 }
+func (scanTask) close(bool) error             { return nil }
+
+type exportKeysTask struct {
+	msg     MessageExportKeys
+	f       *os.File
+	w       *bufio.Writer
+	offset  int64
+	written int64
+}
+
+func (t *exportKeysTask) visit(meta database.KeyMeta) error {
+	n, err := t.w.WriteString(t.msg.line(meta))
+	t.offset += int64(n)
+	t.written++
+	return err
+}
+
+func (t *exportKeysTask) flush() (int64, error) {
+	return t.offset, t.w.Flush()
+}
+
+func (t *exportKeysTask) rows() int64 {
+	return t.written
+}
+
+func (t *exportKeysTask) close(bool) error {
+	err := t.w.Flush()
+	if closeErr := t.f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func (a *App) startJob(msg AppMessage) AppMessage {
+	if !a.db.IsRunning() {
+		log.Printf("db not running for start job operation")
+		return AppMessage{Type: msg.Type, Body: NotRunningResponse}
+	}
+	var startMsg MessageStartJob
+	if err := json.Unmarshal([]byte(msg.Body), &startMsg); err != nil {
+		log.Printf("unmarshaling start job message failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+	if len(startMsg.Params) == 0 {
+		startMsg.Params = json.RawMessage("{}")
+	}
+	params, err := a.scopedParams(startMsg.Params)
+	if err != nil {
+		log.Printf("reading job params failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+	if startMsg.Kind == JobImport {
+		if rejected, ok := a.importRejected(msg.Type, params); ok {
+			return rejected
+		}
+	}
+
+	snapshot, err := a.launchJob(startMsg.Kind, params)
+	if err != nil {
+		log.Printf("starting job failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+	bt, _ := json.Marshal(snapshot)
+	return AppMessage{Type: msg.Type, Body: string(bt)}
+}
+
+// launchJob creates a job of kind with params as they are and runs it in
+// the background.
+func (a *App) launchJob(kind string, params json.RawMessage) (Job, error) {
+	now := time.Now()
+	job := &Job{
+		ID: rand.Text(), Kind: kind, Status: JobRunning, Params: params,
+		StartVersion: a.db.MaxVersion(), CreatedAt: now, UpdatedAt: now, stop: make(chan string, 1),
+	}
+	a.mx.Lock()
+	if a.lastOpen != nil {
+		job.Path = a.lastOpen.Path
+	}
+	a.mx.Unlock()
+
+	task, err := newJobTask(a.db, job, false)
+	if err != nil {
+		return Job{}, err
+	}
+	a.mx.Lock()
+	if a.jobs == nil {
+		a.jobs = make(map[string]*Job)
+	}
+	a.jobs[job.ID] = job
+	snapshot := *job
+	a.mx.Unlock()
+	a.saveJobs()
+
+	log.Printf("job %s (%s) started", job.ID, job.Kind)
+	go a.runJob(job, task)
+	return snapshot, nil
+}
+
+// runJob walks the keys after the job's checkpoint until they run out or the
+// job is told to stop.
+func (a *App) runJob(job *Job, task jobTask) {
+	defer a.reportCrash(SourceJob)
+	var params jobParams
+	_ = json.Unmarshal(job.Params, &params)
+
+	a.mx.Lock()
+	checkpoint := job.Checkpoint
+	a.mx.Unlock()
+	start := time.Now()
+
+	walk := a.db.WalkKeysFrom
+	if job.Kind == JobWarmUp {
+		walk = a.db.WarmUpFrom
+	}
+	if source, ok := task.(jobSource); ok {
+		walk = source.walk
+	}
+	// the checkpoint only moves with a flushed offset, so a resume truncating
+	// the output to the offset restarts right after its last row
+	var (
+		stopped          string
+		last             = checkpoint
+		processed, bytes int64
+	)
+	advance := func(offset int64) {
+		job.Checkpoint, job.Offset, job.Rows = last, offset, task.rows()
+		job.Processed += processed
+		job.Bytes += bytes
+		processed, bytes = 0, 0
+	}
+	err := walk(params.Prefix, checkpoint, func(meta database.KeyMeta) error {
+		select {
+		case stopped = <-job.stop:
+			return errJobStopped
+		default:
+		}
+		// imported rows may come without a version
+		if params.SinceVersion == 0 || meta.Version > params.SinceVersion {
+			if err := task.visit(meta); err != nil {
+				return err
+			}
+		}
+		last = meta.Key
+		processed++
+		bytes += meta.Size
+		if processed%jobProgressEvery != 0 {
+			return nil
+		}
+		offset, err := a.flushJob(job, task)
+		if err != nil {
+			return err
+		}
+		a.mx.Lock()
+		advance(offset)
+		job.UpdatedAt = time.Now()
+		snapshot := *job
+		a.mx.Unlock()
+		a.saveJobs()
+		runtime.EventsEmit(a.ctx, EventJobProgress, snapshot)
+		return nil
+	})
+	offset, flushErr := a.flushJob(job, task)
+	closeErr := task.close(errors.Is(err, errJobStopped) && stopped == JobPaused)
+	if err == nil {
+		err = errors.Join(flushErr, closeErr)
+	}
+	if err == nil {
+		err = jobManifest(job, task.rows())
+	}
+
+	a.mx.Lock()
+	if flushErr == nil {
+		advance(offset)
+	}
+	switch {
+	case errors.Is(err, errJobStopped):
+		job.Status = stopped
+	case err != nil:
+		// the checkpoint is kept, a failed job can be resumed
+		job.Status, job.Error = JobFailed, err.Error()
+	default:
+		job.Status = JobDone
+	}
+	job.UpdatedAt = time.Now()
+	snapshot := *job
+	a.mx.Unlock()
+
+	log.Printf("job %s %s after %d keys", job.ID, snapshot.Status, snapshot.Processed)
+	result := activityOk
+	if snapshot.Status != JobDone {
+		result = snapshot.Status
+		if snapshot.Error != "" {
+			result += ": " + snapshot.Error
+		}
+	}
+	a.activity.add(ActivityEntry{
+		Time: time.Now(), Source: SourceJob, Type: job.Kind, Key: params.Prefix,
+		DurationMs: float64(time.Since(start).Microseconds()) / 1000, Result: result,
+	})
+	a.saveJobs()
+	runtime.EventsEmit(a.ctx, EventJobProgress, snapshot)
+}
+
+// saveJobs persists the unfinished jobs. Failing to do so only costs the
+// ability to resume after a restart, so it's logged and otherwise ignored.
+func (a *App) saveJobs() {
+	a.mx.Lock()
+	jobs := make([]Job, 0, len(a.jobs))
+	for _, job := range a.jobs {
+		if job.Status != JobDone && job.Status != JobCanceled {
+			jobs = append(jobs, *job)
+		}
+	}
+	a.mx.Unlock()
+
+	if err := a.settings.SaveState(jobsStateFile, jobs); err != nil {
+		log.Printf("saving jobs failure: %v", err)
+	}
+}
+
+// loadJobs restores the jobs of an earlier run. Jobs that were running when
+// the app exited are paused, they resume from their last saved checkpoint.
+func (a *App) loadJobs() {
+	var jobs []Job
+	if err := a.settings.LoadState(jobsStateFile, &jobs); err != nil {
+		log.Printf("loading jobs failure: %v", err)
+		return
+	}
+
+	a.mx.Lock()
+	defer a.mx.Unlock()
+	if a.jobs == nil {
+		a.jobs = make(map[string]*Job, len(jobs))
+	}
+	for _, job := range jobs {
+		if job.Status == JobRunning {
+			job.Status = JobPaused
+		}
+		a.jobs[job.ID] = &job
+	}
+	if len(jobs) > 0 {
+		log.Printf("restored %d unfinished jobs", len(jobs))
+	}
+}
+
+func (a *App) listJobs(msg AppMessage) AppMessage {
+	a.mx.Lock()
+	jobs := make([]Job, 0, len(a.jobs))
+	for _, job := range a.jobs {
+		jobs = append(jobs, *job)
+	}
+	a.mx.Unlock()
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].CreatedAt.Before(jobs[j].CreatedAt) })
+
+	bt, _ := json.Marshal(JobsResponse{Jobs: jobs})
+	return AppMessage{Type: msg.Type, Body: string(bt)}
+}
+
+// stopJob pauses or cancels a job. A running job stops at the next key, a
+// paused or failed one can only be canceled.
+func (a *App) stopJob(msg AppMessage, status string) AppMessage {
+	var jobMsg MessageJob
+	if err := json.Unmarshal([]byte(msg.Body), &jobMsg); err != nil {
+		log.Printf("unmarshaling job message failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+
+	a.mx.Lock()
+	job, ok := a.jobs[jobMsg.ID]
+	if !ok {
+		a.mx.Unlock()
+		return AppMessage{Type: msg.Type, Body: JobNotFoundResponse}
+	}
+	persist, closeOutput := false, false
+	switch {
+	case job.Status == JobRunning:
+		select {
+		case job.stop <- status:
+		default:
+			// a stop is already pending
+		}
+	case status == JobCanceled && (job.Status == JobPaused || job.Status == JobFailed):
+		job.Status, job.UpdatedAt = JobCanceled, time.Now()
+		persist, closeOutput = true, true
+	case status == JobCanceled:
+		a.mx.Unlock()
+		return AppMessage{Type: msg.Type, Body: JobFinishedResponse}
+	default:
+		a.mx.Unlock()
+		return AppMessage{Type: msg.Type, Body: JobNotRunningResponse}
+	}
+	a.mx.Unlock()
+
+	if closeOutput {
+		// the output is closed as a running job's is when it's canceled,
+		// a json export ends its array
+		task, err := newJobTask(a.db, job, true)
+		if err == nil {
+			err = task.close(false)
+		}
+		if err != nil {
+			log.Printf("closing output of canceled job %s failure: %v", jobMsg.ID, err)
+		}
+	}
+	if persist {
+		a.saveJobs()
+	}
+	log.Printf("job %s %s requested", jobMsg.ID, status)
+	return AppMessage{Type: msg.Type, Body: OkStatus}
+}
+
+// resumeJob continues a paused or failed job after its checkpoint.
+func (a *App) resumeJob(msg AppMessage) AppMessage {
+	if !a.db.IsRunning() {
+		log.Printf("db not running for resume job operation")
+		return AppMessage{Type: msg.Type, Body: NotRunningResponse}
+	}
+	var jobMsg MessageJob
+	if err := json.Unmarshal([]byte(msg.Body), &jobMsg); err != nil {
+		log.Printf("unmarshaling job message failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+
+	a.mx.Lock()
+	job, ok := a.jobs[jobMsg.ID]
+	if !ok {
+		a.mx.Unlock()
+		return AppMessage{Type: msg.Type, Body: JobNotFoundResponse}
+	}
+	if job.Status != JobPaused && job.Status != JobFailed {
+		a.mx.Unlock()
+		return AppMessage{Type: msg.Type, Body: fmt.Sprintf("job is %s, only paused or failed jobs resume", job.Status)}
+	}
+	if a.lastOpen == nil || a.lastOpen.Path != job.Path {
+		a.mx.Unlock()
+		return AppMessage{Type: msg.Type, Body: fmt.Sprintf("job runs against %q, open that database to resume it", job.Path)}
+	}
+	if job.Kind == JobImport {
+		params := job.Params
+		a.mx.Unlock()
+		if rejected, ok := a.importRejected(msg.Type, params); ok {
+			return rejected
+		}
+		a.mx.Lock()
+		if job.Status != JobPaused && job.Status != JobFailed {
+			a.mx.Unlock()
+			return AppMessage{Type: msg.Type, Body: fmt.Sprintf("job is %s, only paused or failed jobs resume", job.Status)}
+		}
+	}
+	task, err := newJobTask(a.db, job, true)
+	if err != nil {
+		a.mx.Unlock()
+		log.Printf("resuming job failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+	job.Status, job.Error, job.UpdatedAt = JobRunning, "", time.Now()
+	job.stop = make(chan string, 1)
+	snapshot := *job
+	a.mx.Unlock()
+
+	log.Printf("job %s resumed after %d keys", job.ID, snapshot.Processed)
+	go a.runJob(job, task)
+	bt, _ := json.Marshal(snapshot)
+	return AppMessage{Type: msg.Type, Body: string(bt)}
+}
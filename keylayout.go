@@ -0,0 +1,344 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// keyField is one field of a key layout. A size of -1 takes the rest of the
+// key.
+type keyField struct {
+	name string
+	kind string
+	size int
+	le   bool
+}
+
+// keyFieldSizes are the sizes of the fixed-size field types.
+var keyFieldSizes = map[string]int{
+	"u8": 1, "u16": 2, "u32": 4, "u64": 8,
+	"i8": 1, "i16": 2, "i32": 4, "i64": 8,
+	"f32": 4, "f64": 8,
+	"unix": 8, "unixms": 8, "unixns": 8,
+	"uuid": 16,
+}
+
+type MessageKeyLayout struct {
+	Prefix string `json:"prefix"`
+	// Layout describes the keys under the prefix, empty removes it
+	Layout string `json:"layout"`
+}
+
+type KeyLayoutsResponse struct {
+	Layouts map[string]string `json:"layouts"`
+}
+
+type MessageRenderKey struct {
+	// ID is the row ID of the key, Key is used without it
+	ID  string `json:"id"`
+	Key string `json:"key"`
+	// Layout is tried instead of the layouts of the profile, on the part of
+	// the key after Prefix
+	Layout string `json:"layout"`
+	Prefix string `json:"prefix"`
+}
+
+type RenderKeyResponse struct {
+	// Rendered is null when no layout applies to the key
+	Rendered *RenderedKey `json:"rendered"`
+}
+
+// KeyPart is a decoded field of a key.
+type KeyPart struct {
+	Name  string `json:"name,omitempty"`
+	Value string `json:"value"`
+}
+
+// RenderedKey is a key decoded with the layout of its prefix.
+type RenderedKey struct {
+	Prefix string    `json:"prefix"`
+	Fields []KeyPart `json:"fields"`
+	// Text is the key as shown, the prefix followed by the fields as a tuple
+	Text string `json:"text"`
+	// Error tells why the key doesn't match its layout, the fields decoded
+	// before are kept
+	Error string `json:"error,omitempty"`
+}
+
+// parseKeyLayout parses a key layout: fields joined by +, each an optional
+// name and a colon followed by a type, as in uid:u64+ts:unixms. The types are
+// u8 to u64 and i8 to i64 (big-endian, little-endian with an le suffix as
+// in u32le), f32, f64, the 8-byte timestamps unix, unixms and unixns, uuid,
+// hex(N), str(N) and skip(N) of N bytes, and hex and str taking the rest of
+// the key, only as the last field.
+func parseKeyLayout(layout string) ([]keyField, error) {
+	parts := strings.Split(layout, "+")
+	fields := make([]keyField, 0, len(parts))
+	for i, part := range parts {
+		part = strings.TrimSpace(part)
+		var field keyField
+		if name, kind, ok := strings.Cut(part, ":"); ok {
+			field.name, part = strings.TrimSpace(name), strings.TrimSpace(kind)
+		}
+		if kind, size, ok := strings.Cut(part, "("); ok {
+			n, err := strconv.Atoi(strings.TrimSuffix(size, ")"))
+			if err != nil || !strings.HasSuffix(size, ")") || n <= 0 {
+				return nil, fmt.Errorf("field %d: invalid size in %q", i+1, part)
+			}
+			switch kind {
+			case "hex", "str", "skip":
+			default:
+				return nil, fmt.Errorf("field %d: %s takes no size", i+1, kind)
+			}
+			field.kind, field.size = kind, n
+			fields = append(fields, field)
+			continue
+		}
+		base := strings.TrimSuffix(part, "le")
+		switch {
+		case part == "hex", part == "str":
+			if i != len(parts)-1 {
+				return nil, fmt.Errorf("field %d: %s without a size takes the rest of the key, it must be last", i+1, part)
+			}
+			field.kind, field.size = part, -1
+		case base != part && base != "uuid" && keyFieldSizes[base] > 1:
+			field.kind, field.size, field.le = base, keyFieldSizes[base], true
+		case keyFieldSizes[part] > 0:
+			field.kind, field.size = part, keyFieldSizes[part]
+		case part == "":
+			return nil, fmt.Errorf("field %d is empty", i+1)
+		default:
+			return nil, fmt.Errorf("field %d: unknown type %q", i+1, part)
+		}
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+// renderKey decodes the part of a key after its prefix with a layout.
+func renderKey(prefix string, fields []keyField, rest []byte) *RenderedKey {
+	r := &RenderedKey{Prefix: prefix, Fields: make([]KeyPart, 0, len(fields))}
+	for _, field := range fields {
+		size := field.size
+		if size < 0 {
+			size = len(rest)
+		}
+		if len(rest) < size {
+			r.Error = fmt.Sprintf("key ends inside field %s", fieldName(field, len(r.Fields)))
+			break
+		}
+		b := rest[:size]
+		rest = rest[size:]
+		if field.kind != "skip" {
+			r.Fields = append(r.Fields, KeyPart{Name: field.name, Value: keyFieldValue(field, b)})
+		}
+	}
+	if r.Error == "" && len(rest) > 0 {
+		r.Error = fmt.Sprintf("key is %d bytes longer than its layout", len(rest))
+	}
+
+	parts := make([]string, len(r.Fields))
+	for i, part := range r.Fields {
+		parts[i] = part.Value
+		if part.Name != "" {
+			parts[i] = part.Name + "=" + part.Value
+		}
+	}
+	r.Text = prefix + "(" + strings.Join(parts, ", ") + ")"
+	return r
+}
+
+func fieldName(field keyField, i int) string {
+	if field.name != "" {
+		return field.name
+	}
+	return strconv.Itoa(i + 1)
+}
+
+func keyFieldValue(field keyField, b []byte) string {
+	var order binary.ByteOrder = binary.BigEndian
+	if field.le {
+		order = binary.LittleEndian
+	}
+	var u uint64
+	switch len(b) {
+	case 1:
+		u = uint64(b[0])
+	case 2:
+		u = uint64(order.Uint16(b))
+	case 4:
+		u = uint64(order.Uint32(b))
+	case 8:
+		u = order.Uint64(b)
+	}
+	switch field.kind {
+	case "u8", "u16", "u32", "u64":
+		return strconv.FormatUint(u, 10)
+	case "i8":
+		return strconv.FormatInt(int64(int8(u)), 10)
+	case "i16":
+		return strconv.FormatInt(int64(int16(u)), 10)
+	case "i32":
+		return strconv.FormatInt(int64(int32(u)), 10)
+	case "i64":
+		return strconv.FormatInt(int64(u), 10)
+	case "f32":
+		return strconv.FormatFloat(float64(math.Float32frombits(uint32(u))), 'g', -1, 32)
+	case "f64":
+		return strconv.FormatFloat(math.Float64frombits(u), 'g', -1, 64)
+	case "unix":
+		return time.Unix(int64(u), 0).UTC().Format(time.RFC3339)
+	case "unixms":
+		return time.UnixMilli(int64(u)).UTC().Format(time.RFC3339Nano)
+	case "unixns":
+		return time.Unix(0, int64(u)).UTC().Format(time.RFC3339Nano)
+	case "uuid":
+		h := hex.EncodeToString(b)
+		return h[:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:]
+	case "str":
+		if utf8.Valid(b) {
+			return string(b)
+		}
+	}
+	return hex.EncodeToString(b)
+}
+
+// keyLayout is a parsed layout of the keys under prefix.
+type keyLayout struct {
+	prefix string
+	fields []keyField
+}
+
+// keyRenderer renders keys with the layouts of a profile, the longest
+// prefix first.
+type keyRenderer []keyLayout
+
+func newKeyRenderer(layouts map[string]string) keyRenderer {
+	r := make(keyRenderer, 0, len(layouts))
+	for prefix, layout := range layouts {
+		fields, err := parseKeyLayout(layout)
+		if err != nil {
+			log.Printf("parsing key layout of prefix [%s] failure: %v", logKey(prefix), err)
+			continue
+		}
+		r = append(r, keyLayout{prefix: prefix, fields: fields})
+	}
+	sort.Slice(r, func(i, j int) bool { return len(r[i].prefix) > len(r[j].prefix) })
+	return r
+}
+
+// render decodes key with the layout of its longest prefix, nil when no
+// layout applies.
+func (r keyRenderer) render(key string) *RenderedKey {
+	for _, layout := range r {
+		if strings.HasPrefix(key, layout.prefix) {
+			return renderKey(layout.prefix, layout.fields, []byte(key[len(layout.prefix):]))
+		}
+	}
+	return nil
+}
+
+// keyRenderer returns the renderer of the open database's key layouts.
+func (a *App) keyRenderer() keyRenderer {
+	path := a.openPath()
+	if path == "" {
+		return nil
+	}
+	profile, _ := a.settings.Get().Profile(path)
+	return newKeyRenderer(profile.KeyLayouts)
+}
+
+// renderKeys renders the keys of a page in the same order, nil when no key
+// has a layout.
+func (a *App) renderKeys(keys []string) []*RenderedKey {
+	r := a.keyRenderer()
+	if len(r) == 0 {
+		return nil
+	}
+	rendered := make([]*RenderedKey, len(keys))
+	var found bool
+	for i, key := range keys {
+		rendered[i] = r.render(key)
+		found = found || rendered[i] != nil
+	}
+	if !found {
+		return nil
+	}
+	return rendered
+}
+
+// setKeyLayout stores the layout of the keys under a prefix of the open
+// database in its profile, so list and search show them decoded.
+func (a *App) setKeyLayout(msg AppMessage) AppMessage {
+	var layoutMsg MessageKeyLayout
+	if err := json.Unmarshal([]byte(msg.Body), &layoutMsg); err != nil {
+		log.Printf("unmarshaling key layout message failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+	path := a.openPath()
+	if path == "" {
+		log.Printf("setting key layout failure: %s", NoProfileResponse)
+		return AppMessage{Type: msg.Type, Body: NoProfileResponse}
+	}
+	if layoutMsg.Layout != "" {
+		if _, err := parseKeyLayout(layoutMsg.Layout); err != nil {
+			log.Printf("parsing key layout failure: %v", err)
+			return AppMessage{Type: msg.Type, Body: err.Error()}
+		}
+	}
+	layouts, err := a.settings.SetKeyLayout(path, layoutMsg.Prefix, layoutMsg.Layout)
+	if err != nil {
+		log.Printf("setting key layout failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+	log.Printf("key layout of prefix [%s] set, %d layouts", logKey(layoutMsg.Prefix), len(layouts))
+	bt, _ := json.Marshal(KeyLayoutsResponse{Layouts: layouts})
+	return AppMessage{Type: msg.Type, Body: string(bt)}
+}
+
+// renderKeyOf decodes a single key, with a layout being tried or those of
+// the profile.
+func (a *App) renderKeyOf(msg AppMessage) AppMessage {
+	var renderMsg MessageRenderKey
+	if err := json.Unmarshal([]byte(msg.Body), &renderMsg); err != nil {
+		log.Printf("unmarshaling render key message failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+	key := renderMsg.Key
+	if renderMsg.ID != "" {
+		keys, err := keysOf([]string{renderMsg.ID})
+		if err != nil {
+			log.Printf("decoding row id failure: %v", err)
+			return AppMessage{Type: msg.Type, Body: err.Error()}
+		}
+		key = keys[0]
+	}
+
+	var resp RenderKeyResponse
+	if renderMsg.Layout != "" {
+		fields, err := parseKeyLayout(renderMsg.Layout)
+		if err != nil {
+			log.Printf("parsing key layout failure: %v", err)
+			return AppMessage{Type: msg.Type, Body: err.Error()}
+		}
+		if !strings.HasPrefix(key, renderMsg.Prefix) {
+			err := fmt.Errorf("key doesn't start with prefix [%s]", renderMsg.Prefix)
+			log.Printf("rendering key failure: %v", err)
+			return AppMessage{Type: msg.Type, Body: err.Error()}
+		}
+		resp.Rendered = renderKey(renderMsg.Prefix, fields, []byte(key[len(renderMsg.Prefix):]))
+	} else {
+		resp.Rendered = a.keyRenderer().render(key)
+	}
+	bt, _ := json.Marshal(resp)
+	return AppMessage{Type: msg.Type, Body: string(bt)}
+}
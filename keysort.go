@@ -0,0 +1,67 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/filinvadim/badger-gui/database"
+	"sort"
+)
+
+const (
+	SortKey     = "key"
+	SortSize    = "size"
+	SortExpires = "expires"
+	SortVersion = "version"
+)
+
+// sortByMeta reads the metadata of a page of keys and orders them by it,
+// ties and the key sort keep key order. Keys without an expiry sort after
+// expiring ones. Keys deleted since they were listed are dropped.
+func (a *App) sortByMeta(keys []string, by string, desc bool) ([]string, []database.KeyMeta, error) {
+	switch by {
+	case "", SortKey, SortSize, SortExpires, SortVersion:
+	default:
+		return nil, nil, fmt.Errorf("unknown sort field %q", by)
+	}
+	metas := make([]database.KeyMeta, 0, len(keys))
+	for _, key := range keys {
+		meta, err := a.db.Meta(key)
+		if errors.Is(err, database.ErrKeyNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		metas = append(metas, meta)
+	}
+
+	less := func(x, y database.KeyMeta) bool {
+		switch by {
+		case SortSize:
+			if x.Size != y.Size {
+				return x.Size < y.Size
+			}
+		case SortExpires:
+			if x.ExpiresAt != y.ExpiresAt {
+				return y.ExpiresAt == 0 || (x.ExpiresAt != 0 && x.ExpiresAt < y.ExpiresAt)
+			}
+		case SortVersion:
+			if x.Version != y.Version {
+				return x.Version < y.Version
+			}
+		}
+		return x.Key < y.Key
+	}
+	sort.SliceStable(metas, func(i, j int) bool {
+		if desc {
+			return less(metas[j], metas[i])
+		}
+		return less(metas[i], metas[j])
+	})
+
+	sorted := make([]string, len(metas))
+	for i, meta := range metas {
+		sorted[i] = meta.Key
+	}
+	return sorted, metas, nil
+}
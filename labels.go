@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/filinvadim/badger-gui/database"
+	"log"
+	"strings"
+)
+
+type MessageLabel struct {
+	Prefix string `json:"prefix"`
+	// Label names the prefix, empty removes the name
+	Label string `json:"label"`
+}
+
+type LabelsResponse struct {
+	Labels map[string]string `json:"labels"`
+}
+
+// labelPrefix gives a prefix of the open database a friendly name, like
+// "peers" for /p/, kept in its profile.
+func (a *App) labelPrefix(msg AppMessage) AppMessage {
+	var labelMsg MessageLabel
+	if err := json.Unmarshal([]byte(msg.Body), &labelMsg); err != nil {
+		log.Printf("unmarshaling label message failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+	path := a.openPath()
+	if path == "" {
+		log.Printf("labeling prefix failure: %s", NoProfileResponse)
+		return AppMessage{Type: msg.Type, Body: NoProfileResponse}
+	}
+	labels, err := a.settings.SetLabel(path, labelMsg.Prefix, labelMsg.Label)
+	if err != nil {
+		log.Printf("labeling prefix failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+	log.Printf("prefix [%s] labeled, %d labels", logKey(labelMsg.Prefix), len(labels))
+	bt, _ := json.Marshal(LabelsResponse{Labels: labels})
+	return AppMessage{Type: msg.Type, Body: string(bt)}
+}
+
+func (a *App) openPath() string {
+	a.mx.Lock()
+	defer a.mx.Unlock()
+	if a.lastOpen == nil {
+		return ""
+	}
+	return a.lastOpen.Path
+}
+
+// labels returns the prefix labels of the open database.
+func (a *App) labels() map[string]string {
+	path := a.openPath()
+	if path == "" {
+		return nil
+	}
+	profile, _ := a.settings.Get().Profile(path)
+	return profile.Labels
+}
+
+// pageLabels returns the labels of the prefixes any of keys starts with.
+func (a *App) pageLabels(keys []string) map[string]string {
+	labels := a.labels()
+	if len(labels) == 0 {
+		return nil
+	}
+	page := make(map[string]string)
+	for prefix, label := range labels {
+		for _, key := range keys {
+			if strings.HasPrefix(key, prefix) {
+				page[prefix] = label
+				break
+			}
+		}
+	}
+	if len(page) == 0 {
+		return nil
+	}
+	return page
+}
+
+// labelTreemap sets the label of every node whose prefix has one.
+func labelTreemap(node *database.TreemapNode, labels map[string]string) {
+	if node == nil || len(labels) == 0 {
+		return
+	}
+	if !node.Other {
+		node.Label = labels[node.Prefix]
+	}
+	for _, child := range node.Children {
+		labelTreemap(child, labels)
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sync/atomic"
+)
+
+const (
+	// LogLevelInfo logs keys as short hashes, so the lines of a key can be
+	// followed without revealing it
+	LogLevelInfo = "info"
+	// LogLevelDebug logs the first logKeyPrefix characters of keys
+	LogLevelDebug = "debug"
+	// LogLevelTrace logs keys in full
+	LogLevelTrace = "trace"
+
+	logKeyPrefix = 8
+)
+
+// logLevel is how logKey renders keys, set from the settings.
+var logLevel = new(atomic.Value)
+
+// setLogLevel switches how keys are logged, an unknown level logs them as
+// at LogLevelInfo.
+func setLogLevel(level string) {
+	logLevel.Store(level)
+}
+
+// logKey renders a key or a prefix for the log at the log level. Every key
+// logged goes through it, values and secrets are never logged at all.
+func logKey(key string) string {
+	if key == "" {
+		return key
+	}
+	level, _ := logLevel.Load().(string)
+	return logKeyRedaction(level)(key)
+}
+
+// logKeyRedaction returns how keys are rendered in the log at level.
+func logKeyRedaction(level string) func(string) string {
+	switch level {
+	case LogLevelTrace:
+		return func(key string) string { return key }
+	case LogLevelDebug:
+		return truncateLogKey
+	}
+	return hashLogKey
+}
+
+// hashLogKey renders a key as the start of its SHA-256.
+func hashLogKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return "#" + hex.EncodeToString(sum[:4])
+}
+
+func truncateLogKey(key string) string {
+	if runes := []rune(key); len(runes) > logKeyPrefix {
+		return string(runes[:logKeyPrefix]) + "…"
+	}
+	return key
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"crypto/rand"
 	"embed"
+	"github.com/filinvadim/badger-gui/config"
 	"github.com/filinvadim/badger-gui/database"
 	"github.com/wailsapp/wails/v2"
 	"github.com/wailsapp/wails/v2/pkg/options"
@@ -10,7 +11,9 @@ import (
 	"github.com/wailsapp/wails/v2/pkg/options/linux"
 	"github.com/wailsapp/wails/v2/pkg/options/mac"
 	"github.com/wailsapp/wails/v2/pkg/options/windows"
+	"io"
 	"log"
+	"os"
 )
 
 //go:embed frontend/dist
@@ -20,12 +23,20 @@ var assets embed.FS
 var icon []byte
 
 func main() {
+	log.SetOutput(io.MultiWriter(os.Stderr, recentLogs))
+
 	db, err := database.New(nil)
 	if err != nil {
-		log.Fatalf("failed to open database: %v", err)
+		fatal("failed to open database: %v", err)
+	}
+
+	settings, err := config.Load()
+	if err != nil {
+		fatal("failed to load settings: %v", err)
 	}
+	setLogLevel(settings.Get().LogLevel())
 
-	app := NewApp(db)
+	app := NewApp(db, settings)
 
 	setLinuxDesktopIcon(icon)
 
@@ -35,10 +46,12 @@ func main() {
 		Height:           1024,
 		WindowStartState: options.Maximised,
 		AssetServer: &assetserver.Options{
-			Assets: assets,
+			Assets:  assets,
+			Handler: app.assetHandler(),
 		},
 		BackgroundColour: &options.RGBA{R: 27, G: 38, B: 54, A: 1},
 		OnStartup:        app.startup,
+		OnBeforeClose:    app.beforeClose,
 		OnShutdown:       app.close,
 		SingleInstanceLock: &options.SingleInstanceLock{
 			UniqueId: rand.Text(),
@@ -88,6 +101,6 @@ func main() {
 	})
 	if err != nil {
 		db.Close()
-		log.Fatalf("failed to start application: %s", err)
+		fatal("failed to start application: %s", err)
 	}
 }
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/filinvadim/badger-gui/database"
+	"io"
+	"log"
+	"os"
+	"time"
+)
+
+// manifestSuffix is appended to an export's path to name its manifest.
+const manifestSuffix = ".manifest.json"
+
+// ExportManifest describes a finished export, written next to it, so the
+// same query can later be re-run for only the keys written since.
+type ExportManifest struct {
+	// Kind is the job kind, or export_keys for the export_keys message
+	Kind string `json:"kind"`
+	// Query is the export's params, the prefix already scoped
+	Query    json.RawMessage `json:"query"`
+	Database string          `json:"database"`
+	Path     string          `json:"path"`
+	Rows     int64           `json:"rows"`
+	SHA256   string          `json:"sha256"`
+	// MaxVersion is the database's version when the export started, a delta
+	// export takes the keys written after it
+	MaxVersion uint64    `json:"max_version"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type MessageExportDelta struct {
+	// Manifest is the manifest of the export to continue from
+	Manifest string `json:"manifest"`
+	// Path is where the delta is written, its own manifest next to it
+	Path string `json:"path"`
+}
+
+// writeExportManifest hashes the export's output and writes the manifest
+// next to it.
+func writeExportManifest(m ExportManifest) error {
+	f, err := os.Open(database.LongPath(m.Path))
+	if err != nil {
+		return err
+	}
+	h := sha256.New()
+	_, err = io.Copy(h, f)
+	_ = f.Close()
+	if err != nil {
+		return err
+	}
+	m.SHA256 = hex.EncodeToString(h.Sum(nil))
+	m.CreatedAt = time.Now()
+	bt, _ := json.MarshalIndent(m, "", "  ")
+	return os.WriteFile(database.LongPath(m.Path+manifestSuffix), bt, 0600)
+}
+
+// jobManifest writes the manifest of a finished export job, other kinds have
+// none.
+func jobManifest(job *Job, rows int64) error {
+	if job.Kind != JobExportKeys && job.Kind != JobExportQuery {
+		return nil
+	}
+	var out struct {
+		Path string `json:"path"`
+	}
+	if err := json.Unmarshal(job.Params, &out); err != nil {
+		return err
+	}
+	return writeExportManifest(ExportManifest{
+		Kind: job.Kind, Query: job.Params, Database: job.Path, Path: out.Path,
+		Rows: rows, MaxVersion: job.StartVersion,
+	})
+}
+
+// exportDelta starts the export of a manifest again as a job, into a new
+// path, for only the keys written after the manifest's version. Deleted keys
+// aren't part of the delta, they're gone from the key walk.
+func (a *App) exportDelta(msg AppMessage) AppMessage {
+	if !a.db.IsRunning() {
+		log.Printf("db not running for export delta operation")
+		return AppMessage{Type: msg.Type, Body: NotRunningResponse}
+	}
+	var deltaMsg MessageExportDelta
+	if err := json.Unmarshal([]byte(msg.Body), &deltaMsg); err != nil {
+		log.Printf("unmarshaling export delta message failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+	bt, err := os.ReadFile(database.LongPath(deltaMsg.Manifest))
+	if err != nil {
+		log.Printf("reading export manifest failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+	var manifest ExportManifest
+	if err := json.Unmarshal(bt, &manifest); err != nil {
+		log.Printf("unmarshaling export manifest failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+	if openPath := a.openPath(); manifest.Database != openPath {
+		return AppMessage{Type: msg.Type, Body: fmt.Sprintf("manifest was written from %q, open that database to export its delta", manifest.Database)}
+	}
+
+	var params map[string]any
+	if err := json.Unmarshal(manifest.Query, &params); err != nil {
+		log.Printf("reading export manifest query failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+	if params == nil {
+		params = make(map[string]any)
+	}
+	params["path"] = deltaMsg.Path
+	params["since_version"] = manifest.MaxVersion
+	query, _ := json.Marshal(params)
+
+	job, err := a.launchJob(manifest.Kind, query)
+	if err != nil {
+		log.Printf("starting export delta failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+	bt, _ = json.Marshal(job)
+	return AppMessage{Type: msg.Type, Body: string(bt)}
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// MediaInfo is what can be told about a non-image media value without a
+// full decoder.
+type MediaInfo struct {
+	Mime     string `json:"mime"`
+	Pages    int    `json:"pages,omitempty"`
+	Title    string `json:"title,omitempty"`
+	Version  string `json:"version,omitempty"`
+	Duration string `json:"duration,omitempty"`
+	Codec    string `json:"codec,omitempty"`
+	Channels int    `json:"channels,omitempty"`
+	Rate     int    `json:"sample_rate,omitempty"`
+	Bitrate  int    `json:"bitrate,omitempty"`
+	Width    int    `json:"width,omitempty"`
+	Height   int    `json:"height,omitempty"`
+}
+
+// String renders the metadata shown instead of the raw bytes.
+func (m *MediaInfo) String() string {
+	parts := []string{m.Mime}
+	if m.Pages > 0 {
+		parts = append(parts, fmt.Sprintf("%d pages", m.Pages))
+	}
+	if m.Title != "" {
+		parts = append(parts, fmt.Sprintf("title %q", m.Title))
+	}
+	if m.Codec != "" {
+		parts = append(parts, m.Codec)
+	}
+	if m.Width > 0 && m.Height > 0 {
+		parts = append(parts, fmt.Sprintf("%dx%d", m.Width, m.Height))
+	}
+	if m.Duration != "" {
+		parts = append(parts, m.Duration)
+	}
+	if m.Rate > 0 {
+		parts = append(parts, fmt.Sprintf("%d Hz", m.Rate))
+	}
+	if m.Channels > 0 {
+		parts = append(parts, fmt.Sprintf("%d ch", m.Channels))
+	}
+	if m.Bitrate > 0 {
+		parts = append(parts, fmt.Sprintf("%d kbps", m.Bitrate/1000))
+	}
+	return "[" + strings.Join(parts, ", ") + "]"
+}
+
+// mediaInfo recognizes PDF, audio and video values, nil for anything else.
+func mediaInfo(data []byte) *MediaInfo {
+	mime := http.DetectContentType(data)
+	switch {
+	case mime == "application/pdf":
+		return pdfInfo(data)
+	case mime == "audio/wave":
+		return wavInfo(data)
+	case mime == "audio/mpeg":
+		return mp3Info(data)
+	case mime == "video/mp4":
+		return mp4Info(data)
+	case strings.HasPrefix(mime, "audio/"), strings.HasPrefix(mime, "video/"), mime == "application/ogg":
+		return &MediaInfo{Mime: mime}
+	}
+	return nil
+}
+
+var (
+	pdfPageRe  = regexp.MustCompile(`/Type\s*/Page[^s]`)
+	pdfTitleRe = regexp.MustCompile(`/Title\s*\(((?:[^()\\]|\\.)*)\)`)
+
+	pdfUnescape = strings.NewReplacer(`\(`, "(", `\)`, ")", `\\`, `\`)
+)
+
+func pdfInfo(data []byte) *MediaInfo {
+	info := &MediaInfo{Mime: "application/pdf"}
+	if header, _, ok := bytes.Cut(data, []byte("\n")); ok && bytes.HasPrefix(header, []byte("%PDF-")) {
+		info.Version = strings.TrimSpace(string(header[len("%PDF-"):]))
+	}
+	// compressed object streams hide page objects, the count is a lower bound
+	info.Pages = len(pdfPageRe.FindAllIndex(data, -1))
+	if m := pdfTitleRe.FindSubmatch(data); m != nil {
+		info.Title = pdfUnescape.Replace(string(m[1]))
+	}
+	return info
+}
+
+func wavInfo(data []byte) *MediaInfo {
+	info := &MediaInfo{Mime: "audio/wave", Codec: "pcm"}
+	var byteRate uint32
+	for off := 12; off+8 <= len(data); {
+		id, size := string(data[off:off+4]), int(binary.LittleEndian.Uint32(data[off+4:off+8]))
+		body := data[off+8:]
+		switch id {
+		case "fmt ":
+			if len(body) < 16 {
+				return info
+			}
+			info.Channels = int(binary.LittleEndian.Uint16(body[2:4]))
+			info.Rate = int(binary.LittleEndian.Uint32(body[4:8]))
+			byteRate = binary.LittleEndian.Uint32(body[8:12])
+			info.Bitrate = int(byteRate) * 8
+		case "data":
+			if byteRate > 0 {
+				info.Duration = formatDuration(float64(size) / float64(byteRate))
+			}
+			return info
+		}
+		off += 8 + size + size%2
+	}
+	return info
+}
+
+var (
+	mp3Bitrates    = [16]int{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 0}
+	mp3SampleRates = [4]int{44100, 48000, 32000, 0}
+)
+
+// mp3Info reads the first MPEG-1 Layer III frame header. The duration
+// assumes a constant bitrate.
+func mp3Info(data []byte) *MediaInfo {
+	info := &MediaInfo{Mime: "audio/mpeg", Codec: "mp3"}
+	off := 0
+	if len(data) >= 10 && string(data[:3]) == "ID3" {
+		size := int(data[6]&0x7f)<<21 | int(data[7]&0x7f)<<14 | int(data[8]&0x7f)<<7 | int(data[9]&0x7f)
+		off = 10 + size
+	}
+	for ; off+4 <= len(data); off++ {
+		if data[off] != 0xff || data[off+1]&0xfe != 0xfa {
+			continue
+		}
+		bitrate := mp3Bitrates[data[off+2]>>4] * 1000
+		rate := mp3SampleRates[(data[off+2]>>2)&0x03]
+		if bitrate == 0 || rate == 0 {
+			continue
+		}
+		info.Bitrate, info.Rate = bitrate, rate
+		info.Channels = 2
+		if data[off+3]>>6 == 3 {
+			info.Channels = 1
+		}
+		info.Duration = formatDuration(float64(len(data)-off) * 8 / float64(bitrate))
+		return info
+	}
+	return info
+}
+
+// mp4Info walks the box tree for the movie header duration and the first
+// track with visual dimensions.
+func mp4Info(data []byte) *MediaInfo {
+	info := &MediaInfo{Mime: "video/mp4"}
+	if len(data) >= 12 {
+		info.Codec = strings.TrimSpace(string(data[8:12]))
+	}
+	walkMP4(data, info)
+	return info
+}
+
+func walkMP4(data []byte, info *MediaInfo) {
+	for off := 0; off+8 <= len(data); {
+		size := uint64(binary.BigEndian.Uint32(data[off : off+4]))
+		kind := string(data[off+4 : off+8])
+		header := 8
+		if size == 1 && off+16 <= len(data) {
+			size, header = binary.BigEndian.Uint64(data[off+8:off+16]), 16
+		}
+		// compared before adding, a 64-bit size would overflow off+size
+		if size == 0 || size > uint64(len(data)-off) {
+			size = uint64(len(data) - off)
+		}
+		if size < uint64(header) {
+			return
+		}
+		end := off + int(size)
+		body := data[off+header : end]
+		switch kind {
+		case "moov", "trak":
+			walkMP4(body, info)
+		case "mvhd":
+			mp4MovieHeader(body, info)
+		case "tkhd":
+			if info.Width == 0 && len(body) >= 8 {
+				// width and height are the last two 16.16 fixed point fields
+				w := binary.BigEndian.Uint32(body[len(body)-8:])
+				h := binary.BigEndian.Uint32(body[len(body)-4:])
+				info.Width, info.Height = int(w>>16), int(h>>16)
+			}
+		}
+		off = end
+	}
+}
+
+func mp4MovieHeader(body []byte, info *MediaInfo) {
+	if len(body) < 1 {
+		return
+	}
+	var timescale uint32
+	var duration uint64
+	if body[0] == 1 && len(body) >= 32 {
+		timescale = binary.BigEndian.Uint32(body[20:24])
+		duration = binary.BigEndian.Uint64(body[24:32])
+	} else if len(body) >= 20 {
+		timescale = binary.BigEndian.Uint32(body[12:16])
+		duration = uint64(binary.BigEndian.Uint32(body[16:20]))
+	}
+	if timescale > 0 {
+		info.Duration = formatDuration(float64(duration) / float64(timescale))
+	}
+}
+
+func formatDuration(seconds float64) string {
+	return (time.Duration(seconds * float64(time.Second))).Round(time.Millisecond).String()
+}
@@ -0,0 +1,332 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/filinvadim/badger-gui/database"
+	"io"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// latencySamples is how many recent durations per operation the percentiles
+// are computed from.
+const latencySamples = 1024
+
+type MessageMetrics struct {
+	// Reset clears the collected latencies after reporting them
+	Reset bool `json:"reset"`
+}
+
+// OperationLatency summarizes the recent durations of one Storer operation.
+type OperationLatency struct {
+	Op    string  `json:"op"`
+	Count int64   `json:"count"`
+	P50Ms float64 `json:"p50_ms"`
+	P95Ms float64 `json:"p95_ms"`
+	P99Ms float64 `json:"p99_ms"`
+	MaxMs float64 `json:"max_ms"`
+}
+
+type MetricsResponse struct {
+	Operations []OperationLatency `json:"operations"`
+}
+
+type latencyRing struct {
+	count   int64
+	max     time.Duration
+	samples []time.Duration
+	next    int
+}
+
+// latencyRecorder keeps the last latencySamples durations of every
+// operation.
+type latencyRecorder struct {
+	mx  *sync.Mutex
+	ops map[string]*latencyRing
+}
+
+func newLatencyRecorder() *latencyRecorder {
+	return &latencyRecorder{mx: new(sync.Mutex), ops: make(map[string]*latencyRing)}
+}
+
+// since records the time passed since start for op, meant to be deferred.
+func (r *latencyRecorder) since(op string, start time.Time) {
+	took := time.Since(start)
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	ring, ok := r.ops[op]
+	if !ok {
+		ring = &latencyRing{samples: make([]time.Duration, 0, latencySamples)}
+		r.ops[op] = ring
+	}
+	ring.count++
+	ring.max = max(ring.max, took)
+	if len(ring.samples) < latencySamples {
+		ring.samples = append(ring.samples, took)
+		return
+	}
+	ring.samples[ring.next] = took
+	ring.next = (ring.next + 1) % latencySamples
+}
+
+func (r *latencyRecorder) summary(reset bool) []OperationLatency {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	ops := make([]OperationLatency, 0, len(r.ops))
+	for op, ring := range r.ops {
+		sorted := append([]time.Duration(nil), ring.samples...)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+		ops = append(ops, OperationLatency{
+			Op: op, Count: ring.count,
+			P50Ms: millis(percentile(sorted, 0.50)),
+			P95Ms: millis(percentile(sorted, 0.95)),
+			P99Ms: millis(percentile(sorted, 0.99)),
+			MaxMs: millis(ring.max),
+		})
+	}
+	if reset {
+		r.ops = make(map[string]*latencyRing)
+	}
+	sort.Slice(ops, func(i, j int) bool { return ops[i].Op < ops[j].Op })
+	return ops
+}
+
+// percentile picks the nearest-rank percentile of sorted durations.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(p*float64(len(sorted))+0.5) - 1
+	return sorted[min(max(i, 0), len(sorted)-1)]
+}
+
+func millis(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+func (a *App) metrics(msg AppMessage) AppMessage {
+	var metricsMsg MessageMetrics
+	if msg.Body != "" {
+		if err := json.Unmarshal([]byte(msg.Body), &metricsMsg); err != nil {
+			log.Printf("unmarshaling metrics message failure: %v", err)
+			return AppMessage{Type: msg.Type, Body: err.Error()}
+		}
+	}
+	bt, _ := json.Marshal(MetricsResponse{Operations: a.latency.summary(metricsMsg.Reset)})
+	return AppMessage{Type: msg.Type, Body: string(bt)}
+}
+
+// timedStorer measures every Storer call that touches the disk. Cheap state
+// getters, callbacks registration and the long-lived Subscribe go straight
+// to the wrapped Storer.
+type timedStorer struct {
+	Storer
+	latency *latencyRecorder
+}
+
+func (s timedStorer) Open(opts database.OpenOptions) error {
+	defer s.latency.since("open", time.Now())
+	return s.Storer.Open(opts)
+}
+
+func (s timedStorer) Set(key string, value []byte) error {
+	defer s.latency.since("set", time.Now())
+	return s.Storer.Set(key, value)
+}
+
+func (s timedStorer) Get(key string) ([]byte, error) {
+	defer s.latency.since("get", time.Now())
+	return s.Storer.Get(key)
+}
+
+func (s timedStorer) GetVersioned(key string) ([]byte, uint64, error) {
+	defer s.latency.since("get", time.Now())
+	return s.Storer.GetVersioned(key)
+}
+
+func (s timedStorer) SetChecked(key string, value []byte, expected uint64) (uint64, error) {
+	defer s.latency.since("set", time.Now())
+	return s.Storer.SetChecked(key, value, expected)
+}
+
+func (s timedStorer) DeleteChecked(key string, expected uint64) (uint64, error) {
+	defer s.latency.since("delete", time.Now())
+	return s.Storer.DeleteChecked(key, expected)
+}
+
+func (s timedStorer) Meta(key string) (database.KeyMeta, error) {
+	defer s.latency.since("meta", time.Now())
+	return s.Storer.Meta(key)
+}
+
+func (s timedStorer) ViewValue(key string, fn func(value []byte, version uint64) error) error {
+	defer s.latency.since("view_value", time.Now())
+	return s.Storer.ViewValue(key, fn)
+}
+
+func (s timedStorer) Delete(key string) error {
+	defer s.latency.since("delete", time.Now())
+	return s.Storer.Delete(key)
+}
+
+func (s timedStorer) DropPrefix(prefix string) error {
+	defer s.latency.since("drop_prefix", time.Now())
+	return s.Storer.DropPrefix(prefix)
+}
+
+func (s timedStorer) FlushBatch() (int, error) {
+	defer s.latency.since("flush_batch", time.Now())
+	return s.Storer.FlushBatch()
+}
+
+func (s timedStorer) Touch(keys []string, ttl time.Duration) ([]string, error) {
+	defer s.latency.since("touch", time.Now())
+	return s.Storer.Touch(keys, ttl)
+}
+
+func (s timedStorer) Duplicate(src, dst string, overwrite bool) error {
+	defer s.latency.since("duplicate", time.Now())
+	return s.Storer.Duplicate(src, dst, overwrite)
+}
+
+func (s timedStorer) SetMany(entries []database.Change, overwrite bool) ([]string, error) {
+	defer s.latency.since("set", time.Now())
+	return s.Storer.SetMany(entries, overwrite)
+}
+
+func (s timedStorer) Apply(changes []database.Change) error {
+	defer s.latency.since("set", time.Now())
+	return s.Storer.Apply(changes)
+}
+
+func (s timedStorer) Update(fn func(txn *database.Txn) error) error {
+	defer s.latency.since("set", time.Now())
+	return s.Storer.Update(fn)
+}
+
+func (s timedStorer) UpdateKey(key string, fn func(txn *database.Txn) error) (uint64, error) {
+	defer s.latency.since("set", time.Now())
+	return s.Storer.UpdateKey(key, fn)
+}
+
+func (s timedStorer) List(limit *int, startCursor *string) ([]string, string, error) {
+	defer s.latency.since("list", time.Now())
+	return s.Storer.List(limit, startCursor)
+}
+
+func (s timedStorer) Search(prefix string, limit *int, offset int) ([]string, error) {
+	defer s.latency.since("search", time.Now())
+	return s.Storer.Search(prefix, limit, offset)
+}
+
+func (s timedStorer) Count(prefix string) (int, error) {
+	defer s.latency.since("count", time.Now())
+	return s.Storer.Count(prefix)
+}
+
+func (s timedStorer) Scan(prefix string, fn func(key string, value []byte) error) error {
+	defer s.latency.since("scan", time.Now())
+	return s.Storer.Scan(prefix, fn)
+}
+
+func (s timedStorer) WalkKeys(prefix string, fn func(database.KeyMeta) error) error {
+	defer s.latency.since("walk_keys", time.Now())
+	return s.Storer.WalkKeys(prefix, fn)
+}
+
+func (s timedStorer) WalkKeysFrom(prefix, after string, fn func(database.KeyMeta) error) error {
+	defer s.latency.since("walk_keys", time.Now())
+	return s.Storer.WalkKeysFrom(prefix, after, fn)
+}
+
+func (s timedStorer) WalkAllKeys(prefix string, fn func(database.KeyMeta) error) error {
+	defer s.latency.since("walk_keys", time.Now())
+	return s.Storer.WalkAllKeys(prefix, fn)
+}
+
+func (s timedStorer) WarmUpFrom(prefix, after string, fn func(database.KeyMeta) error) error {
+	defer s.latency.since("warm_up", time.Now())
+	return s.Storer.WarmUpFrom(prefix, after, fn)
+}
+
+func (s timedStorer) ExpiredKeys(prefix string, purge bool) (database.ExpiredStats, error) {
+	defer s.latency.since("expired_keys", time.Now())
+	return s.Storer.ExpiredKeys(prefix, purge)
+}
+
+func (s timedStorer) Transform(prefix string, fn database.TransformFunc, dryRun bool, progress func(database.TransformStats)) (database.TransformStats, error) {
+	defer s.latency.since("transform", time.Now())
+	return s.Storer.Transform(prefix, fn, dryRun, progress)
+}
+
+func (s timedStorer) Backup(w io.Writer, opts database.BackupOptions) (uint64, error) {
+	defer s.latency.since("backup", time.Now())
+	return s.Storer.Backup(w, opts)
+}
+
+func (s timedStorer) Restore(r io.Reader, passphrase string) error {
+	defer s.latency.since("restore", time.Now())
+	return s.Storer.Restore(r, passphrase)
+}
+
+func (s timedStorer) OpenBackup(r io.Reader, passphrase string, opts database.OpenOptions) error {
+	defer s.latency.since("open_backup", time.Now())
+	return s.Storer.OpenBackup(r, passphrase, opts)
+}
+
+func (s timedStorer) Versions(key string) ([]database.Version, error) {
+	defer s.latency.since("versions", time.Now())
+	return s.Storer.Versions(key)
+}
+
+func (s timedStorer) Info() (database.Info, error) {
+	defer s.latency.since("info", time.Now())
+	return s.Storer.Info()
+}
+
+func (s timedStorer) SampleStats(fraction float64) (database.SampleStats, error) {
+	defer s.latency.since("sample_stats", time.Now())
+	return s.Storer.SampleStats(fraction)
+}
+
+func (s timedStorer) Namespaces(delimiter string, top int) ([]database.Namespace, database.Namespace, error) {
+	defer s.latency.since("namespaces", time.Now())
+	return s.Storer.Namespaces(delimiter, top)
+}
+
+func (s timedStorer) Treemap(prefix, delimiter string, depth, maxChildren int, fraction float64) (database.Treemap, error) {
+	defer s.latency.since("treemap", time.Now())
+	return s.Storer.Treemap(prefix, delimiter, depth, maxChildren, fraction)
+}
+
+func (s timedStorer) CompressionByNamespace(delimiter string) ([]database.CompressionStat, database.CompressionStat, error) {
+	defer s.latency.since("compression", time.Now())
+	return s.Storer.CompressionByNamespace(delimiter)
+}
+
+func (s timedStorer) VlogFiles() ([]database.VlogFile, error) {
+	defer s.latency.since("vlog_files", time.Now())
+	return s.Storer.VlogFiles()
+}
+
+func (s timedStorer) RunGC(discardRatio float64) (bool, error) {
+	defer s.latency.since("gc", time.Now())
+	return s.Storer.RunGC(discardRatio)
+}
+
+func (s timedStorer) Levels() ([]database.Level, error) {
+	defer s.latency.since("levels", time.Now())
+	return s.Storer.Levels()
+}
+
+func (s timedStorer) Flatten() error {
+	defer s.latency.since("flatten", time.Now())
+	return s.Storer.Flatten()
+}
+
+func (s timedStorer) Close() {
+	defer s.latency.since("close", time.Now())
+	s.Storer.Close()
+}
@@ -0,0 +1,345 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/filinvadim/badger-gui/database"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+	"gopkg.in/yaml.v3"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	opRenamePrefix = "rename_prefix"
+	opReencode     = "reencode"
+	opDrop         = "drop"
+
+	encodingRaw    = "raw"
+	encodingBase64 = "base64"
+	encodingHex    = "hex"
+	encodingJSON   = "json"
+
+	conflictFail      = "fail"
+	conflictSkip      = "skip"
+	conflictOverwrite = "overwrite"
+)
+
+// Migration is an ordered list of steps read from a JSON or YAML file.
+type Migration struct {
+	Name  string          `json:"name" yaml:"name"`
+	Steps []MigrationStep `json:"steps" yaml:"steps"`
+}
+
+type MigrationStep struct {
+	// Op is one of rename_prefix, reencode, drop
+	Op     string `json:"op" yaml:"op"`
+	Prefix string `json:"prefix" yaml:"prefix"`
+	// Match optionally narrows the step to keys matching the regexp
+	Match string `json:"match" yaml:"match"`
+	// To is the new prefix for rename_prefix and the target encoding for reencode
+	To string `json:"to" yaml:"to"`
+	// From is the current value encoding for reencode
+	From string `json:"from" yaml:"from"`
+	// Keep copies the keys for rename_prefix instead of moving them
+	Keep bool `json:"keep" yaml:"keep"`
+	// OnConflict decides what rename_prefix does about keys whose new key
+	// already exists: fail, the default, stops before writing anything, skip
+	// leaves them where they are and overwrite replaces the existing keys
+	OnConflict string `json:"on_conflict" yaml:"on_conflict"`
+}
+
+type MessageMigrate struct {
+	Path   string `json:"path"`
+	DryRun bool   `json:"dry_run"`
+	// ReportPath defaults to the migration file with a .report.json suffix
+	ReportPath string `json:"report_path"`
+}
+
+type MigrationReport struct {
+	Name       string                  `json:"name"`
+	File       string                  `json:"file"`
+	DryRun     bool                    `json:"dry_run"`
+	StartedAt  time.Time               `json:"started_at"`
+	FinishedAt time.Time               `json:"finished_at"`
+	Steps      []StepReport            `json:"steps"`
+	Error      string                  `json:"error,omitempty"`
+	ReportPath string                  `json:"report_path"`
+	Total      database.TransformStats `json:"total"`
+}
+
+type StepReport struct {
+	Index int                     `json:"index"`
+	Step  MigrationStep           `json:"step"`
+	Stats database.TransformStats `json:"stats"`
+	// Collisions are found before a rename_prefix step runs
+	Collisions *RenameCollisionsResponse `json:"collisions,omitempty"`
+	Error      string                    `json:"error,omitempty"`
+}
+
+type MigrationProgressEvent struct {
+	Name  string                  `json:"name"`
+	Index int                     `json:"index"`
+	Steps int                     `json:"steps"`
+	Op    string                  `json:"op"`
+	Stats database.TransformStats `json:"stats"`
+}
+
+func (a *App) migrate(msg AppMessage) AppMessage {
+	if !a.db.IsRunning() {
+		log.Printf("db not running for migrate operation")
+		return AppMessage{Type: msg.Type, Body: NotRunningResponse}
+	}
+	var migrateMsg MessageMigrate
+	if err := json.Unmarshal([]byte(msg.Body), &migrateMsg); err != nil {
+		log.Printf("unmarshaling migrate message failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+	// every step reads what the previous one wrote, which a changeset can't
+	// hold back
+	if !migrateMsg.DryRun && a.isStaging() {
+		log.Printf("migration rejected: staging is on")
+		return AppMessage{Type: msg.Type, Body: "migrations can't be staged, turn staging off to run them"}
+	}
+
+	migration, err := loadMigration(migrateMsg.Path)
+	if err != nil {
+		log.Printf("loading migration failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+	transforms := make([]database.TransformFunc, len(migration.Steps))
+	for i, step := range migration.Steps {
+		if transforms[i], err = step.transform(nil); err != nil {
+			log.Printf("migration step %d invalid: %v", i+1, err)
+			return AppMessage{Type: msg.Type, Body: fmt.Sprintf("step %d: %v", i+1, err)}
+		}
+	}
+
+	report := MigrationReport{
+		Name:       migration.Name,
+		File:       migrateMsg.Path,
+		DryRun:     migrateMsg.DryRun,
+		StartedAt:  time.Now(),
+		ReportPath: migrateMsg.ReportPath,
+	}
+	if report.ReportPath == "" {
+		report.ReportPath = strings.TrimSuffix(migrateMsg.Path, filepath.Ext(migrateMsg.Path)) + ".report.json"
+	}
+
+	for i, step := range migration.Steps {
+		progress := func(stats database.TransformStats) {
+			runtime.EventsEmit(a.ctx, EventMigrationProgress, MigrationProgressEvent{
+				Name: migration.Name, Index: i + 1, Steps: len(migration.Steps), Op: step.Op, Stats: stats,
+			})
+		}
+		stepReport := StepReport{Index: i + 1, Step: step}
+		var stats database.TransformStats
+		if step.Op == opRenamePrefix {
+			stepReport.Collisions, transforms[i], err = a.checkRename(step)
+		}
+		if err == nil {
+			stats, err = a.db.Transform(step.Prefix, transforms[i], migrateMsg.DryRun, progress)
+			progress(stats)
+		}
+
+		stepReport.Stats = stats
+		report.Total.Scanned += stats.Scanned
+		report.Total.Changed += stats.Changed
+		report.Total.Renamed += stats.Renamed
+		report.Total.Copied += stats.Copied
+		report.Total.Deleted += stats.Deleted
+		report.Total.Rewrites += stats.Rewrites
+		if err != nil {
+			stepReport.Error = err.Error()
+			report.Error = fmt.Sprintf("step %d: %v", i+1, err)
+		}
+		report.Steps = append(report.Steps, stepReport)
+		if err != nil {
+			break
+		}
+	}
+	report.FinishedAt = time.Now()
+
+	bt, _ := json.MarshalIndent(report, "", "  ")
+	if err := os.WriteFile(database.LongPath(report.ReportPath), bt, 0600); err != nil {
+		log.Printf("writing migration report failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+	log.Printf(
+		"migration %s finished, dry run [%t], changed %d keys, report %s",
+		migration.Name, migrateMsg.DryRun, report.Total.Changed, report.ReportPath,
+	)
+	return AppMessage{Type: msg.Type, Body: string(bt)}
+}
+
+func loadMigration(path string) (migration Migration, err error) {
+	bt, err := os.ReadFile(database.LongPath(path))
+	if err != nil {
+		return migration, err
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(bt, &migration)
+	default:
+		err = json.Unmarshal(bt, &migration)
+	}
+	if err != nil {
+		return migration, err
+	}
+	if len(migration.Steps) == 0 {
+		return migration, errors.New("migration has no steps")
+	}
+	if migration.Name == "" {
+		migration.Name = filepath.Base(path)
+	}
+	return migration, nil
+}
+
+// checkRename looks for the collisions of a rename_prefix step right before
+// it runs, returning the step's transform skipping them when it's set to.
+func (a *App) checkRename(step MigrationStep) (*RenameCollisionsResponse, database.TransformFunc, error) {
+	collisions, err := findRenameCollisions(a.db, step, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	var source *RenameCollision
+	skip := make(map[string]struct{}, len(collisions.Collisions))
+	for i, c := range collisions.Collisions {
+		skip[c.Key] = struct{}{}
+		if c.Kind == CollisionSource && source == nil {
+			source = &collisions.Collisions[i]
+		}
+	}
+	collisions.Collisions = collisions.Collisions[:min(len(collisions.Collisions), defaultCollisionsLimit)]
+	if source != nil && step.OnConflict == conflictOverwrite {
+		// what a source target ends up holding depends on the order the
+		// keys are renamed in, a renamed value could be overwritten too
+		return &collisions, nil, fmt.Errorf("%s would be renamed onto %s, which is renamed itself, overwrite can't be used",
+			source.Key, source.Target)
+	}
+	if collisions.Total > 0 && (step.OnConflict == "" || step.OnConflict == conflictFail) {
+		return &collisions, nil, fmt.Errorf("%d keys would collide, first %s into %s",
+			collisions.Total, collisions.Collisions[0].Key, collisions.Collisions[0].Target)
+	}
+	if step.OnConflict != conflictSkip {
+		skip = nil
+	}
+	transform, err := step.transform(skip)
+	return &collisions, transform, err
+}
+
+// transform returns the change of the step for every key, skip lists keys a
+// rename_prefix leaves alone.
+func (s MigrationStep) transform(skip map[string]struct{}) (database.TransformFunc, error) {
+	var match *regexp.Regexp
+	if s.Match != "" {
+		var err error
+		if match, err = regexp.Compile(s.Match); err != nil {
+			return nil, err
+		}
+	}
+	matches := func(key string) bool {
+		return match == nil || match.MatchString(key)
+	}
+
+	switch s.Op {
+	case opRenamePrefix:
+		if s.Prefix == "" {
+			return nil, errors.New("rename_prefix needs a prefix")
+		}
+		switch s.OnConflict {
+		case "", conflictFail, conflictSkip, conflictOverwrite:
+		default:
+			return nil, fmt.Errorf("on_conflict is %s, %s or %s", conflictFail, conflictSkip, conflictOverwrite)
+		}
+		return func(key string, value []byte) (*database.Change, error) {
+			if !matches(key) {
+				return nil, nil
+			}
+			if _, ok := skip[key]; ok {
+				return nil, nil
+			}
+			return &database.Change{Key: s.To + strings.TrimPrefix(key, s.Prefix), Value: value, Keep: s.Keep}, nil
+		}, nil
+	case opReencode:
+		if !isEncoding(s.From) || !isEncoding(s.To) {
+			return nil, fmt.Errorf("reencode supports %s, %s, %s and %s",
+				encodingRaw, encodingBase64, encodingHex, encodingJSON)
+		}
+		return func(key string, value []byte) (*database.Change, error) {
+			if !matches(key) {
+				return nil, nil
+			}
+			decoded, err := decodeValue(s.From, value)
+			if err != nil {
+				return nil, fmt.Errorf("decoding %s: %w", key, err)
+			}
+			encoded, err := encodeValue(s.To, decoded)
+			if err != nil {
+				return nil, fmt.Errorf("encoding %s: %w", key, err)
+			}
+			if bytes.Equal(encoded, value) {
+				return nil, nil
+			}
+			return &database.Change{Key: key, Value: encoded}, nil
+		}, nil
+	case opDrop:
+		if s.Prefix == "" && s.Match == "" {
+			return nil, errors.New("drop needs a prefix or a match")
+		}
+		return func(key string, _ []byte) (*database.Change, error) {
+			if !matches(key) {
+				return nil, nil
+			}
+			return &database.Change{Key: key, Delete: true}, nil
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown op %q", s.Op)
+	}
+}
+
+func isEncoding(encoding string) bool {
+	switch encoding {
+	case encodingRaw, encodingBase64, encodingHex, encodingJSON:
+		return true
+	}
+	return false
+}
+
+func decodeValue(encoding string, value []byte) ([]byte, error) {
+	switch encoding {
+	case encodingBase64:
+		return base64.StdEncoding.DecodeString(string(value))
+	case encodingHex:
+		return hex.DecodeString(string(value))
+	case encodingJSON:
+		if !json.Valid(value) {
+			return nil, errors.New("invalid json")
+		}
+	}
+	return value, nil
+}
+
+func encodeValue(encoding string, value []byte) ([]byte, error) {
+	switch encoding {
+	case encodingBase64:
+		return []byte(base64.StdEncoding.EncodeToString(value)), nil
+	case encodingHex:
+		return []byte(hex.EncodeToString(value)), nil
+	case encodingJSON:
+		var buf bytes.Buffer
+		if err := json.Compact(&buf, value); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+	return value, nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/filinvadim/badger-gui/database"
+	"log"
+)
+
+const namespacesTop = 50
+
+type MessageNamespaces struct {
+	// Delimiter defaults to the one the database was opened with
+	Delimiter string `json:"delimiter"`
+}
+
+// NamespacesResponse holds parallel series ready to feed a bar chart.
+type NamespacesResponse struct {
+	Labels []string `json:"labels"`
+	// Aliases are the user's labels of the namespaces, empty when unlabeled
+	Aliases    []string           `json:"aliases"`
+	Keys       []int64            `json:"keys"`
+	Bytes      []int64            `json:"bytes"`
+	Other      database.Namespace `json:"other"`
+	TotalKeys  int64              `json:"total_keys"`
+	TotalBytes int64              `json:"total_bytes"`
+}
+
+func (a *App) namespaces(msg AppMessage) AppMessage {
+	if !a.db.IsRunning() {
+		log.Printf("db not running for namespaces operation")
+		return AppMessage{Type: msg.Type, Body: NotRunningResponse}
+	}
+	var nsMsg MessageNamespaces
+	if msg.Body != "" {
+		if err := json.Unmarshal([]byte(msg.Body), &nsMsg); err != nil {
+			log.Printf("unmarshaling namespaces message failure: %v", err)
+			return AppMessage{Type: msg.Type, Body: err.Error()}
+		}
+	}
+	if nsMsg.Delimiter == "" {
+		nsMsg.Delimiter = a.delimiter()
+	}
+
+	namespaces, other, err := a.db.Namespaces(nsMsg.Delimiter, namespacesTop)
+	if err != nil {
+		log.Printf("grouping namespaces failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+
+	other.Name = "other"
+	resp := NamespacesResponse{
+		Labels: []string{}, Aliases: []string{}, Keys: []int64{}, Bytes: []int64{},
+		Other: other, TotalKeys: other.Keys, TotalBytes: other.Bytes,
+	}
+	labels := a.labels()
+	for _, ns := range namespaces {
+		alias, ok := labels[ns.Name+nsMsg.Delimiter]
+		if !ok {
+			alias = labels[ns.Name]
+		}
+		resp.Labels = append(resp.Labels, ns.Name)
+		resp.Aliases = append(resp.Aliases, alias)
+		resp.Keys = append(resp.Keys, ns.Keys)
+		resp.Bytes = append(resp.Bytes, ns.Bytes)
+		resp.TotalKeys += ns.Keys
+		resp.TotalBytes += ns.Bytes
+	}
+	log.Printf("grouped %d keys into %d namespaces", resp.TotalKeys, len(namespaces))
+	bt, _ := json.Marshal(resp)
+	return AppMessage{Type: msg.Type, Body: string(bt)}
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/filinvadim/badger-gui/database"
+	"log"
+	"sort"
+	"strings"
+)
+
+const (
+	pasteAuto = "auto"
+	pasteTSV  = "tsv"
+	pasteJSON = "json"
+
+	maxPasteRows = 100_000
+)
+
+type MessagePaste struct {
+	// Text is the pasted text, key<TAB>value lines or a JSON array of
+	// {"key": ..., "value": ...} objects or [key, value] pairs
+	Text string `json:"text"`
+	// Format is tsv, json or auto, the default, which takes text starting
+	// with [ as JSON
+	Format string `json:"format"`
+	// Header skips the first line of TSV
+	Header bool `json:"header"`
+	// Overwrite replaces existing keys, they are reported otherwise
+	Overwrite bool `json:"overwrite"`
+	// DryRun only parses and checks the rows
+	DryRun bool `json:"dry_run"`
+	// AcceptLowSpace writes even though the disk may not fit the rows
+	AcceptLowSpace bool `json:"accept_low_space"`
+}
+
+type PasteError struct {
+	// Line is the TSV line or the JSON array element, from 1
+	Line  int    `json:"line"`
+	Key   string `json:"key,omitempty"`
+	Error string `json:"error"`
+}
+
+type PasteResponse struct {
+	Rows    int `json:"rows"`
+	Written int `json:"written"`
+	// Staged counts the rows added to the changeset while staging is on
+	Staged int          `json:"staged"`
+	Errors []PasteError `json:"errors"`
+}
+
+// pasteRow is a parsed row and where it came from.
+type pasteRow struct {
+	line  int
+	key   string
+	value []byte
+}
+
+// paste writes rows pasted from a spreadsheet or a JSON array as one batch.
+// Rows that don't parse or whose key exists are reported by line and the
+// rest are written.
+func (a *App) paste(msg AppMessage) AppMessage {
+	if !a.db.IsRunning() {
+		log.Printf("db not running for paste operation")
+		return AppMessage{Type: msg.Type, Body: NotRunningResponse}
+	}
+	var pasteMsg MessagePaste
+	if err := json.Unmarshal([]byte(msg.Body), &pasteMsg); err != nil {
+		log.Printf("unmarshaling paste message failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+	if pasteMsg.Overwrite && a.isWriteProtected(TypeDelete) {
+		log.Printf("overwriting pasted keys rejected: write password required")
+		return AppMessage{Type: msg.Type, Body: WriteProtectedResponse}
+	}
+	format := pasteMsg.Format
+	if format == "" || format == pasteAuto {
+		format = pasteTSV
+		if strings.HasPrefix(strings.TrimSpace(pasteMsg.Text), "[") {
+			format = pasteJSON
+		}
+	}
+
+	var (
+		rows []pasteRow
+		errs []PasteError
+		err  error
+	)
+	switch format {
+	case pasteTSV:
+		rows, errs = parsePasteTSV(pasteMsg.Text, pasteMsg.Header)
+	case pasteJSON:
+		rows, errs, err = parsePasteJSON(pasteMsg.Text)
+	default:
+		err = fmt.Errorf("unknown paste format %q", pasteMsg.Format)
+	}
+	if err != nil {
+		log.Printf("parsing paste failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+	if len(rows)+len(errs) > maxPasteRows {
+		return AppMessage{Type: msg.Type, Body: fmt.Sprintf("paste has more than %d rows", maxPasteRows)}
+	}
+
+	// a key pasted twice keeps its first row
+	entries := make([]database.Change, 0, len(rows))
+	lines := make(map[string]int, len(rows))
+	schemas := a.schemas()
+	for _, row := range rows {
+		if first, ok := lines[row.key]; ok {
+			errs = append(errs, PasteError{Line: row.line, Key: row.key, Error: fmt.Sprintf("key already pasted on line %d", first)})
+			continue
+		}
+		lines[row.key] = row.line
+		if _, violations := schemas.validate(row.key, row.value); len(violations) > 0 {
+			errs = append(errs, PasteError{Line: row.line, Key: row.key, Error: violationsError(violations).Error()})
+			continue
+		}
+		entries = append(entries, database.Change{Key: row.key, Value: row.value})
+	}
+
+	resp := PasteResponse{Rows: len(rows)}
+	if !pasteMsg.DryRun && len(entries) > 0 {
+		var size int64
+		for _, e := range entries {
+			size += int64(len(e.Key) + len(e.Value))
+		}
+		if held, ok := a.guardSpace(msg.Type, database.SpaceImport, size, pasteMsg.AcceptLowSpace); !ok {
+			return held
+		}
+		existing, staged, err := a.stageMany(entries, pasteMsg.Overwrite)
+		if !staged {
+			existing, err = a.db.SetMany(entries, pasteMsg.Overwrite)
+		}
+		if err != nil {
+			log.Printf("writing pasted keys failure: %v", err)
+			return AppMessage{Type: msg.Type, Body: err.Error()}
+		}
+		for _, key := range existing {
+			errs = append(errs, PasteError{Line: lines[key], Key: key, Error: database.ErrKeyExists.Error()})
+		}
+		if staged {
+			resp.Staged = len(entries) - len(existing)
+		} else {
+			resp.Written = len(entries) - len(existing)
+		}
+	}
+	resp.Errors = sortPasteErrors(errs)
+
+	log.Printf("pasted %d rows, %d written, %d staged, %d errors", resp.Rows, resp.Written, resp.Staged, len(resp.Errors))
+	bt, _ := json.Marshal(resp)
+	return AppMessage{Type: msg.Type, Body: string(bt)}
+}
+
+// parsePasteTSV splits every non-empty line at its first tab, the value
+// keeping any further tabs.
+func parsePasteTSV(text string, header bool) (rows []pasteRow, errs []PasteError) {
+	for i, line := range strings.Split(text, "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		if (header && i == 0) || strings.TrimSpace(line) == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "\t")
+		switch {
+		case !ok:
+			errs = append(errs, PasteError{Line: i + 1, Error: "no tab between key and value"})
+		case key == "":
+			errs = append(errs, PasteError{Line: i + 1, Error: "empty key"})
+		default:
+			rows = append(rows, pasteRow{line: i + 1, key: key, value: []byte(value)})
+		}
+	}
+	return rows, errs
+}
+
+// parsePasteJSON reads an array of objects or pairs. String values are
+// written as they are, any other JSON value as its encoding.
+func parsePasteJSON(text string) (rows []pasteRow, errs []PasteError, err error) {
+	var elems []json.RawMessage
+	if err := json.Unmarshal([]byte(text), &elems); err != nil {
+		return nil, nil, err
+	}
+	for i, elem := range elems {
+		var (
+			key   string
+			value json.RawMessage
+		)
+		var obj struct {
+			Key   *string         `json:"key"`
+			Value json.RawMessage `json:"value"`
+		}
+		var pair []json.RawMessage
+		switch {
+		case json.Unmarshal(elem, &obj) == nil && obj.Key != nil:
+			key, value = *obj.Key, obj.Value
+		case json.Unmarshal(elem, &pair) == nil && len(pair) == 2 && json.Unmarshal(pair[0], &key) == nil:
+			value = pair[1]
+		default:
+			errs = append(errs, PasteError{Line: i + 1, Error: `expected {"key": ..., "value": ...} or [key, value]`})
+			continue
+		}
+		if key == "" {
+			errs = append(errs, PasteError{Line: i + 1, Error: "empty key"})
+			continue
+		}
+		rows = append(rows, pasteRow{line: i + 1, key: key, value: pasteValue(value)})
+	}
+	return rows, errs, nil
+}
+
+// pasteValue unquotes a JSON string, null or a missing value is empty.
+func pasteValue(raw json.RawMessage) []byte {
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil || len(raw) == 0 {
+		return []byte(s)
+	}
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, raw); err != nil {
+		return raw
+	}
+	return buf.Bytes()
+}
+
+func sortPasteErrors(errs []PasteError) []PasteError {
+	if errs == nil {
+		return []PasteError{}
+	}
+	sort.SliceStable(errs, func(i, j int) bool { return errs[i].Line < errs[j].Line })
+	return errs
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+const (
+	decoderRaw      = "raw"
+	decoderProtobuf = "protobuf"
+	decoderJSON     = "json"
+	decoderText     = "text"
+	decoderHex      = "hex"
+	decoderBase64   = "base64"
+)
+
+// Preset describes where a well-known application keeps its badger store and
+// how its keys are laid out.
+type Preset struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	// Paths are candidate locations relative to the home directory, resolved
+	// to absolute paths in responses
+	Paths     []string `json:"paths"`
+	Delimiter string   `json:"delimiter"`
+	// Decoder hints how values should be rendered
+	Decoder  string `json:"decoder"`
+	Managed  bool   `json:"managed"`
+	ReadOnly bool   `json:"read_only"`
+
+	// Path is the first existing candidate, or the first one when none exists
+	Path   string `json:"path"`
+	Exists bool   `json:"exists"`
+}
+
+type PresetsResponse struct {
+	Presets []Preset `json:"presets"`
+}
+
+var presetRegistry = []Preset{
+	{
+		ID: "kubo", Name: "Kubo (IPFS) badgerds",
+		Description: "IPFS repository using the badger datastore",
+		Paths:       []string{".ipfs/badgerds"},
+		Delimiter:   "/", Decoder: decoderRaw, ReadOnly: true,
+	},
+	{
+		ID: "ipfs-cluster", Name: "IPFS Cluster",
+		Description: "IPFS Cluster peer state in badger",
+		Paths:       []string{".ipfs-cluster/badger"},
+		Delimiter:   "/", Decoder: decoderRaw, ReadOnly: true,
+	},
+	{
+		ID: "dgraph-p", Name: "Dgraph postings (p)",
+		Description: "Dgraph Alpha postings directory, opened in managed mode",
+		Paths:       []string{"dgraph/p", "p"},
+		Decoder:     decoderProtobuf, Managed: true, ReadOnly: true,
+	},
+	{
+		ID: "dgraph-w", Name: "Dgraph write-ahead log (w)",
+		Description: "Dgraph Alpha write-ahead directory, opened in managed mode",
+		Paths:       []string{"dgraph/w", "w"},
+		Decoder:     decoderProtobuf, Managed: true, ReadOnly: true,
+	},
+	{
+		ID: "jaeger", Name: "Jaeger badger storage",
+		Description: "Jaeger spans stored with the badger backend, keys directory",
+		Paths:       []string{"jaeger/badger/keys", "data/keys"},
+		Decoder:     decoderProtobuf, ReadOnly: true,
+	},
+	{
+		ID: "lotus", Name: "Lotus chain datastore",
+		Description: "Filecoin Lotus node chain blockstore",
+		Paths:       []string{".lotus/datastore/chain"},
+		Delimiter:   "/", Decoder: decoderRaw, ReadOnly: true,
+	},
+}
+
+// presets resolves every preset's candidate paths against the home directory.
+func (a *App) presets(msg AppMessage) AppMessage {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		log.Printf("getting home directory failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+
+	presets := make([]Preset, 0, len(presetRegistry))
+	for _, preset := range presetRegistry {
+		paths := make([]string, 0, len(preset.Paths))
+		for _, p := range preset.Paths {
+			paths = append(paths, filepath.Join(home, filepath.FromSlash(p)))
+		}
+		preset.Paths = paths
+		preset.Path = paths[0]
+		for _, p := range paths {
+			if info, err := os.Stat(p); err == nil && info.IsDir() {
+				preset.Path, preset.Exists = p, true
+				break
+			}
+		}
+		presets = append(presets, preset)
+	}
+	bt, _ := json.Marshal(PresetsResponse{Presets: presets})
+	return AppMessage{Type: msg.Type, Body: string(bt)}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"github.com/filinvadim/badger-gui/database"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// maxPreviewBytes caps the bytes of each value a list preview reads
+	maxPreviewBytes = 1024
+	// previewHexBytes is how many bytes of a binary value are shown in hex
+	previewHexBytes = 32
+
+	previewJSON   = "json"
+	previewText   = "text"
+	previewBinary = "binary"
+)
+
+// ValuePreview is the head of a value shown next to its key in list and
+// search results, enough to tell keys apart without opening them.
+type ValuePreview struct {
+	// Type is json, text, binary or the mime type of images and media
+	Type string `json:"type"`
+	// Text is a one-line rendering of the value's first bytes, hex for
+	// binary values
+	Text string `json:"text"`
+	Size int64  `json:"size"`
+	// Truncated is set when Text shows only part of the value
+	Truncated bool `json:"truncated,omitempty"`
+	// Missing is set when the key was deleted since it was listed
+	Missing bool   `json:"missing,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// previews reads the first n bytes of the values of keys, in the same order.
+func (a *App) previews(keys []string, n int) []ValuePreview {
+	n = min(n, maxPreviewBytes)
+	previews := make([]ValuePreview, len(keys))
+	for i, key := range keys {
+		err := a.db.ViewValue(key, func(value []byte, _ uint64) error {
+			previews[i] = previewValue(value, n)
+			return nil
+		})
+		switch {
+		case errors.Is(err, database.ErrKeyNotFound):
+			previews[i].Missing = true
+		case err != nil:
+			previews[i].Error = err.Error()
+		}
+	}
+	return previews
+}
+
+// previewValue detects the type of value and renders its first n bytes.
+func previewValue(value []byte, n int) ValuePreview {
+	p := ValuePreview{Size: int64(len(value)), Truncated: len(value) > n}
+	head := value[:min(len(value), n)]
+	// media are only named, parsing them takes more than the head
+	switch mime := http.DetectContentType(head); {
+	case strings.HasPrefix(mime, "image/"), strings.HasPrefix(mime, "audio/"), strings.HasPrefix(mime, "video/"),
+		mime == "application/pdf", mime == "application/ogg":
+		p.Type, p.Text, p.Truncated = mime, "["+mime+"]", false
+		return p
+	}
+
+	// a cut may split a rune, what's left of it is dropped
+	text := head
+	if p.Truncated {
+		for i := 0; i < utf8.UTFMax && len(text) > 0 && !utf8.Valid(text); i++ {
+			text = text[:len(text)-1]
+		}
+	}
+	if !utf8.Valid(text) || bytes.IndexByte(text, 0) >= 0 {
+		p.Type = previewBinary
+		p.Text = hex.EncodeToString(head[:min(len(head), previewHexBytes)])
+		p.Truncated = len(value) > previewHexBytes
+		return p
+	}
+	p.Type = previewText
+	if trimmed := bytes.TrimSpace(text); len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[') &&
+		(p.Truncated || json.Valid(value)) {
+		p.Type = previewJSON
+	}
+	// one line: runs of whitespace, newlines included, become a space
+	p.Text = strings.Join(strings.Fields(string(text)), " ")
+	return p
+}
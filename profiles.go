@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/filinvadim/badger-gui/config"
+	"github.com/filinvadim/badger-gui/database"
+	"log"
+	"time"
+)
+
+type MessageSaveProfile struct {
+	config.Profile
+	// Delete removes the profile of Path instead of saving it
+	Delete bool `json:"delete"`
+}
+
+// applyProfile fills the options left unset in the open message from the
+// saved profile. Read-only is sticky, a profile can't be overridden into
+// writable mode without disabling it with no_profile.
+func applyProfile(openMsg MessageOpen, p config.Profile) MessageOpen {
+	if openMsg.Delimiter == "" {
+		openMsg.Delimiter = p.Delimiter
+	}
+	if openMsg.Compression == "" {
+		openMsg.Compression = p.Compression
+	}
+	if openMsg.ValueDir == "" {
+		openMsg.ValueDir = p.ValueDir
+	}
+	if openMsg.BlockCacheMB == 0 {
+		openMsg.BlockCacheMB = p.BlockCacheMB
+	}
+	if openMsg.IndexCacheMB == 0 {
+		openMsg.IndexCacheMB = p.IndexCacheMB
+	}
+	if openMsg.PageSize == 0 {
+		openMsg.PageSize = p.PageSize
+	}
+	if openMsg.PrefetchSize == 0 {
+		openMsg.PrefetchSize = p.PrefetchSize
+	}
+	if openMsg.NumCompactors == 0 {
+		openMsg.NumCompactors = p.NumCompactors
+	}
+	if openMsg.GC == nil {
+		openMsg.GC = p.GC
+	}
+	openMsg.ReadOnly = openMsg.ReadOnly || p.ReadOnly
+	return openMsg
+}
+
+func gcPolicy(p *config.GCPolicy) *database.GCPolicy {
+	if p == nil {
+		return nil
+	}
+	return &database.GCPolicy{
+		DiscardRatio: p.DiscardRatio,
+		Interval:     time.Duration(p.IntervalMinutes) * time.Minute,
+		OnlyWhenIdle: p.OnlyWhenIdle,
+	}
+}
+
+// saveProfile stores the profile of a database path, the open database when
+// no path is given.
+func (a *App) saveProfile(msg AppMessage) AppMessage {
+	var profileMsg MessageSaveProfile
+	if err := json.Unmarshal([]byte(msg.Body), &profileMsg); err != nil {
+		log.Printf("unmarshaling save profile message failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+	if profileMsg.Path == "" {
+		a.mx.Lock()
+		if a.lastOpen != nil {
+			profileMsg.Path = a.lastOpen.Path
+		}
+		a.mx.Unlock()
+	}
+	if profileMsg.Path == "" {
+		log.Printf("saving profile failure: %s", NoProfileResponse)
+		return AppMessage{Type: msg.Type, Body: NoProfileResponse}
+	}
+
+	var err error
+	if profileMsg.Delete {
+		err = a.settings.DeleteProfile(profileMsg.Path)
+	} else {
+		err = a.settings.SaveProfile(profileMsg.Profile)
+	}
+	if err != nil {
+		log.Printf("saving profile failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+	log.Printf("profile of %s saved, deleted [%t]", profileMsg.Path, profileMsg.Delete)
+	return AppMessage{Type: msg.Type, Body: OkStatus}
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/filinvadim/badger-gui/config"
+	"github.com/filinvadim/badger-gui/database"
+	"github.com/filinvadim/badger-gui/s3"
+	"io"
+	"log"
+	"os"
+	"time"
+)
+
+type MessageS3Credentials struct {
+	AccessKeyID     string `json:"access_key_id"`
+	SecretAccessKey string `json:"secret_access_key"`
+}
+
+type MessageBackupS3 struct {
+	Key        string `json:"key"`
+	Compress   bool   `json:"compress"`
+	Passphrase string `json:"passphrase"`
+}
+
+type MessageRestoreS3 struct {
+	Key        string `json:"key"`
+	Passphrase string `json:"passphrase"`
+	// AcceptLowSpace restores even though the disk may not fit the backup
+	AcceptLowSpace bool `json:"accept_low_space"`
+}
+
+type BackupS3Response struct {
+	Status  string `json:"status"`
+	Key     string `json:"key"`
+	Version uint64 `json:"version"`
+}
+
+type ListS3Response struct {
+	Objects []s3.Object `json:"objects"`
+}
+
+func (a *App) setS3Credentials(msg AppMessage) AppMessage {
+	var credsMsg MessageS3Credentials
+	if err := json.Unmarshal([]byte(msg.Body), &credsMsg); err != nil {
+		log.Printf("unmarshaling s3 credentials message failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+	if err := config.SetSecret(config.KeyS3AccessKeyID, credsMsg.AccessKeyID); err != nil {
+		log.Printf("storing s3 access key failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+	if err := config.SetSecret(config.KeyS3SecretAccessKey, credsMsg.SecretAccessKey); err != nil {
+		log.Printf("storing s3 secret key failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+	log.Println("s3 credentials stored in keychain")
+	return AppMessage{Type: msg.Type, Body: OkStatus}
+}
+
+func (a *App) backupS3(msg AppMessage) AppMessage {
+	if !a.db.IsRunning() {
+		log.Printf("db not running for s3 backup operation")
+		return AppMessage{Type: msg.Type, Body: NotRunningResponse}
+	}
+	var backupMsg MessageBackupS3
+	if err := json.Unmarshal([]byte(msg.Body), &backupMsg); err != nil {
+		log.Printf("unmarshaling s3 backup message failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+	client, err := a.s3Client()
+	if err != nil {
+		log.Printf("s3 client failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+
+	key := backupMsg.Key
+	if key == "" {
+		key = fmt.Sprintf("badger-%s.bak", time.Now().UTC().Format("20060102T150405Z"))
+	}
+	key = a.settings.Get().S3.Prefix + key
+
+	// the object size must be known upfront, so the backup is staged locally
+	tmp, err := os.CreateTemp("", "badger-gui-*.bak")
+	if err != nil {
+		log.Printf("creating temp backup file failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	version, err := a.db.Backup(tmp, database.BackupOptions{
+		Compress:   backupMsg.Compress,
+		Passphrase: backupMsg.Passphrase,
+	})
+	if err != nil {
+		log.Printf("backup failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+	size, err := tmp.Seek(0, io.SeekCurrent)
+	if err == nil {
+		_, err = tmp.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		log.Printf("rewinding temp backup file failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+	if err := client.Put(key, tmp, size); err != nil {
+		log.Printf("uploading backup failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+	log.Printf("backup uploaded to s3 as %s, %d bytes", key, size)
+	bt, _ := json.Marshal(BackupS3Response{Status: OkStatus, Key: key, Version: version})
+	return AppMessage{Type: msg.Type, Body: string(bt)}
+}
+
+func (a *App) restoreS3(msg AppMessage) AppMessage {
+	if !a.db.IsRunning() {
+		log.Printf("db not running for s3 restore operation")
+		return AppMessage{Type: msg.Type, Body: NotRunningResponse}
+	}
+	var restoreMsg MessageRestoreS3
+	if err := json.Unmarshal([]byte(msg.Body), &restoreMsg); err != nil {
+		log.Printf("unmarshaling s3 restore message failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+	client, err := a.s3Client()
+	if err != nil {
+		log.Printf("s3 client failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+
+	// the size comes from the listing, an unlisted object counts as empty
+	objects, err := client.List(restoreMsg.Key)
+	if err != nil {
+		log.Printf("listing s3 backups failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+	var size int64
+	for _, obj := range objects {
+		if obj.Key == restoreMsg.Key {
+			size = obj.Size
+		}
+	}
+	if held, ok := a.guardSpace(msg.Type, database.SpaceRestore, size, restoreMsg.AcceptLowSpace); !ok {
+		return held
+	}
+
+	body, err := client.Get(restoreMsg.Key)
+	if err != nil {
+		log.Printf("downloading backup failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+	defer body.Close()
+
+	if err := a.db.Restore(body, restoreMsg.Passphrase); err != nil {
+		log.Printf("restore failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+	log.Printf("backup %s restored from s3", restoreMsg.Key)
+	return AppMessage{Type: msg.Type, Body: OkStatus}
+}
+
+func (a *App) listS3(msg AppMessage) AppMessage {
+	client, err := a.s3Client()
+	if err != nil {
+		log.Printf("s3 client failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+	objects, err := client.List(a.settings.Get().S3.Prefix)
+	if err != nil {
+		log.Printf("listing s3 backups failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+	bt, _ := json.Marshal(ListS3Response{Objects: objects})
+	return AppMessage{Type: msg.Type, Body: string(bt)}
+}
+
+func (a *App) s3Client() (*s3.Client, error) {
+	accessKeyID, err := config.GetSecret(config.KeyS3AccessKeyID)
+	if err != nil {
+		return nil, err
+	}
+	secretAccessKey, err := config.GetSecret(config.KeyS3SecretAccessKey)
+	if err != nil {
+		return nil, err
+	}
+	s3Settings := a.settings.Get().S3
+	return s3.New(s3.Config{
+		Endpoint:        s3Settings.Endpoint,
+		Region:          s3Settings.Region,
+		Bucket:          s3Settings.Bucket,
+		AccessKeyID:     accessKeyID,
+		SecretAccessKey: secretAccessKey,
+		UsePathStyle:    s3Settings.UsePathStyle,
+	})
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+	"log"
+	"strconv"
+	"strings"
+)
+
+const (
+	replHistorySize = 200
+	replScanLimit   = 20
+
+	replHelp = `commands:
+  get <key>
+  set <key> <value>
+  del <key>
+  scan [prefix] [limit]
+  count [prefix]
+  history
+  help`
+)
+
+type MessageRepl struct {
+	Command string `json:"command"`
+}
+
+type ReplResponse struct {
+	Command string   `json:"command"`
+	Output  []string `json:"output"`
+	Error   string   `json:"error,omitempty"`
+	History []string `json:"history"`
+}
+
+type ReplOutputEvent struct {
+	Command string `json:"command"`
+	Line    string `json:"line"`
+}
+
+// replSession collects the output of one command, emitting every line as it
+// is produced so long scans show up progressively in the console.
+type replSession struct {
+	app     *App
+	command string
+	output  []string
+}
+
+func (s *replSession) println(format string, args ...any) {
+	line := fmt.Sprintf(format, args...)
+	s.output = append(s.output, line)
+	runtime.EventsEmit(s.app.ctx, EventReplOutput, ReplOutputEvent{Command: s.command, Line: line})
+}
+
+func (a *App) repl(msg AppMessage) AppMessage {
+	var replMsg MessageRepl
+	if err := json.Unmarshal([]byte(msg.Body), &replMsg); err != nil {
+		log.Printf("unmarshaling repl message failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+
+	command := strings.TrimSpace(replMsg.Command)
+	session := &replSession{app: a, command: command}
+	var err error
+	if command != "" {
+		a.addReplHistory(command)
+		err = a.runReplCommand(session, command)
+	}
+
+	resp := ReplResponse{Command: command, Output: session.output, History: a.getReplHistory()}
+	if err != nil {
+		log.Printf("repl command failure: %v", err)
+		resp.Error = err.Error()
+	}
+	bt, _ := json.Marshal(resp)
+	return AppMessage{Type: msg.Type, Body: string(bt)}
+}
+
+func (a *App) runReplCommand(s *replSession, command string) error {
+	name, args, _ := strings.Cut(command, " ")
+	args = strings.TrimSpace(args)
+
+	switch strings.ToLower(name) {
+	case "help":
+		for _, line := range strings.Split(replHelp, "\n") {
+			s.println("%s", line)
+		}
+		return nil
+	case "history":
+		for i, line := range a.getReplHistory() {
+			s.println("%4d  %s", i+1, line)
+		}
+		return nil
+	}
+
+	if !a.db.IsRunning() {
+		return errors.New(NotRunningResponse)
+	}
+
+	switch strings.ToLower(name) {
+	case "get":
+		if args == "" {
+			return errors.New("usage: get <key>")
+		}
+		value, err := a.db.Get(a.virtualKey(args))
+		if err != nil {
+			return err
+		}
+		s.println("%s", replValue(value))
+	case "set":
+		key, value, ok := strings.Cut(args, " ")
+		if !ok || key == "" {
+			return errors.New("usage: set <key> <value>")
+		}
+		status, err := a.replWrite(TypeSet, MessageSet{Key: key, Value: value})
+		if err != nil {
+			return err
+		}
+		s.println("%s", status)
+	case "del":
+		if args == "" {
+			return errors.New("usage: del <key>")
+		}
+		status, err := a.replWrite(TypeDelete, MessageDelete{Key: args})
+		if err != nil {
+			return err
+		}
+		s.println("%s", status)
+	case "scan":
+		fields := strings.Fields(args)
+		prefix, limit := "", replScanLimit
+		if len(fields) > 0 {
+			prefix = fields[0]
+		}
+		if len(fields) > 1 {
+			n, err := strconv.Atoi(fields[1])
+			if err != nil || n <= 0 {
+				return errors.New("usage: scan [prefix] [limit]")
+			}
+			limit = n
+		}
+		keys, err := a.db.Search(a.scoped(prefix), &limit, 0)
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			value, err := a.db.Get(key)
+			shown := a.shownKey(key)
+			if err != nil {
+				s.println("%s => (%v)", shown, err)
+				continue
+			}
+			s.println("%s => %s", shown, replValue(value))
+		}
+		s.println("(%d keys)", len(keys))
+	case "count":
+		count, err := a.db.Count(a.scoped(args))
+		if err != nil {
+			return err
+		}
+		s.println("%d", count)
+	default:
+		return fmt.Errorf("unknown command %q, type help", name)
+	}
+	return nil
+}
+
+// replWrite sends a console write through Call, so it's checked, staged and
+// hooked like the same message from the frontend. It returns the status of
+// a successful write.
+func (a *App) replWrite(t messageType, body any) (string, error) {
+	bt, _ := json.Marshal(body)
+	resp := a.Call(AppMessage{Type: t, Body: string(bt)})
+	if resp.Body == OkStatus {
+		return OkStatus, nil
+	}
+	var status SchemaViolationResponse
+	if err := json.Unmarshal([]byte(resp.Body), &status); err != nil {
+		return "", errors.New(resp.Body)
+	}
+	switch status.Status {
+	case OkStatus, StagedStatus:
+		return status.Status, nil
+	case SchemaViolationStatus:
+		return "", violationsError(status.Violations)
+	}
+	return "", errors.New(resp.Body)
+}
+
+func replValue(value []byte) string {
+	if isImage(value) {
+		return "[image]"
+	}
+	if media := mediaInfo(value); media != nil {
+		return media.String()
+	}
+	return string(value)
+}
+
+func (a *App) addReplHistory(command string) {
+	a.mx.Lock()
+	defer a.mx.Unlock()
+	if n := len(a.replHistory); n > 0 && a.replHistory[n-1] == command {
+		return
+	}
+	a.replHistory = append(a.replHistory, command)
+	if len(a.replHistory) > replHistorySize {
+		a.replHistory = a.replHistory[len(a.replHistory)-replHistorySize:]
+	}
+}
+
+func (a *App) getReplHistory() []string {
+	a.mx.Lock()
+	defer a.mx.Unlock()
+	return append([]string(nil), a.replHistory...)
+}
@@ -0,0 +1,368 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/filinvadim/badger-gui/config"
+	"github.com/filinvadim/badger-gui/database"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	retentionCheckInterval = time.Minute
+	// retentionSample is how many of the deleted keys a report lists
+	retentionSample = 20
+	// retentionBatch is how many entries are deleted in one transaction
+	retentionBatch = 1000
+
+	EventRetention = "retention:run"
+)
+
+type MessageRetention struct {
+	// Rules replace the rules of the open database, without them the rules
+	// are only reported
+	Rules []config.RetentionRule `json:"rules"`
+}
+
+type RetentionResponse struct {
+	Rules []config.RetentionRule `json:"rules"`
+}
+
+type MessageRunRetention struct {
+	// Name runs a single rule, all of them when empty
+	Name   string `json:"name"`
+	DryRun bool   `json:"dry_run"`
+}
+
+// RetentionReport is the outcome of one rule, emitted as retention:run after
+// scheduled runs.
+type RetentionReport struct {
+	Rule    string `json:"rule"`
+	DryRun  bool   `json:"dry_run"`
+	Scanned int    `json:"scanned"`
+	// Deleted are the entries past the rule's age, the ones that would be
+	// deleted in a dry run
+	Deleted int `json:"deleted"`
+	// Unparsed counts the entries without a readable timestamp, they're kept
+	Unparsed   int      `json:"unparsed"`
+	Sample     []string `json:"sample"`
+	Error      string   `json:"error,omitempty"`
+	DurationMs int64    `json:"duration_ms"`
+}
+
+type RunRetentionResponse struct {
+	Reports []RetentionReport `json:"reports"`
+}
+
+// setRetention reports or replaces the retention rules of the open database.
+func (a *App) setRetention(msg AppMessage) AppMessage {
+	path := a.openPath()
+	if path == "" {
+		log.Printf("setting retention failure: %s", NoProfileResponse)
+		return AppMessage{Type: msg.Type, Body: NoProfileResponse}
+	}
+	var retentionMsg MessageRetention
+	if msg.Body != "" {
+		if err := json.Unmarshal([]byte(msg.Body), &retentionMsg); err != nil {
+			log.Printf("unmarshaling retention message failure: %v", err)
+			return AppMessage{Type: msg.Type, Body: err.Error()}
+		}
+	}
+	if retentionMsg.Rules != nil {
+		if err := validateRetention(retentionMsg.Rules); err != nil {
+			log.Printf("validating retention rules failure: %v", err)
+			return AppMessage{Type: msg.Type, Body: err.Error()}
+		}
+		if err := a.settings.SetRetention(path, retentionMsg.Rules); err != nil {
+			log.Printf("saving retention rules failure: %v", err)
+			return AppMessage{Type: msg.Type, Body: err.Error()}
+		}
+		log.Printf("%d retention rules saved", len(retentionMsg.Rules))
+	}
+	bt, _ := json.Marshal(RetentionResponse{Rules: a.retentionRules()})
+	return AppMessage{Type: msg.Type, Body: string(bt)}
+}
+
+func validateRetention(rules []config.RetentionRule) error {
+	names := make(map[string]struct{}, len(rules))
+	for i, rule := range rules {
+		switch {
+		case rule.Name == "":
+			return fmt.Errorf("rule %d has no name", i+1)
+		case rule.Prefix == "":
+			return fmt.Errorf("rule %s has no prefix", rule.Name)
+		case rule.MaxAgeDays <= 0:
+			return fmt.Errorf("rule %s needs a positive max_age_days", rule.Name)
+		case (rule.KeySegment > 0) == (rule.Field != ""):
+			return fmt.Errorf("rule %s needs either a key_segment or a field", rule.Name)
+		case rule.IntervalMinutes < 0:
+			return fmt.Errorf("rule %s has a negative interval", rule.Name)
+		}
+		if _, ok := names[rule.Name]; ok {
+			return fmt.Errorf("rule %s is defined twice", rule.Name)
+		}
+		names[rule.Name] = struct{}{}
+	}
+	return nil
+}
+
+// retentionRules returns the rules of the open database.
+func (a *App) retentionRules() []config.RetentionRule {
+	path := a.openPath()
+	if path == "" {
+		return []config.RetentionRule{}
+	}
+	profile, _ := a.settings.Get().Profile(path)
+	if profile.Retention == nil {
+		return []config.RetentionRule{}
+	}
+	return profile.Retention
+}
+
+func (a *App) runRetention(msg AppMessage) AppMessage {
+	if !a.db.IsRunning() {
+		log.Printf("db not running for retention operation")
+		return AppMessage{Type: msg.Type, Body: NotRunningResponse}
+	}
+	var runMsg MessageRunRetention
+	if msg.Body != "" {
+		if err := json.Unmarshal([]byte(msg.Body), &runMsg); err != nil {
+			log.Printf("unmarshaling run retention message failure: %v", err)
+			return AppMessage{Type: msg.Type, Body: err.Error()}
+		}
+	}
+
+	resp := RunRetentionResponse{Reports: []RetentionReport{}}
+	delimiter := a.delimiter()
+	for _, rule := range a.retentionRules() {
+		if runMsg.Name != "" && rule.Name != runMsg.Name {
+			continue
+		}
+		report := a.applyRetention(rule, delimiter, runMsg.DryRun)
+		resp.Reports = append(resp.Reports, report)
+	}
+	if runMsg.Name != "" && len(resp.Reports) == 0 {
+		return AppMessage{Type: msg.Type, Body: fmt.Sprintf("no retention rule %q", runMsg.Name)}
+	}
+	bt, _ := json.Marshal(resp)
+	return AppMessage{Type: msg.Type, Body: string(bt)}
+}
+
+// applyRetention deletes, or only counts in a dry run, the entries of a rule
+// older than its age. Each entry is read again in the transaction deleting
+// it, so one written since the scan is kept unless it's past the age too.
+func (a *App) applyRetention(rule config.RetentionRule, delimiter string, dryRun bool) RetentionReport {
+	start := time.Now()
+	cutoff := start.AddDate(0, 0, -rule.MaxAgeDays)
+	report := RetentionReport{Rule: rule.Name, DryRun: dryRun, Sample: []string{}}
+	expired := func(key string, value []byte) bool {
+		at, ok := retentionTime(rule, delimiter, key, value)
+		return ok && at.Before(cutoff)
+	}
+
+	var pending []string
+	flush := func() error {
+		if len(pending) == 0 {
+			return nil
+		}
+		var deleted int
+		err := a.db.Update(func(txn *database.Txn) error {
+			deleted = 0
+			for _, key := range pending {
+				value, _, err := txn.Get(key)
+				if errors.Is(err, database.ErrKeyNotFound) {
+					continue
+				}
+				if err != nil {
+					return err
+				}
+				if !expired(key, value) {
+					continue
+				}
+				if err := txn.Delete(key); err != nil {
+					return err
+				}
+				deleted++
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		report.Deleted += deleted
+		pending = pending[:0]
+		return nil
+	}
+
+	// the scan only picks the candidates, they're deleted in batches
+	stats, err := a.db.Transform(rule.Prefix, func(key string, value []byte) (*database.Change, error) {
+		at, ok := retentionTime(rule, delimiter, key, value)
+		if !ok {
+			report.Unparsed++
+			return nil, nil
+		}
+		if !at.Before(cutoff) {
+			return nil, nil
+		}
+		if len(report.Sample) < retentionSample {
+			report.Sample = append(report.Sample, key)
+		}
+		if dryRun {
+			report.Deleted++
+			return nil, nil
+		}
+		pending = append(pending, key)
+		if len(pending) >= retentionBatch {
+			return nil, flush()
+		}
+		return nil, nil
+	}, true, nil)
+	if err == nil && !dryRun {
+		err = flush()
+	}
+	report.Scanned = stats.Scanned
+	if err != nil {
+		report.Error = err.Error()
+	}
+	report.DurationMs = time.Since(start).Milliseconds()
+	log.Printf(
+		"retention rule %s, dry run [%t], deleted %d of %d entries, %d unparsed",
+		rule.Name, dryRun, report.Deleted, report.Scanned, report.Unparsed,
+	)
+	return report
+}
+
+// retentionTime reads the timestamp of an entry from its key or value.
+func retentionTime(rule config.RetentionRule, delimiter, key string, value []byte) (time.Time, bool) {
+	var raw string
+	if rule.KeySegment > 0 {
+		raw = keySegment(key, delimiter, rule.KeySegment)
+	} else {
+		dec := json.NewDecoder(bytes.NewReader(value))
+		dec.UseNumber()
+		var doc any
+		if err := dec.Decode(&doc); err != nil {
+			return time.Time{}, false
+		}
+		v, ok := jsonPath(doc, rule.Field)
+		if !ok {
+			return time.Time{}, false
+		}
+		switch v := v.(type) {
+		case string:
+			raw = v
+		case json.Number:
+			raw = v.String()
+		default:
+			return time.Time{}, false
+		}
+	}
+	return parseTimestamp(raw, rule.Layout)
+}
+
+// Layouts reading the timestamp as a Unix time in the given unit. Numbers are
+// only read as times with one of them, a bare ID or counter would otherwise
+// pass for a date in 1970.
+const (
+	layoutUnix      = "unix"
+	layoutUnixMilli = "unix_ms"
+	layoutUnixMicro = "unix_us"
+	layoutUnixNano  = "unix_ns"
+)
+
+// parseTimestamp parses raw with layout, one of the Unix layouts or a Go time
+// layout, or RFC 3339 without one.
+func parseTimestamp(raw, layout string) (time.Time, bool) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return time.Time{}, false
+	}
+	switch layout {
+	case "":
+		t, err := time.Parse(time.RFC3339Nano, raw)
+		return t, err == nil
+	case layoutUnix:
+		if n, err := strconv.ParseInt(raw, 10, 64); err == nil {
+			return time.Unix(n, 0), true
+		}
+		f, err := strconv.ParseFloat(raw, 64)
+		return time.UnixMilli(int64(f * 1000)), err == nil
+	case layoutUnixMilli, layoutUnixMicro, layoutUnixNano:
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return time.Time{}, false
+		}
+		switch layout {
+		case layoutUnixMilli:
+			return time.UnixMilli(n), true
+		case layoutUnixMicro:
+			return time.UnixMicro(n), true
+		}
+		return time.Unix(0, n), true
+	}
+	t, err := time.Parse(layout, raw)
+	return t, err == nil
+}
+
+// watchRetention runs the scheduled retention rules of the open database.
+// A rule first runs one interval after the database was opened or the rule
+// was scheduled, and is skipped in safe mode and on read-only databases.
+func (a *App) watchRetention() {
+	defer a.reportCrash(crashSourceWatchRetention)
+	ticker := time.NewTicker(retentionCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-a.done:
+			return
+		case <-ticker.C:
+		}
+		if !a.db.IsRunning() {
+			continue
+		}
+		path := a.openPath()
+		if path == "" || a.db.IsReadOnly() || a.isWriteLocked(TypeRunRetention) {
+			continue
+		}
+
+		now := time.Now()
+		delimiter := a.delimiter()
+		for _, rule := range a.retentionRules() {
+			if rule.IntervalMinutes <= 0 {
+				continue
+			}
+			id := path + "\x00" + rule.Name
+			a.mx.Lock()
+			if a.retentionRuns == nil {
+				a.retentionRuns = make(map[string]time.Time)
+			}
+			last, ok := a.retentionRuns[id]
+			due := ok && now.Sub(last) >= time.Duration(rule.IntervalMinutes)*time.Minute
+			if !ok || due {
+				a.retentionRuns[id] = now
+			}
+			a.mx.Unlock()
+			if !due {
+				continue
+			}
+
+			report := a.applyRetention(rule, delimiter, false)
+			result := activityOk
+			if report.Error != "" {
+				result = report.Error
+			}
+			a.activity.add(ActivityEntry{
+				Time: now, Source: SourceRetention, Type: string(TypeRunRetention), Key: rule.Prefix,
+				DurationMs: float64(report.DurationMs), Result: result,
+			})
+			runtime.EventsEmit(a.ctx, EventRetention, report)
+		}
+	}
+}
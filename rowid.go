@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/filinvadim/badger-gui/database"
+	"log"
+)
+
+type DeleteIDsResponse struct {
+	Status  string `json:"status"`
+	Deleted int    `json:"deleted"`
+	Staged  int    `json:"staged"`
+}
+
+// rowID is the opaque ID of a listed row: the raw key bytes in unpadded
+// URL-safe base64. Keys go out as JSON strings, which replace bytes that
+// aren't valid UTF-8, so a binary key listed as a string can't be sent back;
+// its ID can. IDs don't depend on the page, so a selection survives
+// pagination.
+func rowID(key string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(key))
+}
+
+func rowIDs(keys []string) []string {
+	ids := make([]string, len(keys))
+	for i, key := range keys {
+		ids[i] = rowID(key)
+	}
+	return ids
+}
+
+// keysOf decodes row IDs into their keys.
+func keysOf(ids []string) ([]string, error) {
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		key, err := base64.RawURLEncoding.DecodeString(id)
+		if err != nil {
+			return nil, fmt.Errorf("invalid row id %q", id)
+		}
+		keys[i] = string(key)
+	}
+	return keys, nil
+}
+
+// deleteIDs deletes the keys of a selection in one transaction, or stages
+// the deletes while staging is on. Write hooks run as for single deletes.
+func (a *App) deleteIDs(t messageType, ids []string) AppMessage {
+	keys, err := a.rowKeys(ids)
+	if err != nil {
+		log.Printf("decoding row ids failure: %v", err)
+		return AppMessage{Type: t, Body: err.Error()}
+	}
+
+	resp := DeleteIDsResponse{Status: OkStatus}
+	var (
+		deletes = make([]string, 0, len(keys))
+		hooks   = make(map[string]writeHooks, len(keys))
+	)
+	for _, key := range keys {
+		if staged, ok := a.stage(t, key, nil, 0); ok {
+			var write WriteResponse
+			if json.Unmarshal([]byte(staged.Body), &write) != nil || write.Status != StagedStatus {
+				return staged
+			}
+			resp.Staged++
+			continue
+		}
+		a.ownWrite(key, nil)
+		hooks[key] = a.writeHooks(key)
+		deletes = append(deletes, key)
+	}
+	if len(deletes) > 0 {
+		err := a.db.Update(func(txn *database.Txn) error {
+			for _, key := range deletes {
+				var prev []byte
+				if len(hooks[key]) > 0 {
+					value, _, err := txn.Get(key)
+					if err != nil && !errors.Is(err, database.ErrKeyNotFound) {
+						return err
+					}
+					prev = value
+				}
+				if err := txn.Delete(key); err != nil {
+					return err
+				}
+				if err := hooks[key].applyHooks(txn, key, prev, nil); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			log.Printf("deleting selected keys failure: %v", err)
+			return AppMessage{Type: t, Body: err.Error()}
+		}
+	}
+	resp.Deleted = len(deletes)
+	log.Printf("%d selected keys deleted, %d staged", resp.Deleted, resp.Staged)
+
+	bt, _ := json.Marshal(resp)
+	return AppMessage{Type: t, Body: string(bt)}
+}
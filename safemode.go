@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+)
+
+// mutatingTypes are the message types rejected while safe mode is on.
+var mutatingTypes = map[messageType]struct{}{
+	TypeSet:            {},
+	TypeDelete:         {},
+	TypeRestore:        {},
+	TypeRestoreS3:      {},
+	TypeMigrate:        {},
+	TypeTouch:          {},
+	TypeDuplicate:      {},
+	TypeDropPrefix:     {},
+	TypeGenerate:       {},
+	TypePaste:          {},
+	TypeRunRetention:   {},
+	TypeCommitStaged:   {},
+	TypeRevert:         {},
+	TypeFlushWrites:    {},
+	TypeImportSettings: {},
+}
+
+type MessageSafeMode struct {
+	Enabled bool `json:"enabled"`
+	// Confirm must be set to leave safe mode
+	Confirm bool `json:"confirm"`
+}
+
+type SafeModeResponse struct {
+	Enabled bool `json:"enabled"`
+	// Discarded is how many batched writes entering safe mode dropped
+	Discarded int `json:"discarded,omitempty"`
+}
+
+func (a *App) isWriteLocked(t messageType) bool {
+	if !a.safeMode.Load() {
+		return false
+	}
+	_, ok := mutatingTypes[t]
+	return ok
+}
+
+func (a *App) setSafeMode(msg AppMessage) AppMessage {
+	var safeModeMsg MessageSafeMode
+	if err := json.Unmarshal([]byte(msg.Body), &safeModeMsg); err != nil {
+		log.Printf("unmarshaling safe mode message failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+	if !safeModeMsg.Enabled && a.safeMode.Load() && !safeModeMsg.Confirm {
+		log.Printf("leaving safe mode requires confirmation")
+		return AppMessage{Type: msg.Type, Body: ConfirmationRequiredResponse}
+	}
+	a.safeMode.Store(safeModeMsg.Enabled)
+	resp := SafeModeResponse{Enabled: safeModeMsg.Enabled}
+	if safeModeMsg.Enabled {
+		// writes still buffered would otherwise land with the next flush,
+		// periodic or on close, past the lock
+		resp.Discarded = a.db.DiscardBatch()
+		a.pauseImports()
+	}
+	log.Printf("safe mode enabled [%t], %d batched writes discarded", resp.Enabled, resp.Discarded)
+	bt, _ := json.Marshal(resp)
+	return AppMessage{Type: msg.Type, Body: string(bt)}
+}
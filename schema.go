@@ -0,0 +1,426 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// SchemaViolationStatus is the status of a write rejected by the JSON Schema
+// of its prefix.
+const SchemaViolationStatus = "schema_violation"
+
+// maxSchemaViolations caps the violations reported for one value.
+const maxSchemaViolations = 20
+
+type MessageSchema struct {
+	Prefix string `json:"prefix"`
+	// Schema is the JSON Schema values under the prefix must match, empty
+	// or null removes it. $ref isn't supported.
+	Schema json.RawMessage `json:"schema"`
+}
+
+type SchemasResponse struct {
+	Schemas map[string]json.RawMessage `json:"schemas"`
+}
+
+type SchemaViolation struct {
+	// Path is the JSON pointer of the offending value, empty for the root
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+// SchemaViolationResponse rejects a write whose value doesn't match the
+// schema of its prefix.
+type SchemaViolationResponse struct {
+	Status     string            `json:"status"`
+	Key        string            `json:"key"`
+	Prefix     string            `json:"prefix"`
+	Violations []SchemaViolation `json:"violations"`
+}
+
+// setSchema attaches a JSON Schema to a prefix of the open database, kept in
+// its profile, so values written under it are validated.
+func (a *App) setSchema(msg AppMessage) AppMessage {
+	var schemaMsg MessageSchema
+	if err := json.Unmarshal([]byte(msg.Body), &schemaMsg); err != nil {
+		log.Printf("unmarshaling schema message failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+	path := a.openPath()
+	if path == "" {
+		log.Printf("setting schema failure: %s", NoProfileResponse)
+		return AppMessage{Type: msg.Type, Body: NoProfileResponse}
+	}
+	if string(schemaMsg.Schema) == "null" {
+		schemaMsg.Schema = nil
+	}
+	if len(schemaMsg.Schema) > 0 {
+		var schema any
+		if err := json.Unmarshal(schemaMsg.Schema, &schema); err != nil {
+			log.Printf("parsing schema failure: %v", err)
+			return AppMessage{Type: msg.Type, Body: err.Error()}
+		}
+		if err := checkSchema(schema, ""); err != nil {
+			log.Printf("checking schema failure: %v", err)
+			return AppMessage{Type: msg.Type, Body: err.Error()}
+		}
+	}
+	schemas, err := a.settings.SetSchema(path, schemaMsg.Prefix, schemaMsg.Schema)
+	if err != nil {
+		log.Printf("setting schema failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+	log.Printf("schema of prefix [%s] set, %d schemas", logKey(schemaMsg.Prefix), len(schemas))
+	bt, _ := json.Marshal(SchemasResponse{Schemas: schemas})
+	return AppMessage{Type: msg.Type, Body: string(bt)}
+}
+
+// prefixSchemas are the parsed schemas of the open database, by prefix.
+type prefixSchemas map[string]any
+
+func (a *App) schemas() prefixSchemas {
+	path := a.openPath()
+	if path == "" {
+		return nil
+	}
+	profile, _ := a.settings.Get().Profile(path)
+	schemas := make(prefixSchemas, len(profile.Schemas))
+	for prefix, raw := range profile.Schemas {
+		var schema any
+		if err := json.Unmarshal(raw, &schema); err != nil {
+			log.Printf("parsing schema of prefix [%s] failure: %v", logKey(prefix), err)
+			continue
+		}
+		schemas[prefix] = schema
+	}
+	return schemas
+}
+
+// validate checks value against the schema of the longest prefix of key
+// that has one. It returns that prefix and the violations, none when the
+// value matches or no schema applies.
+func (s prefixSchemas) validate(key string, value []byte) (string, []SchemaViolation) {
+	var (
+		prefix string
+		schema any
+		found  bool
+	)
+	for p, sch := range s {
+		if strings.HasPrefix(key, p) && (!found || len(p) > len(prefix)) {
+			prefix, schema, found = p, sch, true
+		}
+	}
+	if !found {
+		return "", nil
+	}
+	var doc any
+	if err := json.Unmarshal(value, &doc); err != nil {
+		return prefix, []SchemaViolation{{Message: "value is not JSON: " + err.Error()}}
+	}
+	var violations []SchemaViolation
+	validateSchema(schema, doc, "", &violations)
+	if len(violations) > maxSchemaViolations {
+		violations = violations[:maxSchemaViolations]
+	}
+	return prefix, violations
+}
+
+// schemaViolation answers a write rejected by a schema.
+func schemaViolation(t messageType, key, prefix string, violations []SchemaViolation) AppMessage {
+	log.Printf("%s of key %s rejected: %d schema violations", t, logKey(key), len(violations))
+	bt, _ := json.Marshal(SchemaViolationResponse{
+		Status: SchemaViolationStatus, Key: key, Prefix: prefix, Violations: violations,
+	})
+	return AppMessage{Type: t, Body: string(bt)}
+}
+
+// violationsError joins violations into one error, for the console.
+func violationsError(violations []SchemaViolation) error {
+	msgs := make([]string, 0, len(violations))
+	for _, v := range violations {
+		msgs = append(msgs, violationText(v))
+	}
+	return errors.New(strings.Join(msgs, "; "))
+}
+
+func violationText(v SchemaViolation) string {
+	if v.Path == "" {
+		return v.Message
+	}
+	return v.Path + ": " + v.Message
+}
+
+// checkSchema rejects schemas using keywords this validator would get wrong
+// and patterns that don't compile.
+func checkSchema(schema any, path string) error {
+	switch s := schema.(type) {
+	case bool:
+		return nil
+	case map[string]any:
+		if _, ok := s["$ref"]; ok {
+			return fmt.Errorf("%s/$ref is not supported", path)
+		}
+		if p, ok := s["pattern"].(string); ok {
+			if _, err := regexp.Compile(p); err != nil {
+				return fmt.Errorf("%s/pattern: %w", path, err)
+			}
+		}
+		for _, kw := range []string{"items", "additionalProperties", "not"} {
+			if sub, ok := s[kw]; ok {
+				if err := checkSchema(sub, path+"/"+kw); err != nil {
+					return err
+				}
+			}
+		}
+		if props, ok := s["properties"].(map[string]any); ok {
+			for name, sub := range props {
+				if err := checkSchema(sub, path+"/properties/"+name); err != nil {
+					return err
+				}
+			}
+		}
+		for _, kw := range []string{"allOf", "anyOf", "oneOf"} {
+			subs, _ := s[kw].([]any)
+			for i, sub := range subs {
+				if err := checkSchema(sub, path+"/"+kw+"/"+strconv.Itoa(i)); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("schema at %q is not an object or a boolean", path)
+	}
+}
+
+// validateSchema appends the violations of doc against schema, a subset of
+// JSON Schema: type, enum, const, the number, string, array and object
+// bounds, properties, required, additionalProperties, items, pattern and the
+// allOf, anyOf, oneOf and not combinations.
+func validateSchema(schema, doc any, path string, violations *[]SchemaViolation) {
+	fail := func(format string, args ...any) {
+		*violations = append(*violations, SchemaViolation{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+	s, ok := schema.(map[string]any)
+	if !ok {
+		if b, isBool := schema.(bool); isBool && !b {
+			fail("no value is allowed")
+		}
+		return
+	}
+
+	if t, ok := s["type"]; ok && !matchesType(t, doc) {
+		fail("expected %s, got %s", typeNames(t), jsonType(doc))
+		return
+	}
+	if enum, ok := s["enum"].([]any); ok {
+		found := false
+		for _, e := range enum {
+			if reflect.DeepEqual(e, doc) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			fail("must be one of %s", compactJSON(enum))
+		}
+	}
+	if c, ok := s["const"]; ok && !reflect.DeepEqual(c, doc) {
+		fail("must be %s", compactJSON(c))
+	}
+
+	switch v := doc.(type) {
+	case float64:
+		if n, ok := s["minimum"].(float64); ok && v < n {
+			fail("must be at least %v", n)
+		}
+		if n, ok := s["maximum"].(float64); ok && v > n {
+			fail("must be at most %v", n)
+		}
+		if n, ok := s["exclusiveMinimum"].(float64); ok && v <= n {
+			fail("must be greater than %v", n)
+		}
+		if n, ok := s["exclusiveMaximum"].(float64); ok && v >= n {
+			fail("must be less than %v", n)
+		}
+		if n, ok := s["multipleOf"].(float64); ok && n > 0 {
+			if q := v / n; math.Abs(q-math.Round(q)) > 1e-9 {
+				fail("must be a multiple of %v", n)
+			}
+		}
+	case string:
+		length := float64(utf8.RuneCountInString(v))
+		if n, ok := s["minLength"].(float64); ok && length < n {
+			fail("must be at least %v characters", n)
+		}
+		if n, ok := s["maxLength"].(float64); ok && length > n {
+			fail("must be at most %v characters", n)
+		}
+		if p, ok := s["pattern"].(string); ok {
+			if re, err := regexp.Compile(p); err == nil && !re.MatchString(v) {
+				fail("must match %s", p)
+			}
+		}
+	case []any:
+		if n, ok := s["minItems"].(float64); ok && float64(len(v)) < n {
+			fail("must have at least %v items", n)
+		}
+		if n, ok := s["maxItems"].(float64); ok && float64(len(v)) > n {
+			fail("must have at most %v items", n)
+		}
+		if unique, _ := s["uniqueItems"].(bool); unique {
+			for i := range v {
+				for j := i + 1; j < len(v); j++ {
+					if reflect.DeepEqual(v[i], v[j]) {
+						fail("items %d and %d are equal", i, j)
+					}
+				}
+			}
+		}
+		if items, ok := s["items"]; ok {
+			for i, item := range v {
+				validateSchema(items, item, path+"/"+strconv.Itoa(i), violations)
+			}
+		}
+	case map[string]any:
+		if n, ok := s["minProperties"].(float64); ok && float64(len(v)) < n {
+			fail("must have at least %v properties", n)
+		}
+		if n, ok := s["maxProperties"].(float64); ok && float64(len(v)) > n {
+			fail("must have at most %v properties", n)
+		}
+		if required, ok := s["required"].([]any); ok {
+			for _, r := range required {
+				if name, ok := r.(string); ok {
+					if _, present := v[name]; !present {
+						fail("missing required property %q", name)
+					}
+				}
+			}
+		}
+		props, _ := s["properties"].(map[string]any)
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			sub := path + "/" + pointerEscape(name)
+			if propSchema, ok := props[name]; ok {
+				validateSchema(propSchema, v[name], sub, violations)
+				continue
+			}
+			if additional, ok := s["additionalProperties"]; ok {
+				if allowed, isBool := additional.(bool); isBool && !allowed {
+					*violations = append(*violations, SchemaViolation{Path: sub, Message: "property is not allowed"})
+					continue
+				}
+				validateSchema(additional, v[name], sub, violations)
+			}
+		}
+	}
+
+	if all, ok := s["allOf"].([]any); ok {
+		for _, sub := range all {
+			validateSchema(sub, doc, path, violations)
+		}
+	}
+	if anyOf, ok := s["anyOf"].([]any); ok && countMatches(anyOf, doc) == 0 {
+		fail("must match at least one schema of anyOf")
+	}
+	if oneOf, ok := s["oneOf"].([]any); ok {
+		if n := countMatches(oneOf, doc); n != 1 {
+			fail("must match exactly one schema of oneOf, matches %d", n)
+		}
+	}
+	if not, ok := s["not"]; ok && countMatches([]any{not}, doc) == 1 {
+		fail("must not match the schema of not")
+	}
+}
+
+func countMatches(schemas []any, doc any) int {
+	n := 0
+	for _, sub := range schemas {
+		var violations []SchemaViolation
+		validateSchema(sub, doc, "", &violations)
+		if len(violations) == 0 {
+			n++
+		}
+	}
+	return n
+}
+
+func matchesType(t, doc any) bool {
+	switch t := t.(type) {
+	case string:
+		return isType(t, doc)
+	case []any:
+		for _, name := range t {
+			if name, ok := name.(string); ok && isType(name, doc) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func isType(name string, doc any) bool {
+	switch name {
+	case "integer":
+		f, ok := doc.(float64)
+		return ok && f == math.Trunc(f)
+	case "number":
+		_, ok := doc.(float64)
+		return ok
+	default:
+		return jsonType(doc) == name
+	}
+}
+
+func jsonType(doc any) string {
+	switch doc.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	default:
+		return "object"
+	}
+}
+
+func typeNames(t any) string {
+	if names, ok := t.([]any); ok {
+		s := make([]string, 0, len(names))
+		for _, name := range names {
+			s = append(s, fmt.Sprint(name))
+		}
+		return strings.Join(s, " or ")
+	}
+	return fmt.Sprint(t)
+}
+
+func compactJSON(v any) string {
+	bt, _ := json.Marshal(v)
+	return string(bt)
+}
+
+// pointerEscape escapes a property name for a JSON pointer.
+func pointerEscape(name string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(name)
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/filinvadim/badger-gui/database"
+	"log"
+	"strings"
+)
+
+type MessageScope struct {
+	// Prefix pins the working prefix, empty clears it
+	Prefix string `json:"prefix"`
+}
+
+type ScopeResponse struct {
+	Prefix string `json:"prefix"`
+}
+
+// setScope pins a working prefix for the connection. Listing, searching,
+// counting, exports, jobs and the analysis messages stay under it until it's
+// cleared or another database is opened. An empty body reports the scope.
+func (a *App) setScope(msg AppMessage) AppMessage {
+	if msg.Body != "" {
+		var scopeMsg MessageScope
+		if err := json.Unmarshal([]byte(msg.Body), &scopeMsg); err != nil {
+			log.Printf("unmarshaling scope message failure: %v", err)
+			return AppMessage{Type: msg.Type, Body: err.Error()}
+		}
+		a.mx.Lock()
+		// a scope of its own leaves the virtual database
+		a.scope, a.virtual = scopeMsg.Prefix, ""
+		a.mx.Unlock()
+		log.Printf("scope set to [%s]", logKey(scopeMsg.Prefix))
+	}
+	a.mx.Lock()
+	bt, _ := json.Marshal(ScopeResponse{Prefix: a.scope})
+	a.mx.Unlock()
+	return AppMessage{Type: msg.Type, Body: string(bt)}
+}
+
+// scoped narrows prefix to the working prefix. Prefixes within the scope are
+// kept, ones the scope starts with become the scope and anything else is
+// taken as relative to it. In a virtual database every prefix is relative to
+// its own.
+func (a *App) scoped(prefix string) string {
+	a.mx.Lock()
+	scope, virtual := a.scope, a.virtual
+	a.mx.Unlock()
+	switch {
+	case virtual != "":
+		return scope + prefix
+	case scope == "", strings.HasPrefix(prefix, scope):
+		return prefix
+	case strings.HasPrefix(scope, prefix):
+		return scope
+	}
+	return scope + prefix
+}
+
+// scopedParams applies the scope to the prefix of job params, the other
+// fields are left as they are.
+func (a *App) scopedParams(params json.RawMessage) (json.RawMessage, error) {
+	fields := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(params, &fields); err != nil {
+		return nil, err
+	}
+	var prefix string
+	if raw, ok := fields["prefix"]; ok {
+		if err := json.Unmarshal(raw, &prefix); err != nil {
+			return nil, err
+		}
+	}
+	fields["prefix"], _ = json.Marshal(a.scoped(prefix))
+	return json.Marshal(fields)
+}
+
+// listScoped pages through the keys of the scope the way List pages through
+// all of them, a page holding the connection's page size without a limit. An
+// "end" cursor marks the last page.
+func (a *App) listScoped(limit *int, cursor *string) ([]string, string, error) {
+	var after string
+	if cursor != nil {
+		after = *cursor
+	}
+	size := a.db.PageSize()
+	if limit != nil {
+		size = *limit
+	}
+	keys := []string{}
+	err := a.db.WalkKeysFrom(a.scoped(""), after, func(meta database.KeyMeta) error {
+		keys = append(keys, meta.Key)
+		if len(keys) >= size {
+			return errPageFull
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errPageFull) {
+		return nil, "", err
+	}
+	last := ""
+	if len(keys) > 0 {
+		last = keys[len(keys)-1]
+	}
+	if len(keys) < size {
+		last = "end"
+	}
+	return keys, last, nil
+}
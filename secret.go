@@ -0,0 +1,37 @@
+package main
+
+import (
+	"encoding/json"
+)
+
+const redacted = "[redacted]"
+
+// Secret holds sensitive input such as encryption keys as bytes so it can be
+// wiped after use. It is never marshaled back out nor printed.
+type Secret []byte
+
+func (s *Secret) UnmarshalJSON(data []byte) error {
+	var str string
+	if err := json.Unmarshal(data, &str); err != nil {
+		return err
+	}
+	*s = Secret(str)
+	return nil
+}
+
+func (s Secret) MarshalJSON() ([]byte, error) {
+	return []byte(`""`), nil
+}
+
+func (s Secret) String() string {
+	return redacted
+}
+
+func (s Secret) GoString() string {
+	return redacted
+}
+
+// Wipe zeroes the secret in place.
+func (s Secret) Wipe() {
+	clear(s)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/filinvadim/badger-gui/config"
+	"github.com/filinvadim/badger-gui/database"
+	"log"
+	"os"
+)
+
+type MessageSettingsFile struct {
+	Path string `json:"path"`
+}
+
+func (a *App) getSettings(msg AppMessage) AppMessage {
+	settings := a.settings.Get()
+	settings.WritePasswordHash = ""
+	bt, _ := json.Marshal(settings)
+	return AppMessage{Type: msg.Type, Body: string(bt)}
+}
+
+func (a *App) saveSettings(msg AppMessage) AppMessage {
+	var settings config.Settings
+	if err := json.Unmarshal([]byte(msg.Body), &settings); err != nil {
+		log.Printf("unmarshaling settings message failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+	// the write password is only changed through its dedicated message
+	settings.WritePasswordHash = a.settings.Get().WritePasswordHash
+	if err := a.settings.Update(settings); err != nil {
+		log.Printf("saving settings failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+	a.startWatchers()
+	a.restartHTTPServer()
+	a.restartDebugServer()
+	a.restartAutomation()
+	setLogLevel(a.settings.Get().LogLevel())
+	log.Println("settings saved")
+	return AppMessage{Type: msg.Type, Body: OkStatus}
+}
+
+// exportSettings writes settings, bookmarks and saved queries to a single
+// file that can be imported on another machine.
+func (a *App) exportSettings(msg AppMessage) AppMessage {
+	var fileMsg MessageSettingsFile
+	if err := json.Unmarshal([]byte(msg.Body), &fileMsg); err != nil {
+		log.Printf("unmarshaling export settings message failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+	f, err := os.OpenFile(database.LongPath(fileMsg.Path), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		log.Printf("creating settings file failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+	err = a.settings.Export(f)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		log.Printf("exporting settings failure: %v", err)
+		_ = os.Remove(database.LongPath(fileMsg.Path))
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+	log.Printf("settings exported to %s", fileMsg.Path)
+	return AppMessage{Type: msg.Type, Body: OkStatus}
+}
+
+func (a *App) importSettings(msg AppMessage) AppMessage {
+	var fileMsg MessageSettingsFile
+	if err := json.Unmarshal([]byte(msg.Body), &fileMsg); err != nil {
+		log.Printf("unmarshaling import settings message failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+	f, err := os.Open(database.LongPath(fileMsg.Path))
+	if err != nil {
+		log.Printf("opening settings file failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+	defer f.Close()
+
+	if err := a.settings.Import(f); err != nil {
+		log.Printf("importing settings failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+	a.startWatchers()
+	a.restartHTTPServer()
+	a.restartDebugServer()
+	a.restartAutomation()
+	setLogLevel(a.settings.Get().LogLevel())
+	log.Printf("settings imported from %s", fileMsg.Path)
+	return a.getSettings(msg)
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+	"log"
+	"time"
+)
+
+const (
+	// shutdownTimeout bounds how long closing waits for jobs to reach a
+	// checkpoint and for calls to return before the database is closed
+	shutdownTimeout = 30 * time.Second
+	shutdownPoll    = 50 * time.Millisecond
+
+	dialogYes = "Yes"
+	dialogNo  = "No"
+)
+
+// beforeClose asks what to do with running jobs when the window is closed:
+// wait for them, which keeps the app open until they're done, cancel them, or
+// pause them at a checkpoint they resume from after a restart. Pausing is
+// also what happens when the dialog is dismissed.
+func (a *App) beforeClose(ctx context.Context) (prevent bool) {
+	if a.quitting.Load() {
+		return false
+	}
+	running := a.runningJobs()
+	if running == 0 {
+		return false
+	}
+
+	wait, err := runtime.MessageDialog(ctx, runtime.MessageDialogOptions{
+		Type:          runtime.QuestionDialog,
+		Title:         "Jobs are running",
+		Message:       fmt.Sprintf("%d jobs are still running. Wait for them to finish before quitting?", running),
+		Buttons:       []string{dialogYes, dialogNo},
+		DefaultButton: dialogYes,
+		CancelButton:  dialogNo,
+	})
+	if err != nil {
+		log.Printf("asking about running jobs failure: %v", err)
+	}
+	if wait == dialogYes {
+		a.quitting.Store(true)
+		log.Printf("quitting once %d jobs finish", running)
+		go func() {
+			a.waitIdle(0)
+			runtime.Quit(ctx)
+		}()
+		return true
+	}
+
+	cancel, err := runtime.MessageDialog(ctx, runtime.MessageDialogOptions{
+		Type:          runtime.QuestionDialog,
+		Title:         "Jobs are running",
+		Message:       "Cancel the jobs? Otherwise they're paused and can be resumed after a restart.",
+		Buttons:       []string{dialogYes, dialogNo},
+		DefaultButton: dialogNo,
+		CancelButton:  dialogNo,
+	})
+	if err != nil {
+		log.Printf("asking about running jobs failure: %v", err)
+	}
+	status := JobPaused
+	if cancel == dialogYes {
+		status = JobCanceled
+	}
+	a.stopJobs(status)
+	a.waitIdle(shutdownTimeout)
+	return false
+}
+
+// runningJobs counts the jobs walking keys.
+func (a *App) runningJobs() int {
+	a.mx.Lock()
+	defer a.mx.Unlock()
+	var n int
+	for _, job := range a.jobs {
+		if job.Status == JobRunning {
+			n++
+		}
+	}
+	return n
+}
+
+// stopJobs pauses or cancels every running job, they stop at the next key.
+func (a *App) stopJobs(status string) {
+	a.mx.Lock()
+	defer a.mx.Unlock()
+	for _, job := range a.jobs {
+		if job.Status != JobRunning {
+			continue
+		}
+		select {
+		case job.stop <- status:
+		default:
+			// a stop is already pending
+		}
+		log.Printf("job %s %s for shutdown", job.ID, status)
+	}
+}
+
+// waitIdle waits until no job runs and no call is being handled, giving up
+// after timeout unless it's zero. It reports whether everything settled.
+func (a *App) waitIdle(timeout time.Duration) bool {
+	var deadline time.Time
+	if timeout > 0 {
+		deadline = time.Now().Add(timeout)
+	}
+	for a.runningJobs() > 0 || a.inflight.Load() > 0 {
+		if !deadline.IsZero() && time.Now().After(deadline) {
+			log.Printf("shutdown gave up waiting: %d jobs running, %d calls in flight", a.runningJobs(), a.inflight.Load())
+			return false
+		}
+		time.Sleep(shutdownPoll)
+	}
+	return true
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/filinvadim/badger-gui/config"
+	"github.com/filinvadim/badger-gui/database"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	snapshotFormat = 1
+
+	// the entries of a snapshot file, a zip archive
+	snapshotManifestEntry = "manifest.json"
+	snapshotBackupEntry   = "backup"
+	snapshotDecoderEntry  = "decoder.json"
+)
+
+// SnapshotManifest describes a shared snapshot. It's checked before the
+// backup is loaded, the hash after.
+type SnapshotManifest struct {
+	Format    int       `json:"format"`
+	CreatedAt time.Time `json:"created_at"`
+	// Source is the base name of the database directory the snapshot was
+	// taken from, the full path stays on the sharer's machine
+	Source string `json:"source"`
+	// Version is the database's version the backup was taken at
+	Version   uint64 `json:"version"`
+	Size      int64  `json:"size"`
+	SHA256    string `json:"sha256"`
+	Encrypted bool   `json:"encrypted"`
+	// Decoder is set when the snapshot carries the display settings of the
+	// database
+	Decoder bool `json:"decoder"`
+}
+
+type MessageShareSnapshot struct {
+	Path string `json:"path"`
+	// IncludeDecoder adds the delimiter, decoder, labels, templates, schemas
+	// and key layouts of the database's profile, so it renders the same for
+	// the receiver
+	IncludeDecoder bool `json:"include_decoder"`
+	// Passphrase encrypts the backup inside the snapshot
+	Passphrase string `json:"passphrase"`
+}
+
+type ShareSnapshotResponse struct {
+	Status   string           `json:"status"`
+	Manifest SnapshotManifest `json:"manifest"`
+}
+
+type MessageOpenSnapshot struct {
+	Path       string `json:"path"`
+	Passphrase string `json:"passphrase"`
+	// Delimiter is used when the snapshot carries no display settings
+	Delimiter string `json:"delimiter"`
+}
+
+type OpenSnapshotResponse struct {
+	OpenResponse
+	Manifest SnapshotManifest `json:"manifest"`
+}
+
+// shareSnapshot writes the open database into a single file another user
+// opens with open_snapshot: a zip holding a compressed backup, a manifest
+// and optionally the display settings of the profile. Secrets, paths and
+// write settings like hooks and retention rules stay out.
+func (a *App) shareSnapshot(msg AppMessage) AppMessage {
+	if !a.db.IsRunning() {
+		log.Printf("db not running for share snapshot operation")
+		return AppMessage{Type: msg.Type, Body: NotRunningResponse}
+	}
+	var shareMsg MessageShareSnapshot
+	if err := json.Unmarshal([]byte(msg.Body), &shareMsg); err != nil {
+		log.Printf("unmarshaling share snapshot message failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+
+	manifest, err := a.writeSnapshot(shareMsg)
+	if err != nil {
+		log.Printf("share snapshot failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+	log.Printf("snapshot written to %s, %d bytes, encrypted [%t]", shareMsg.Path, manifest.Size, manifest.Encrypted)
+	bt, _ := json.Marshal(ShareSnapshotResponse{Status: OkStatus, Manifest: manifest})
+	return AppMessage{Type: msg.Type, Body: string(bt)}
+}
+
+// writeSnapshot writes the snapshot next to its path and moves it there once
+// complete, a failed one leaves a file already at the path as it was.
+func (a *App) writeSnapshot(shareMsg MessageShareSnapshot) (manifest SnapshotManifest, err error) {
+	path := database.LongPath(shareMsg.Path)
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return SnapshotManifest{}, err
+	}
+	defer func() {
+		_ = f.Close()
+		if err != nil {
+			_ = os.Remove(tmp)
+		}
+	}()
+	zw := zip.NewWriter(f)
+
+	manifest = SnapshotManifest{
+		Format: snapshotFormat, CreatedAt: time.Now().UTC(), Encrypted: shareMsg.Passphrase != "",
+	}
+	if path := a.openPath(); path != "" {
+		manifest.Source = filepath.Base(path)
+	}
+	// the backup archive is compressed already
+	w, err := zw.CreateHeader(&zip.FileHeader{Name: snapshotBackupEntry, Method: zip.Store})
+	if err != nil {
+		return SnapshotManifest{}, err
+	}
+	h := sha256.New()
+	counter := &countingWriter{w: io.MultiWriter(w, h)}
+	manifest.Version, err = a.db.Backup(counter, database.BackupOptions{Compress: true, Passphrase: shareMsg.Passphrase})
+	if err != nil {
+		return SnapshotManifest{}, err
+	}
+	manifest.Size, manifest.SHA256 = counter.n, hex.EncodeToString(h.Sum(nil))
+
+	if shareMsg.IncludeDecoder {
+		manifest.Decoder = true
+		if err := writeSnapshotEntry(zw, snapshotDecoderEntry, a.decoderProfile()); err != nil {
+			return SnapshotManifest{}, err
+		}
+	}
+	if err := writeSnapshotEntry(zw, snapshotManifestEntry, manifest); err != nil {
+		return SnapshotManifest{}, err
+	}
+	if err := zw.Close(); err != nil {
+		return SnapshotManifest{}, err
+	}
+	if err := f.Close(); err != nil {
+		return SnapshotManifest{}, err
+	}
+	return manifest, os.Rename(tmp, path)
+}
+
+// decoderProfile is the part of the open database's profile about how its
+// keys and values are shown.
+func (a *App) decoderProfile() config.Profile {
+	a.mx.Lock()
+	var delimiter string
+	if a.lastOpen != nil {
+		delimiter = a.lastOpen.Delimiter
+	}
+	a.mx.Unlock()
+	profile, _ := a.settings.Get().Profile(a.openPath())
+	return config.Profile{
+		Delimiter: delimiter, Decoder: profile.Decoder, Decoders: profile.Decoders, DefaultPrefix: profile.DefaultPrefix,
+		Labels: profile.Labels, Templates: profile.Templates, Schemas: profile.Schemas, KeyLayouts: profile.KeyLayouts,
+	}
+}
+
+func writeSnapshotEntry(zw *zip.Writer, name string, v any) error {
+	w, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// openSnapshot opens a shared snapshot as a read-only in-memory database,
+// nothing is written to disk. Its display settings, if any, come back as
+// the profile.
+func (a *App) openSnapshot(msg AppMessage) AppMessage {
+	if a.db.IsRunning() {
+		log.Printf(AlreadyRunningResponse)
+		return AppMessage{Type: msg.Type, Body: AlreadyRunningResponse}
+	}
+	var openMsg MessageOpenSnapshot
+	if err := json.Unmarshal([]byte(msg.Body), &openMsg); err != nil {
+		log.Printf("unmarshaling open snapshot message failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+	return a.openSnapshotFile(msg.Type, openMsg)
+}
+
+func (a *App) openSnapshotFile(t messageType, openMsg MessageOpenSnapshot) AppMessage {
+	if pending, ok := a.stagedPending(t, openMsg.Path); ok {
+		return pending
+	}
+	manifest, profile, err := a.loadSnapshot(openMsg)
+	if err != nil {
+		log.Printf("opening snapshot failure: %v", err)
+		a.emitError("open", openMsg.Path, err)
+		return AppMessage{Type: t, Body: err.Error()}
+	}
+
+	delimiter := openMsg.Delimiter
+	if manifest.Decoder {
+		delimiter = profile.Delimiter
+	}
+	a.startSession(&MessageOpen{Delimiter: delimiter, ReadOnly: true})
+	a.emitOpened(false)
+
+	log.Printf("snapshot %s opened, taken from %s at version %d", openMsg.Path, manifest.Source, manifest.Version)
+	resp := OpenSnapshotResponse{
+		OpenResponse: OpenResponse{
+			Status: OkStatus, InMemory: true, ReadOnly: true, MaxVersion: a.db.MaxVersion(), PageSize: a.db.PageSize(),
+		},
+		Manifest: manifest,
+	}
+	if manifest.Decoder {
+		resp.Profile = &profile
+	}
+	bt, _ := json.Marshal(resp)
+	return AppMessage{Type: t, Body: string(bt)}
+}
+
+// isSnapshotFile tells a shared snapshot, a zip archive, from a backup file.
+func isSnapshotFile(path string) bool {
+	f, err := os.Open(database.LongPath(path))
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	head := make([]byte, 4)
+	if _, err := io.ReadFull(f, head); err != nil {
+		return false
+	}
+	return string(head) == "PK\x03\x04"
+}
+
+// loadSnapshot checks the manifest of a snapshot and loads its backup into a
+// new in-memory connection, closed again when the backup doesn't match the
+// manifest's hash.
+func (a *App) loadSnapshot(openMsg MessageOpenSnapshot) (SnapshotManifest, config.Profile, error) {
+	zr, err := zip.OpenReader(database.LongPath(openMsg.Path))
+	if err != nil {
+		return SnapshotManifest{}, config.Profile{}, fmt.Errorf("reading snapshot: %w", err)
+	}
+	defer zr.Close()
+
+	var (
+		manifest SnapshotManifest
+		profile  config.Profile
+	)
+	if err := readSnapshotEntry(&zr.Reader, snapshotManifestEntry, &manifest); err != nil {
+		return manifest, profile, err
+	}
+	if manifest.Format < 1 || manifest.Format > snapshotFormat {
+		return manifest, profile, fmt.Errorf("unsupported snapshot format %d", manifest.Format)
+	}
+	if manifest.Encrypted && openMsg.Passphrase == "" {
+		return manifest, profile, errors.New("snapshot is encrypted, a passphrase is required")
+	}
+	if manifest.Decoder {
+		if err := readSnapshotEntry(&zr.Reader, snapshotDecoderEntry, &profile); err != nil {
+			return manifest, profile, err
+		}
+	}
+
+	backup, err := zr.Open(snapshotBackupEntry)
+	if err != nil {
+		return manifest, profile, fmt.Errorf("reading snapshot backup: %w", err)
+	}
+	defer backup.Close()
+	h := sha256.New()
+	r := io.TeeReader(backup, h)
+	if err := a.db.OpenBackup(r, openMsg.Passphrase, database.OpenOptions{}); err != nil {
+		return manifest, profile, err
+	}
+	// badger may stop reading before the end of the stream
+	if _, err := io.Copy(io.Discard, r); err != nil {
+		a.db.Close()
+		a.emitClosedAt(openMsg.Path, ClosedInvalid)
+		return manifest, profile, err
+	}
+	if sum := hex.EncodeToString(h.Sum(nil)); sum != manifest.SHA256 {
+		a.db.Close()
+		a.emitClosedAt(openMsg.Path, ClosedInvalid)
+		return manifest, profile, fmt.Errorf("snapshot backup is corrupted, sha256 %s doesn't match the manifest", sum)
+	}
+	return manifest, profile, nil
+}
+
+func readSnapshotEntry(zr *zip.Reader, name string, v any) error {
+	f, err := zr.Open(name)
+	if err != nil {
+		return fmt.Errorf("reading snapshot %s: %w", name, err)
+	}
+	defer f.Close()
+	if err := json.NewDecoder(f).Decode(v); err != nil {
+		return fmt.Errorf("reading snapshot %s: %w", name, err)
+	}
+	return nil
+}
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,469 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/filinvadim/badger-gui/database"
+	"log"
+	"strings"
+	"time"
+)
+
+const (
+	StagedStatus = "staged"
+
+	StagedAdd    = "add"
+	StagedUpdate = "update"
+	StagedDelete = "delete"
+)
+
+type MessageStaging struct {
+	// Enabled turns staging on or off, the changeset is only reported when
+	// nil. It can't be turned off while changes are staged.
+	Enabled *bool `json:"enabled"`
+}
+
+type MessageDiscardStaged struct {
+	// Keys and the keys of the row IDs IDs discard the changes of these
+	// keys, all of them when both are empty
+	Keys []string `json:"keys"`
+	IDs  []string `json:"ids"`
+}
+
+// StagedChange is a pending edit of the changeset. Old is the value when the
+// key was first staged and BaseVersion its version then, zero for new keys.
+// TTL is the expiry the value is written with, from touch and generate.
+type StagedChange struct {
+	Key         string    `json:"key"`
+	Op          string    `json:"op"`
+	Old         string    `json:"old"`
+	New         string    `json:"new"`
+	TTL         string    `json:"ttl,omitempty"`
+	BaseVersion uint64    `json:"base_version"`
+	StagedAt    time.Time `json:"staged_at"`
+}
+
+type StagingResponse struct {
+	Enabled bool           `json:"enabled"`
+	Changes []StagedChange `json:"changes"`
+}
+
+type CommitStagedResponse struct {
+	Status    string `json:"status"`
+	Committed int    `json:"committed"`
+	// Conflicts are the keys changed outside the changeset since they were
+	// staged, nothing is committed when there are any
+	Conflicts []string `json:"conflicts,omitempty"`
+}
+
+type stagedEdit struct {
+	value  []byte
+	ttl    time.Duration
+	delete bool
+	old    []byte
+	base   uint64
+	at     time.Time
+}
+
+var errStagingOff = errors.New("staging was turned off")
+
+// changeset collects the edits made while staging is on, in staging order.
+type changeset struct {
+	edits map[string]*stagedEdit
+	order []string
+}
+
+func newChangeset() *changeset {
+	return &changeset{edits: make(map[string]*stagedEdit)}
+}
+
+func (c *changeset) remove(key string) {
+	delete(c.edits, key)
+	for i, k := range c.order {
+		if k == key {
+			c.order = append(c.order[:i], c.order[i+1:]...)
+			return
+		}
+	}
+}
+
+// within are the staged keys under prefix, in staging order.
+func (c *changeset) within(prefix string) []string {
+	keys := make([]string, 0, len(c.order))
+	for _, key := range c.order {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// changes are the staged changes under prefix, their keys relative to it.
+func (c *changeset) changes(prefix string) []StagedChange {
+	changes := make([]StagedChange, 0, len(c.order))
+	for _, key := range c.within(prefix) {
+		e := c.edits[key]
+		change := StagedChange{
+			Key: key[len(prefix):], Op: StagedUpdate, Old: string(e.old), New: string(e.value), BaseVersion: e.base, StagedAt: e.at,
+		}
+		switch {
+		case e.delete:
+			change.Op = StagedDelete
+		case e.base == 0:
+			change.Op = StagedAdd
+		}
+		if e.ttl > 0 {
+			change.TTL = e.ttl.String()
+		}
+		changes = append(changes, change)
+	}
+	return changes
+}
+
+// setStaging reports the changeset, or turns staging on or off.
+func (a *App) setStaging(msg AppMessage) AppMessage {
+	var stagingMsg MessageStaging
+	if msg.Body != "" {
+		if err := json.Unmarshal([]byte(msg.Body), &stagingMsg); err != nil {
+			log.Printf("unmarshaling staging message failure: %v", err)
+			return AppMessage{Type: msg.Type, Body: err.Error()}
+		}
+	}
+	prefix := a.virtualPrefix()
+	a.mx.Lock()
+	defer a.mx.Unlock()
+	if stagingMsg.Enabled != nil {
+		switch {
+		case *stagingMsg.Enabled && a.staging == nil:
+			a.staging = newChangeset()
+		case !*stagingMsg.Enabled && a.staging != nil:
+			if n := len(a.staging.order); n > 0 {
+				return AppMessage{Type: msg.Type, Body: fmt.Sprintf("%d changes are staged, commit or discard them first", n)}
+			}
+			a.staging = nil
+		}
+		log.Printf("staging enabled [%t]", *stagingMsg.Enabled)
+	}
+	resp := StagingResponse{Enabled: a.staging != nil, Changes: []StagedChange{}}
+	if a.staging != nil {
+		resp.Changes = a.staging.changes(prefix)
+	}
+	bt, _ := json.Marshal(resp)
+	return AppMessage{Type: msg.Type, Body: string(bt)}
+}
+
+// stage adds a set, or a delete when value is nil, to the changeset. It
+// returns false when staging is off and the write should go through. An
+// expected version is checked against the database as the write would be.
+func (a *App) stage(t messageType, key string, value []byte, expected uint64) (AppMessage, bool) {
+	if !a.isStaging() {
+		return AppMessage{}, false
+	}
+	version, err := a.stageEdit(key, value, 0, expected)
+	switch {
+	case errors.Is(err, database.ErrVersionChanged):
+		return a.checkedWriteResponse(t, key, version, nil, err), true
+	case err != nil:
+		log.Printf("staging key failure %s: %v", logKey(key), err)
+		return AppMessage{Type: t, Body: err.Error()}, true
+	}
+	log.Printf("%s of key %s staged", t, logKey(key))
+	bt, _ := json.Marshal(WriteResponse{Status: StagedStatus})
+	return AppMessage{Type: t, Body: string(bt)}, true
+}
+
+// stageMany stages the entries of a bulk write. Keys that exist, staged or
+// in the database, are skipped and returned as existing unless overwrite is
+// set. It returns false when staging is off.
+func (a *App) stageMany(entries []database.Change, overwrite bool) (existing []string, staged bool, err error) {
+	if !a.isStaging() {
+		return nil, false, nil
+	}
+	for _, e := range entries {
+		if !overwrite {
+			_, _, err := a.currentValue(e.Key)
+			if err == nil {
+				existing = append(existing, e.Key)
+				continue
+			}
+			if !errors.Is(err, database.ErrKeyNotFound) {
+				return existing, true, err
+			}
+		}
+		value := e.Value
+		if value == nil {
+			value = []byte{}
+		}
+		if _, err := a.stageEdit(e.Key, value, e.TTL, 0); err != nil {
+			return existing, true, err
+		}
+	}
+	log.Printf("%d keys staged, %d existing", len(entries)-len(existing), len(existing))
+	return existing, true, nil
+}
+
+// stageTouch stages keys with their current value and a new ttl, a zero ttl
+// removing the expiry. Keys that don't exist are returned as missing.
+func (a *App) stageTouch(keys []string, ttl time.Duration) (missing []string, err error) {
+	for _, key := range keys {
+		value, _, err := a.currentValue(key)
+		if errors.Is(err, database.ErrKeyNotFound) {
+			missing = append(missing, key)
+			continue
+		}
+		if err != nil {
+			return missing, err
+		}
+		if _, err := a.stageEdit(key, value, ttl, 0); err != nil {
+			return missing, err
+		}
+	}
+	return missing, nil
+}
+
+// stageDuplicate stages a copy of src with its expiry as dst, which is only
+// replaced when overwrite is set.
+func (a *App) stageDuplicate(src, dst string, overwrite bool) error {
+	if !overwrite {
+		_, _, err := a.currentValue(dst)
+		if err == nil {
+			return database.ErrKeyExists
+		}
+		if !errors.Is(err, database.ErrKeyNotFound) {
+			return err
+		}
+	}
+	value, ttl, err := a.currentValue(src)
+	if err != nil {
+		return err
+	}
+	_, err = a.stageEdit(dst, value, ttl, 0)
+	return err
+}
+
+// isStaging tells whether writes go to the changeset.
+func (a *App) isStaging() bool {
+	a.mx.Lock()
+	defer a.mx.Unlock()
+	return a.staging != nil
+}
+
+// stagedPending rejects t while changes are staged for another database
+// than path, they would be lost or committed to the wrong one.
+func (a *App) stagedPending(t messageType, path string) (AppMessage, bool) {
+	a.mx.Lock()
+	defer a.mx.Unlock()
+	if a.staging == nil || len(a.staging.order) == 0 || (a.lastOpen != nil && path != "" && a.lastOpen.Path == path) {
+		return AppMessage{}, false
+	}
+	n := len(a.staging.order)
+	log.Printf("%s rejected: %d changes are staged", t, n)
+	return AppMessage{Type: t, Body: fmt.Sprintf("%d changes are staged, commit or discard them first", n)}, true
+}
+
+// stageEdit adds a set expiring after ttl, or a delete when value is nil, to
+// the changeset. The current version is returned with ErrVersionChanged when
+// expected is set and differs.
+func (a *App) stageEdit(key string, value []byte, ttl time.Duration, expected uint64) (uint64, error) {
+	a.mx.Lock()
+	if a.staging == nil {
+		a.mx.Unlock()
+		return 0, errStagingOff
+	}
+	edit := a.staging.edits[key]
+	a.mx.Unlock()
+
+	if edit == nil {
+		old, base, err := a.db.GetVersioned(key)
+		if err != nil && !errors.Is(err, database.ErrKeyNotFound) {
+			return 0, err
+		}
+		if expected != 0 && expected != base {
+			return base, database.ErrVersionChanged
+		}
+		edit = &stagedEdit{old: old, base: base}
+	}
+
+	a.mx.Lock()
+	defer a.mx.Unlock()
+	if a.staging == nil {
+		return 0, errStagingOff
+	}
+	if staged, ok := a.staging.edits[key]; ok {
+		edit = staged
+	} else {
+		a.staging.edits[key] = edit
+		a.staging.order = append(a.staging.order, key)
+	}
+	edit.value, edit.ttl, edit.delete, edit.at = value, ttl, value == nil, time.Now()
+	if edit.delete && edit.base == 0 {
+		// deleting a staged new key leaves nothing to commit
+		a.staging.remove(key)
+	}
+	return 0, nil
+}
+
+// currentValue returns the value of key as the changeset would leave it, and
+// its remaining time to live.
+func (a *App) currentValue(key string) ([]byte, time.Duration, error) {
+	if edit, ok := a.stagedValue(key); ok {
+		if edit.delete {
+			return nil, 0, database.ErrKeyNotFound
+		}
+		return edit.value, edit.ttl, nil
+	}
+	value, err := a.db.Get(key)
+	if err != nil {
+		return nil, 0, err
+	}
+	meta, err := a.db.Meta(key)
+	if err != nil {
+		return nil, 0, err
+	}
+	var ttl time.Duration
+	if meta.ExpiresAt > 0 {
+		ttl = max(time.Until(time.Unix(int64(meta.ExpiresAt), 0)), time.Second)
+	}
+	return value, ttl, nil
+}
+
+// stagedValue returns the staged edit of key, if any.
+func (a *App) stagedValue(key string) (stagedEdit, bool) {
+	a.mx.Lock()
+	defer a.mx.Unlock()
+	if a.staging == nil {
+		return stagedEdit{}, false
+	}
+	edit, ok := a.staging.edits[key]
+	if !ok {
+		return stagedEdit{}, false
+	}
+	return *edit, true
+}
+
+// commitStaged writes the changeset, unless any of its keys changed since
+// it was staged. The keys derived by write hooks are written along in the
+// same transaction.
+func (a *App) commitStaged(msg AppMessage) AppMessage {
+	if !a.db.IsRunning() {
+		log.Printf("db not running for commit staged operation")
+		return AppMessage{Type: msg.Type, Body: NotRunningResponse}
+	}
+	// a virtual database commits its own changes only
+	prefix := a.virtualPrefix()
+	a.mx.Lock()
+	if a.staging == nil {
+		a.mx.Unlock()
+		return AppMessage{Type: msg.Type, Body: "staging is off"}
+	}
+	keys := a.staging.within(prefix)
+	edits := make(map[string]stagedEdit, len(keys))
+	for _, key := range keys {
+		edits[key] = *a.staging.edits[key]
+	}
+	a.mx.Unlock()
+
+	hooks := make(map[string]writeHooks, len(keys))
+	for _, key := range keys {
+		hooks[key] = a.writeHooks(key)
+		a.ownWrite(key, edits[key].value)
+	}
+	// the versions are checked in the transaction writing the changes, so
+	// a concurrent writer makes badger run it again
+	resp := CommitStagedResponse{Status: OkStatus}
+	err := a.db.Update(func(txn *database.Txn) error {
+		resp.Conflicts = resp.Conflicts[:0]
+		for _, key := range keys {
+			version, err := txn.Version(key)
+			if err != nil {
+				return err
+			}
+			if version != edits[key].base {
+				resp.Conflicts = append(resp.Conflicts, key)
+			}
+		}
+		if len(resp.Conflicts) > 0 {
+			return nil
+		}
+		for _, key := range keys {
+			edit := edits[key]
+			var err error
+			if edit.delete {
+				err = txn.Delete(key)
+			} else {
+				err = txn.Set(key, edit.value, edit.ttl)
+			}
+			if err != nil {
+				return err
+			}
+			if err := hooks[key].applyHooks(txn, key, edit.old, edit.value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("committing staged changes failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+	if len(resp.Conflicts) > 0 {
+		log.Printf("commit of %d staged changes rejected: %d keys changed", len(keys), len(resp.Conflicts))
+		resp.Conflicts = a.shownKeys(resp.Conflicts)
+		resp.Status = ConflictStatus
+		bt, _ := json.Marshal(resp)
+		return AppMessage{Type: msg.Type, Body: string(bt)}
+	}
+
+	a.mx.Lock()
+	if a.staging != nil {
+		for _, key := range keys {
+			a.staging.remove(key)
+		}
+	}
+	a.mx.Unlock()
+	resp.Committed = len(keys)
+	log.Printf("%d staged changes committed", resp.Committed)
+
+	bt, _ := json.Marshal(resp)
+	return AppMessage{Type: msg.Type, Body: string(bt)}
+}
+
+// discardStaged drops staged changes without writing them.
+func (a *App) discardStaged(msg AppMessage) AppMessage {
+	var discardMsg MessageDiscardStaged
+	if msg.Body != "" {
+		if err := json.Unmarshal([]byte(msg.Body), &discardMsg); err != nil {
+			log.Printf("unmarshaling discard staged message failure: %v", err)
+			return AppMessage{Type: msg.Type, Body: err.Error()}
+		}
+	}
+	selected, err := a.rowKeys(discardMsg.IDs)
+	if err != nil {
+		log.Printf("decoding row ids failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+	discardMsg.Keys = append(a.virtualKeys(discardMsg.Keys), selected...)
+	prefix := a.virtualPrefix()
+	a.mx.Lock()
+	defer a.mx.Unlock()
+	if a.staging == nil {
+		return AppMessage{Type: msg.Type, Body: "staging is off"}
+	}
+	if len(discardMsg.Keys) == 0 && prefix != "" {
+		// a virtual database discards its own changes only
+		discardMsg.Keys = a.staging.within(prefix)
+	}
+	switch {
+	case len(discardMsg.Keys) > 0:
+		for _, key := range discardMsg.Keys {
+			a.staging.remove(key)
+		}
+		log.Printf("staged changes of %d keys discarded", len(discardMsg.Keys))
+	case prefix == "":
+		log.Printf("%d staged changes discarded", len(a.staging.order))
+		a.staging = newChangeset()
+	}
+	bt, _ := json.Marshal(StagingResponse{Enabled: true, Changes: a.staging.changes(prefix)})
+	return AppMessage{Type: msg.Type, Body: string(bt)}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/filinvadim/badger-gui/database"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+	"log"
+)
+
+const EventKeyStale = "key:stale"
+
+type MessageOpenKey struct {
+	// Key is the key the editor shows, empty when it's closed
+	Key string `json:"key"`
+	// Version is the version of the value shown, see Item.Version
+	Version uint64 `json:"version"`
+}
+
+// OpenKeyResponse tells whether the value shown is still current. It's
+// also emitted as key:stale once the key is written by someone else.
+type OpenKeyResponse struct {
+	Key            string `json:"key"`
+	Version        uint64 `json:"version"`
+	CurrentVersion uint64 `json:"current_version"`
+	Stale          bool   `json:"stale"`
+	Deleted        bool   `json:"deleted"`
+}
+
+// openKey is the key open in the editor and the version it shows. own is
+// the last write made from the editor, so its notification isn't taken for
+// someone else's.
+type openKey struct {
+	OpenKeyResponse
+	own     []byte
+	hasOwn  bool
+	ownDrop bool
+	cancel  context.CancelFunc
+}
+
+// setOpenKey follows the key open in the editor, emitting key:stale when
+// another client, job or API call writes it. Without a body it reports the
+// state of the open key.
+func (a *App) setOpenKey(msg AppMessage) AppMessage {
+	if msg.Body == "" {
+		a.mx.Lock()
+		resp := OpenKeyResponse{}
+		if a.openKey != nil {
+			resp = a.openKey.OpenKeyResponse
+		}
+		a.mx.Unlock()
+		resp.Key = a.shownKey(resp.Key)
+		bt, _ := json.Marshal(resp)
+		return AppMessage{Type: msg.Type, Body: string(bt)}
+	}
+	var openMsg MessageOpenKey
+	if err := json.Unmarshal([]byte(msg.Body), &openMsg); err != nil {
+		log.Printf("unmarshaling open key message failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+	a.closeOpenKey()
+	if openMsg.Key == "" {
+		return AppMessage{Type: msg.Type, Body: OkStatus}
+	}
+	if !a.db.IsRunning() {
+		log.Printf("db not running for open key operation")
+		return AppMessage{Type: msg.Type, Body: NotRunningResponse}
+	}
+	openMsg.Key = a.virtualKey(openMsg.Key)
+
+	resp := OpenKeyResponse{Key: openMsg.Key, Version: openMsg.Version}
+	meta, err := a.db.Meta(openMsg.Key)
+	switch {
+	case err == nil:
+		resp.CurrentVersion = meta.Version
+	case errors.Is(err, database.ErrKeyNotFound):
+		resp.Deleted = openMsg.Version != 0
+	default:
+		log.Printf("reading open key failure %s: %v", logKey(openMsg.Key), err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+	resp.Stale = resp.CurrentVersion != resp.Version
+
+	ctx, cancel := context.WithCancel(context.Background())
+	open := &openKey{OpenKeyResponse: resp, cancel: cancel}
+	a.mx.Lock()
+	a.openKey = open
+	a.mx.Unlock()
+	go func() {
+		err := a.db.Subscribe(ctx, []string{open.Key}, func(change database.KeyChange) {
+			if change.Key == open.Key {
+				a.keyChanged(open, change)
+			}
+		})
+		if err != nil {
+			log.Printf("watching open key failure: %v", err)
+		}
+	}()
+
+	log.Printf("following open key %s at version %d, stale [%t]", logKey(resp.Key), resp.Version, resp.Stale)
+	resp.Key = a.shownKey(resp.Key)
+	bt, _ := json.Marshal(resp)
+	return AppMessage{Type: msg.Type, Body: string(bt)}
+}
+
+// keyChanged marks the open key stale unless the change is the editor's own
+// write, which moves the version shown instead.
+func (a *App) keyChanged(open *openKey, change database.KeyChange) {
+	a.mx.Lock()
+	if a.openKey != open || change.Version <= open.Version {
+		a.mx.Unlock()
+		return
+	}
+	own := open.hasOwn && open.ownDrop == change.Deleted && bytes.Equal(open.own, change.Value)
+	open.hasOwn = false
+	open.CurrentVersion = change.Version
+	open.Deleted = change.Deleted
+	if own && !open.Stale {
+		open.Version = change.Version
+		a.mx.Unlock()
+		return
+	}
+	open.Stale = true
+	event := open.OpenKeyResponse
+	a.mx.Unlock()
+
+	log.Printf("open key %s changed at version %d, showing %d", logKey(event.Key), event.CurrentVersion, event.Version)
+	event.Key = a.shownKey(event.Key)
+	runtime.EventsEmit(a.ctx, EventKeyStale, event)
+}
+
+// ownWrite notes a set, or a delete when value is nil, of key made from the
+// editor before it's written.
+func (a *App) ownWrite(key string, value []byte) {
+	a.mx.Lock()
+	defer a.mx.Unlock()
+	if a.openKey == nil || a.openKey.Key != key {
+		return
+	}
+	a.openKey.own, a.openKey.hasOwn, a.openKey.ownDrop = value, true, value == nil
+}
+
+// closeOpenKey stops following the open key.
+func (a *App) closeOpenKey() {
+	a.mx.Lock()
+	open := a.openKey
+	a.openKey = nil
+	a.mx.Unlock()
+	if open != nil {
+		open.cancel()
+	}
+}
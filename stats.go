@@ -0,0 +1,33 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+)
+
+type MessageSampleStats struct {
+	// Fraction of keys to sample, defaults to 1%
+	Fraction float64 `json:"fraction"`
+}
+
+func (a *App) sampleStats(msg AppMessage) AppMessage {
+	if !a.db.IsRunning() {
+		log.Printf("db not running for sample stats operation")
+		return AppMessage{Type: msg.Type, Body: NotRunningResponse}
+	}
+	var statsMsg MessageSampleStats
+	if msg.Body != "" {
+		if err := json.Unmarshal([]byte(msg.Body), &statsMsg); err != nil {
+			log.Printf("unmarshaling sample stats message failure: %v", err)
+			return AppMessage{Type: msg.Type, Body: err.Error()}
+		}
+	}
+	stats, err := a.db.SampleStats(statsMsg.Fraction)
+	if err != nil {
+		log.Printf("sampling stats failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+	log.Printf("sampled %d of ~%d keys in %dms", stats.Sampled, stats.EstimatedKeys, stats.DurationMs)
+	bt, _ := json.Marshal(stats)
+	return AppMessage{Type: msg.Type, Body: string(bt)}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"strings"
+	"time"
+)
+
+type MessageValueTemplate struct {
+	Prefix string `json:"prefix"`
+	// Template is the value new keys under the prefix start with, empty
+	// removes it
+	Template string `json:"template"`
+}
+
+type ValueTemplatesResponse struct {
+	Templates map[string]string `json:"templates"`
+}
+
+type MessageNewValue struct {
+	Key string `json:"key"`
+}
+
+type NewValueResponse struct {
+	// Prefix is the longest prefix of the key with a template, empty when
+	// there's none
+	Prefix   string `json:"prefix"`
+	Template string `json:"template"`
+	// Value is the template with its placeholders filled in
+	Value string `json:"value"`
+}
+
+// setValueTemplate stores the value template of a prefix of the open
+// database in its profile.
+func (a *App) setValueTemplate(msg AppMessage) AppMessage {
+	var templateMsg MessageValueTemplate
+	if err := json.Unmarshal([]byte(msg.Body), &templateMsg); err != nil {
+		log.Printf("unmarshaling value template message failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+	path := a.openPath()
+	if path == "" {
+		log.Printf("setting value template failure: %s", NoProfileResponse)
+		return AppMessage{Type: msg.Type, Body: NoProfileResponse}
+	}
+	templates, err := a.settings.SetTemplate(path, templateMsg.Prefix, templateMsg.Template)
+	if err != nil {
+		log.Printf("setting value template failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+	log.Printf("value template of prefix [%s] set, %d templates", logKey(templateMsg.Prefix), len(templates))
+	bt, _ := json.Marshal(ValueTemplatesResponse{Templates: templates})
+	return AppMessage{Type: msg.Type, Body: string(bt)}
+}
+
+// newValue returns the value the editor starts a new key with, from the
+// template of the key's longest prefix that has one. The placeholders are
+// the generator's, {n} being 1.
+func (a *App) newValue(msg AppMessage) AppMessage {
+	var newMsg MessageNewValue
+	if err := json.Unmarshal([]byte(msg.Body), &newMsg); err != nil {
+		log.Printf("unmarshaling new value message failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+
+	var resp NewValueResponse
+	if path := a.openPath(); path != "" {
+		profile, _ := a.settings.Get().Profile(path)
+		for prefix, template := range profile.Templates {
+			if strings.HasPrefix(newMsg.Key, prefix) && len(prefix) >= len(resp.Prefix) {
+				resp.Prefix, resp.Template = prefix, template
+			}
+		}
+	}
+	if resp.Template != "" {
+		resp.Value = renderTemplate(resp.Template, make(map[string]string), 1, time.Now())
+	}
+	bt, _ := json.Marshal(resp)
+	return AppMessage{Type: msg.Type, Body: string(bt)}
+}
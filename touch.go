@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+)
+
+type MessageTouch struct {
+	Key string `json:"key"`
+	// Keys is the bulk variant, touched together with Key in one transaction
+	Keys []string `json:"keys"`
+	// IDs are row IDs of keys touched along with Keys, see rowID
+	IDs []string `json:"ids"`
+	// TTL is a Go duration like "72h", empty removes the expiry
+	TTL string `json:"ttl"`
+}
+
+type TouchResponse struct {
+	Status  string   `json:"status"`
+	Touched int      `json:"touched"`
+	Missing []string `json:"missing"`
+}
+
+func (a *App) touchKeys(msg AppMessage) AppMessage {
+	if !a.db.IsRunning() {
+		log.Printf("db not running for touch operation")
+		return AppMessage{Type: msg.Type, Body: NotRunningResponse}
+	}
+	var touchMsg MessageTouch
+	if err := json.Unmarshal([]byte(msg.Body), &touchMsg); err != nil {
+		log.Printf("unmarshaling touch message failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+	var ttl time.Duration
+	if touchMsg.TTL != "" {
+		var err error
+		if ttl, err = time.ParseDuration(touchMsg.TTL); err != nil {
+			log.Printf("parsing ttl failure: %v", err)
+			return AppMessage{Type: msg.Type, Body: err.Error()}
+		}
+	}
+	selected, err := a.rowKeys(touchMsg.IDs)
+	if err != nil {
+		log.Printf("decoding row ids failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+	keys := append(a.virtualKeys(touchMsg.Keys), selected...)
+	if touchMsg.Key != "" {
+		keys = append([]string{a.virtualKey(touchMsg.Key)}, keys...)
+	}
+
+	var missing []string
+	status := OkStatus
+	if a.isStaging() {
+		status = StagedStatus
+		missing, err = a.stageTouch(keys, ttl)
+	} else {
+		missing, err = a.db.Touch(keys, ttl)
+	}
+	if err != nil {
+		log.Printf("touching keys failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+	touched := len(keys) - len(missing)
+	log.Printf("touched %d keys with ttl [%s], %d missing, status %s", touched, ttl, len(missing), status)
+	bt, _ := json.Marshal(TouchResponse{Status: status, Touched: touched, Missing: a.shownKeys(missing)})
+	return AppMessage{Type: msg.Type, Body: string(bt)}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+)
+
+type MessageTreemap struct {
+	Prefix string `json:"prefix"`
+	// Delimiter defaults to the one the database was opened with
+	Delimiter string `json:"delimiter"`
+	// Depth is how many segments below prefix get their own node, 3 by
+	// default
+	Depth int `json:"depth"`
+	// Children caps the children of a node, 20 by default
+	Children int `json:"children"`
+	// Fraction of keys to sample on large databases, defaults to 1%
+	Fraction float64 `json:"fraction"`
+}
+
+// treemap returns nested prefixes with their byte sizes, the shape treemap
+// charts take, to show where the space of the keyspace goes.
+func (a *App) treemap(msg AppMessage) AppMessage {
+	if !a.db.IsRunning() {
+		log.Printf("db not running for treemap operation")
+		return AppMessage{Type: msg.Type, Body: NotRunningResponse}
+	}
+	var treemapMsg MessageTreemap
+	if msg.Body != "" {
+		if err := json.Unmarshal([]byte(msg.Body), &treemapMsg); err != nil {
+			log.Printf("unmarshaling treemap message failure: %v", err)
+			return AppMessage{Type: msg.Type, Body: err.Error()}
+		}
+	}
+	treemapMsg.Prefix = a.scoped(treemapMsg.Prefix)
+	if treemapMsg.Delimiter == "" {
+		treemapMsg.Delimiter = a.delimiter()
+	}
+
+	tm, err := a.db.Treemap(
+		treemapMsg.Prefix, treemapMsg.Delimiter, treemapMsg.Depth, treemapMsg.Children, treemapMsg.Fraction,
+	)
+	if err != nil {
+		log.Printf("building treemap failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+	labelTreemap(tm.Root, a.labels())
+	shownTreemap(tm.Root, a.virtualPrefix())
+	log.Printf("treemap built from %d keys in %dms, exact [%t]", tm.Sampled, tm.DurationMs, tm.Exact)
+	bt, _ := json.Marshal(tm)
+	return AppMessage{Type: msg.Type, Body: string(bt)}
+}
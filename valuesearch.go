@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+)
+
+const (
+	// valueSearchChunk is how much of a value is searched at a time
+	valueSearchChunk = 1 << 20
+	// valueSearchOverlap is how far a regular expression match may reach
+	// into the next chunk, longer matches are cut there
+	valueSearchOverlap = 4 << 10
+
+	defaultValueSearchLimit = 100
+	maxValueSearchLimit     = 10000
+)
+
+type MessageValueSearch struct {
+	Key string `json:"key"`
+	// ID is the row ID of the key, for binary keys
+	ID string `json:"id"`
+	// Pattern is the text searched for, Hex the bytes in hex. Regex takes
+	// Pattern as a regular expression.
+	Pattern    string `json:"pattern"`
+	Hex        string `json:"hex"`
+	Regex      bool   `json:"regex"`
+	IgnoreCase bool   `json:"ignore_case"`
+	// From is the offset the search starts at, the next of a previous page
+	From int64 `json:"from"`
+	// Limit caps the matches, 100 by default and 10000 at most
+	Limit int `json:"limit"`
+}
+
+type ValueMatch struct {
+	Offset int64 `json:"offset"`
+	Length int   `json:"length"`
+}
+
+type ValueSearchResponse struct {
+	Key     string       `json:"key"`
+	Size    int64        `json:"size"`
+	Matches []ValueMatch `json:"matches"`
+	// Next is where to continue when the limit was reached, 0 otherwise
+	Next int64 `json:"next"`
+}
+
+// valueSearch finds a byte pattern or a regular expression inside a single
+// value, a chunk at a time, and returns the offsets of the matches for the
+// hex viewer to jump to.
+func (a *App) valueSearch(msg AppMessage) AppMessage {
+	if !a.db.IsRunning() {
+		return AppMessage{Type: msg.Type, Body: NotRunningResponse}
+	}
+	var searchMsg MessageValueSearch
+	if err := json.Unmarshal([]byte(msg.Body), &searchMsg); err != nil {
+		log.Printf("unmarshaling value search message failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+	if searchMsg.ID != "" {
+		keys, err := keysOf([]string{searchMsg.ID})
+		if err != nil {
+			return AppMessage{Type: msg.Type, Body: err.Error()}
+		}
+		searchMsg.Key = keys[0]
+	}
+	find, err := valueMatcher(searchMsg)
+	if err != nil {
+		log.Printf("value search pattern failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+	limit := searchMsg.Limit
+	if limit <= 0 {
+		limit = defaultValueSearchLimit
+	}
+	limit = min(limit, maxValueSearchLimit)
+
+	resp := ValueSearchResponse{Key: searchMsg.Key, Matches: []ValueMatch{}}
+	err = a.db.ViewValue(searchMsg.Key, func(value []byte, _ uint64) error {
+		resp.Size = int64(len(value))
+		resp.Matches, resp.Next = searchChunks(value, max(searchMsg.From, 0), limit, find)
+		return nil
+	})
+	if err != nil {
+		log.Printf("value search failure %s: %v", logKey(searchMsg.Key), err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+	log.Printf("value of %s searched, %d matches", logKey(searchMsg.Key), len(resp.Matches))
+	bt, _ := json.Marshal(resp)
+	return AppMessage{Type: msg.Type, Body: string(bt)}
+}
+
+// matchFunc returns the start and end of the first match in b, -1 when
+// there's none.
+type matchFunc func(b []byte) (int, int)
+
+func valueMatcher(searchMsg MessageValueSearch) (matchFunc, error) {
+	switch {
+	case searchMsg.Hex != "":
+		pattern, err := hex.DecodeString(searchMsg.Hex)
+		if err != nil {
+			return nil, fmt.Errorf("invalid hex pattern: %w", err)
+		}
+		return literalMatcher(pattern), nil
+	case searchMsg.Pattern == "":
+		return nil, errors.New("pattern or hex is required")
+	case !searchMsg.Regex && !searchMsg.IgnoreCase:
+		return literalMatcher([]byte(searchMsg.Pattern)), nil
+	}
+	expr := searchMsg.Pattern
+	if !searchMsg.Regex {
+		expr = regexp.QuoteMeta(expr)
+	}
+	if searchMsg.IgnoreCase {
+		expr = "(?i)" + expr
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	return func(b []byte) (int, int) {
+		loc := re.FindIndex(b)
+		if loc == nil {
+			return -1, -1
+		}
+		return loc[0], loc[1]
+	}, nil
+}
+
+func literalMatcher(pattern []byte) matchFunc {
+	return func(b []byte) (int, int) {
+		i := bytes.Index(b, pattern)
+		if i < 0 {
+			return -1, -1
+		}
+		return i, i + len(pattern)
+	}
+}
+
+// searchChunks collects up to limit matches of value from offset on. Each
+// chunk is searched with valueSearchOverlap bytes of the next, so matches
+// across a boundary are found; only those starting inside the chunk count.
+func searchChunks(value []byte, from int64, limit int, find matchFunc) ([]ValueMatch, int64) {
+	matches := make([]ValueMatch, 0, min(limit, 64))
+	size := int64(len(value))
+	pos := from
+	for pos < size {
+		chunkEnd := min(pos+valueSearchChunk, size)
+		window := value[pos:min(chunkEnd+valueSearchOverlap, size)]
+		start, end := find(window)
+		if start < 0 || pos+int64(start) >= chunkEnd {
+			pos = chunkEnd
+			continue
+		}
+		if end == start {
+			// an empty match of a regular expression marks no bytes
+			pos += int64(start + 1)
+			continue
+		}
+		if len(matches) == limit {
+			return matches, pos + int64(start)
+		}
+		matches = append(matches, ValueMatch{Offset: pos + int64(start), Length: end - start})
+		pos += int64(end)
+	}
+	return matches, 0
+}
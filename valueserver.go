@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/filinvadim/badger-gui/database"
+	"log"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const valuePath = "/value"
+
+// assetHandler serves what the embedded frontend assets don't have. The
+// value endpoint lets the hex viewer and media players fetch a value by URL,
+// seeking with Range requests instead of passing whole blobs through Call.
+func (a *App) assetHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(valuePath, a.handleValue)
+	return mux
+}
+
+// passiveTypes are the sniffed Content-Types served inline. Values come from
+// the database and are served on the app's own origin, so anything a webview
+// could run (HTML, SVG, XML, PDF, scripts) is served as an attachment instead.
+var passiveTypes = []string{"image/", "audio/", "video/", "text/plain", "application/json"}
+
+// valueContentType returns the sniffed Content-Type of value and whether it's
+// safe to serve inline.
+func valueContentType(value []byte) (string, bool) {
+	contentType := http.DetectContentType(value)
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil || mediaType == "image/svg+xml" {
+		return "application/octet-stream", false
+	}
+	for _, passive := range passiveTypes {
+		if strings.HasPrefix(mediaType, passive) {
+			return contentType, true
+		}
+	}
+	return "application/octet-stream", false
+}
+
+// handleValue serves GET /value?key=... with Range, If-Range and ETag
+// support. Responses are sandboxed and never sniffed again by the webview.
+func (a *App) handleValue(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	if !a.db.IsRunning() {
+		http.Error(w, NotRunningResponse, http.StatusServiceUnavailable)
+		return
+	}
+	a.touch()
+
+	// the key is shown relative to the virtual database in use
+	key := a.virtualKey(r.URL.Query().Get("key"))
+	err := a.db.ViewValue(key, func(value []byte, version uint64) error {
+		contentType, inline := valueContentType(value)
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Header().Set("Content-Security-Policy", "sandbox")
+		if !inline {
+			w.Header().Set("Content-Disposition", "attachment")
+		}
+		w.Header().Set("ETag", fmt.Sprintf(`"%d"`, version))
+		w.Header().Set("Cache-Control", "no-cache")
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(value))
+		return nil
+	})
+	switch {
+	case errors.Is(err, database.ErrKeyNotFound):
+		http.NotFound(w, r)
+	case err != nil:
+		log.Printf("serving value failure: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
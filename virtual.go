@@ -0,0 +1,263 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/filinvadim/badger-gui/database"
+	"log"
+	"strings"
+)
+
+// virtualRefused are the messages refused while a virtual database is in
+// use: the ones acting on the whole connection and the keyed ones that don't
+// resolve keys relative to its prefix. Keyed handlers that do go through
+// virtualKey and shownKey.
+var virtualRefused = map[messageType]struct{}{
+	TypeBackup:        {},
+	TypeBackupS3:      {},
+	TypeRestore:       {},
+	TypeRestoreS3:     {},
+	TypeShareSnapshot: {},
+	TypeMigrate:       {},
+	TypeHooks:         {},
+	TypeRetention:     {},
+	TypeRunRetention:  {},
+	TypePaste:         {},
+	TypeFlatten:       {},
+	TypeGenerate:      {},
+	TypeInternalKeys:  {},
+	TypeExportDelta:   {},
+	TypeNamespaces:    {},
+	TypeSampleStats:   {},
+	TypeCompression:   {},
+	TypeColumns:       {},
+	TypeCollisions:    {},
+	TypeCompareKey:    {},
+	TypeValueSearch:   {},
+	TypeRenderKey:     {},
+	TypeNewValue:      {},
+	TypeRecentKeys:    {},
+	TypeGlobalSearch:  {},
+	TypeActivity:      {},
+}
+
+func (a *App) isVirtualRefused(t messageType) bool {
+	if _, ok := virtualRefused[t]; !ok {
+		return false
+	}
+	return a.virtualPrefix() != ""
+}
+
+type MessageVirtual struct {
+	Name string `json:"name"`
+	// Prefix is the part of the connection the virtual database shows,
+	// empty removes it
+	Prefix string `json:"prefix"`
+}
+
+type MessageUseVirtual struct {
+	// Name is the virtual database to switch to, empty goes back to the
+	// whole connection
+	Name string `json:"name"`
+}
+
+type VirtualResponse struct {
+	// Virtual are the prefixes of the virtual databases, by name
+	Virtual map[string]string `json:"virtual"`
+	// Active is the virtual database in use, empty for the whole connection
+	Active string `json:"active"`
+}
+
+// setVirtual defines a virtual database of the open one, a prefix of it
+// browsed as a database of its own, and reports them all. They're kept in
+// its profile, so the tenants of a multi-tenant store are set up once.
+// Without a body the virtual databases are only reported.
+func (a *App) setVirtual(msg AppMessage) AppMessage {
+	path := a.openPath()
+	if path == "" {
+		log.Printf("defining virtual database failure: %s", NoProfileResponse)
+		return AppMessage{Type: msg.Type, Body: NoProfileResponse}
+	}
+	if msg.Body != "" {
+		var virtualMsg MessageVirtual
+		if err := json.Unmarshal([]byte(msg.Body), &virtualMsg); err != nil {
+			log.Printf("unmarshaling virtual message failure: %v", err)
+			return AppMessage{Type: msg.Type, Body: err.Error()}
+		}
+		if virtualMsg.Name == "" {
+			return AppMessage{Type: msg.Type, Body: "virtual database name is required"}
+		}
+		virtual, err := a.settings.SetVirtual(path, virtualMsg.Name, virtualMsg.Prefix)
+		if err != nil {
+			log.Printf("defining virtual database failure: %v", err)
+			return AppMessage{Type: msg.Type, Body: err.Error()}
+		}
+		a.mx.Lock()
+		if a.virtual == virtualMsg.Name {
+			// the one in use is left, or follows its new prefix
+			a.scope = virtualMsg.Prefix
+			if virtualMsg.Prefix == "" {
+				a.virtual = ""
+			}
+		}
+		a.mx.Unlock()
+		log.Printf("virtual database %s set to prefix [%s], %d defined", virtualMsg.Name, logKey(virtualMsg.Prefix), len(virtual))
+	}
+	return AppMessage{Type: msg.Type, Body: a.virtualResponse(path)}
+}
+
+// useVirtual switches the connection to a virtual database: its prefix
+// becomes the scope, so everything scoped stays within it, and db:opened
+// announces it as an entry of its own.
+func (a *App) useVirtual(msg AppMessage) AppMessage {
+	if !a.db.IsRunning() {
+		return AppMessage{Type: msg.Type, Body: NotRunningResponse}
+	}
+	path := a.openPath()
+	if path == "" {
+		return AppMessage{Type: msg.Type, Body: NoProfileResponse}
+	}
+	var useMsg MessageUseVirtual
+	if err := json.Unmarshal([]byte(msg.Body), &useMsg); err != nil {
+		log.Printf("unmarshaling use virtual message failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+	var prefix string
+	if useMsg.Name != "" {
+		profile, _ := a.settings.Get().Profile(path)
+		var ok bool
+		if prefix, ok = profile.Virtual[useMsg.Name]; !ok {
+			return AppMessage{Type: msg.Type, Body: fmt.Sprintf("virtual database %q not found", useMsg.Name)}
+		}
+	}
+	a.mx.Lock()
+	a.scope, a.virtual = prefix, useMsg.Name
+	a.mx.Unlock()
+	log.Printf("switched to virtual database %s, prefix [%s]", useMsg.Name, logKey(prefix))
+	a.emitOpened(false)
+	return AppMessage{Type: msg.Type, Body: a.virtualResponse(path)}
+}
+
+func (a *App) virtualResponse(path string) string {
+	profile, _ := a.settings.Get().Profile(path)
+	resp := VirtualResponse{Virtual: profile.Virtual}
+	if resp.Virtual == nil {
+		resp.Virtual = map[string]string{}
+	}
+	a.mx.Lock()
+	resp.Active = a.virtual
+	a.mx.Unlock()
+	bt, _ := json.Marshal(resp)
+	return string(bt)
+}
+
+// virtualPrefix is the prefix of the virtual database in use, empty for the
+// whole connection.
+func (a *App) virtualPrefix() string {
+	a.mx.Lock()
+	defer a.mx.Unlock()
+	if a.virtual == "" {
+		return ""
+	}
+	return a.scope
+}
+
+// virtualKey is the key of the connection a key of the virtual database in
+// use stands for.
+func (a *App) virtualKey(key string) string {
+	return a.virtualPrefix() + key
+}
+
+func (a *App) virtualKeys(keys []string) []string {
+	prefix := a.virtualPrefix()
+	if prefix == "" {
+		return keys
+	}
+	resolved := make([]string, len(keys))
+	for i, key := range keys {
+		resolved[i] = prefix + key
+	}
+	return resolved
+}
+
+// rowKeys decodes row IDs, taken of keys as shown, into the keys of the
+// connection.
+func (a *App) rowKeys(ids []string) ([]string, error) {
+	keys, err := keysOf(ids)
+	if err != nil {
+		return nil, err
+	}
+	return a.virtualKeys(keys), nil
+}
+
+// relativeKey is key as the virtual database in use shows it, false when
+// it's outside of it.
+func (a *App) relativeKey(key string) (string, bool) {
+	return relativeTo(a.virtualPrefix(), key)
+}
+
+// shownKey is key as it's answered, relative to the virtual database in use.
+// Handlers only answer keys they resolved with virtualKey, or found within
+// the scope, so they're never outside of it.
+func (a *App) shownKey(key string) string {
+	shown, _ := a.relativeKey(key)
+	return shown
+}
+
+func (a *App) shownKeys(keys []string) []string {
+	prefix := a.virtualPrefix()
+	if prefix == "" {
+		return keys
+	}
+	shown := make([]string, len(keys))
+	for i, key := range keys {
+		shown[i], _ = relativeTo(prefix, key)
+	}
+	return shown
+}
+
+func relativeTo(prefix, key string) (string, bool) {
+	if !strings.HasPrefix(key, prefix) {
+		return key, false
+	}
+	return key[len(prefix):], true
+}
+
+// shownMeta makes the keys of meta relative to the virtual database in use.
+func (a *App) shownMeta(meta []database.KeyMeta) []database.KeyMeta {
+	prefix := a.virtualPrefix()
+	for i := range meta {
+		meta[i].Key, _ = relativeTo(prefix, meta[i].Key)
+	}
+	return meta
+}
+
+// shownTreemap makes the prefixes of the nodes relative to the virtual
+// database in use, after they're labeled.
+func shownTreemap(node *database.TreemapNode, prefix string) {
+	if node == nil || prefix == "" {
+		return
+	}
+	node.Prefix, _ = relativeTo(prefix, node.Prefix)
+	for _, child := range node.Children {
+		shownTreemap(child, prefix)
+	}
+}
+
+// virtualChanges leaves the writes outside the virtual database in use out of
+// a key:changed event and makes the others relative to it.
+func (a *App) virtualChanges(event KeyChangedEvent) KeyChangedEvent {
+	prefix := a.virtualPrefix()
+	if prefix == "" {
+		return event
+	}
+	changes := make([]database.KeyChange, 0, len(event.Changes))
+	for _, change := range event.Changes {
+		var ok bool
+		if change.Key, ok = relativeTo(prefix, change.Key); ok {
+			changes = append(changes, change)
+		}
+	}
+	event.Changes = changes
+	return event
+}
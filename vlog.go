@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/filinvadim/badger-gui/database"
+	"log"
+)
+
+type MessageGC struct {
+	DiscardRatio float64 `json:"discard_ratio"`
+}
+
+type VlogFilesResponse struct {
+	Files []database.VlogFile `json:"files"`
+}
+
+type GCResponse struct {
+	Rewritten bool                `json:"rewritten"`
+	Files     []database.VlogFile `json:"files"`
+}
+
+func (a *App) vlogFiles(msg AppMessage) AppMessage {
+	if !a.db.IsRunning() {
+		log.Printf("db not running for vlog files operation")
+		return AppMessage{Type: msg.Type, Body: NotRunningResponse}
+	}
+	files, err := a.db.VlogFiles()
+	if err != nil {
+		log.Printf("listing vlog files failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+	bt, _ := json.Marshal(VlogFilesResponse{Files: files})
+	return AppMessage{Type: msg.Type, Body: string(bt)}
+}
+
+func (a *App) runGC(msg AppMessage) AppMessage {
+	if !a.db.IsRunning() {
+		log.Printf("db not running for gc operation")
+		return AppMessage{Type: msg.Type, Body: NotRunningResponse}
+	}
+	var gcMsg MessageGC
+	if msg.Body != "" {
+		if err := json.Unmarshal([]byte(msg.Body), &gcMsg); err != nil {
+			log.Printf("unmarshaling gc message failure: %v", err)
+			return AppMessage{Type: msg.Type, Body: err.Error()}
+		}
+	}
+	rewritten, err := a.db.RunGC(gcMsg.DiscardRatio)
+	if err != nil {
+		log.Printf("value log gc failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+	log.Printf("value log gc finished, rewritten [%t]", rewritten)
+
+	files, err := a.db.VlogFiles()
+	if err != nil {
+		log.Printf("listing vlog files failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+	bt, _ := json.Marshal(GCResponse{Rewritten: rewritten, Files: files})
+	return AppMessage{Type: msg.Type, Body: string(bt)}
+}
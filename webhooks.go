@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/filinvadim/badger-gui/config"
+	"github.com/filinvadim/badger-gui/database"
+	"log"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const webhookTimeout = 10 * time.Second
+
+var webhookClient = &http.Client{Timeout: webhookTimeout}
+
+// WebhookPayload is what webhook templates are rendered with.
+type WebhookPayload struct {
+	Prefix    string `json:"prefix"`
+	Key       string `json:"key"`
+	Value     string `json:"-"`
+	Version   uint64 `json:"version"`
+	ExpiresAt uint64 `json:"expires_at"`
+	Deleted   bool   `json:"deleted"`
+	Time      string `json:"time"`
+}
+
+// startWatchers (re)subscribes to the prefixes of the configured webhooks,
+// and to every key for the key:changed events.
+func (a *App) startWatchers() {
+	a.mx.Lock()
+	if a.stopWatchers != nil {
+		a.stopWatchers()
+		a.stopWatchers = nil
+	}
+	if !a.db.IsRunning() {
+		a.mx.Unlock()
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	a.stopWatchers = cancel
+	a.mx.Unlock()
+
+	go a.emitKeyChanges(ctx)
+	hooks := a.settings.Get().Webhooks
+	if len(hooks) == 0 {
+		return
+	}
+
+	prefixes := make([]string, 0, len(hooks))
+	for _, h := range hooks {
+		prefixes = append(prefixes, h.Prefix)
+	}
+	go func() {
+		err := a.db.Subscribe(ctx, prefixes, func(change database.KeyChange) {
+			a.fireWebhooks(hooks, change)
+		})
+		if err != nil {
+			log.Printf("watching prefixes failure: %v", err)
+		}
+	}()
+	log.Printf("watching %d prefixes for webhooks", len(prefixes))
+}
+
+func (a *App) fireWebhooks(hooks []config.Webhook, change database.KeyChange) {
+	for _, h := range hooks {
+		if !strings.HasPrefix(change.Key, h.Prefix) {
+			continue
+		}
+		payload := WebhookPayload{
+			Prefix:    h.Prefix,
+			Key:       change.Key,
+			Value:     string(change.Value),
+			Version:   change.Version,
+			ExpiresAt: change.ExpiresAt,
+			Deleted:   change.Deleted,
+			Time:      time.Now().UTC().Format(time.RFC3339),
+		}
+		go func(h config.Webhook) {
+			start, result := time.Now(), activityOk
+			if err := postWebhook(h, payload); err != nil {
+				log.Printf("webhook for prefix %s failure: %v", logKey(h.Prefix), err)
+				result = err.Error()
+			}
+			a.activity.add(ActivityEntry{
+				Time: time.Now(), Source: SourceWebhook, Type: h.URL, Key: change.Key,
+				DurationMs: float64(time.Since(start).Microseconds()) / 1000, Result: result,
+			})
+		}(h)
+	}
+}
+
+func postWebhook(h config.Webhook, payload WebhookPayload) error {
+	var (
+		body        bytes.Buffer
+		contentType = "application/json"
+	)
+	if h.Template == "" {
+		if err := json.NewEncoder(&body).Encode(payload); err != nil {
+			return err
+		}
+	} else {
+		tmpl, err := template.New("webhook").Parse(h.Template)
+		if err != nil {
+			return err
+		}
+		if err := tmpl.Execute(&body, payload); err != nil {
+			return err
+		}
+		if !json.Valid(body.Bytes()) {
+			contentType = "text/plain"
+		}
+	}
+
+	resp, err := webhookClient.Post(h.URL, contentType, &body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/filinvadim/badger-gui/config"
+	"log"
+)
+
+// destructiveTypes require the write password, when one is configured,
+// to be entered once per session.
+var destructiveTypes = map[messageType]struct{}{
+	TypeDelete:       {},
+	TypeRestore:      {},
+	TypeRestoreS3:    {},
+	TypeMigrate:      {},
+	TypeDropPrefix:   {},
+	TypeRetention:    {},
+	TypeRunRetention: {},
+	TypeHooks:        {},
+	// saved and imported settings replace retention rules, hooks and listen
+	// addresses, a saved profile its retention rules and hooks
+	TypeSaveSettings:   {},
+	TypeSaveProfile:    {},
+	TypeImportSettings: {},
+}
+
+type MessageWritePassword struct {
+	Current string `json:"current"`
+	// New clears the protection when empty
+	New string `json:"new"`
+}
+
+type MessageUnlockWrites struct {
+	Password string `json:"password"`
+}
+
+func (a *App) isWriteProtected(t messageType) bool {
+	if _, ok := destructiveTypes[t]; !ok {
+		return false
+	}
+	return a.settings.Get().WritePasswordHash != "" && !a.unlocked.Load()
+}
+
+func (a *App) setWritePassword(msg AppMessage) AppMessage {
+	var passwordMsg MessageWritePassword
+	if err := json.Unmarshal([]byte(msg.Body), &passwordMsg); err != nil {
+		log.Printf("unmarshaling write password message failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+
+	settings := a.settings.Get()
+	if settings.WritePasswordHash != "" {
+		ok, err := config.VerifyPassword(passwordMsg.Current, settings.WritePasswordHash)
+		if err != nil {
+			log.Printf("verifying write password failure: %v", err)
+			return AppMessage{Type: msg.Type, Body: err.Error()}
+		}
+		if !ok {
+			log.Printf("changing write password rejected: wrong password")
+			return AppMessage{Type: msg.Type, Body: WrongPasswordResponse}
+		}
+	}
+
+	settings.WritePasswordHash = ""
+	if passwordMsg.New != "" {
+		hash, err := config.HashPassword(passwordMsg.New)
+		if err != nil {
+			log.Printf("hashing write password failure: %v", err)
+			return AppMessage{Type: msg.Type, Body: err.Error()}
+		}
+		settings.WritePasswordHash = hash
+	}
+	if err := a.settings.Update(settings); err != nil {
+		log.Printf("saving settings failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+	a.unlocked.Store(false)
+	log.Printf("write password set [%t]", passwordMsg.New != "")
+	return AppMessage{Type: msg.Type, Body: OkStatus}
+}
+
+func (a *App) unlockWrites(msg AppMessage) AppMessage {
+	var unlockMsg MessageUnlockWrites
+	if err := json.Unmarshal([]byte(msg.Body), &unlockMsg); err != nil {
+		log.Printf("unmarshaling unlock message failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+	hash := a.settings.Get().WritePasswordHash
+	if hash == "" {
+		return AppMessage{Type: msg.Type, Body: OkStatus}
+	}
+	ok, err := config.VerifyPassword(unlockMsg.Password, hash)
+	if err != nil {
+		log.Printf("verifying write password failure: %v", err)
+		return AppMessage{Type: msg.Type, Body: err.Error()}
+	}
+	if !ok {
+		log.Printf("unlocking writes rejected: wrong password")
+		return AppMessage{Type: msg.Type, Body: WrongPasswordResponse}
+	}
+	a.unlocked.Store(true)
+	log.Println("destructive operations unlocked for the session")
+	return AppMessage{Type: msg.Type, Body: OkStatus}
+}